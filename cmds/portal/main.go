@@ -5,9 +5,11 @@ package main
 import (
 	"cloudiac/portal/apps"
 	"cloudiac/portal/task_manager"
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/pkg/errors"
@@ -20,7 +22,9 @@ import (
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
 	"cloudiac/portal/services"
+	"cloudiac/portal/services/logstorage"
 	"cloudiac/portal/services/rbac"
+	"cloudiac/portal/services/stepbroker"
 	"cloudiac/portal/web"
 	"cloudiac/utils/kafka"
 	"cloudiac/utils/logs"
@@ -55,6 +59,12 @@ func main() {
 	{
 		db.Init(configs.Get().Mysql)
 		models.Init(true)
+		if err := logstorage.Init(); err != nil {
+			panic(err)
+		}
+		if err := stepbroker.Init(); err != nil {
+			panic(err)
+		}
 
 		tx := db.Get().Begin()
 		defer func() {
@@ -74,10 +84,15 @@ func main() {
 		services.MaintenanceRunnerPerMax()
 		kafka.InitKafkaProducerBuilder()
 		rbac.InitPolicy()
+		// 加载并定期同步组织自定义角色的权限策略
+		go services.SyncRolePolicies(time.Minute)
 	}
 
-	// 注册到 consul
-	if err := common.CheckAndReConnectConsul(iac_common.IacPortalServiceName, configs.Get().Consul.ServiceID); err != nil {
+	if configs.Get().UseDBRegistry() {
+		// 使用数据库作为注册中心，定时上报心跳
+		go services.ServiceKeepAlive(context.Background(), iac_common.IacPortalServiceName)
+	} else if err := common.CheckAndReConnectConsul(iac_common.IacPortalServiceName, configs.Get().Consul.ServiceID); err != nil {
+		// 注册到 consul
 		log.Fatal(err)
 	}
 
@@ -228,6 +243,10 @@ func initSystemConfig(tx *db.Session) (err error) {
 			Name:        models.SysCfgNameTaskStepTimeout,
 			Value:       "3600",
 			Description: "步骤超时时间",
+		}, {
+			Name:        models.SysCfgNameApprovalTTL,
+			Value:       "0",
+			Description: "审批超时时间(小时)，超时未审批的任务自动驳回，0 表示不超时",
 		},
 	}
 
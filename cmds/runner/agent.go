@@ -0,0 +1,157 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package main
+
+import (
+	"bytes"
+	iac_common "cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/runner"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"cloudiac/utils/tunnel"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	agentCredentialFile = "agent.json"
+	agentRetryMax       = time.Minute
+)
+
+// agentCredential agent 注册成功后 portal 返回的凭证
+type agentCredential struct {
+	RunnerId string `json:"runnerId"`
+	Secret   string `json:"secret"`
+}
+
+func agentCredentialPath() string {
+	conf := configs.Get().Runner
+	return filepath.Join(conf.AbsStoragePath(), agentCredentialFile)
+}
+
+func loadAgentCredential() (*agentCredential, error) {
+	content, err := ioutil.ReadFile(agentCredentialPath())
+	if err != nil {
+		return nil, err
+	}
+	cred := agentCredential{}
+	if err := json.Unmarshal(content, &cred); err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+// joinPortal 使用注册令牌向 portal 注册，并保存返回的凭证
+func joinPortal() (*agentCredential, error) {
+	conf := configs.Get().Runner.Agent
+	if conf.JoinToken == "" {
+		return nil, fmt.Errorf("configuration 'runner.agent.join_token' is empty")
+	}
+	name := conf.Name
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	body, _ := json.Marshal(map[string]string{"token": conf.JoinToken, "name": name})
+	resp, err := http.Post(utils.JoinURL(conf.PortalAddress, "/api/v1/runner_agent/join"),
+		"application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := struct {
+		Code    int              `json:"code"`
+		Message string           `json:"message"`
+		Result  *agentCredential `json:"result"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.Wrapf(err, "decode join response, status %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || result.Result == nil {
+		return nil, fmt.Errorf("join portal failed: %d %s", result.Code, result.Message)
+	}
+
+	content, _ := json.Marshal(result.Result)
+	if err := ioutil.WriteFile(agentCredentialPath(), content, 0600); err != nil {
+		return nil, err
+	}
+	return result.Result, nil
+}
+
+// localRunnerAddr 本地 runner api 的访问地址
+func localRunnerAddr(listen string) (string, error) {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", err
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return fmt.Sprintf("http://%s", net.JoinHostPort(host, port)), nil
+}
+
+// StartAgent 以 agent 模式连接 portal，连接断开后自动重连
+func StartAgent() {
+	conf := configs.Get()
+	logger := logs.Get().WithField("func", "StartAgent")
+
+	target, err := localRunnerAddr(conf.Listen)
+	if err != nil {
+		logger.Fatalf("parse listen address: %v", err)
+	}
+
+	cred, err := loadAgentCredential()
+	if os.IsNotExist(err) {
+		cred, err = joinPortal()
+	}
+	if err != nil {
+		logger.Fatalf("load agent credential: %v", err)
+	}
+	logger = logger.WithField("runnerId", cred.RunnerId)
+	logger.Infof("runner agent mode, portal %s", conf.Runner.Agent.PortalAddress)
+	if runner.StepEventsEnabled() {
+		go runner.StartStepEventPublisher(conf.Runner.Agent.PortalAddress, cred.RunnerId)
+	}
+
+	header := http.Header{}
+	header.Set(tunnel.HeaderRunnerId, cred.RunnerId)
+	header.Set(tunnel.HeaderRunnerSecret, cred.Secret)
+	header.Set(tunnel.HeaderRunnerSlots, strconv.Itoa(conf.Runner.MaxTasks))
+	header.Set(tunnel.HeaderRunnerVersion, iac_common.VERSION)
+
+	retry := time.Second
+	for {
+		conn, resp, err := utils.WebsocketDailWithHeader(conf.Runner.Agent.PortalAddress,
+			"/api/v1/runner_agent/connect", nil, header)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+				// 凭证失效(如 agent 已在 portal 被删除)，需要重新注册
+				logger.Fatalf("connect portal: unauthorized, remove %s and join again", agentCredentialPath())
+			}
+			logger.Warnf("connect portal: %v, retry after %s", err, retry)
+			time.Sleep(retry)
+			if retry *= 2; retry > agentRetryMax {
+				retry = agentRetryMax
+			}
+			continue
+		}
+
+		logger.Infof("portal connected")
+		retry = time.Second
+		err = tunnel.NewAgent(conn, target).Serve()
+		logger.Warnf("portal disconnected: %v", err)
+		_ = conn.Close()
+		time.Sleep(retry)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package main
+
+import (
+	iac_common "cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"cloudiac/utils/runnerauth"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const heartbeatPath = "/api/v1/runners/heartbeat"
+
+func sendHeartbeat() error {
+	conf := configs.Get()
+	var tags []string
+	if conf.Consul.ServiceTags != "" {
+		tags = strings.Split(conf.Consul.ServiceTags, ";")
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":      conf.Consul.ServiceID,
+		"address": conf.Consul.ServiceIP,
+		"port":    conf.Consul.ServicePort,
+		"tags":    tags,
+		"slots":   conf.Runner.MaxTasks,
+		"version": iac_common.VERSION,
+	})
+
+	header := runnerauth.SignHeader(conf.RunnerApiSecret, http.MethodPost, heartbeatPath, "", body)
+	header.Set("Content-Type", "application/json")
+	resp, err := utils.HttpService(utils.JoinURL(conf.Portal.Address, heartbeatPath), http.MethodPost, &header, body, 5, 10)
+	if err != nil {
+		return err
+	}
+
+	result := struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return err
+	} else if result.Code != http.StatusOK {
+		return fmt.Errorf("%d %s", result.Code, result.Message)
+	}
+	return nil
+}
+
+// StartHeartbeat 使用数据库作为注册中心时定时向 portal 上报心跳
+func StartHeartbeat() {
+	logger := logs.Get().WithField("func", "StartHeartbeat")
+	logger.Infof("report heartbeat to portal %s", configs.Get().Portal.Address)
+
+	ticker := time.NewTicker(time.Duration(iac_common.ServiceHeartbeatInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		if err := sendHeartbeat(); err != nil {
+			logger.Warnf("send heartbeat: %v", err)
+		}
+		<-ticker.C
+	}
+}
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"cloudiac/runner"
 	v1 "cloudiac/runner/api/v1"
 	"cloudiac/utils"
 	"encoding/json"
@@ -54,7 +55,21 @@ func main() {
 	runnerConfJson, _ := json.Marshal(configs.Get().Runner)
 	logs.Get().Infof("runner configs: %s", runnerConfJson)
 
-	if err := common.CheckAndReConnectConsul(iac_common.RunnerServiceName, configs.Get().Consul.ServiceID); err != nil {
+	if configs.Get().Runner.PushEvents {
+		runner.EnableStepEvents()
+		if !configs.Get().Runner.AgentMode() {
+			// agent 模式下在获取 runner id 后启动
+			go runner.StartStepEventPublisher(configs.Get().Portal.Address, configs.Get().Consul.ServiceID)
+		}
+	}
+
+	if configs.Get().Runner.AgentMode() {
+		// agent 模式下 runner 主动连接 portal，不注册到 consul
+		go StartAgent()
+	} else if configs.Get().UseDBRegistry() {
+		// 使用数据库作为注册中心，通过 portal 上报心跳
+		go StartHeartbeat()
+	} else if err := common.CheckAndReConnectConsul(iac_common.RunnerServiceName, configs.Get().Consul.ServiceID); err != nil {
 		log.Fatal(err)
 	}
 
@@ -76,6 +91,16 @@ func checkConfigs(c *configs.Config) error {
 			return fmt.Errorf("configuration '%s' is empty", c.name)
 		}
 	}
+
+	switch c.Runner.Executor {
+	case "", runner.ExecutorDocker:
+	case runner.ExecutorKubernetes:
+		if c.Runner.Kubernetes.WorkspacePVC == "" {
+			return fmt.Errorf("configuration 'runner.kubernetes.workspace_pvc' is empty")
+		}
+	default:
+		return fmt.Errorf("unknown runner executor '%s'", c.Runner.Executor)
+	}
 	return nil
 }
 
@@ -6,9 +6,9 @@ import (
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
 	"cloudiac/portal/services"
+	"cloudiac/portal/services/logstorage"
 	"fmt"
 	"os"
-	"strings"
 	"sync"
 	"time"
 )
@@ -49,31 +49,33 @@ func dbInit() {
 func AddDependenciesData() error {
 	sess, t := db.Get(), time.Now()
 
-	fmt.Println("start to search all tfstate.json")
-	var tfstateRecords []models.DBStorage
-	if err := sess.Model(&models.DBStorage{}).Where("path LIKE ?", "%tfstate.json").
-		Select("path", "content").Find(&tfstateRecords); err != nil {
+	fmt.Println("start to search all tasks")
+	var tasks []models.Task
+	if err := sess.Model(&models.Task{}).Select("id", "project_id", "env_id").Find(&tasks); err != nil {
 		return err
 	}
 
-	size := len(tfstateRecords)
+	size := len(tasks)
 
 	if size == 0 {
 		return nil
 	}
 
-	fmt.Printf("found total %d tfstate.json data\n", len(tfstateRecords))
+	fmt.Printf("found total %d tasks\n", len(tasks))
 
 	wg, step := sync.WaitGroup{}, size/5
+	if step == 0 {
+		step = size
+	}
 	for i := 0; i < size; i = i + step {
 		left, right := i, i+step
 		if i+step > size {
-			right = size - 1
+			right = size
 		}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			addDependenciesByStateJSON(tfstateRecords[left:right])
+			addDependenciesByStateJSON(tasks[left:right])
 		}()
 	}
 
@@ -84,19 +86,29 @@ func AddDependenciesData() error {
 	return nil
 }
 
-func addDependenciesByStateJSON(tfstateRecords []models.DBStorage) {
+// addDependenciesByStateJSON 通过日志存储读取任务的 tfstate.json，存储可以是 db、s3 或者 local
+func addDependenciesByStateJSON(tasks []models.Task) {
 	sess := db.Get()
-	size := len(tfstateRecords)
-	for index, row := range tfstateRecords {
-		fmt.Printf("process the %s, index: %d, total: %d\n", row.Path, index, size)
-		tfState, err := services.UnmarshalStateJson(row.Content)
+	size := len(tasks)
+	for index, task := range tasks {
+		path := task.StateJsonPath()
+		content, err := logstorage.Get().Read(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "index: %d, read tfstate error: %s, path: %s\n", index, err, path)
+			continue
+		}
+
+		fmt.Printf("process the %s, index: %d, total: %d\n", path, index, size)
+		tfState, err := services.UnmarshalStateJson(content)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "index: %d, unmarshal tfstate error: %s, path: %s, content: %s\n",
-				index, err, row.Path, string(row.Content))
+				index, err, path, string(content))
 			continue
 		}
 
-		taskId := strings.Split(row.Path, "/")[2]
+		taskId := task.Id
 
 		rs := make([]*models.Resource, 0)
 		rs = append(rs, services.TraverseStateModule(&tfState.Values.RootModule)...)
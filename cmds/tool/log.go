@@ -0,0 +1,80 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package main
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
+	"fmt"
+)
+
+// ./iac-tool log-migrate
+// ./iac-tool log-migrate --to local --delete
+
+type LogMigrateCmd struct {
+	To     string `long:"to" description:"target log storage (s3, local), default to log_storage.type in config"`
+	Delete bool   `long:"delete" description:"delete migrated logs from db"`
+}
+
+func (*LogMigrateCmd) Usage() string {
+	return `<log migrate>`
+}
+
+func (c *LogMigrateCmd) Execute(args []string) error {
+	configs.Init(opt.Config)
+	db.Init(configs.Get().Mysql)
+	models.Init(false)
+
+	conf := configs.Get().LogStorage
+	if c.To != "" {
+		conf.Type = c.To
+	}
+	if conf.Type == "" || conf.Type == logstorage.TypeDB {
+		return fmt.Errorf("target log storage must be %s or %s", logstorage.TypeS3, logstorage.TypeLocal)
+	}
+	storage, err := logstorage.New(conf)
+	if err != nil {
+		return err
+	}
+
+	// 按 id 分批迁移，避免一次加载所有日志内容
+	const batchSize = 100
+	var (
+		lastId uint
+		total  int
+		failed int
+	)
+	for {
+		rows := make([]*models.DBStorage, 0)
+		if err := db.Get().Where("id > ?", lastId).Order("id").Limit(batchSize).Find(&rows); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			lastId = row.Id
+			total++
+			if err := storage.Write(row.Path, row.Content); err != nil {
+				failed++
+				logger.Errorf("migrate log %s failed: %v", row.Path, err)
+				continue
+			}
+			if c.Delete {
+				if _, err := db.Get().Where("id = ?", row.Id).Delete(&models.DBStorage{}); err != nil {
+					logger.Errorf("delete log %s from db failed: %v", row.Path, err)
+				}
+			}
+		}
+
+		if len(rows) < batchSize {
+			break
+		}
+	}
+
+	logger.Infof("log migrate to %s done, total %d, failed %d", conf.Type, total, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d logs migrate failed", failed)
+	}
+	return nil
+}
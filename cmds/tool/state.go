@@ -0,0 +1,81 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package main
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/statebackend"
+	"fmt"
+)
+
+// ./iac-tool state-migrate --backend s3 --env env-xxx --env env-yyy
+// ./iac-tool state-migrate --backend s3 --org org-xxx
+
+type StateMigrateCmd struct {
+	Backend string   `long:"backend" short:"b" description:"target state backend (consul, s3, http, pg)" required:"true"`
+	EnvIds  []string `long:"env" short:"e" description:"environment id, can be specified multiple times"`
+	OrgId   string   `long:"org" short:"o" description:"migrate all environments of the organization"`
+	SetOrg  bool     `long:"set-org-default" description:"also set the target backend as organization default"`
+	Force   bool     `long:"force" description:"overwrite the state already exists in the target backend"`
+}
+
+func (*StateMigrateCmd) Usage() string {
+	return `<state migrate>`
+}
+
+func (c *StateMigrateCmd) Execute(args []string) error {
+	if !statebackend.IsValid(c.Backend) {
+		return fmt.Errorf("invalid state backend '%s'", c.Backend)
+	}
+	if len(c.EnvIds) == 0 && c.OrgId == "" {
+		return fmt.Errorf("--env or --org is required")
+	}
+
+	configs.Init(opt.Config)
+	db.Init(configs.Get().Mysql)
+	models.Init(false)
+
+	envs := make([]*models.Env, 0)
+	query := db.Get().Model(&models.Env{})
+	if c.OrgId != "" {
+		query = query.Where("org_id = ?", c.OrgId)
+	}
+	if len(c.EnvIds) > 0 {
+		query = query.Where("id IN (?)", c.EnvIds)
+	}
+	if err := query.Find(&envs); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, env := range envs {
+		logger.Infof("migrate env %s(%s) state: %s -> %s", env.Id, env.Name, env.StateBackend, c.Backend)
+		// 每个环境单独提交，单个环境失败不影响其他环境
+		err := db.Get().Transaction(func(tx *db.Session) error {
+			if er := services.MigrateEnvState(tx, env, c.Backend, c.Force); er != nil {
+				return er
+			}
+			return nil
+		})
+		if err != nil {
+			failed++
+			logger.Errorf("migrate env %s state failed: %v", env.Id, err)
+		}
+	}
+
+	if c.SetOrg && c.OrgId != "" {
+		if _, err := db.Get().Model(&models.Organization{}).Where("id = ?", c.OrgId).
+			UpdateColumn("state_backend", c.Backend); err != nil {
+			return err
+		}
+	}
+
+	logger.Infof("state migrate done, total %d, failed %d", len(envs), failed)
+	if failed > 0 {
+		return fmt.Errorf("%d environments migrate failed", failed)
+	}
+	return nil
+}
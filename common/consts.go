@@ -18,6 +18,8 @@ const (
 	TaskTypeEnvParse = "envParse" // 环境策略扫描，只执行策略扫描，不修改资源或配置
 	TaskTypeTplScan  = "tplScan"  // 云模板策略扫描，只执行策略扫描，不修改资源或配置
 	TaskTypeTplParse = "tplParse" // 云模板策略扫描，只执行策略扫描，不修改资源或配置
+	TaskTypeImport   = "import"   // 将已存在的云资源导入到环境的 state 中
+	TaskTypeState    = "state"    // state 操作，如 state mv、state rm、taint
 
 	// TODO 与 taskTypexxx 重复，需要替换
 	TaskJobPlan     = "plan"
@@ -29,6 +31,8 @@ const (
 	TaskJobEnvParse = "envParse"
 	TaskJobTplScan  = "tplScan"
 	TaskJobTplParse = "tplParse"
+	TaskJobImport   = "import"
+	TaskJobState    = "state"
 
 	TaskPending   = "pending"
 	TaskRunning   = "running"
@@ -43,6 +47,8 @@ const (
 	TaskStepTfPlan    = "terraformPlan"
 	TaskStepTfApply   = "terraformApply"
 	TaskStepTfDestroy = "terraformDestroy"
+	TaskStepTfImport  = "terraformImport"
+	TaskStepTfState   = "terraformState"
 
 	// 0.3 扫描步骤名称
 	TaskStepOpaScan = "opaScan" // 云模板策略扫描
@@ -71,6 +77,7 @@ const (
 	TaskStepComplete  = "complete"
 	TaskStepTimeout   = "timeout"
 	TaskStepAborted   = "aborted"
+	TaskStepLost      = "lost" // 执行步骤的 runner 失联
 
 	TaskStepPolicyViolationExitCode = 3 // 合规检查不通过时的退出码
 
@@ -82,6 +89,8 @@ const (
 	TaskTypeEnvParseName = "envParse"
 	TaskTypeTplScanName  = "tplScan"
 	TaskTypeTplParseName = "tplParse"
+	TaskTypeImportName   = "import"
+	TaskTypeStateName    = "state"
 
 	ProjectStatusEnable  = "enable"
 	ProjectStatusDisable = "disable"
@@ -89,6 +98,10 @@ const (
 	// 默认步骤超时时间(秒)
 	DefaultTaskStepTimeout = 3600
 
+	// IaC 引擎，为空时表示 terraform
+	IacEngineTerraform = "terraform"
+	IacEngineOpenTofu  = "opentofu"
+
 	VcsGitlab = "gitlab"
 	VcsGitea  = "gitea"
 	VcsGitee  = "gitee"
@@ -117,15 +130,29 @@ const (
 
 	RunnerServiceName    = "CT-Runner"
 	IacPortalServiceName = "IaC-Portal"
+	RunnerMetaSlots      = "slots" // runner 注册到 consul 的 meta 信息，可同时执行的任务数量
 
 	ConsulCa            = "ca.pem"
 	ConsulCakey         = "client.key"
 	ConsulCapem         = "client.pem"
 	ConsulContainerPath = "/cloudiac/cert/"
 	ConsulSessionTTL    = 10
+
+	// ServiceHeartbeatInterval 使用数据库作为注册中心时服务上报心跳的间隔(秒)
+	ServiceHeartbeatInterval = 10
+)
+
+// terraform state backend 类型
+const (
+	StateBackendConsul = "consul"
+	StateBackendS3     = "s3"
+	StateBackendHttp   = "http"
+	StateBackendPg     = "pg"
 )
 
 var (
+	StateBackends = []string{StateBackendConsul, StateBackendS3, StateBackendHttp, StateBackendPg}
+
 	TerraformVersions = []string{
 		// 以下两个版本不支持 network mirror 协议。
 		// 这里注释掉，但 worker 镜像里还是会安装，以保证兼容性
@@ -139,4 +166,19 @@ var (
 		"1.1.9",
 		"1.2.4",
 	}
+
+	// worker 镜像中内置的 OpenTofu 版本
+	OpenTofuVersions = []string{
+		"1.6.2",
+		"1.7.3",
+		"1.8.3",
+	}
 )
+
+// IacEngineVersions 返回 IaC 引擎在 worker 镜像中内置的版本列表
+func IacEngineVersions(engine string) []string {
+	if engine == IacEngineOpenTofu {
+		return OpenTofuVersions
+	}
+	return TerraformVersions
+}
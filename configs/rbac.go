@@ -45,11 +45,13 @@ var Polices = []Policy{
 	//    4. admin: 组织管理员
 	//    5. member: 普通用户
 	//    6. complianceManager: 合规管理员
+	//    7. role-xxx: 组织自定义角色，策略保存在数据库中，运行时加载
 	//    项目角色
 	//    1. manager: 管理者
 	//    2. approver: 审批者
 	//    3. operator: 执行者
 	//    4. guest: 访客
+	//    5. role-xxx: 组织自定义角色
 	// 资源
 	//    对于访问的 URL  /api/v1/orgs/org-c3eotk06n88iemk0go90
 	//    默认情况下解析出第三段 URL 的 orgs 作为资源名称
@@ -119,6 +121,31 @@ var Polices = []Policy{
 	{"member", "ldap", "read/list"},
 	{"manager", "ldap", "*"},
 
+	// OIDC 用户组角色映射
+	{"admin", "oidc", "*"},
+
+	// 自定义角色
+	{"admin", "roles", "*"},
+	{"member", "roles", "read"},
+	{"complianceManager", "roles", "read"},
+	{"manager", "roles", "read"},
+
+	// 环境审批组
+	{"admin", "approver_groups", "*"},
+	{"member", "approver_groups", "read"},
+	{"complianceManager", "approver_groups", "read"},
+	{"manager", "approver_groups", "read"},
+	{"approver", "approver_groups", "read"},
+
+	// 变更窗口
+	{"admin", "change_windows", "*"},
+	{"member", "change_windows", "read"},
+	{"complianceManager", "change_windows", "read"},
+	{"manager", "change_windows", "read"},
+	{"approver", "change_windows", "read"},
+	{"operator", "change_windows", "read"},
+	{"guest", "change_windows", "read"},
+
 	// 项目
 	{"admin", "projects", "*"},
 	{"member", "projects", "read"},
@@ -128,16 +155,28 @@ var Polices = []Policy{
 	{"operator", "projects", "read"},
 	{"guest", "projects", "read"},
 
+	// 任务审批规则
+	{"manager", "approval_rules", "*"},
+	{"approver", "approval_rules", "read"},
+	{"operator", "approval_rules", "read"},
+	{"guest", "approval_rules", "read"},
+
 	// 环境
 	{"manager", "envs", "*"},
 	{"approver", "envs", "*"},
 	{"operator", "envs", "read/update/deploy/destroy"},
 	{"guest", "envs", "read"},
 
+	// 批量部署(创建及审批分别使用 envs/deploy 及 tasks/approve 权限)
+	{"manager", "stack_runs", "read"},
+	{"approver", "stack_runs", "read"},
+	{"operator", "stack_runs", "read"},
+	{"guest", "stack_runs", "read"},
+
 	// 任务
 	{"manager", "tasks", "*"},
 	{"approver", "tasks", "*"},
-	{"operator", "tasks", "read/abort"},
+	{"operator", "tasks", "read/abort/recover"},
 	{"guest", "tasks", "read"},
 
 	// 云模板
@@ -230,6 +269,7 @@ var Polices = []Policy{
 	{"demo", "keys", "read"},
 	{"demo", "templates", "read"},
 	{"demo", "envs", "*"},
+	{"demo", "stack_runs", "read"},
 	{"demo", "tasks", "*"},
 	{"demo", "variables", "*"},
 	{"demo", "policies", "read"},
@@ -0,0 +1,126 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/version"
+)
+
+// PlanInput 执行计划策略的输入
+// 策略中可以通过 input.plan 访问 terraform show -json 的输出，
+// 通过 input.summary 访问资源变更数量，通过 input.cost 访问费用预估(月费用)，如:
+//
+//	deny[msg] {
+//	  input.summary.destroy > 5
+//	  msg := sprintf("%d resources will be destroyed", [input.summary.destroy])
+//	}
+type PlanInput struct {
+	Plan    interface{} `json:"plan"`
+	Summary PlanSummary `json:"summary"`
+	Cost    PlanCost    `json:"cost"`
+}
+
+type PlanSummary struct {
+	Add     int `json:"add"`
+	Change  int `json:"change"`
+	Destroy int `json:"destroy"`
+}
+
+type PlanCost struct {
+	Added          float32  `json:"added"`          // 新增资源的费用
+	Destroyed      float32  `json:"destroyed"`      // 删除资源的费用(负数)
+	Updated        float32  `json:"updated"`        // 变更资源的费用差值
+	Delta          float32  `json:"delta"`          // 本次变更导致的费用变化
+	ForecastFailed []string `json:"forecastFailed"` // 询价失败的资源
+}
+
+// EvalRego 使用 rego 脚本内容对输入进行检查，返回规则的结果
+// name 为策略名称，同时作为查找规则的依据(参考 searchRule)
+func EvalRego(name string, content string, input interface{}) ([]interface{}, error) {
+	reg := Rego{
+		filePath: name + ".rego",
+		content:  content,
+	}
+	if err := reg.Init(); err != nil {
+		return nil, err
+	}
+	if len(reg.rules) == 0 {
+		return nil, fmt.Errorf("no rule found")
+	}
+	reg.rule = searchRule(reg, name)
+	reg.query = fmt.Sprintf("data.%s.%s", reg.pkg, reg.rule)
+
+	obj := ast.NewObject()
+	obj.Insert(ast.StringTerm("version"), ast.StringTerm(version.Version))
+	obj.Insert(ast.StringTerm("commit"), ast.StringTerm(version.Vcs))
+
+	r := rego.New(
+		rego.Input(input),
+		rego.Query(reg.query),
+		rego.Module(reg.filePath, reg.content),
+		rego.Runtime(ast.NewTerm(obj)),
+	)
+	resultSet, err := r.Eval(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("evaluating policy: %w", err)
+	}
+	if len(resultSet) == 0 || len(resultSet[0].Expressions) == 0 {
+		return nil, nil
+	}
+
+	// 规则可以是集合(deny[msg] { ... })或者布尔值(deny { ... })
+	switch v := resultSet[0].Expressions[0].Value.(type) {
+	case []interface{}:
+		return v, nil
+	case bool:
+		if v {
+			return []interface{}{v}, nil
+		}
+		return nil, nil
+	case nil:
+		return nil, nil
+	default:
+		return []interface{}{v}, nil
+	}
+}
+
+// ParseViolations 从规则结果中提取违规信息及相关的资源
+// 结果可以是字符串、包含 msg/resource 字段的对象或者 true
+func ParseViolations(result []interface{}) (messages []string, resources []string) {
+	for _, v := range result {
+		switch r := v.(type) {
+		case string:
+			messages = append(messages, r)
+		case map[string]interface{}:
+			if msg, ok := r["msg"].(string); ok {
+				messages = append(messages, msg)
+			}
+			if res, ok := r["resource"].(string); ok {
+				resources = append(resources, res)
+			} else if res, ok := r["Id"].(string); ok {
+				resources = append(resources, res)
+			}
+		}
+	}
+	return messages, resources
+}
+
+// SplitResourceAddress 拆分资源地址，如 alicloud_instance.web => alicloud_instance, web
+func SplitResourceAddress(address string) (resType string, resName string) {
+	// 去掉 module 前缀
+	if idx := strings.LastIndex(address, "module."); idx != -1 {
+		if parts := strings.SplitN(address[idx:], ".", 3); len(parts) == 3 {
+			address = parts[2]
+		}
+	}
+	if idx := strings.Index(address, "."); idx > 0 {
+		return address[:idx], address[idx+1:]
+	}
+	return "unknown", address
+}
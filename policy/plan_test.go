@@ -0,0 +1,44 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalRegoPlanInput(t *testing.T) {
+	content := `package cloudiac
+
+deny_destroy[msg] {
+	input.summary.destroy > 1
+	msg := sprintf("%d resources will be destroyed", [input.summary.destroy])
+}
+`
+	input := PlanInput{Summary: PlanSummary{Destroy: 3}}
+	result, err := EvalRego("deny_destroy", content, input)
+	assert.NoError(t, err)
+	messages, _ := ParseViolations(result)
+	assert.Equal(t, []string{"3 resources will be destroyed"}, messages)
+
+	input.Summary.Destroy = 1
+	result, err = EvalRego("deny_destroy", content, input)
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+func TestSplitResourceAddress(t *testing.T) {
+	cases := []struct {
+		address, resType, resName string
+	}{
+		{"alicloud_instance.web", "alicloud_instance", "web"},
+		{"module.vpc.alicloud_vpc.main", "alicloud_vpc", "main"},
+		{"module.a.module.b.aws_instance.web[0]", "aws_instance", "web[0]"},
+	}
+	for _, c := range cases {
+		resType, resName := SplitResourceAddress(c.address)
+		assert.Equal(t, c.resType, resType)
+		assert.Equal(t, c.resName, resName)
+	}
+}
@@ -55,19 +55,21 @@ type Policy struct {
 }
 
 type Meta struct {
-	Category      string `json:"category"`                                           // 分组
-	Root          string `json:"root" validate:"required"`                           // 根目录
-	File          string `json:"file" validate:"required"`                           // 文件名
-	Id            string `json:"id" validate:"required"`                             // 策略id
-	Name          string `json:"name" validate:"required"`                           // 策略名称
-	Label         string `json:"label"`                                              // 策略标签
-	PolicyType    string `json:"policy_type" binding:"required"`                     // 策略类型
-	ReferenceId   string `json:"reference_id"`                                       // 引用策略id
-	ResourceType  string `json:"resource_type" binding:"required"`                   // 资源类型
-	Severity      string `json:"severity" validate:"required,oneof=low medium high"` // 严重程度
-	Version       int    `json:"version"`                                            // 策略版本
-	FixSuggestion string `json:"fix_suggestion"`                                     // 修复建议
-	Description   string `json:"description"`                                        // 描述
+	Category      string `json:"category"`                                             // 分组
+	Root          string `json:"root" validate:"required"`                             // 根目录
+	File          string `json:"file" validate:"required"`                             // 文件名
+	Id            string `json:"id" validate:"required"`                               // 策略id
+	Name          string `json:"name" validate:"required"`                             // 策略名称
+	Label         string `json:"label"`                                                // 策略标签
+	PolicyType    string `json:"policy_type" binding:"required"`                       // 策略类型
+	ReferenceId   string `json:"reference_id"`                                         // 引用策略id
+	ResourceType  string `json:"resource_type" binding:"required"`                     // 资源类型
+	Severity      string `json:"severity" validate:"required,oneof=low medium high"`   // 严重程度
+	Version       int    `json:"version"`                                              // 策略版本
+	FixSuggestion string `json:"fix_suggestion"`                                       // 修复建议
+	Description   string `json:"description"`                                          // 描述
+	InputType     string `json:"input_type" validate:"omitempty,oneof=hcl plan"`       // 策略输入类型，默认为 hcl
+	Enforcement   string `json:"enforcement" validate:"omitempty,oneof=deny approval"` // 执行计划策略不通过时的处理方式，默认为 deny
 }
 
 type Resource struct {
@@ -426,10 +428,12 @@ func (r *Rego) Init() error {
 		return fmt.Errorf("rego file path is empty")
 	}
 
-	r.content, err = r.LoadRego()
-	if err != nil {
-		// error load rego file
-		return err
+	if r.content == "" {
+		r.content, err = r.LoadRego()
+		if err != nil {
+			// error load rego file
+			return err
+		}
 	}
 
 	r.compiler, err = r.Compile()
@@ -774,10 +778,22 @@ func ParseMeta(regoFilePath string, metaFilePath string) (*PolicyWithMeta, e.Err
 	if meta.ReferenceId == "" {
 		meta.ReferenceId = meta.Id
 	}
+	if meta.InputType == "" {
+		meta.InputType = models.PolicyInputTypeHCL
+	}
+	if meta.InputType == models.PolicyInputTypePlan {
+		// 执行计划策略针对的是整个执行计划，不需要指定资源类型
+		if meta.ResourceType == "" {
+			meta.ResourceType = "terraform_plan"
+		}
+		if meta.Enforcement == "" {
+			meta.Enforcement = models.PolicyEnforcementDeny
+		}
+	}
 	if meta.ResourceType == "" {
 		return nil, e.New(e.PolicyRegoMissingComment, fmt.Errorf("missing resource type info"))
 	}
-	if meta.PolicyType == "" {
+	if meta.PolicyType == "" && strings.Contains(meta.ResourceType, "_") {
 		// alicloud_instance => alicloud
 		meta.PolicyType = meta.ResourceType[:strings.Index(meta.ResourceType, "_")]
 	}
@@ -830,6 +846,12 @@ func ParseMetaFromRego(regoFilePath string, regoContent string) (*Meta, error) {
 	//	## 策略分类(或者叫标签)，多个分类使用逗号分隔
 	//	# @label: cat1,cat2
 	//
+	//	## 策略输入类型: 可选 hcl/plan，plan 表示对 terraform 执行计划进行检查
+	//	# @input_type: plan
+	//
+	//	## 执行计划策略不通过时的处理方式: 可选 deny/approval
+	//	# @enforcement: approval
+	//
 	//	## 策略修复建议（支持多行）
 	//	# @fix_suggestion:
 	//	Terraform 代码去掉`associate_public_ip_address`配置
@@ -853,6 +875,8 @@ func ParseMetaFromRego(regoFilePath string, regoContent string) (*Meta, error) {
 		Category:     ExtractStr("category", regoContent),
 		ReferenceId:  ExtractStr("reference_id", regoContent),
 		Severity:     ExtractStr("severity", regoContent),
+		InputType:    ExtractStr("input_type", regoContent),
+		Enforcement:  ExtractStr("enforcement", regoContent),
 	}
 	ver := ExtractStr("version", regoContent)
 	meta.Version, _ = strconv.Atoi(ver)
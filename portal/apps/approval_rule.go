@@ -0,0 +1,111 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// SearchApprovalRule 查询项目下的审批规则
+func SearchApprovalRule(c *ctx.ServiceContext, form *forms.SearchApprovalRuleForm) (interface{}, e.Error) {
+	if c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+	query := services.SearchApprovalRule(c.DB(), c.ProjectId, form.EnvId)
+	return getPage(query, form, models.ApprovalRule{})
+}
+
+// DetailApprovalRule 审批规则详情
+func DetailApprovalRule(c *ctx.ServiceContext, form *forms.DetailApprovalRuleForm) (*models.ApprovalRule, e.Error) {
+	return services.GetApprovalRuleById(c.DB(), c.ProjectId, form.Id)
+}
+
+// CreateApprovalRule 创建审批规则，规则对之后的审批立即生效
+func CreateApprovalRule(c *ctx.ServiceContext, form *forms.CreateApprovalRuleForm) (*models.ApprovalRule, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create approval rule %s", form.Name))
+	if c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+
+	if form.EnvId != "" {
+		if _, er := getProjectEnv(c, form.EnvId); er != nil {
+			return nil, er
+		}
+	}
+	if form.ApproverGroupId != "" {
+		if _, er := services.GetApproverGroupById(c.DB(), c.OrgId, form.ApproverGroupId); er != nil {
+			return nil, er
+		}
+	}
+
+	rule := models.ApprovalRule{
+		OrgId:                    c.OrgId,
+		ProjectId:                c.ProjectId,
+		EnvId:                    form.EnvId,
+		Name:                     form.Name,
+		Enabled:                  form.Enabled == nil || *form.Enabled,
+		ApproverGroupId:          form.ApproverGroupId,
+		RequiredApprovals:        form.RequiredApprovals,
+		ForbidSelfApproval:       form.ForbidSelfApproval,
+		AutoApproveAdditionsOnly: form.AutoApproveAdditionsOnly,
+		AutoApproveMaxCost:       form.AutoApproveMaxCost,
+	}
+	if rule.RequiredApprovals == 0 {
+		rule.RequiredApprovals = 1
+	}
+	return services.CreateApprovalRule(c.DB(), rule)
+}
+
+// UpdateApprovalRule 修改审批规则
+func UpdateApprovalRule(c *ctx.ServiceContext, form *forms.UpdateApprovalRuleForm) (*models.ApprovalRule, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update approval rule %s", form.Id))
+
+	rule, er := services.GetApprovalRuleById(c.DB(), c.ProjectId, form.Id)
+	if er != nil {
+		return nil, er
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("name") {
+		attrs["name"] = form.Name
+	}
+	if form.HasKey("enabled") {
+		attrs["enabled"] = form.Enabled
+	}
+	if form.HasKey("approverGroupId") {
+		if form.ApproverGroupId != "" {
+			if _, er := services.GetApproverGroupById(c.DB(), c.OrgId, form.ApproverGroupId); er != nil {
+				return nil, er
+			}
+		}
+		attrs["approver_group_id"] = form.ApproverGroupId
+	}
+	if form.HasKey("requiredApprovals") {
+		attrs["required_approvals"] = form.RequiredApprovals
+	}
+	if form.HasKey("forbidSelfApproval") {
+		attrs["forbid_self_approval"] = form.ForbidSelfApproval
+	}
+	if form.HasKey("autoApproveAdditionsOnly") {
+		attrs["auto_approve_additions_only"] = form.AutoApproveAdditionsOnly
+	}
+	if form.HasKey("autoApproveMaxCost") {
+		attrs["auto_approve_max_cost"] = form.AutoApproveMaxCost
+	}
+	if len(attrs) == 0 {
+		return rule, nil
+	}
+	return services.UpdateApprovalRule(c.DB(), c.ProjectId, form.Id, attrs)
+}
+
+// DeleteApprovalRule 删除审批规则
+func DeleteApprovalRule(c *ctx.ServiceContext, form *forms.DeleteApprovalRuleForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete approval rule %s", form.Id))
+	return nil, services.DeleteApprovalRule(c.DB(), c.ProjectId, form.Id)
+}
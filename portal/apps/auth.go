@@ -73,6 +73,16 @@ func Login(c *ctx.ServiceContext, form *forms.LoginForm) (resp interface{}, er e
 		}
 	}
 
+	// 启用或者被要求启用多因素认证的用户需要再完成一次验证
+	if data, er := mfaLoginResp(c, user); er != nil {
+		return nil, er
+	} else if data != nil {
+		return data, nil
+	}
+	return issueLoginToken(c, user)
+}
+
+func issueLoginToken(c *ctx.ServiceContext, user *models.User) (*resps.LoginResp, e.Error) {
 	token, err := services.GenerateToken(user.Id, user.Name, user.IsAdmin, 1*24*time.Hour)
 	if err != nil {
 		c.Logger().Errorf("name [%s] generateToken error: %v", user.Email, err)
@@ -86,7 +96,7 @@ func Login(c *ctx.ServiceContext, form *forms.LoginForm) (resp interface{}, er e
 	// 记录操作日志
 	services.InsertUserOperateLog(user.Id, "", user.Id, consts.OperatorObjectTypeUser, "login", "", nil)
 
-	return data, nil
+	return &data, nil
 }
 
 func createLdapUser(c *ctx.ServiceContext, username, email string) (*models.User, e.Error) {
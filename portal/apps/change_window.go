@@ -0,0 +1,108 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// checkChangeWindowOverride 紧急变更需要组织管理员或者项目管理者权限，并且需要填写变更原因
+func checkChangeWindowOverride(c *ctx.ServiceContext, reason string) e.Error {
+	if !(c.IsSuperAdmin ||
+		services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) ||
+		services.UserHasProjectRole(c.UserId, c.OrgId, c.ProjectId, consts.ProjectRoleManager)) {
+		return e.New(e.PermissionDeny, fmt.Errorf("emergency override is not allowed"), http.StatusForbidden)
+	}
+	if strings.TrimSpace(reason) == "" {
+		return e.New(e.ChangeOverrideReasonRequired, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// SearchChangeWindow 查询组织的变更窗口及冻结期设置
+func SearchChangeWindow(c *ctx.ServiceContext, form *forms.SearchChangeWindowForm) (interface{}, e.Error) {
+	query := services.SearchChangeWindow(c.DB(), c.OrgId, form.ProjectId)
+	return getPage(query, form, models.ChangeWindow{})
+}
+
+// DetailChangeWindow 变更窗口详情
+func DetailChangeWindow(c *ctx.ServiceContext, form *forms.DetailChangeWindowForm) (*models.ChangeWindow, e.Error) {
+	return services.GetChangeWindowById(c.DB(), c.OrgId, form.Id)
+}
+
+// CreateChangeWindow 创建变更窗口或者冻结期
+func CreateChangeWindow(c *ctx.ServiceContext, form *forms.CreateChangeWindowForm) (*models.ChangeWindow, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create change window %s", form.Name))
+
+	if form.ProjectId != "" {
+		project, er := services.DetailProject(c.DB(), form.ProjectId)
+		if er != nil || project.OrgId != c.OrgId {
+			return nil, e.New(e.ProjectNotExists, http.StatusBadRequest)
+		}
+	}
+	return services.CreateChangeWindow(c.DB(), models.ChangeWindow{
+		OrgId:       c.OrgId,
+		ProjectId:   form.ProjectId,
+		Name:        form.Name,
+		Type:        form.Type,
+		Enabled:     form.Enabled == nil || *form.Enabled,
+		Description: form.Description,
+		Timezone:    form.Timezone,
+		Cron:        form.Cron,
+		Duration:    form.Duration,
+		StartTime:   form.StartTime,
+		EndTime:     form.EndTime,
+	})
+}
+
+// UpdateChangeWindow 修改变更窗口或者冻结期
+func UpdateChangeWindow(c *ctx.ServiceContext, form *forms.UpdateChangeWindowForm) (*models.ChangeWindow, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update change window %s", form.Id))
+
+	w, er := services.GetChangeWindowById(c.DB(), c.OrgId, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	if form.HasKey("name") {
+		w.Name = form.Name
+	}
+	if form.HasKey("type") {
+		w.Type = form.Type
+	}
+	if form.HasKey("enabled") {
+		w.Enabled = form.Enabled
+	}
+	if form.HasKey("description") {
+		w.Description = form.Description
+	}
+	if form.HasKey("timezone") {
+		w.Timezone = form.Timezone
+	}
+	if form.HasKey("cron") {
+		w.Cron = form.Cron
+	}
+	if form.HasKey("duration") {
+		w.Duration = form.Duration
+	}
+	if form.HasKey("startTime") {
+		w.StartTime = form.StartTime
+	}
+	if form.HasKey("endTime") {
+		w.EndTime = form.EndTime
+	}
+	return services.UpdateChangeWindow(c.DB(), w)
+}
+
+// DeleteChangeWindow 删除变更窗口或者冻结期
+func DeleteChangeWindow(c *ctx.ServiceContext, form *forms.DeleteChangeWindowForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete change window %s", form.Id))
+	return nil, services.DeleteChangeWindow(c.DB(), c.OrgId, form.Id)
+}
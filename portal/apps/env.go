@@ -386,6 +386,9 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 	if err = envWorkdirCheck(c, tpl.RepoId, form.Revision, form.Workdir, tpl.VcsId); err != nil {
 		return nil, err
 	}
+	if err = envIacEngineCheck(form.IacEngine, form.TfVersion); err != nil {
+		return nil, err
+	}
 
 	tx := c.Tx()
 	defer func() {
@@ -426,6 +429,9 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		Revision:     form.Revision,
 		KeyId:        form.KeyId,
 		Workdir:      form.Workdir,
+		IacEngine:    form.IacEngine,
+		TfVersion:    form.TfVersion,
+		StateBackend: form.StateBackend,
 
 		TTL:             form.TTL,
 		AutoDestroyAt:   &destroyAt,
@@ -732,6 +738,36 @@ func setAndCheckUpdateEnvAutoApproval(c *ctx.ServiceContext, tx *db.Session, att
 	return nil
 }
 
+// setAndCheckUpdateEnvProtection 只有组织管理员和项目管理者可以修改环境的保护设置
+func setAndCheckUpdateEnvProtection(c *ctx.ServiceContext, tx *db.Session, attrs models.Attrs, form *forms.UpdateEnvForm) e.Error {
+	if !form.HasKey("protected") && !form.HasKey("approverGroupId") && !form.HasKey("requiredApprovals") {
+		return nil
+	}
+	if !(c.IsSuperAdmin ||
+		services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) ||
+		services.UserHasProjectRole(c.UserId, c.OrgId, c.ProjectId, consts.ProjectRoleManager)) {
+		_ = tx.Rollback()
+		return e.New(e.PermissionDeny, http.StatusForbidden)
+	}
+
+	if form.HasKey("protected") {
+		attrs["protected"] = form.Protected
+	}
+	if form.HasKey("approverGroupId") {
+		if form.ApproverGroupId != "" {
+			if _, er := services.GetApproverGroupById(tx, c.OrgId, form.ApproverGroupId); er != nil {
+				_ = tx.Rollback()
+				return er
+			}
+		}
+		attrs["approver_group_id"] = form.ApproverGroupId
+	}
+	if form.HasKey("requiredApprovals") {
+		attrs["required_approvals"] = form.RequiredApprovals
+	}
+	return nil
+}
+
 func setAndCheckUpdateEnvDeploy(tx *db.Session, attrs models.Attrs, env *models.Env, form *forms.UpdateEnvForm) e.Error {
 	if !form.HasKey("deployAt") && !form.HasKey("autoDeployCron") {
 		return nil
@@ -875,6 +911,10 @@ func setAndCheckUpdateEnvByForm(c *ctx.ServiceContext, tx *db.Session, attrs mod
 		return err
 	}
 
+	if err := setAndCheckUpdateEnvProtection(c, tx, attrs, form); err != nil {
+		return err
+	}
+
 	if form.HasKey("archived") {
 		envResCount := int64(0)
 		if env.LastResTaskId != "" {
@@ -1040,15 +1080,24 @@ func EnvDetail(c *ctx.ServiceContext, form forms.DetailEnvForm) (*models.EnvDeta
 }
 
 // EnvDeploy 创建新部署任务
-// 任务类型：plan, apply, destroy
+// 任务类型：plan, apply, destroy, import
 func EnvDeploy(c *ctx.ServiceContext, form *forms.DeployEnvForm) (ret *models.EnvDetail, er e.Error) {
 	_ = c.DB().Transaction(func(tx *db.Session) error {
 		ret, er = envDeploy(c, tx, form)
 		return er
 	})
 
-	// 记录操作日志
-	services.InsertUserOperateLog(c.UserId, c.OrgId, form.Id, consts.OperatorObjectTypeEnv, form.TaskType, form.Name, nil)
+	// 记录操作日志，导入及 state 操作需要记录操作的资源
+	var attrs models.ResAttrs
+	if er == nil {
+		switch form.TaskType {
+		case common.TaskTypeImport:
+			attrs = models.ResAttrs{"taskId": ret.TaskId, "imports": form.Imports}
+		case common.TaskTypeState:
+			attrs = models.ResAttrs{"taskId": ret.TaskId, "stateOps": form.StateOps}
+		}
+	}
+	services.InsertUserOperateLog(c.UserId, c.OrgId, form.Id, consts.OperatorObjectTypeEnv, form.TaskType, form.Name, attrs)
 
 	return ret, er
 }
@@ -1111,6 +1160,20 @@ func envPreCheck(orgId, projectId, keyId models.Id, playbook string) e.Error {
 	return nil
 }
 
+// envIacEngineCheck 环境覆盖模板的 IaC 引擎时需要同时指定该引擎可用的版本
+func envIacEngineCheck(engine, version string) e.Error {
+	if engine == "" {
+		return nil
+	}
+	if version == "" {
+		return e.New(e.BadParam, http.StatusBadRequest, "tfVersion is required when iacEngine is set")
+	}
+	if err := checkIacEngineVersion(engine, version); err != nil {
+		return e.New(e.InvalidTfVersion, err, http.StatusBadRequest)
+	}
+	return nil
+}
+
 func envCheck(tx *db.Session, orgId, projectId, id models.Id, lg logs.Logger) (*models.Env, e.Error) {
 	envQuery := services.QueryWithProjectId(services.QueryWithOrgId(tx, orgId), projectId)
 	env, err := services.GetEnvById(envQuery, id)
@@ -1196,6 +1259,10 @@ func setEnvByForm(env *models.Env, form *forms.DeployEnvForm) {
 	if form.HasKey("workdir") {
 		env.Workdir = form.Workdir
 	}
+	if form.HasKey("iacEngine") {
+		env.IacEngine = form.IacEngine
+		env.TfVersion = form.TfVersion
+	}
 
 	setEnvRunnerInfoByForm(env, form)
 }
@@ -1381,6 +1448,9 @@ func setAndCheckEnvByForm(c *ctx.ServiceContext, tx *db.Session, env *models.Env
 	if form.TaskType == "" {
 		return e.New(e.BadParam, http.StatusBadRequest)
 	}
+	if err := checkDeployTaskOptions(form); err != nil {
+		return err
+	}
 
 	if form.HasKey("varGroupIds") || form.HasKey("delVarGroupIds") {
 		// 创建变量组与实例的关系
@@ -1392,6 +1462,31 @@ func setAndCheckEnvByForm(c *ctx.ServiceContext, tx *db.Session, env *models.Env
 	return nil
 }
 
+// checkDeployTaskOptions 检查导入、state 操作及 replace、refresh-only 等任务参数
+func checkDeployTaskOptions(form *forms.DeployEnvForm) e.Error {
+	if form.TaskType == common.TaskTypeImport && len(form.Imports) == 0 {
+		return e.New(e.BadParam, http.StatusBadRequest, "imports is required when taskType is import")
+	}
+	if form.TaskType == common.TaskTypeState {
+		if len(form.StateOps) == 0 {
+			return e.New(e.BadParam, http.StatusBadRequest, "stateOps is required when taskType is state")
+		}
+		for _, op := range form.StateOps {
+			if op.Op == models.StateOpMv && op.Destination == "" {
+				return e.New(e.BadParam, http.StatusBadRequest, fmt.Sprintf("destination is required to move %s", op.Address))
+			}
+		}
+	}
+	if (len(form.Replaces) > 0 || form.RefreshOnly) &&
+		form.TaskType != common.TaskTypePlan && form.TaskType != common.TaskTypeApply {
+		return e.New(e.BadParam, http.StatusBadRequest, "replaces and refreshOnly only work with plan or apply task")
+	}
+	if len(form.Replaces) > 0 && form.RefreshOnly {
+		return e.New(e.BadParam, http.StatusBadRequest, "replaces can not be used with refreshOnly")
+	}
+	return nil
+}
+
 func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm) (*models.EnvDetail, e.Error) { // nolint:cyclop
 	c.AddLogField("action", fmt.Sprintf("deploy env task %s", form.Id))
 	lg := c.Logger()
@@ -1399,6 +1494,9 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 	if err := envPreCheck(c.OrgId, c.ProjectId, form.KeyId, form.Playbook); err != nil {
 		return nil, err
 	}
+	if err := envIacEngineCheck(form.IacEngine, form.TfVersion); err != nil {
+		return nil, err
+	}
 	lg.Debugln("envDeploy -> envPreCheck finish")
 
 	// 检查自动纠漂移、推送到分支时重新部署时，是否了配置自动审批
@@ -1417,6 +1515,21 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 	if form.TaskType != common.TaskTypePlan && env.Locked {
 		return nil, e.New(e.EnvLocked, http.StatusBadRequest)
 	}
+	if form.TaskType == common.TaskTypeDestroy {
+		if er := services.CheckEnvDestroyPerm(tx, env, c.UserId, c.IsSuperAdmin); er != nil {
+			return nil, er
+		}
+	}
+	// 冻结期内或者变更窗口外只允许发起 plan 任务或者紧急变更
+	if form.TaskType != common.TaskTypePlan {
+		if form.EmergencyOverride {
+			if er := checkChangeWindowOverride(c, form.OverrideReason); er != nil {
+				return nil, er
+			}
+		} else if er := services.CheckChangeWindow(tx, c.OrgId, c.ProjectId, time.Now()); er != nil {
+			return nil, er
+		}
+	}
 
 	// 模板检查
 	tpl, err := envTplCheck(tx, c.OrgId, env.TplId, c.Logger())
@@ -1460,9 +1573,19 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 	}
 
 	targets := make([]string, 0)
-	if len(strings.TrimSpace(form.Targets)) > 0 {
+	imports := make(models.TaskImports, 0)
+	if form.TaskType == common.TaskTypeImport {
+		// terraform import 不支持 target 参数
+		for _, imp := range form.Imports {
+			imports = append(imports, models.TaskImport{Address: imp.Address, Id: imp.Id})
+		}
+	} else if len(strings.TrimSpace(form.Targets)) > 0 {
 		targets = strings.Split(strings.TrimSpace(form.Targets), ",")
 	}
+	stateOps := make(models.TaskStateOps, 0)
+	for _, op := range form.StateOps {
+		stateOps = append(stateOps, models.TaskStateOp{Op: op.Op, Address: op.Address, Destination: op.Destination})
+	}
 
 	// 计算变量列表
 	vars, er := services.GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
@@ -1508,6 +1631,10 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 		SourceSys:   taskSourceSys,
 		Callback:    env.Callback,
 		IsDriftTask: IsDriftTask,
+		Imports:     imports,
+		StateOps:    stateOps,
+		Replaces:    form.Replaces,
+		RefreshOnly: form.RefreshOnly,
 	})
 
 	if err != nil {
@@ -1516,6 +1643,12 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 	}
 	lg.Debugln("envDeploy -> CreateTask finish")
 
+	if form.EmergencyOverride && form.TaskType != common.TaskTypePlan {
+		if err := services.OverrideTaskChangeWindow(tx, task, c.UserId, form.OverrideReason); err != nil {
+			return nil, err
+		}
+	}
+
 	if _, err := tx.UpdateAll(env); err != nil {
 		c.Logger().Errorf("error save env, err %s", err)
 		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
@@ -1602,7 +1735,7 @@ func EnvVariables(c *ctx.ServiceContext, form forms.SearchEnvVariableForm) (inte
 	task := models.Task{}
 	err := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId, models.Task{}.TableName()).
 		Where("env_id = ? AND `type` IN (?)", form.Id,
-			[]string{common.TaskTypePlan, common.TaskTypeApply, common.TaskTypeDestroy}).Last(&task)
+			[]string{common.TaskTypePlan, common.TaskTypeApply, common.TaskTypeDestroy, common.TaskTypeImport}).Last(&task)
 	if err != nil {
 		if e.IsRecordNotFound(err) {
 			return nil, e.New(e.ObjectNotExists, http.StatusNotFound)
@@ -1734,6 +1867,37 @@ func EnvUpdateTags(c *ctx.ServiceContext, form *forms.UpdateEnvTagsForm) (resp i
 	}
 }
 
+// EnvStateMigrate 迁移环境 state 到指定的存储后端
+func EnvStateMigrate(c *ctx.ServiceContext, form *forms.EnvStateMigrateForm) (*models.Env, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("migrate env %s state to %s", form.Id, form.Backend))
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	env, err := services.GetEnvById(tx.Where("project_id = ?", c.ProjectId), form.Id)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	if err := services.MigrateEnvState(tx, env, form.Backend, form.Force); err != nil {
+		_ = tx.Rollback()
+		c.Logger().Errorf("migrate env state error: %v", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+	return env, nil
+}
+
 func EnvLock(c *ctx.ServiceContext, form *forms.EnvLockForm) (interface{}, e.Error) {
 	tx := c.Tx()
 	defer func() {
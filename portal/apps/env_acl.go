@@ -0,0 +1,183 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/rbac"
+	"fmt"
+	"net/http"
+)
+
+// SearchApproverGroup 查询组织下的审批组
+func SearchApproverGroup(c *ctx.ServiceContext, form *forms.SearchApproverGroupForm) (interface{}, e.Error) {
+	query := services.SearchApproverGroup(c.DB(), c.OrgId, form.Q)
+	return getPage(query, form, models.ApproverGroup{})
+}
+
+// DetailApproverGroup 审批组详情
+func DetailApproverGroup(c *ctx.ServiceContext, form *forms.DetailApproverGroupForm) (*models.ApproverGroup, e.Error) {
+	return services.GetApproverGroupById(c.DB(), c.OrgId, form.Id)
+}
+
+// CreateApproverGroup 创建审批组，审批组成员必须是组织成员
+func CreateApproverGroup(c *ctx.ServiceContext, form *forms.CreateApproverGroupForm) (*models.ApproverGroup, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create approver group %s", form.Name))
+
+	if er := checkApproverGroupUsers(c, form.UserIds); er != nil {
+		return nil, er
+	}
+	return services.CreateApproverGroup(c.DB(), models.ApproverGroup{
+		OrgId:       c.OrgId,
+		Name:        form.Name,
+		Description: form.Description,
+		UserIds:     form.UserIds,
+	})
+}
+
+// UpdateApproverGroup 修改审批组
+func UpdateApproverGroup(c *ctx.ServiceContext, form *forms.UpdateApproverGroupForm) (*models.ApproverGroup, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update approver group %s", form.Id))
+
+	attrs := models.Attrs{}
+	if form.HasKey("name") {
+		attrs["name"] = form.Name
+	}
+	if form.HasKey("description") {
+		attrs["description"] = form.Description
+	}
+	if form.HasKey("userIds") {
+		if er := checkApproverGroupUsers(c, form.UserIds); er != nil {
+			return nil, er
+		}
+		attrs["user_ids"] = models.StrSlice(form.UserIds)
+	}
+	if len(attrs) == 0 {
+		return services.GetApproverGroupById(c.DB(), c.OrgId, form.Id)
+	}
+	return services.UpdateApproverGroup(c.DB(), c.OrgId, form.Id, attrs)
+}
+
+// DeleteApproverGroup 删除审批组
+func DeleteApproverGroup(c *ctx.ServiceContext, form *forms.DeleteApproverGroupForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete approver group %s", form.Id))
+	return nil, services.DeleteApproverGroup(c.DB(), c.OrgId, form.Id)
+}
+
+func checkApproverGroupUsers(c *ctx.ServiceContext, userIds []string) e.Error {
+	for _, id := range userIds {
+		if !services.UserHasOrgRole(models.Id(id), c.OrgId, "") {
+			return e.New(e.UserNotExists, fmt.Errorf("user %s is not a member of the org", id), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// checkEnvAclPerm 环境角色只能由组织管理员、项目管理者或者环境管理者设置
+func checkEnvAclPerm(c *ctx.ServiceContext, envId models.Id) e.Error {
+	if _, er := getProjectEnv(c, envId); er != nil {
+		return er
+	}
+	if c.IsSuperAdmin ||
+		services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) ||
+		services.UserHasProjectRole(c.UserId, c.OrgId, c.ProjectId, consts.ProjectRoleManager) {
+		return nil
+	}
+	role, er := services.GetEnvUserRole(c.DB(), envId, c.UserId)
+	if er != nil {
+		return er
+	} else if role != consts.ProjectRoleManager {
+		return e.New(e.PermissionDeny, http.StatusForbidden)
+	}
+	return nil
+}
+
+// checkEnvRolePerm 检查用户在环境中的有效角色(环境角色覆盖项目角色)是否拥有环境的 act 权限，
+// 用于一次请求操作多个环境的接口，路由的权限检查只能使用项目角色
+func checkEnvRolePerm(c *ctx.ServiceContext, env *models.Env, act string) e.Error {
+	if c.IsSuperAdmin || services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) {
+		return nil
+	}
+
+	orgRole := ""
+	if userOrg := services.UserOrgRoles(c.UserId)[env.OrgId]; userOrg != nil {
+		orgRole = userOrg.Role
+	}
+	projRole, er := services.GetEnvUserRole(c.DB(), env.Id, c.UserId)
+	if er != nil {
+		return er
+	}
+	if projRole == "" {
+		if userProject := services.UserProjectRoles(c.UserId)[env.ProjectId]; userProject != nil {
+			projRole = userProject.Role
+		}
+	}
+
+	allow, err := rbac.Enforce(orgRole, projRole, "envs", act)
+	if err != nil {
+		return e.New(e.InternalError, err)
+	} else if !allow {
+		return e.New(e.PermissionDeny, fmt.Errorf("%s not allowed to %s env %s", projRole, act, env.Id), http.StatusForbidden)
+	}
+	return nil
+}
+
+// SearchEnvUser 查询环境中设置了环境角色的用户
+func SearchEnvUser(c *ctx.ServiceContext, form *forms.SearchEnvUserForm) (interface{}, e.Error) {
+	if _, er := getProjectEnv(c, form.Id); er != nil {
+		return nil, er
+	}
+	return getPage(services.SearchEnvUser(c.DB(), form.Id), form, models.EnvUser{})
+}
+
+// SetEnvUser 设置用户在环境中的角色，环境角色会覆盖用户的项目角色，用户必须是项目成员
+func SetEnvUser(c *ctx.ServiceContext, form *forms.SetEnvUserForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("set env %s user %s role %s", form.Id, form.UserId, form.Role))
+
+	if er := checkEnvAclPerm(c, form.Id); er != nil {
+		return nil, er
+	}
+	if er := services.ValidProjectRole(c.DB(), c.OrgId, form.Role); er != nil {
+		return nil, er
+	}
+	if !services.UserHasProjectRole(form.UserId, c.OrgId, c.ProjectId, "") {
+		return nil, e.New(e.UserNotExists, fmt.Errorf("user is not a member of the project"), http.StatusBadRequest)
+	}
+
+	return nil, services.SetEnvUser(c.DB(), models.EnvUser{
+		EnvId:  form.Id,
+		UserId: form.UserId,
+		Role:   form.Role,
+	})
+}
+
+// DeleteEnvUser 删除用户的环境角色，删除后用户使用项目角色访问环境
+func DeleteEnvUser(c *ctx.ServiceContext, form *forms.DeleteEnvUserForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete env %s user %s", form.Id, form.UserId))
+
+	if er := checkEnvAclPerm(c, form.Id); er != nil {
+		return nil, er
+	}
+	return nil, services.DeleteEnvUser(c.DB(), form.Id, form.UserId)
+}
+
+// SearchTaskApproval 查询任务的审批记录
+func SearchTaskApproval(c *ctx.ServiceContext, form *forms.DetailTaskForm) (interface{}, e.Error) {
+	task, er := services.GetTaskById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+	if er != nil && er.Code() == e.TaskNotExists {
+		return nil, e.New(e.TaskNotExists, er, http.StatusNotFound)
+	} else if er != nil {
+		return nil, er
+	}
+
+	approvals := make([]models.TaskApproval, 0)
+	if err := services.SearchTaskApproval(c.DB(), task.Id).Find(&approvals); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return approvals, nil
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"net/http"
+)
+
+func toEnvDependencyItems(envs []models.Env) []resps.EnvDependencyItem {
+	items := make([]resps.EnvDependencyItem, 0, len(envs))
+	for _, env := range envs {
+		items = append(items, resps.EnvDependencyItem{Id: env.Id, Name: env.Name, Status: env.Status})
+	}
+	return items
+}
+
+func getEnvDependency(sess *db.Session, envId models.Id) (*resps.EnvDependencyResp, e.Error) {
+	dependsOn, er := services.GetEnvDependsOn(sess, envId)
+	if er != nil {
+		return nil, er
+	}
+	dependents, er := services.GetEnvDependents(sess, envId)
+	if er != nil {
+		return nil, er
+	}
+	return &resps.EnvDependencyResp{
+		DependsOn:  toEnvDependencyItems(dependsOn),
+		Dependents: toEnvDependencyItems(dependents),
+	}, nil
+}
+
+// GetEnvDependency 查询环境的依赖及被依赖关系
+func GetEnvDependency(c *ctx.ServiceContext, form *forms.EnvParam) (*resps.EnvDependencyResp, e.Error) {
+	env, er := getProjectEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	return getEnvDependency(c.DB(), env.Id)
+}
+
+// UpdateEnvDependency 更新环境依赖的环境列表
+func UpdateEnvDependency(c *ctx.ServiceContext, form *forms.UpdateEnvDependencyForm) (*resps.EnvDependencyResp, e.Error) {
+	env, er := getProjectEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if er := services.SetEnvDependencies(tx, env, form.DependsOn); er != nil {
+		_ = tx.Rollback()
+		return nil, er
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, env.Id, consts.OperatorObjectTypeEnv, "update_dependency", env.Name, nil)
+	return getEnvDependency(c.DB(), env.Id)
+}
+
+// CreateEnvChain 按依赖顺序部署或销毁环境依赖链
+func CreateEnvChain(c *ctx.ServiceContext, form *forms.EnvParam, action string) (*resps.EnvChainResp, e.Error) {
+	env, er := getProjectEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	if env.Archived {
+		return nil, e.New(e.EnvArchived, http.StatusBadRequest)
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	chain, er := services.CreateEnvChain(tx, env, action, c.UserId)
+	if er != nil {
+		_ = tx.Rollback()
+		return nil, er
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, env.Id, consts.OperatorObjectTypeEnv, "chain_"+action, env.Name, nil)
+	return buildEnvChainResp(c.DB(), chain)
+}
+
+func buildEnvChainResp(sess *db.Session, chain *models.EnvChain) (*resps.EnvChainResp, e.Error) {
+	resp := resps.EnvChainResp{
+		EnvChain: *chain,
+		Tasks:    make([]resps.EnvChainTaskItem, 0, len(chain.EnvIds)),
+	}
+	for i, envId := range chain.EnvIds {
+		item := resps.EnvChainTaskItem{EnvId: models.Id(envId)}
+		if env, er := services.GetEnvById(sess, models.Id(envId)); er == nil {
+			item.EnvName = env.Name
+		} else if er.Code() != e.EnvNotExists {
+			return nil, er
+		}
+		if i < len(chain.TaskIds) {
+			item.TaskId = models.Id(chain.TaskIds[i])
+			if task, er := services.GetTaskById(sess, item.TaskId); er == nil {
+				item.TaskStatus = task.Status
+			} else if er.Code() != e.TaskNotExists {
+				return nil, er
+			}
+		}
+		resp.Tasks = append(resp.Tasks, item)
+	}
+	return &resp, nil
+}
+
+// SearchEnvChain 查询环境发起的依赖链编排记录
+func SearchEnvChain(c *ctx.ServiceContext, form *forms.SearchEnvChainForm) (interface{}, e.Error) {
+	env, er := getProjectEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+
+	p := page.New(form.CurrentPage(), form.PageSize(), services.QueryEnvChains(c.DB(), env.Id))
+	chains := make([]*models.EnvChain, 0)
+	if err := p.Scan(&chains); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     chains,
+	}, nil
+}
+
+// EnvChainDetail 依赖链编排详情，包含每个环境对应的任务
+func EnvChainDetail(c *ctx.ServiceContext, form *forms.EnvChainParam) (*resps.EnvChainResp, e.Error) {
+	env, er := getProjectEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	chain, er := services.GetEnvChainById(c.DB().Where("env_id = ?", env.Id), form.ChainId)
+	if er != nil {
+		return nil, er
+	}
+	return buildEnvChainResp(c.DB(), chain)
+}
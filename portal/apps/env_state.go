@@ -0,0 +1,235 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/statebackend"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// TfStateGet 读取环境 state(terraform http backend GET)，环境没有 state 时返回 nil
+func TfStateGet(c *ctx.ServiceContext, token string, statePath string) ([]byte, e.Error) {
+	env, _, er := services.VerifyStateToken(c.DB(), token, statePath)
+	if er != nil {
+		return nil, er
+	}
+	return services.GetEnvState(c.DB(), env.Id)
+}
+
+// TfStateSave 保存环境 state(terraform http backend POST)
+func TfStateSave(c *ctx.ServiceContext, token string, statePath string, lockId string, content []byte) e.Error {
+	env, taskId, er := services.VerifyStateToken(c.DB(), token, statePath)
+	if er != nil {
+		return er
+	}
+	c.AddLogField("envId", string(env.Id)).AddLogField("taskId", string(taskId))
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	version, er := services.SaveEnvState(tx, env, taskId, lockId, content)
+	if er != nil {
+		_ = tx.Rollback()
+		return er
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return e.New(e.DBError, err)
+	}
+	c.Logger().Infof("state saved, version %s, serial %d", version.Id, version.Serial)
+	return nil
+}
+
+// tfLockInfo terraform 加锁、解锁时提交的锁信息，这里只需要关心锁 ID
+type tfLockInfo struct {
+	ID string `json:"ID"`
+}
+
+func parseTfLockInfo(info []byte) (string, e.Error) {
+	lockInfo := tfLockInfo{}
+	if err := json.Unmarshal(info, &lockInfo); err != nil {
+		return "", e.New(e.BadParam, err)
+	}
+	return lockInfo.ID, nil
+}
+
+// TfStateLock 锁定环境 state(terraform http backend LOCK)，
+// 已被锁定时返回当前的锁，terraform 会将锁信息展示给用户
+func TfStateLock(c *ctx.ServiceContext, token string, statePath string, info []byte) (*models.StateLock, e.Error) {
+	env, _, er := services.VerifyStateToken(c.DB(), token, statePath)
+	if er != nil {
+		return nil, er
+	}
+	lockId, er := parseTfLockInfo(info)
+	if er != nil {
+		return nil, er
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	lock, er := services.LockEnvState(tx, env.Id, lockId, string(info))
+	if er != nil {
+		_ = tx.Rollback()
+		return lock, er
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+	return lock, nil
+}
+
+// TfStateUnlock 解锁环境 state(terraform http backend UNLOCK)
+func TfStateUnlock(c *ctx.ServiceContext, token string, statePath string, info []byte) e.Error {
+	env, _, er := services.VerifyStateToken(c.DB(), token, statePath)
+	if er != nil {
+		return er
+	}
+	lockId, er := parseTfLockInfo(info)
+	if er != nil {
+		return er
+	}
+	return services.UnlockEnvState(c.DB(), env.Id, lockId)
+}
+
+func getProjectEnv(c *ctx.ServiceContext, envId models.Id) (*models.Env, e.Error) {
+	return services.GetEnvById(c.DB().Where("project_id = ?", c.ProjectId), envId)
+}
+
+// getHostedStateEnv 获取 state 由平台托管的环境，只有托管的 state 会记录版本
+func getHostedStateEnv(c *ctx.ServiceContext, envId models.Id) (*models.Env, e.Error) {
+	env, er := getProjectEnv(c, envId)
+	if er != nil {
+		return nil, er
+	}
+	if !statebackend.IsHosted(env.StateBackend) {
+		return nil, e.New(e.EnvStateNotHosted, http.StatusBadRequest)
+	}
+	return env, nil
+}
+
+// SearchStateVersion 查询环境 state 版本列表
+func SearchStateVersion(c *ctx.ServiceContext, form *forms.SearchStateVersionForm) (interface{}, e.Error) {
+	env, er := getHostedStateEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+
+	query := services.QueryStateVersion(c.DB(), env.Id)
+	if form.SortField() == "" {
+		query = query.Order("created_at DESC, serial DESC")
+	} else {
+		query = form.Order(query)
+	}
+
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	versions := make([]*models.StateVersion, 0)
+	if err := p.Scan(&versions); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     versions,
+	}, nil
+}
+
+// GetStateVersion 获取环境 state 版本详情(包含 state 内容)
+func GetStateVersion(c *ctx.ServiceContext, form *forms.StateVersionParam) (*models.StateVersion, e.Error) {
+	env, er := getHostedStateEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	return services.GetStateVersionById(c.DB(), env.Id, form.VersionId)
+}
+
+// StateVersionDiff 对比 state 版本与基准版本的差异，未指定基准版本时与上一个版本对比
+func StateVersionDiff(c *ctx.ServiceContext, form *forms.StateVersionDiffForm) (*resps.StateVersionDiffResp, e.Error) {
+	env, er := getHostedStateEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	version, er := services.GetStateVersionById(c.DB(), env.Id, form.VersionId)
+	if er != nil {
+		return nil, er
+	}
+
+	var base *models.StateVersion
+	if form.Target != "" {
+		base, er = services.GetStateVersionById(c.DB(), env.Id, form.Target)
+	} else {
+		base, er = services.GetPreviousStateVersion(c.DB(), version)
+	}
+	if er != nil {
+		return nil, er
+	}
+
+	baseContent, baseId := []byte("{}"), ""
+	if base != nil {
+		baseContent, baseId = base.Content, string(base.Id)
+	}
+	diff, err := services.DiffStateContent(baseContent, version.Content)
+	if err != nil {
+		return nil, e.New(e.EnvStateBackendError, err)
+	}
+	diff.FromVersion = baseId
+	diff.ToVersion = string(version.Id)
+	return diff, nil
+}
+
+// StateVersionRollback 将环境 state 回滚到指定版本
+func StateVersionRollback(c *ctx.ServiceContext, form *forms.StateVersionParam) (*models.StateVersion, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("rollback env %s state to %s", form.Id, form.VersionId))
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	env, er := services.GetEnvById(tx.Where("project_id = ?", c.ProjectId), form.Id)
+	if er != nil {
+		_ = tx.Rollback()
+		return nil, er
+	}
+	version, er := services.GetStateVersionById(tx, env.Id, form.VersionId)
+	if er != nil {
+		_ = tx.Rollback()
+		return nil, er
+	}
+
+	newVersion, er := services.RollbackEnvState(tx, env, version, c.UserId)
+	if er != nil {
+		_ = tx.Rollback()
+		c.Logger().Errorf("rollback env state error: %v", er)
+		return nil, er
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+	return newVersion, nil
+}
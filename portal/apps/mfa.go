@@ -0,0 +1,181 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// mfaLoginResp 密码校验通过后，判断用户是否需要进行多因素认证，需要时返回 mfaToken，否则返回 nil
+func mfaLoginResp(c *ctx.ServiceContext, user *models.User) (*resps.LoginResp, e.Error) {
+	if user.MfaEnabled {
+		token, err := services.GenerateMfaPendingToken(user.Id, false)
+		if err != nil {
+			return nil, e.New(e.InternalError, err, http.StatusInternalServerError)
+		}
+		return &resps.LoginResp{MfaRequired: true, MfaToken: token}, nil
+	}
+
+	enforced, er := services.UserMfaEnforced(c.DB(), user)
+	if er != nil {
+		return nil, er
+	} else if !enforced {
+		return nil, nil
+	}
+	token, err := services.GenerateMfaPendingToken(user.Id, true)
+	if err != nil {
+		return nil, e.New(e.InternalError, err, http.StatusInternalServerError)
+	}
+	return &resps.LoginResp{MfaEnrollRequired: true, MfaToken: token}, nil
+}
+
+func getMfaPendingUser(c *ctx.ServiceContext, mfaToken string, enroll bool) (*models.User, e.Error) {
+	userId, er := services.VerifyMfaPendingToken(mfaToken, enroll)
+	if er != nil {
+		return nil, er
+	}
+	user, er := services.GetUserById(c.DB(), userId)
+	if er != nil {
+		return nil, e.New(e.MfaTokenInvalid, er, http.StatusUnauthorized)
+	}
+	if user.Status == consts.UserStatusDisable {
+		return nil, e.New(e.UserDisabled, http.StatusForbidden)
+	}
+	return user, nil
+}
+
+// LoginMfa 使用验证码或恢复码完成登录
+func LoginMfa(c *ctx.ServiceContext, form *forms.LoginMfaForm) (*resps.LoginResp, e.Error) {
+	user, er := getMfaPendingUser(c, form.MfaToken, false)
+	if er != nil {
+		return nil, er
+	}
+	c.AddLogField("action", fmt.Sprintf("user mfa login: %s", user.Email))
+
+	if er := services.VerifyUserMfa(c.DB(), user, form.Code); er != nil {
+		return nil, er
+	}
+	return issueLoginToken(c, user)
+}
+
+// MfaEnroll 被要求启用多因素认证的用户在登录时绑定认证器
+func MfaEnroll(c *ctx.ServiceContext, form *forms.MfaEnrollForm) (*resps.MfaEnrollResp, e.Error) {
+	user, er := getMfaPendingUser(c, form.MfaToken, true)
+	if er != nil {
+		return nil, er
+	}
+	return startMfaEnroll(c, user)
+}
+
+// MfaEnrollConfirm 确认绑定认证器并完成登录
+func MfaEnrollConfirm(c *ctx.ServiceContext, form *forms.MfaEnrollConfirmForm) (*resps.MfaEnrollConfirmResp, e.Error) {
+	user, er := getMfaPendingUser(c, form.MfaToken, true)
+	if er != nil {
+		return nil, er
+	}
+	codes, er := confirmMfaEnroll(c, user, form.Code)
+	if er != nil {
+		return nil, er
+	}
+	login, er := issueLoginToken(c, user)
+	if er != nil {
+		return nil, er
+	}
+	return &resps.MfaEnrollConfirmResp{RecoveryCodes: codes, Token: login.Token}, nil
+}
+
+// SelfMfaEnroll 登录用户绑定认证器
+func SelfMfaEnroll(c *ctx.ServiceContext) (*resps.MfaEnrollResp, e.Error) {
+	user, er := services.GetUserById(c.DB(), c.UserId)
+	if er != nil {
+		return nil, er
+	}
+	return startMfaEnroll(c, user)
+}
+
+// SelfMfaEnrollConfirm 登录用户确认绑定认证器
+func SelfMfaEnrollConfirm(c *ctx.ServiceContext, form *forms.MfaCodeForm) (*resps.MfaEnrollConfirmResp, e.Error) {
+	user, er := services.GetUserById(c.DB(), c.UserId)
+	if er != nil {
+		return nil, er
+	}
+	codes, er := confirmMfaEnroll(c, user, form.Code)
+	if er != nil {
+		return nil, er
+	}
+	return &resps.MfaEnrollConfirmResp{RecoveryCodes: codes}, nil
+}
+
+// SelfMfaDisable 登录用户关闭多因素认证，被要求启用多因素认证的用户不能关闭
+func SelfMfaDisable(c *ctx.ServiceContext, form *forms.MfaCodeForm) (interface{}, e.Error) {
+	c.AddLogField("action", "disable mfa")
+	user, er := services.GetUserById(c.DB(), c.UserId)
+	if er != nil {
+		return nil, er
+	}
+	if enforced, er := services.UserMfaEnforced(c.DB(), user); er != nil {
+		return nil, er
+	} else if enforced {
+		return nil, e.New(e.MfaEnforced, http.StatusBadRequest)
+	}
+	if er := services.VerifyUserMfa(c.DB(), user, form.Code); er != nil {
+		return nil, er
+	}
+	if er := services.ResetUserMfa(c.DB(), user.Id); er != nil {
+		return nil, er
+	}
+
+	services.InsertUserOperateLog(c.UserId, "", user.Id, consts.OperatorObjectTypeUser, "disable_mfa", "", nil)
+	return nil, nil
+}
+
+// ResetUserMfa 平台管理员重置用户的多因素认证，用于用户丢失认证器及恢复码的情况
+func ResetUserMfa(c *ctx.ServiceContext, form *forms.DetailUserForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("reset user mfa %s", form.Id))
+	if form.Id == consts.SysUserId {
+		return nil, e.New(e.PermissionDeny, fmt.Errorf("modify sys user denied"), http.StatusForbidden)
+	} else if !c.IsSuperAdmin {
+		return nil, e.New(e.PermissionDeny, http.StatusForbidden)
+	}
+
+	user, er := services.GetUserById(c.DB(), form.Id)
+	if er != nil && er.Code() == e.UserNotExists {
+		return nil, e.New(er.Code(), er, http.StatusBadRequest)
+	} else if er != nil {
+		return nil, er
+	}
+	if er := services.ResetUserMfa(c.DB(), user.Id); er != nil {
+		return nil, er
+	}
+
+	services.InsertUserOperateLog(c.UserId, "", user.Id, consts.OperatorObjectTypeUser, "reset_mfa", "", nil)
+	return nil, nil
+}
+
+func startMfaEnroll(c *ctx.ServiceContext, user *models.User) (*resps.MfaEnrollResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("enroll mfa: %s", user.Email))
+	secret, url, er := services.StartMfaEnroll(c.DB(), user)
+	if er != nil {
+		return nil, er
+	}
+	return &resps.MfaEnrollResp{Secret: secret, Url: url}, nil
+}
+
+func confirmMfaEnroll(c *ctx.ServiceContext, user *models.User, code string) ([]string, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("confirm mfa enrollment: %s", user.Email))
+	codes, er := services.ConfirmMfaEnroll(c.DB(), user, code)
+	if er != nil {
+		return nil, er
+	}
+
+	services.InsertUserOperateLog(user.Id, "", user.Id, consts.OperatorObjectTypeUser, "enable_mfa", "", nil)
+	return codes, nil
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"cloudiac/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	oidcDefaultRedirect = "/"
+	oidcLoginPage       = "/login"
+	oidcRequestTimeout  = 30 * time.Second
+)
+
+// OidcConfig 返回登录页面需要的 oidc 配置
+func OidcConfig(c *ctx.ServiceContext) (*resps.OidcConfigResp, e.Error) {
+	conf := configs.Get()
+	return &resps.OidcConfigResp{
+		Enabled:      conf.OidcEnabled(),
+		ProviderName: conf.Oidc.ProviderName,
+	}, nil
+}
+
+// OidcLogin 生成 oidc 登录请求，返回 IdP 的认证地址及需要保存到 cookie 中的登录请求信息
+func OidcLogin(c *ctx.ServiceContext, form *forms.OidcLoginForm) (authUrl string, authReq string, er e.Error) {
+	if !configs.Get().OidcEnabled() {
+		return "", "", e.New(e.OidcNotEnabled, http.StatusBadRequest)
+	}
+
+	req := services.NewOidcAuthRequest(oidcSafeRedirect(form.Redirect))
+	ctx, cancel := context.WithTimeout(context.Background(), oidcRequestTimeout)
+	defer cancel()
+	authUrl, err := services.OidcAuthCodeURL(ctx, req)
+	if err != nil {
+		c.Logger().Errorf("get oidc auth url error: %v", err)
+		return "", "", e.New(e.OidcLoginFailed, err, http.StatusInternalServerError)
+	}
+	authReq, err = services.EncodeOidcAuthRequest(req)
+	if err != nil {
+		return "", "", e.New(e.InternalError, err, http.StatusInternalServerError)
+	}
+	return authUrl, authReq, nil
+}
+
+// OidcCallback 处理 IdP 的回调，登录成功后跳转到登录请求指定的页面，并在地址中附带用于换取 token 的 oidcCode 参数，
+// 登录失败时跳转到登录页面，并在地址中附带错误码 oidcError 参数
+func OidcCallback(c *ctx.ServiceContext, form *forms.OidcCallbackForm, authReq string) string {
+	code, redirect, er := oidcCallback(c, form, authReq)
+	if er != nil {
+		c.Logger().Warnf("oidc login failed: %v", er)
+		return oidcRedirectUrl(oidcLoginPage, "oidcError", fmt.Sprintf("%d", er.Code()))
+	}
+	return oidcRedirectUrl(redirect, "oidcCode", code)
+}
+
+func oidcCallback(c *ctx.ServiceContext, form *forms.OidcCallbackForm, authReq string) (code string, redirect string, er e.Error) {
+	if !configs.Get().OidcEnabled() {
+		return "", "", e.New(e.OidcNotEnabled, http.StatusBadRequest)
+	}
+	if form.Error != "" {
+		return "", "", e.New(e.OidcLoginFailed, fmt.Errorf("%s: %s", form.Error, form.ErrorDescription))
+	}
+
+	req, err := services.DecodeOidcAuthRequest(authReq)
+	if err != nil {
+		return "", "", e.New(e.OidcStateInvalid, err)
+	}
+	if form.State == "" || form.State != req.State {
+		return "", "", e.New(e.OidcStateInvalid, fmt.Errorf("state mismatch"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oidcRequestTimeout)
+	defer cancel()
+	info, err := services.OidcExchange(ctx, req, form.Code)
+	if err != nil {
+		return "", "", e.New(e.OidcLoginFailed, err)
+	}
+	c.AddLogField("action", fmt.Sprintf("user oidc login: %s", info.Email))
+
+	user, er := services.GetUserByOidcIdentity(c.DB(), info.Issuer, info.Subject)
+	if er != nil && er.Code() == e.UserNotExists {
+		user, er = linkOidcUser(c, info)
+	}
+	if er != nil {
+		return "", "", er
+	}
+	if user.Status == consts.UserStatusDisable {
+		return "", "", e.New(e.UserDisabled)
+	}
+	if user.ActiveStatus == consts.UserEmailINActivate {
+		return "", "", e.New(e.InvalidActiveEmail)
+	}
+
+	if er := refreshOidcUserRole(c, user, info.Groups); er != nil {
+		return "", "", er
+	}
+
+	code, err = services.GenerateOidcLoginCode(c.DB(), user.Id)
+	if err != nil {
+		return "", "", e.New(e.InternalError, err)
+	}
+
+	// 记录操作日志
+	services.InsertUserOperateLog(user.Id, "", user.Id, consts.OperatorObjectTypeUser, "login", "", nil)
+
+	return code, req.Redirect, nil
+}
+
+// linkOidcUser 首次通过 oidc 登录时绑定用户，邮箱不存在时创建新用户。
+// 同邮箱的已有用户(包括管理员)只有在管理员允许后才能绑定，避免 IdP 中的同邮箱账号接管该用户
+func linkOidcUser(c *ctx.ServiceContext, info *services.OidcUserInfo) (*models.User, e.Error) {
+	user, er := services.GetUserByEmail(c.DB(), info.Email)
+	if er != nil && er.Code() == e.UserNotExists {
+		name := []rune(info.Name)
+		if len(name) > 32 {
+			name = name[:32]
+		}
+		return services.CreateUser(c.DB(), models.User{
+			Name:        string(name),
+			Email:       info.Email,
+			OidcIssuer:  info.Issuer,
+			OidcSubject: info.Subject,
+		})
+	} else if er != nil {
+		return nil, er
+	}
+
+	if !user.OidcLinkAllowed {
+		return nil, e.New(e.OidcUserNotLinked, fmt.Errorf("user '%s' is not allowed to link oidc identity", user.Email))
+	}
+	if er := services.LinkUserOidc(c.DB(), user.Id, info.Issuer, info.Subject); er != nil {
+		return nil, er
+	}
+	services.InsertUserOperateLog(user.Id, "", user.Id, consts.OperatorObjectTypeUser, "link_oidc", "", nil)
+	return user, nil
+}
+
+// SetUserOidcLink 允许或禁止用户绑定 oidc 身份，需要平台管理员权限，修改后用户已绑定的身份失效
+func SetUserOidcLink(c *ctx.ServiceContext, form *forms.UserOidcLinkForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("set user oidc link %s: %v", form.Id, form.Allowed))
+	if form.Id == consts.SysUserId {
+		return nil, e.New(e.PermissionDeny, fmt.Errorf("modify sys user denied"), http.StatusForbidden)
+	} else if !c.IsSuperAdmin {
+		return nil, e.New(e.PermissionDeny, http.StatusForbidden)
+	}
+
+	user, er := services.GetUserById(c.DB(), form.Id)
+	if er != nil && er.Code() == e.UserNotExists {
+		return nil, e.New(er.Code(), er, http.StatusBadRequest)
+	} else if er != nil {
+		return nil, er
+	}
+	if er := services.SetUserOidcLinkAllowed(c.DB(), user.Id, form.Allowed); er != nil {
+		return nil, er
+	}
+
+	services.InsertUserOperateLog(c.UserId, "", user.Id, consts.OperatorObjectTypeUser, "set_oidc_link", "", nil)
+	return nil, nil
+}
+
+func refreshOidcUserRole(c *ctx.ServiceContext, user *models.User, groups []string) (er e.Error) {
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	c.Logger().Debugf("refresh oidc user roles, groups: %v", groups)
+	if er := services.RefreshUserOidcRoles(tx, user.Id, groups); er != nil {
+		_ = tx.Rollback()
+		return er
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// OidcToken 使用 oidc 登录成功后得到的 code 换取用户 token
+func OidcToken(c *ctx.ServiceContext, form *forms.OidcTokenForm) (*resps.LoginResp, e.Error) {
+	userId, er := services.ConsumeOidcLoginCode(c.DB(), form.Code)
+	if er != nil {
+		return nil, er
+	}
+	user, er := services.GetUserById(c.DB(), userId)
+	if er != nil {
+		return nil, er
+	}
+	if user.Status == consts.UserStatusDisable {
+		return nil, e.New(e.UserDisabled, http.StatusForbidden)
+	}
+
+	// 与密码登录一致，启用或者被要求启用多因素认证的用户需要再完成一次验证
+	if data, er := mfaLoginResp(c, user); er != nil {
+		return nil, er
+	} else if data != nil {
+		return data, nil
+	}
+
+	token, err := services.GenerateToken(user.Id, user.Name, user.IsAdmin, 1*24*time.Hour)
+	if err != nil {
+		c.Logger().Errorf("name [%s] generateToken error: %v", user.Email, err)
+		return nil, e.New(e.InternalError, err, http.StatusInternalServerError)
+	}
+	return &resps.LoginResp{Token: token}, nil
+}
+
+// oidcSafeRedirect 只允许跳转到站内页面，避免被用作开放重定向
+func oidcSafeRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.Contains(redirect, "\\") {
+		return oidcDefaultRedirect
+	}
+	return redirect
+}
+
+func oidcRedirectUrl(path string, key, value string) string {
+	u, err := url.Parse(utils.JoinURL(configs.Get().Portal.Address, oidcSafeRedirect(path)))
+	if err != nil {
+		return oidcLoginPage
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// SearchOidcGroupRole 查询组织下的 oidc 用户组角色映射
+func SearchOidcGroupRole(c *ctx.ServiceContext, form *forms.SearchOidcGroupRoleForm) (interface{}, e.Error) {
+	query := services.SearchOidcGroupRole(c.DB(), c.OrgId, form.ProjectId, form.Q)
+	return getPage(query, form, models.OidcGroupRole{})
+}
+
+// CreateOidcGroupRole 创建 oidc 用户组角色映射，用户下次通过 oidc 登录时生效
+func CreateOidcGroupRole(c *ctx.ServiceContext, form *forms.CreateOidcGroupRoleForm) (*models.OidcGroupRole, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create oidc group role %s", form.Group))
+
+	if form.ProjectId == "" {
+		if er := services.ValidOrgRole(c.DB(), c.OrgId, form.Role,
+			consts.OrgRoleAdmin, "complianceManager", consts.OrgRoleMember); er != nil {
+			return nil, er
+		}
+	} else {
+		if er := services.ValidProjectRole(c.DB(), c.OrgId, form.Role); er != nil {
+			return nil, er
+		}
+		project, er := services.DetailProject(c.DB(), form.ProjectId)
+		if er != nil || project.OrgId != c.OrgId {
+			return nil, e.New(e.ProjectNotExists, http.StatusBadRequest)
+		}
+	}
+
+	return services.CreateOidcGroupRole(c.DB(), models.OidcGroupRole{
+		OrgId:     c.OrgId,
+		ProjectId: form.ProjectId,
+		Group:     form.Group,
+		Role:      form.Role,
+	})
+}
+
+// DeleteOidcGroupRole 删除 oidc 用户组角色映射
+func DeleteOidcGroupRole(c *ctx.ServiceContext, form *forms.DeleteOidcGroupRoleForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete oidc group role %s", form.Id))
+	return nil, services.DeleteOidcGroupRole(c.DB(), c.OrgId, form.Id)
+}
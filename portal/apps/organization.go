@@ -132,6 +132,22 @@ func UpdateOrganization(c *ctx.ServiceContext, form *forms.UpdateOrganizationFor
 		attrs["runner_id"] = form.RunnerId
 	}
 
+	if form.HasKey("stateBackend") {
+		attrs["state_backend"] = form.StateBackend
+	}
+
+	if form.HasKey("mfaRequired") {
+		attrs["mfa_required"] = form.MfaRequired
+	}
+
+	if form.HasKey("queueWeight") {
+		// 调度权重影响所有组织的任务调度，只有平台管理员可以调整
+		if !c.IsSuperAdmin {
+			return nil, e.New(e.PermissionDeny, http.StatusForbidden)
+		}
+		attrs["queue_weight"] = form.QueueWeight
+	}
+
 	// 变更组织状态
 	if form.HasKey("status") {
 		if _, err := ChangeOrgStatus(c, &forms.DisableOrganizationForm{Id: form.Id, Status: form.Status}); err != nil {
@@ -280,8 +296,8 @@ func AddUserOrgRel(c *ctx.ServiceContext, form *forms.AddUserOrgRelForm) (*resps
 		query = query.Where(fmt.Sprintf("%s.id in (?)", models.User{}.TableName()), userIds)
 	}
 
-	if form.Role != consts.OrgRoleMember && form.Role != consts.OrgRoleAdmin {
-		return nil, e.New(e.InvalidRoleName, http.StatusBadRequest)
+	if er := services.ValidOrgRole(c.DB(), form.Id, form.Role, consts.OrgRoleMember, consts.OrgRoleAdmin); er != nil {
+		return nil, er
 	}
 	user, err := services.GetUserById(query, form.UserId)
 	if err != nil && err.Code() == e.UserNotExists {
@@ -319,6 +335,10 @@ func UpdateUserOrgRel(c *ctx.ServiceContext, form *forms.UpdateUserOrgRelForm) (
 		userIds, _ := services.GetUserIdsByOrg(c.DB(), c.OrgId)
 		query = query.Where(fmt.Sprintf("%s.id in (?)", models.User{}.TableName()), userIds)
 	}
+	if er := services.ValidOrgRole(c.DB(), c.OrgId, form.Role,
+		consts.OrgRoleAdmin, "complianceManager", consts.OrgRoleMember); er != nil {
+		return nil, er
+	}
 	user, err := services.GetUserById(query, form.UserId)
 	if err != nil && err.Code() == e.UserNotExists {
 		return nil, e.New(err.Code(), err, http.StatusBadRequest)
@@ -453,6 +473,10 @@ func InviteUser(c *ctx.ServiceContext, form *forms.InviteUserForm) (*resps.UserW
 	if form.Role == "" {
 		form.Role = consts.OrgRoleMember
 	}
+	if er := services.ValidOrgRole(c.DB(), org.Id, form.Role,
+		consts.OrgRoleAdmin, "complianceManager", consts.OrgRoleMember); er != nil {
+		return nil, er
+	}
 
 	if !c.IsSuperAdmin {
 		ok, er := services.HasInviteUserPerm(c.DB(), c.UserId, org.Id, form.Role)
@@ -579,6 +603,10 @@ func UpdateUserOrg(c *ctx.ServiceContext, form *forms.UpdateUserOrgForm) (userRe
 		userIds, _ := services.GetUserIdsByOrg(tx, c.OrgId)
 		query = query.Where(fmt.Sprintf("%s.id in (?)", models.User{}.TableName()), userIds)
 	}
+	if err := services.ValidOrgRole(tx, c.OrgId, form.Role,
+		consts.OrgRoleAdmin, "complianceManager", consts.OrgRoleMember); err != nil {
+		return nil, err
+	}
 	user, err := services.GetUserById(query, form.UserId)
 	if err != nil && err.Code() == e.UserNotExists {
 		return nil, e.New(err.Code(), err, http.StatusBadRequest)
@@ -106,6 +106,7 @@ func ScanTemplateOrEnv(c *ctx.ServiceContext, form *forms.ScanTemplateForm, envI
 				Type:        taskType,
 				StepTimeout: common.DefaultTaskStepTimeout,
 				RunnerId:    runnerId,
+				AutoRunner:  true, // 使用默认 runner，任务开始执行前根据 runner 负载重新选择
 			},
 		})
 	}
@@ -813,6 +814,10 @@ func PolicyTest(c *ctx.ServiceContext, form *forms.PolicyTestForm) (*resps.Polic
 		}, nil
 	}
 
+	if form.InputType == models.PolicyInputTypePlan {
+		return planPolicyTest(form.Rego, value), nil
+	}
+
 	tmpDir, err := os.MkdirTemp("", "*")
 	if err != nil {
 		return nil, e.New(e.InternalError, errors.Wrapf(err, "create tmp dir"), http.StatusInternalServerError)
@@ -849,6 +854,29 @@ func PolicyTest(c *ctx.ServiceContext, form *forms.PolicyTestForm) (*resps.Polic
 	}
 }
 
+// planPolicyTest 测试执行计划策略，input 与任务执行时的策略输入格式一致
+func planPolicyTest(rego string, input interface{}) *resps.PolicyTestResp {
+	result, err := policy.EvalRego("policy", rego, input)
+	if err != nil {
+		return &resps.PolicyTestResp{
+			Data:         map[string]interface{}{},
+			Error:        err.Error(),
+			PolicyStatus: common.PolicyStatusFailed,
+		}
+	}
+
+	status := common.PolicyStatusPassed
+	if len(result) > 0 {
+		status = common.PolicyStatusViolated
+	} else {
+		result = []interface{}{}
+	}
+	return &resps.PolicyTestResp{
+		Data:         result,
+		PolicyStatus: status,
+	}
+}
+
 type PieCharPercent []PieSectorPercent
 
 type PieSectorPercent struct {
@@ -1108,7 +1136,9 @@ func policiesUpsert(tx *db.Session, userId models.Id, orgId models.Id, policyGro
 			PolicyType:    pm.Meta.PolicyType,
 			Tags:          pm.Meta.Category,
 
-			Rego: pm.Rego,
+			Rego:        pm.Rego,
+			InputType:   pm.Meta.InputType,
+			Enforcement: pm.Meta.Enforcement,
 		}
 		// 如果策略已经存在则更新已经存在的策略
 		op, _ := services.GetPolicyByName(tx, np.Name, policyGroup.Id, orgId)
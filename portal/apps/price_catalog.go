@@ -0,0 +1,71 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services/forecast/pricecalculator"
+	"net/http"
+	"os"
+)
+
+// SearchPriceCatalog 查询内置询价使用的价格目录
+func SearchPriceCatalog(c *ctx.ServiceContext) (interface{}, e.Error) {
+	infos, err := pricecalculator.GetCatalogSource().List()
+	if err != nil {
+		return nil, e.New(e.PriceCatalogInvalid, err, http.StatusInternalServerError)
+	}
+	return infos, nil
+}
+
+// PriceCatalogDetail 价格目录详情
+func PriceCatalogDetail(c *ctx.ServiceContext, form *forms.PriceCatalogParam) (*pricecalculator.Catalog, e.Error) {
+	catalog, err := pricecalculator.GetCatalogSource().Get(form.Provider, form.Version)
+	if os.IsNotExist(err) {
+		return nil, e.New(e.PriceCatalogNotExist, http.StatusNotFound)
+	} else if err != nil {
+		return nil, e.New(e.PriceCatalogInvalid, err, http.StatusInternalServerError)
+	}
+	return catalog, nil
+}
+
+// UploadPriceCatalog 上传价格目录，云商及版本相同时覆盖原有的价格目录
+func UploadPriceCatalog(c *ctx.ServiceContext, form *forms.UploadPriceCatalogForm) (interface{}, e.Error) {
+	c.AddLogField("action", "upload price catalog")
+
+	if _, err := pricecalculator.ParseCatalog([]byte(form.Content)); err != nil {
+		return nil, e.New(e.PriceCatalogInvalid, err, http.StatusBadRequest)
+	}
+	catalog, err := pricecalculator.GetCatalogSource().Save([]byte(form.Content), form.Format)
+	if err != nil {
+		return nil, e.New(e.InternalError, err, http.StatusInternalServerError)
+	}
+
+	c.Logger().Infof("price catalog %s/%s uploaded", catalog.Provider, catalog.Version)
+
+	infos, err := pricecalculator.GetCatalogSource().List()
+	if err != nil {
+		return nil, e.New(e.PriceCatalogInvalid, err, http.StatusInternalServerError)
+	}
+	for _, info := range infos {
+		if info.Provider == catalog.Provider && info.Version == catalog.Version {
+			return info, nil
+		}
+	}
+	return nil, e.New(e.PriceCatalogNotExist, http.StatusInternalServerError)
+}
+
+// DeletePriceCatalog 删除价格目录
+func DeletePriceCatalog(c *ctx.ServiceContext, form *forms.PriceCatalogParam) (interface{}, e.Error) {
+	c.AddLogField("action", "delete price catalog")
+
+	err := pricecalculator.GetCatalogSource().Delete(form.Provider, form.Version)
+	if os.IsNotExist(err) {
+		return nil, e.New(e.PriceCatalogNotExist, http.StatusNotFound)
+	} else if err != nil {
+		return nil, e.New(e.InternalError, err, http.StatusInternalServerError)
+	}
+	return nil, nil
+}
@@ -242,6 +242,15 @@ func UpdateProject(c *ctx.ServiceContext, form *forms.UpdateProjectForm) (interf
 		attrs["status"] = form.Status
 	}
 
+	if form.HasKey("queueWeight") {
+		// 调度权重影响所有组织的任务调度，只有平台管理员可以调整
+		if !c.IsSuperAdmin {
+			_ = tx.Rollback()
+			return nil, e.New(e.PermissionDeny, http.StatusForbidden)
+		}
+		attrs["queue_weight"] = form.QueueWeight
+	}
+
 	project := &models.Project{}
 	project.Id = form.Id
 	err := services.UpdateProject(tx, project, attrs)
@@ -14,6 +14,9 @@ import (
 )
 
 func CreateProjectUser(c *ctx.ServiceContext, form *forms.CreateProjectUserForm) (interface{}, e.Error) {
+	if er := services.ValidProjectRole(c.DB(), c.OrgId, form.Role); er != nil {
+		return nil, er
+	}
 	projectUser := make([]*models.UserProject, len(form.UserId))
 
 	// 检查用户是否属于本组织用户
@@ -89,6 +92,9 @@ func UpdateProjectUser(c *ctx.ServiceContext, form *forms.UpdateProjectUserForm)
 
 	attrs := models.Attrs{}
 	if form.HasKey("role") {
+		if er := services.ValidProjectRole(c.DB(), c.OrgId, form.Role); er != nil {
+			return nil, er
+		}
 		attrs["role"] = form.Role
 	}
 
@@ -9,8 +9,6 @@ import (
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/services"
 	runnerClear "cloudiac/runner"
-	"cloudiac/utils"
-	"net/http"
 )
 
 func ClearProviderCache(c *ctx.ServiceContext, form *forms.ClearProviderCacheForm) (interface{}, e.Error) {
@@ -21,16 +19,13 @@ func ClearProviderCache(c *ctx.ServiceContext, form *forms.ClearProviderCacheFor
 
 	for _, runner := range runners {
 
-		requestUrl := utils.JoinURL(runner.Address, consts.RunnerClearProviderCache)
 		req := runnerClear.RunClearProviderCacheReq{
 			Source:  form.Source,
 			Version: form.Version,
 		}
 
-		header := &http.Header{}
-		header.Set("Content-Type", "application/json")
 		timeout := int(consts.RunnerConnectTimeout.Seconds())
-		_, err := utils.HttpService(requestUrl, "POST", header, req, timeout, timeout)
+		_, err := services.RunnerPost(runner.Address, consts.RunnerClearProviderCache, req, timeout, timeout)
 		if err != nil {
 			return nil, e.New(e.RunnerError, err)
 		}
@@ -0,0 +1,85 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"fmt"
+	"time"
+)
+
+const defaultDriftTrendDays = 30
+
+// SearchEnvDrift 查询环境的资源属性漂移记录
+func SearchEnvDrift(c *ctx.ServiceContext, form *forms.SearchEnvDriftForm) (interface{}, e.Error) {
+	env, er := getProjectEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	query := services.SearchEnvDriftRecord(c.DB(), env.Id, form.Status, form.Q)
+	return getPage(query, form, models.ResourceDriftRecord{})
+}
+
+// UpdateEnvDrift 确认或者忽略资源属性的漂移
+func UpdateEnvDrift(c *ctx.ServiceContext, form *forms.UpdateEnvDriftForm) (*models.ResourceDriftRecord, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update env drift %s %s", form.DriftId, form.Status))
+
+	env, er := getProjectEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	r, er := services.GetDriftRecordById(c.DB(), env.Id, form.DriftId)
+	if er != nil {
+		return nil, er
+	}
+	r, er = services.UpdateDriftRecordStatus(c.DB(), r, form.Status, c.UserId)
+	if er != nil {
+		return nil, er
+	}
+	services.InsertUserOperateLog(c.UserId, c.OrgId, env.Id, consts.OperatorObjectTypeEnv, "drift_"+form.Status, env.Name,
+		models.ResAttrs{"address": r.Address, "path": r.Path})
+	return r, nil
+}
+
+func driftTrendStart(days int) (time.Time, int) {
+	if days == 0 {
+		days = defaultDriftTrendDays
+	}
+	return time.Now().AddDate(0, 0, 1-days), days
+}
+
+// EnvDriftTrend 环境的漂移趋势
+func EnvDriftTrend(c *ctx.ServiceContext, form *forms.EnvDriftTrendForm) ([]resps.DriftTrendPoint, e.Error) {
+	env, er := getProjectEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	start, days := driftTrendStart(form.Days)
+	return services.GetDriftTrend(c.DB().Where("env_id = ?", env.Id), start, days)
+}
+
+// ProjectDriftTrend 项目的漂移趋势
+func ProjectDriftTrend(c *ctx.ServiceContext, form *forms.DriftTrendForm) ([]resps.DriftTrendPoint, e.Error) {
+	start, days := driftTrendStart(form.Days)
+	return services.GetDriftTrend(c.DB().Where("org_id = ? AND project_id = ?", c.OrgId, c.ProjectId), start, days)
+}
+
+// OrgDriftTrend 组织的漂移趋势，非组织管理员只统计有权限的项目
+func OrgDriftTrend(c *ctx.ServiceContext, form *forms.DriftTrendForm) ([]resps.DriftTrendPoint, e.Error) {
+	query := c.DB().Where("org_id = ?", c.OrgId)
+	if !c.IsSuperAdmin && !services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) {
+		projectIds := services.UserProjectIds(c.UserId, c.OrgId)
+		if len(projectIds) == 0 {
+			projectIds = []models.Id{""}
+		}
+		query = query.Where("project_id IN (?)", projectIds)
+	}
+	start, days := driftTrendStart(form.Days)
+	return services.GetDriftTrend(query, start, days)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"fmt"
+)
+
+// SearchRole 查询组织下的自定义角色
+func SearchRole(c *ctx.ServiceContext, form *forms.SearchRoleForm) (interface{}, e.Error) {
+	query := services.SearchRole(c.DB(), c.OrgId, form.Scope, form.Q)
+	return getPage(query, form, models.Role{})
+}
+
+// RolePermissions 自定义角色可以授予的权限列表
+func RolePermissions(c *ctx.ServiceContext, form *forms.RolePermissionsForm) ([]resps.RolePermissionResp, e.Error) {
+	return services.RolePermissions(form.Scope), nil
+}
+
+// DetailRole 自定义角色详情
+func DetailRole(c *ctx.ServiceContext, form *forms.DetailRoleForm) (*models.Role, e.Error) {
+	return services.GetRoleById(c.DB(), c.OrgId, form.Id)
+}
+
+// CreateRole 创建自定义角色
+func CreateRole(c *ctx.ServiceContext, form *forms.CreateRoleForm) (*models.Role, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create role %s", form.Name))
+
+	if er := services.ValidRolePermissions(form.Scope, form.Permissions); er != nil {
+		return nil, er
+	}
+	role, er := services.CreateRole(c.DB(), models.Role{
+		OrgId:       c.OrgId,
+		Name:        form.Name,
+		Scope:       form.Scope,
+		Description: form.Description,
+		Permissions: form.Permissions,
+	})
+	if er != nil {
+		return nil, er
+	}
+	reloadRolePolicies(c)
+	return role, nil
+}
+
+// UpdateRole 修改自定义角色，权限修改后立即生效
+func UpdateRole(c *ctx.ServiceContext, form *forms.UpdateRoleForm) (*models.Role, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update role %s", form.Id))
+
+	role, er := services.GetRoleById(c.DB(), c.OrgId, form.Id)
+	if er != nil {
+		return nil, er
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("name") {
+		attrs["name"] = form.Name
+	}
+	if form.HasKey("description") {
+		attrs["description"] = form.Description
+	}
+	if form.HasKey("permissions") {
+		if er := services.ValidRolePermissions(role.Scope, form.Permissions); er != nil {
+			return nil, er
+		}
+		attrs["permissions"] = models.StrSlice(form.Permissions)
+	}
+	if len(attrs) == 0 {
+		return role, nil
+	}
+
+	role, er = services.UpdateRole(c.DB(), c.OrgId, form.Id, attrs)
+	if er != nil {
+		return nil, er
+	}
+	reloadRolePolicies(c)
+	return role, nil
+}
+
+// DeleteRole 删除自定义角色
+func DeleteRole(c *ctx.ServiceContext, form *forms.DeleteRoleForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete role %s", form.Id))
+	if er := services.DeleteRole(c.DB(), c.OrgId, form.Id); er != nil {
+		return nil, er
+	}
+	reloadRolePolicies(c)
+	return nil, nil
+}
+
+// reloadRolePolicies 角色变更后立即更新当前实例的权限策略，其他实例通过定时同步更新
+func reloadRolePolicies(c *ctx.ServiceContext) {
+	if err := services.ReloadRolePolicies(c.DB()); err != nil {
+		c.Logger().Errorf("reload role policies error: %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"bytes"
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"cloudiac/runner/ws"
+	"cloudiac/utils"
+	"cloudiac/utils/runnerauth"
+	"cloudiac/utils/tunnel"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	runnerJoinTokenDefaultExpire = time.Hour
+	runnerAgentPingInterval      = services.RunnerAgentPingInterval
+)
+
+func checkRunnerAgentPerm(c *ctx.ServiceContext) e.Error {
+	if !c.IsSuperAdmin {
+		return e.New(e.PermissionDeny, fmt.Errorf("super admin required"), http.StatusForbidden)
+	}
+	return nil
+}
+
+// CreateRunnerJoinToken 创建 runner agent 注册令牌
+func CreateRunnerJoinToken(c *ctx.ServiceContext, form *forms.CreateRunnerJoinTokenForm) (interface{}, e.Error) {
+	if er := checkRunnerAgentPerm(c); er != nil {
+		return nil, er
+	}
+
+	expire := runnerJoinTokenDefaultExpire
+	if form.Expire > 0 {
+		expire = time.Duration(form.Expire) * time.Second
+	}
+	token, t, er := services.CreateRunnerJoinToken(c.DB(), c.UserId, form.Tags, expire)
+	if er != nil {
+		return nil, er
+	}
+	return &resps.RunnerJoinTokenResp{RunnerJoinToken: *t, Token: token}, nil
+}
+
+// SearchRunnerAgent 查询 runner agent 列表
+func SearchRunnerAgent(c *ctx.ServiceContext, form *forms.SearchRunnerAgentForm) (interface{}, e.Error) {
+	if er := checkRunnerAgentPerm(c); er != nil {
+		return nil, er
+	}
+
+	query := services.SearchRunnerAgent(c.DB(), form.Q)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	agents := make([]models.RunnerAgent, 0)
+	if err := p.Scan(&agents); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	return &page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     agents,
+	}, nil
+}
+
+// DeleteRunnerAgent 删除 runner agent，agent 需要重新使用注册令牌注册
+func DeleteRunnerAgent(c *ctx.ServiceContext, form *forms.DeleteRunnerAgentForm) (interface{}, e.Error) {
+	if er := checkRunnerAgentPerm(c); er != nil {
+		return nil, er
+	}
+
+	if _, er := services.GetRunnerAgent(c.DB(), form.Id); er != nil {
+		return nil, er
+	}
+	if er := services.DeleteRunnerAgent(c.DB(), form.Id); er != nil {
+		return nil, er
+	}
+	return nil, nil
+}
+
+// RunnerAgentJoin runner agent 使用注册令牌注册
+func RunnerAgentJoin(c *ctx.ServiceContext, form *forms.RunnerAgentJoinForm) (interface{}, e.Error) {
+	var (
+		agent  *models.RunnerAgent
+		secret string
+		er     e.Error
+	)
+	err := c.DB().Transaction(func(tx *db.Session) error {
+		agent, secret, er = services.JoinRunnerAgent(tx, form.Token, form.Name)
+		if er != nil {
+			return er
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, e.AutoNew(err, e.DBError)
+	}
+
+	c.Logger().Infof("runner agent %s(%s) joined", agent.Name, agent.Id)
+	return &resps.RunnerAgentJoinResp{RunnerId: agent.Id.String(), Secret: secret}, nil
+}
+
+// RunnerAgentConnect 处理 agent 的 websocket 连接，连接断开前不会返回
+func RunnerAgentConnect(c *ctx.GinRequest) e.Error {
+	sc := c.Service()
+	runnerId := c.GetHeader(tunnel.HeaderRunnerId)
+	logger := c.Logger().WithField("runnerId", runnerId)
+
+	if _, er := services.AuthRunnerAgent(sc.DB(), runnerId, c.GetHeader(tunnel.HeaderRunnerSecret)); er != nil {
+		return er
+	}
+
+	conn, err := ws.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 失败时已返回了错误响应
+		logger.Warnf("upgrade runner agent connection: %v", err)
+		return nil
+	}
+
+	sess := tunnel.NewSession(conn)
+	services.RegisterRunnerAgentSession(runnerId, sess)
+	slots, _ := strconv.Atoi(c.GetHeader(tunnel.HeaderRunnerSlots))
+	if er := services.UpdateRunnerAgentStatus(sc.DB(), runnerId, models.RunnerAgentOnline, models.Attrs{
+		"slots":   slots,
+		"version": c.GetHeader(tunnel.HeaderRunnerVersion),
+	}); er != nil {
+		logger.Errorf("update runner agent status: %v", er)
+	}
+	logger.Infof("runner agent connected")
+
+	// 定时发送 ping，超过 3 个周期未收到 pong 则认为连接已断开
+	_ = conn.SetReadDeadline(time.Now().Add(3 * runnerAgentPingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(3 * runnerAgentPingInterval))
+	})
+	go func() {
+		ticker := time.NewTicker(runnerAgentPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sess.Done():
+				return
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)); err != nil {
+					sess.Close()
+					return
+				}
+				if er := services.TouchRunnerAgent(sc.DB(), runnerId); er != nil {
+					logger.Warnf("touch runner agent: %v", er)
+				}
+			}
+		}
+	}()
+
+	err = sess.Serve()
+	logger.Infof("runner agent disconnected: %v", err)
+	if services.UnregisterRunnerAgentSession(runnerId, sess) {
+		if er := services.UpdateRunnerAgentStatus(sc.DB(), runnerId, models.RunnerAgentOffline, nil); er != nil {
+			logger.Errorf("update runner agent status: %v", er)
+		}
+	}
+	return nil
+}
+
+// RunnerAgentProxy 将 runner api 请求通过当前实例持有的 agent 连接转发到 runner。
+// 请求需要使用 runner api 密钥签名，签名路径为 runner api 的路径(即 urlPath)
+func RunnerAgentProxy(c *ctx.GinRequest, runnerId string, urlPath string) e.Error {
+	sess := services.GetRunnerAgentSession(runnerId)
+	if sess == nil {
+		return e.New(e.RunnerAgentNotConnected, http.StatusBadGateway)
+	}
+
+	body, er := VerifyRunnerRequest(c, urlPath)
+	if er != nil {
+		return er
+	}
+
+	req := &tunnel.Message{
+		Method: c.Request.Method,
+		Path:   urlPath,
+		Query:  c.Request.URL.RawQuery,
+		Header: http.Header{},
+		Body:   body,
+	}
+	for _, k := range []string{runnerauth.HeaderTimestamp, runnerauth.HeaderNonce, runnerauth.HeaderSignature,
+		"Content-Type"} {
+		if v := c.GetHeader(k); v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		return proxyRunnerAgentStream(c, sess, req)
+	}
+
+	resp, err := sess.Do(c.Request.Context(), req)
+	if err != nil {
+		return e.New(e.RunnerAgentNotConnected, err, http.StatusBadGateway)
+	}
+	writeTunnelResponse(c, resp)
+	return nil
+}
+
+// VerifyRunnerRequest 校验使用 runner api 密钥签名的请求，urlPath 为签名使用的路径，返回请求的 body
+func VerifyRunnerRequest(c *ctx.GinRequest, urlPath string) ([]byte, e.Error) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, e.New(e.BadParam, err, http.StatusBadRequest)
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	signed := c.Request.Clone(c.Request.Context())
+	signed.URL.Path = urlPath
+	if err := runnerauth.Verify(configs.Get().RunnerApiSecret, signed, body); err != nil {
+		return nil, e.New(e.InvalidToken, err, http.StatusUnauthorized)
+	}
+	return body, nil
+}
+
+func writeTunnelResponse(c *ctx.GinRequest, resp *tunnel.Message) {
+	body := resp.Body
+	if len(body) == 0 && resp.Error != "" {
+		body = []byte(resp.Error)
+	}
+	c.Data(resp.Status, resp.Header.Get("Content-Type"), body)
+	c.Abort()
+}
+
+func proxyRunnerAgentStream(c *ctx.GinRequest, sess *tunnel.Session, req *tunnel.Message) e.Error {
+	logger := c.Logger().WithField("func", "proxyRunnerAgentStream").WithField("path", req.Path)
+	rCtx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	stream, resp, err := sess.OpenStream(rCtx, req)
+	if err != nil {
+		return e.New(e.RunnerAgentNotConnected, err, http.StatusBadGateway)
+	}
+	if stream == nil {
+		writeTunnelResponse(c, resp)
+		return nil
+	}
+	defer stream.Close()
+
+	conn, err := ws.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		logger.Warnf("upgrade websocket: %v", err)
+		return nil
+	}
+	defer conn.Close()
+
+	// 调用方断开连接时关闭数据流
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		msg, err := stream.Recv(rCtx)
+		if err == context.Canceled {
+			return nil
+		} else if err != nil {
+			_ = utils.WebsocketCloseWithCode(conn, websocket.CloseGoingAway, err.Error())
+			return nil
+		}
+		if msg.Type == tunnel.MsgStreamClose {
+			_ = utils.WebsocketCloseWithCode(conn, msg.Status, msg.Error)
+			return nil
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, msg.Body); err != nil {
+			logger.Debugf("write message: %v", err)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// CreateStackRun 对项目下的多个环境发起批量编排
+func CreateStackRun(c *ctx.ServiceContext, form *forms.CreateStackRunForm) (*resps.StackRunResp, e.Error) {
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+	if form.AutoApprove && form.TaskType != models.TaskTypePlan {
+		if err := checkUserHasApprovalPerm(c); err != nil {
+			return nil, e.AutoNew(err, e.PermissionDeny)
+		}
+	}
+
+	envs := make([]*models.Env, 0, len(form.EnvIds))
+	if err := services.QueryWithProjectId(c.DB(), c.ProjectId).Model(&models.Env{}).
+		Where("id IN (?)", form.EnvIds).Find(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	for _, id := range form.EnvIds {
+		found := false
+		for _, env := range envs {
+			if env.Id == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, e.New(e.StackRunEnvInvalid, fmt.Errorf("env '%s' not exists in project", id), http.StatusBadRequest)
+		}
+	}
+	// 路由只检查了项目角色的部署权限，这里按每个环境的有效角色检查部署或销毁权限
+	act := "deploy"
+	if form.TaskType == models.TaskTypeDestroy {
+		act = "destroy"
+	}
+	for _, env := range envs {
+		if er := checkEnvRolePerm(c, env, act); er != nil {
+			return nil, er
+		}
+	}
+
+	run := models.StackRun{
+		OrgId:       c.OrgId,
+		ProjectId:   c.ProjectId,
+		CreatorId:   c.UserId,
+		Name:        form.Name,
+		TaskType:    form.TaskType,
+		Mode:        form.Mode,
+		AutoApprove: form.AutoApprove,
+	}
+	if run.Mode == "" {
+		run.Mode = models.StackRunModeFailFast
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if _, er := services.CreateStackRun(tx, &run, envs); er != nil {
+		_ = tx.Rollback()
+		return nil, er
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, c.ProjectId, consts.OperatorObjectTypeProject, "stack_run_"+run.TaskType, run.Name, nil)
+	return buildStackRunResp(c.DB(), &run)
+}
+
+func buildStackRunResp(sess *db.Session, run *models.StackRun) (*resps.StackRunResp, e.Error) {
+	items, er := services.GetStackRunTasks(sess, run.Id)
+	if er != nil {
+		return nil, er
+	}
+
+	resp := resps.StackRunResp{
+		StackRun: *run,
+		Tasks:    make([]resps.StackRunTaskItem, 0, len(items)),
+	}
+	for _, item := range items {
+		ti := resps.StackRunTaskItem{
+			EnvId:     item.EnvId,
+			TaskId:    item.TaskId,
+			DependsOn: make([]models.Id, 0, len(item.DependsOn)),
+		}
+		for _, id := range item.DependsOn {
+			ti.DependsOn = append(ti.DependsOn, models.Id(id))
+		}
+		if env, er := services.GetEnvById(sess, item.EnvId); er == nil {
+			ti.EnvName = env.Name
+		} else if er.Code() != e.EnvNotExists {
+			return nil, er
+		}
+		if task, er := services.GetTaskById(sess, item.TaskId); er == nil {
+			ti.TaskStatus = task.Status
+		} else if er.Code() != e.TaskNotExists {
+			return nil, er
+		}
+		resp.Tasks = append(resp.Tasks, ti)
+	}
+	return &resp, nil
+}
+
+// SearchStackRun 查询项目的批量编排记录
+func SearchStackRun(c *ctx.ServiceContext, form *forms.SearchStackRunForm) (interface{}, e.Error) {
+	query := services.QueryStackRuns(c.DB(), c.ProjectId)
+	if form.Status != "" {
+		query = query.Where("status = ?", form.Status)
+	}
+
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	runs := make([]*models.StackRun, 0)
+	if err := p.Scan(&runs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     runs,
+	}, nil
+}
+
+func getProjectStackRun(c *ctx.ServiceContext, id models.Id) (*models.StackRun, e.Error) {
+	return services.GetStackRunById(c.DB().Where("project_id = ?", c.ProjectId), id)
+}
+
+// StackRunDetail 批量编排详情，包含每个环境对应的任务
+func StackRunDetail(c *ctx.ServiceContext, form *forms.StackRunParam) (*resps.StackRunResp, e.Error) {
+	run, er := getProjectStackRun(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	return buildStackRunResp(c.DB(), run)
+}
+
+// ApproveStackRun 审批批量编排，审批结果对编排中所有任务的执行计划生效
+func ApproveStackRun(c *ctx.ServiceContext, form *forms.ApproveStackRunForm) (*resps.StackRunResp, e.Error) {
+	run, er := getProjectStackRun(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if er := services.ApproveStackRun(tx, run, form.Action, c.UserId); er != nil {
+		_ = tx.Rollback()
+		if er.Code() == e.StackRunNotApproving {
+			return nil, e.New(er.Code(), http.StatusConflict)
+		}
+		return nil, er
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+	return buildStackRunResp(c.DB(), run)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/stepbroker"
+	"cloudiac/runner"
+	"cloudiac/runner/ws"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stepLogSaveInterval 保存执行中步骤日志的间隔
+const stepLogSaveInterval = 5 * time.Second
+
+// RunnerStepEvents 接收 runner 推送的步骤事件并分发给订阅者，连接断开前不会返回。
+// 请求使用 runner api 密钥签名
+func RunnerStepEvents(c *ctx.GinRequest) e.Error {
+	runnerId := c.Query("runnerId")
+	if _, er := VerifyRunnerRequest(c, c.Request.URL.Path); er != nil {
+		return er
+	}
+	if runnerId == "" {
+		return e.New(e.BadParam, fmt.Errorf("runnerId is required"), http.StatusBadRequest)
+	}
+	logger := c.Logger().WithField("runnerId", runnerId).WithField("func", "RunnerStepEvents")
+
+	conn, err := ws.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 失败时已返回了错误响应
+		logger.Warnf("upgrade runner events connection: %v", err)
+		return nil
+	}
+	defer conn.Close()
+
+	broker := stepbroker.Get()
+	broker.RunnerConnected(runnerId)
+	defer broker.RunnerDisconnected(runnerId)
+	logger.Infof("runner step events connected")
+
+	// 定时发送 ping，超过 3 个周期未收到任何消息则认为连接已断开
+	_ = conn.SetReadDeadline(time.Now().Add(3 * runnerAgentPingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(3 * runnerAgentPingInterval))
+	})
+
+	eventCh := make(chan *runner.TaskStepEvent, 64)
+	go func() {
+		defer close(eventCh)
+		for {
+			ev := runner.TaskStepEvent{}
+			if err := conn.ReadJSON(&ev); err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					logger.Warnf("read runner event: %v", err)
+				}
+				return
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(3 * runnerAgentPingInterval))
+			eventCh <- &ev
+		}
+	}()
+
+	saver := services.NewStepLogSaver()
+	saveTicker := time.NewTicker(stepLogSaveInterval)
+	defer saveTicker.Stop()
+	pingTicker := time.NewTicker(runnerAgentPingInterval)
+	defer pingTicker.Stop()
+
+	for {
+		select {
+		case ev, ok := <-eventCh:
+			if !ok {
+				saver.Save(broker.TakeDirtyLogs(runnerId))
+				logger.Infof("runner step events disconnected")
+				return nil
+			}
+			if ev.IsExited() {
+				// 先保存日志再发布退出事件，保证步骤结束时写入的全量日志不会被覆盖
+				saver.Save(broker.TakeDirtyLogs(runnerId))
+				saver.Forget(ev.TaskId, ev.Step)
+			}
+			broker.Publish(runnerId, ev)
+		case <-saveTicker.C:
+			saver.Save(broker.TakeDirtyLogs(runnerId))
+		case <-pingTicker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)); err != nil {
+				logger.Debugf("write ping: %v", err)
+			}
+		}
+	}
+}
+
+// SubscribeRunnerStepEvents 响应其他 portal 实例转发的步骤事件订阅，请求使用 runner api 密钥签名。
+// 第一条消息为订阅时已收到的日志，之后依次推送步骤事件，订阅结束时断开连接
+func SubscribeRunnerStepEvents(c *ctx.GinRequest) e.Error {
+	if _, er := VerifyRunnerRequest(c, c.Request.URL.Path); er != nil {
+		return er
+	}
+	runnerId, taskId := c.Query("runnerId"), c.Query("taskId")
+	step, err := strconv.Atoi(c.Query("step"))
+	if err != nil || runnerId == "" || taskId == "" {
+		return e.New(e.BadParam, fmt.Errorf("runnerId, taskId and step are required"), http.StatusBadRequest)
+	}
+
+	sub := stepbroker.SubscribeLocal(runnerId, taskId, step)
+	if sub == nil {
+		return e.New(e.ObjectNotExists, fmt.Errorf("step events not available"), http.StatusNotFound)
+	}
+	defer sub.Close()
+
+	conn, err := ws.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 失败时已返回了错误响应
+		c.Logger().Warnf("upgrade step events subscription: %v", err)
+		return nil
+	}
+	defer conn.Close()
+
+	// 对方实例取消订阅时会断开连接
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := conn.WriteJSON(&runner.TaskStepEvent{Type: runner.TaskStepEventLog, Content: sub.Log}); err != nil {
+		return nil
+	}
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if err := conn.WriteJSON(ev); err != nil {
+				return nil
+			}
+		case <-closed:
+			return nil
+		}
+	}
+}
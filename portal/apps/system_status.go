@@ -3,9 +3,11 @@
 package apps
 
 import (
+	"cloudiac/common"
 	"cloudiac/configs"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/models/resps"
 	"cloudiac/portal/services"
@@ -61,8 +63,25 @@ func ConsulKVSearch(key string) (interface{}, e.Error) {
 	return services.ConsulKVSearch(key)
 }
 
-func RunnerSearch() (interface{}, e.Error) {
-	return services.RunnerSearch()
+func RunnerSearch(c *ctx.ServiceContext) (interface{}, e.Error) {
+	runners, er := services.RunnerSearch()
+	if er != nil {
+		return nil, er
+	}
+	loads, er := services.GetRunnerLoads(c.DB())
+	if er != nil {
+		return nil, er
+	}
+
+	resp := make([]resps.RunnerResp, 0, len(runners))
+	for _, r := range runners {
+		resp = append(resp, resps.RunnerResp{
+			AgentService: r,
+			Slots:        services.RunnerSlots(r),
+			Load:         loads[r.ID],
+		})
+	}
+	return resp, nil
 }
 
 func SystemSwitchStatus() (interface{}, e.Error) {
@@ -83,6 +102,13 @@ func ConsulTagUpdate(c *ctx.ServiceContext, form forms.ConsulTagUpdateForm) (int
 		return nil, e.New(e.PermissionDeny, fmt.Errorf("super admin required"), http.StatusForbidden)
 	}
 
+	// agent 模式的 runner 标签保存在数据库中
+	if services.IsRunnerAgent(form.ServiceId) {
+		return nil, services.UpdateRunnerAgentTags(c.DB(), models.Id(form.ServiceId), form.Tags)
+	} else if configs.Get().UseDBRegistry() {
+		return nil, services.UpdateServiceTags(c.DB(), form.ServiceId, form.Tags)
+	}
+
 	//将修改后的tag存到consul中
 	if err := services.ConsulKVSave(form.ServiceId, form.Tags); err != nil {
 		return nil, err
@@ -99,6 +125,29 @@ func ConsulTagUpdate(c *ctx.ServiceContext, form forms.ConsulTagUpdateForm) (int
 	return nil, nil
 }
 
+// UpdateRunnerTags 修改 runner tags，根据 runner 注册方式保存到 consul 或数据库
+func UpdateRunnerTags(c *ctx.ServiceContext, form *forms.UpdateRunnerTagsForm) (interface{}, e.Error) {
+	return ConsulTagUpdate(c, forms.ConsulTagUpdateForm{ServiceId: form.Id, Tags: form.Tags})
+}
+
+// RunnerHeartbeat 使用数据库作为注册中心时接收 runner 上报的心跳
+func RunnerHeartbeat(c *ctx.ServiceContext, form *forms.RunnerHeartbeatForm) (interface{}, e.Error) {
+	if !configs.Get().UseDBRegistry() {
+		return nil, e.New(e.BadRequest, fmt.Errorf("service registry is not db"), http.StatusBadRequest)
+	}
+
+	s := &models.ServiceInstance{
+		Service: common.RunnerServiceName,
+		Address: form.Address,
+		Port:    form.Port,
+		Tags:    form.Tags,
+		Slots:   form.Slots,
+		Version: form.Version,
+	}
+	s.Id = models.Id(form.Id)
+	return nil, services.ServiceHeartbeat(c.DB(), s)
+}
+
 func RunnerTags() (interface{}, e.Error) {
 	tags, err := services.SystemRunnerTags()
 	if err != nil {
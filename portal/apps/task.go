@@ -25,6 +25,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/sse"
 )
@@ -204,18 +205,42 @@ func ApproveTask(c *ctx.ServiceContext, form *forms.ApproveTaskForm) (interface{
 		return nil, e.New(e.TaskApproveNotPending, http.StatusBadRequest)
 	}
 
-	// 更新审批状态
-	step.ApproverId = c.UserId
-	switch form.Action {
-	case forms.TaskActionApproved:
-		err = services.ApproveTaskStep(c.DB(), task.Id, step.Index, c.UserId)
-	case forms.TaskActionRejected:
-		err = services.RejectTaskStep(c.DB(), task.Id, step.Index, c.UserId)
+	// 冻结期内或者变更窗口外只能通过紧急变更审批通过
+	override := false
+	if form.Action == forms.TaskActionApproved {
+		if form.EmergencyOverride {
+			if er := checkChangeWindowOverride(c, form.OverrideReason); er != nil {
+				return nil, er
+			}
+			override = true
+		} else if er := services.CheckTaskChangeWindow(c.DB(), task, time.Now()); er != nil {
+			return nil, er
+		}
 	}
-	if err != nil {
+
+	// 记录审批结果，审批人数满足要求后更新审批状态
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+	if _, err = services.VoteTaskStep(tx, task, step, c.UserId, form.Action, form.Comment); err != nil {
+		_ = tx.Rollback()
 		c.Logger().Errorf("error approve task, err %s", err)
 		return nil, err
 	}
+	if override && !task.ChangeWindowOverride {
+		if err = services.OverrideTaskChangeWindow(tx, task, c.UserId, form.OverrideReason); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
 
 	return nil, nil
 }
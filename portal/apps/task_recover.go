@@ -0,0 +1,132 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+func SearchTaskEvents(c *ctx.ServiceContext, form *forms.SearchTaskEventForm) (interface{}, e.Error) {
+	if _, er := services.GetTaskById(c.DB(), form.Id); er != nil {
+		return nil, e.New(er.Code(), er, http.StatusNotFound)
+	}
+
+	events := make([]*models.TaskEvent, 0)
+	if err := services.QueryTaskEvents(c.DB(), form.Id).Find(&events); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return events, nil
+}
+
+// RecoverTask 恢复执行变更步骤时 runner 失联的任务。
+// 恢复操作会发起一个 state 任务，先解除 state 锁再刷新 state，使 state 与实际的资源一致。
+// 使用 portal 托管 state 时自动获取锁 id，其他 backend 需要用户从任务日志中获取锁 id 后传入
+func RecoverTask(c *ctx.ServiceContext, form *forms.RecoverTaskForm) (*models.Task, e.Error) {
+	var (
+		env         *models.Env
+		recoverTask *models.Task
+	)
+	er := c.DB().Transaction(func(tx *db.Session) error {
+		task, er := services.GetTaskById(tx, form.Id)
+		if er != nil {
+			return e.New(er.Code(), er, http.StatusNotFound)
+		}
+		step, er := services.GetTaskStep(tx, task.Id, task.CurrStep)
+		if er != nil {
+			return er
+		}
+		if !step.IsLost() || services.IsReschedulableStep(step.Type) {
+			return e.New(e.TaskCannotRecover,
+				fmt.Errorf("task step %s status is '%s'", step, step.Status), http.StatusConflict)
+		}
+
+		env, er = envCheck(tx, c.OrgId, c.ProjectId, task.EnvId, c.Logger())
+		if er != nil {
+			return er
+		}
+		if env.Locked {
+			return e.New(e.EnvLocked, http.StatusBadRequest)
+		}
+		// 只有环境最后一次执行的任务需要恢复，之后的任务已经重新获取过 state 锁
+		if env.LastTaskId != task.Id {
+			return e.New(e.TaskCannotRecover,
+				fmt.Errorf("task %s is not the last task of env", task.Id), http.StatusConflict)
+		}
+		// runner 可能因为网络分区等原因被误判为失联，此时步骤可能仍在执行并持有锁，强制解锁会导致并发写入 state
+		if alive, er := services.IsRunnerAlive(task.RunnerId); er != nil {
+			return er
+		} else if alive {
+			return e.New(e.TaskCannotRecover,
+				fmt.Errorf("runner %s of task is still alive", task.RunnerId), http.StatusConflict)
+		}
+		tpl, er := envTplCheck(tx, c.OrgId, env.TplId, c.Logger())
+		if er != nil {
+			return er
+		}
+
+		lockId := form.LockId
+		if lockId == "" {
+			lock, er := services.GetEnvStateLock(tx, env.Id)
+			if er != nil {
+				return er
+			} else if lock != nil {
+				lockId = lock.LockId
+			}
+		}
+		stateOps := make(models.TaskStateOps, 0)
+		if lockId != "" {
+			stateOps = append(stateOps, models.TaskStateOp{Op: models.StateOpForceUnlock, Address: lockId})
+		}
+		stateOps = append(stateOps, models.TaskStateOp{Op: models.StateOpRefresh})
+
+		vars, err := services.GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+		if err != nil {
+			return err
+		}
+		runnerId, er := services.GetAvailableRunnerIdByStr(env.RunnerId, env.RunnerTags)
+		if er != nil {
+			return er
+		}
+
+		recoverTask, er = services.CreateTask(tx, tpl, env, models.Task{
+			Name:            models.Task{}.GetTaskNameByType(models.TaskTypeState),
+			CreatorId:       c.UserId,
+			KeyId:           env.KeyId,
+			Variables:       vars,
+			AutoApprove:     env.AutoApproval,
+			Revision:        env.Revision,
+			StopOnViolation: env.StopOnViolation,
+			ExtraData:       env.ExtraData,
+			BaseTask: models.BaseTask{
+				Type:        models.TaskTypeState,
+				StepTimeout: env.StepTimeout,
+				RunnerId:    runnerId,
+			},
+			Source:   consts.TaskSourceManual,
+			Callback: env.Callback,
+			StateOps: stateOps,
+		})
+		if er != nil {
+			return er
+		}
+
+		_, er = services.AddTaskEvent(tx, task, step, models.TaskEventRecoveryStarted,
+			fmt.Sprintf("recovery task %s created by %s", recoverTask.Id, c.Username), recoverTask.Id.String())
+		return er
+	})
+	if er != nil {
+		return nil, e.AutoNew(er, e.InternalError)
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, env.Id, consts.OperatorObjectTypeEnv, "recover", env.Name,
+		models.ResAttrs{"taskId": form.Id, "recoverTaskId": recoverTask.Id})
+	return recoverTask, nil
+}
@@ -71,6 +71,7 @@ func CreateTemplate(c *ctx.ServiceContext, form *forms.CreateTemplateForm) (*mod
 		PlayVarsFile: form.PlayVarsFile,
 		TfVarsFile:   form.TfVarsFile,
 		TfVersion:    form.TfVersion,
+		IacEngine:    form.IacEngine,
 		PolicyEnable: form.PolicyEnable,
 		Triggers:     form.TplTriggers,
 		KeyId:        form.KeyId,
@@ -175,6 +176,9 @@ func setAttrsByFormKeys(attrs models.Attrs, form *forms.UpdateTemplateForm) {
 	if form.HasKey("tfVersion") {
 		attrs["tfVersion"] = form.TfVersion
 	}
+	if form.HasKey("iacEngine") {
+		attrs["iacEngine"] = form.IacEngine
+	}
 	if form.HasKey("repoRevision") {
 		attrs["repoRevision"] = form.RepoRevision
 	}
@@ -10,6 +10,8 @@ import (
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/services"
 	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -24,6 +26,7 @@ import (
 )
 
 var TfListVersions []string
+var TofuListVersions []string
 var m sync.RWMutex
 
 type tfVersionList struct {
@@ -45,17 +48,21 @@ func AutoGetTfVersion(c *ctx.ServiceContext, form *forms.TemplateTfVersionSearch
 		return nil, e.New(e.VcsError, er)
 	}
 	content, er := repoDetail.ReadFileContent(form.VcsBranch, filepath.Join(form.Workdir, "versions.tf"))
+	defaultVersion := consts.DefaultTerraformVersion
+	if form.IacEngine == common.IacEngineOpenTofu {
+		defaultVersion = consts.DefaultOpenTofuVersion
+	}
 	// 没有找到versions.tf 文件，使用默认版本，不报错
 	if er != nil {
-		return consts.DefaultTerraformVersion, nil
+		return defaultVersion, nil
 	}
 	tfconstraint := GetUserTfVersion(content)
 	// 如果用户versions.tf 中没有制定terraform 版本，使用我们默认版本
 	if tfconstraint == "" {
-		return consts.DefaultTerraformVersion, nil
+		return defaultVersion, nil
 	}
 	// 查看内置版本中有无满足用户约束条件的版本
-	tfVersion, tferr := GetDetailTfVersion(common.TerraformVersions, tfconstraint)
+	tfVersion, tferr := GetDetailTfVersion(common.IacEngineVersions(form.IacEngine), tfconstraint)
 	if tferr != nil {
 		return nil, e.New(e.InvalidTfVersion, tferr)
 	}
@@ -63,7 +70,7 @@ func AutoGetTfVersion(c *ctx.ServiceContext, form *forms.TemplateTfVersionSearch
 		return tfVersion, nil
 	} else {
 		// 如果内置版本中没有满足用户版本，则从官方提供所有版本中查找
-		tflist := getTfVersions()
+		tflist := getTfVersions(form.IacEngine)
 		if len(tflist) > 0 {
 			tfVersion, tferr = GetDetailTfVersion(tflist, tfconstraint)
 			// 官方提供所有版本没有找到，则抛错认定用户指定版本不存在
@@ -77,6 +84,28 @@ func AutoGetTfVersion(c *ctx.ServiceContext, form *forms.TemplateTfVersionSearch
 	return nil, e.New(e.VcsError, fmt.Errorf("Illegal terrain version number, please enter after verification"))
 }
 
+// openTofuMinVersion OpenTofu 从 terraform 1.6 分叉，没有更早的版本
+const openTofuMinVersion = "1.6.0"
+
+// checkIacEngineVersion 检查版本是否为 IaC 引擎可用的版本，
+// 版本不在内置版本中时使用已获取到的官方版本列表检查，未获取到官方版本列表时不做检查
+func checkIacEngineVersion(engine, version string) error {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return fmt.Errorf("invalid %s version '%s'", engine, version)
+	}
+	if engine == common.IacEngineOpenTofu && v.LessThan(semver.MustParse(openTofuMinVersion)) {
+		return fmt.Errorf("%s version '%s' not exists", engine, version)
+	}
+	if utils.StrInArray(version, common.IacEngineVersions(engine)...) {
+		return nil
+	}
+	if list := getTfVersions(engine); len(list) > 0 && !utils.StrInArray(version, list...) {
+		return fmt.Errorf("%s version '%s' not exists", engine, version)
+	}
+	return nil
+}
+
 // tflist: 提供的terraform版本约束列表
 // tfconstraint: 用户versions.tf中指定的版本约束范围
 func GetDetailTfVersion(tflist []string, tfconstraint string) (string, error) {
@@ -180,6 +209,33 @@ func GetTFList(mirrorURL string, preRelease bool) ([]string, error) {
 
 }
 
+// GetTofuList 获取 opentofu 官方提供的版本列表
+func GetTofuList(mirrorURL string) ([]string, error) {
+	cli := http.Client{Timeout: consts.HttpClientTimeout * time.Second}
+	resp, err := cli.Get(mirrorURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return []string{}, nil
+	}
+
+	body := struct {
+		Versions []struct {
+			Id string `json:"id"`
+		} `json:"versions"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	versions := make([]string, 0, len(body.Versions))
+	for _, v := range body.Versions {
+		versions = append(versions, v.Id)
+	}
+	return versions, nil
+}
+
 func initTfversions() {
 	// 添加写锁
 	m.Lock()
@@ -194,6 +250,10 @@ func initTfversions() {
 
 		}
 	}
+	// opentofu 版本列表获取失败不影响 terraform，等待下次刷新
+	if versions, err := GetTofuList(consts.DefaultTofuMirror); err == nil {
+		TofuListVersions = versions
+	}
 }
 
 func InitTfVersions() {
@@ -207,9 +267,12 @@ func InitTfVersions() {
 
 }
 
-func getTfVersions() []string {
+func getTfVersions(engine string) []string {
 	// 添加读锁
 	m.RLock()
 	defer m.RUnlock()
+	if engine == common.IacEngineOpenTofu {
+		return TofuListVersions
+	}
 	return TfListVersions
 }
@@ -181,6 +181,12 @@ func ApiTriggerHandler(c *ctx.ServiceContext, form forms.ApiTriggerHandler) (int
 		taskType = models.TaskTypeApply
 	case models.TaskTypeDestroy:
 		taskType = models.TaskTypeDestroy
+		// 与页面发起销毁一致，受保护的环境只有触发器创建者为环境所有者时才能销毁
+		if err := services.CheckEnvDestroyPerm(tx, env, token.CreatorId,
+			services.UserIsSuperAdmin(tx, token.CreatorId)); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
 	//todo 合规
 	default:
 		return nil, e.New(e.BadRequest, errors.New("token action illegal"), http.StatusBadRequest)
@@ -31,8 +31,8 @@ type VarGroupVariablesCreate struct {
 }
 
 func CreateVariableGroup(c *ctx.ServiceContext, form *forms.CreateVariableGroupForm) (interface{}, e.Error) {
-	if form.Provider != "alicloud" && form.CostCounted {
-		return nil, e.New(e.BadParam, fmt.Errorf("cost statistics can only be enabled if the provider is alicloud"), http.StatusBadRequest)
+	if _, ok := consts.BillProviderResAccount[form.Provider]; !ok && form.CostCounted {
+		return nil, e.New(e.BadParam, fmt.Errorf("cost statistics can only be enabled if the provider is alicloud or aws"), http.StatusBadRequest)
 	}
 	session := c.DB()
 
@@ -178,8 +178,8 @@ func getVarGroupVariables(variables []models.VarGroupVariable, vgVarsMap map[str
 
 // nolint:cyclop
 func UpdateVariableGroup(c *ctx.ServiceContext, form *forms.UpdateVariableGroupForm) (interface{}, e.Error) {
-	if form.Provider != "alicloud" && form.CostCounted {
-		return nil, e.New(e.BadParam, fmt.Errorf("cost statistics can only be enabled if the provider is alicloud"), http.StatusBadRequest)
+	if _, ok := consts.BillProviderResAccount[form.Provider]; !ok && form.CostCounted {
+		return nil, e.New(e.BadParam, fmt.Errorf("cost statistics can only be enabled if the provider is alicloud or aws"), http.StatusBadRequest)
 	}
 	session := c.DB()
 	attrs := models.Attrs{}
@@ -298,6 +298,7 @@ func createTplScan(userId models.Id, tpl *models.Template, options webhookOption
 			Type:        taskType,
 			StepTimeout: common.DefaultTaskStepTimeout,
 			RunnerId:    runnerId,
+			AutoRunner:  true, // 使用默认 runner，任务开始执行前根据 runner 负载重新选择
 		},
 	})
 	if err != nil {
@@ -19,10 +19,12 @@ const (
 	DefaultPageSize = 15   // 默认分页大小
 	MaxPageSize     = 5000 // 最大单页数据条数
 
-	MaxLogContentSize = 1024 * 1024 // 最大日志文件大小，超限会被截断
+	MaxLogContentSize = 1024 * 1024 // 使用 db 存储日志时的最大日志文件大小，超限会被截断
 
 	RunnerConnectTimeout = time.Second * 5
 	DbTaskPollInterval   = time.Second * 3 // 轮询 db 任务状态的间隔
+	// StepEventIdleTimeout 超过该时长未收到 runner 推送的步骤事件时改为主动连接 runner 获取(runner 每 30 秒推送一次步骤状态)
+	StepEventIdleTimeout = time.Second * 90
 
 	CallbackTimeout = time.Second * 5
 
@@ -37,13 +39,19 @@ const (
 	DefaultSysName  = "System"
 
 	DefaultTerraformVersion = "1.2.4"
+	DefaultOpenTofuVersion  = "1.6.2"
 
 	// token subject
-	JwtSubjectUserAuth  = "userAuth" // 用于用户认证
-	JwtSubjectSsoCode   = "ssoCode"  // 用于 sso 单点登录
-	JwtSubjectActivate  = "activate" // 用于账号激活
-	UserEmailINActivate = "inactive" // 用于账号激活
-	UserEmailActivate   = "active"   // 用于账号激活
+	JwtSubjectUserAuth    = "userAuth"    // 用于用户认证
+	JwtSubjectSsoCode     = "ssoCode"     // 用于 sso 单点登录
+	JwtSubjectActivate    = "activate"    // 用于账号激活
+	JwtSubjectStateAccess = "stateAccess" // 用于任务访问 portal 托管的 terraform state
+	JwtSubjectOidcState   = "oidcState"   // 用于保存 oidc 登录请求的 state 等信息
+	JwtSubjectOidcCode    = "oidcCode"    // 用于 oidc 登录成功后换取用户 token
+	JwtSubjectMfaPending  = "mfaPending"  // 用于密码校验通过后进行多因素认证
+	UserEmailINActivate   = "inactive"    // 用于账号激活
+	UserEmailActivate     = "active"      // 用于账号激活
+	UserStatusDisable     = "disable"     // 用户已禁用
 
 	DirRoot                          = "/"
 	PolicyGroupDownloadTimeoutSecond = 20 * time.Second
@@ -155,6 +163,7 @@ const (
 	EvenvtCronDrift    = "task.crondrift"
 
 	DefaultTfMirror   = "https://releases.hashicorp.com/terraform"
+	DefaultTofuMirror = "https://get.opentofu.org/tofu/api.json"
 	HttpClientTimeout = 20
 
 	TaskCallbackKafka = "kafka"
@@ -167,11 +176,19 @@ const (
 	TaskSourceAutoDestroy  = "autoDestroy"
 	TaskSourceAutoDeploy   = "autoDeploy"
 	TaskSourceApi          = "api"
+	TaskSourceEnvChain     = "envChain"
+	TaskSourceStackRun     = "stackRun"
+
+	// 任务调度优先级，手动触发的任务优先于自动触发的任务，漂移检测任务最后执行
+	TaskPriorityLow    = 0
+	TaskPriorityNormal = 10
+	TaskPriorityHigh   = 20
 
 	TaskAutoDestroyName = "Auto Destroy"
 	TaskAutoDeployName  = "Auto Deploy"
 
 	BillCollectAli = "alicloud"
+	BillCollectAws = "aws"
 
 	//terraform action type
 	TerraformActionCreate = "create"
@@ -198,6 +215,16 @@ const (
 const (
 	AlicloudAK = "ALICLOUD_ACCESS_KEY"
 	AlicloudSK = "ALICLOUD_SECRET_KEY"
+
+	AwsAK = "AWS_ACCESS_KEY_ID"
+	AwsSK = "AWS_SECRET_ACCESS_KEY"
+	// aws 成本和使用情况报告(CUR)的存储位置
+	AwsCurBucket   = "AWS_CUR_BUCKET"
+	AwsCurPrefix   = "AWS_CUR_PREFIX"
+	AwsCurRegion   = "AWS_CUR_REGION"
+	AwsCurEndpoint = "AWS_CUR_ENDPOINT"
+	// 从本地目录读取 CUR 报告，用于测试或者报告已同步到本地的场景
+	AwsCurLocalDir = "AWS_CUR_LOCAL_DIR"
 )
 
 var (
@@ -243,6 +270,7 @@ var (
 
 	BillProviderResAccount = map[string][]string{
 		BillCollectAli: []string{AlicloudAK, AlicloudSK},
+		BillCollectAws: []string{AwsAK, AwsSK, AwsCurBucket, AwsCurPrefix, AwsCurRegion, AwsCurEndpoint, AwsCurLocalDir},
 	}
 
 	UserOperationLogAttr = map[string]string{
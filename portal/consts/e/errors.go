@@ -161,6 +161,21 @@ const (
 	EnvTagNumLimited         = 30821
 	EnvTagLengthLimited      = 30822
 	TemplateNotBind          = 30823
+	EnvStateBackendError     = 30824
+	EnvStateMigrateActive    = 30825
+	EnvStateLocked           = 30826
+	EnvStateLockIdMismatch   = 30827
+	EnvStateVersionNotExists = 30828
+	EnvStateRollbackActive   = 30829
+	EnvStateNotHosted        = 30830
+	EnvDependencyInvalid     = 30831
+	EnvDependencyCycle       = 30832
+	EnvHasDependents         = 30833
+	EnvOutputRefInvalid      = 30834
+	EnvChainActive           = 30835
+	StackRunEnvInvalid       = 30836
+	StackRunNotApproving     = 30837
+	EnvStateMigrateExists    = 30838
 
 	//// task 309
 	TaskAlreadyExists     = 30910
@@ -171,6 +186,7 @@ const (
 	TaskAborting          = 30917
 	TaskAborted           = 30918
 	TaskCannotAbort       = 30919
+	TaskCannotRecover     = 30920
 
 	//// ssh key 310
 	KeyAlreadyExists  = 31010
@@ -229,4 +245,62 @@ const (
 	LdapBindError      = 31713
 	LdapUnknowError    = 31714
 	LdapUserNotExist   = 31715
+
+	// price catalog 318
+	PriceCatalogInvalid  = 31810
+	PriceCatalogNotExist = 31811
+
+	// oidc 319
+	OidcNotEnabled        = 31910
+	OidcStateInvalid      = 31911
+	OidcLoginFailed       = 31912
+	OidcGroupRoleExisted  = 31913
+	OidcGroupRoleNotExist = 31914
+	OidcUserNotLinked     = 31915
+
+	// mfa 320
+	MfaCodeInvalid    = 32010
+	MfaNotEnabled     = 32011
+	MfaAlreadyEnabled = 32012
+	MfaNotEnrolled    = 32013
+	MfaEnforced       = 32014
+	MfaTokenInvalid   = 32015
+	MfaLocked         = 32016
+
+	// 自定义角色 321
+	RoleNotExist          = 32110
+	RoleAlreadyExists     = 32111
+	RolePermissionInvalid = 32112
+	RoleInUse             = 32113
+
+	// 环境权限及受保护环境 322
+	EnvProtected               = 32210
+	EnvApproverRequired        = 32211
+	TaskAlreadyVoted           = 32212
+	ApproverGroupNotExist      = 32213
+	ApproverGroupAlreadyExists = 32214
+	ApproverGroupInUse         = 32215
+	EnvUserNotExist            = 32216
+
+	// 任务审批规则 323
+	ApprovalRuleNotExist    = 32310
+	TaskSelfApprovalDenied  = 32311
+	TaskApproverNotEligible = 32312
+
+	// 变更窗口及冻结期 324
+	ChangeWindowNotExist         = 32410
+	ChangeWindowInvalid          = 32411
+	ChangeFrozen                 = 32412
+	ChangeWindowClosed           = 32413
+	ChangeOverrideReasonRequired = 32414
+
+	// 资源漂移记录 325
+	DriftRecordNotExist      = 32510
+	DriftRecordStatusInvalid = 32511
+
+	// runner agent 326
+	RunnerJoinTokenInvalid  = 32610
+	RunnerAgentNotExist     = 32611
+	RunnerAgentAuthFailed   = 32612
+	RunnerAgentNotConnected = 32613
 )
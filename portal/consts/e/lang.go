@@ -286,6 +286,10 @@ var errorMsgs = map[int]map[string]string{
 		"en-US": "task cannot abort",
 		"zh-CN": "任务当前无法中止",
 	},
+	TaskCannotRecover: {
+		"en-US": "task does not need or cannot be recovered",
+		"zh-CN": "任务无需或无法进行恢复",
+	},
 	TemplateAlreadyExists: {
 		"en-US": "template already exists",
 		"zh-CN": "模板名称重复",
@@ -594,4 +598,224 @@ var errorMsgs = map[int]map[string]string{
 		"en-US": "template is not bound to the project",
 		"zh-CN": "云模板未绑定当前项目",
 	},
+	EnvStateBackendError: {
+		"en-US": "environment state backend error",
+		"zh-CN": "环境 state 存储读写失败",
+	},
+	EnvStateMigrateActive: {
+		"en-US": "state migration failed. Active tasks in the environment",
+		"zh-CN": "state 迁移失败，环境下有活跃任务",
+	},
+	EnvStateLocked: {
+		"en-US": "environment state is locked",
+		"zh-CN": "环境 state 已被锁定",
+	},
+	EnvStateLockIdMismatch: {
+		"en-US": "state lock id mismatch",
+		"zh-CN": "state 锁 ID 不匹配",
+	},
+	EnvStateVersionNotExists: {
+		"en-US": "state version not exists",
+		"zh-CN": "state 版本不存在",
+	},
+	EnvStateRollbackActive: {
+		"en-US": "state rollback failed. Active tasks in the environment",
+		"zh-CN": "state 回滚失败，环境下有活跃任务",
+	},
+	EnvStateNotHosted: {
+		"en-US": "environment state is not hosted by the platform",
+		"zh-CN": "环境 state 未由平台托管",
+	},
+	EnvDependencyInvalid: {
+		"en-US": "invalid environment dependency",
+		"zh-CN": "无效的环境依赖",
+	},
+	EnvDependencyCycle: {
+		"en-US": "environment dependency cycle detected",
+		"zh-CN": "环境依赖存在循环",
+	},
+	EnvHasDependents: {
+		"en-US": "environment is depended on by other environments",
+		"zh-CN": "环境被其他环境依赖，不允许销毁",
+	},
+	EnvOutputRefInvalid: {
+		"en-US": "invalid environment output reference",
+		"zh-CN": "环境 output 引用无效",
+	},
+	EnvChainActive: {
+		"en-US": "environment chain is running",
+		"zh-CN": "环境有正在执行的依赖链编排",
+	},
+	StackRunEnvInvalid: {
+		"en-US": "invalid stack run environment",
+		"zh-CN": "无效的批量编排环境",
+	},
+	StackRunNotApproving: {
+		"en-US": "stack run is not waiting for approval",
+		"zh-CN": "批量编排不在待审批状态",
+	},
+	EnvStateMigrateExists: {
+		"en-US": "state already exists in the target backend. Force migration to overwrite it",
+		"zh-CN": "目标存储后端已存在 state，需要强制迁移才能覆盖",
+	},
+	PriceCatalogInvalid: {
+		"en-US": "invalid price catalog",
+		"zh-CN": "无效的价格目录",
+	},
+	PriceCatalogNotExist: {
+		"en-US": "price catalog does not exist",
+		"zh-CN": "价格目录不存在",
+	},
+	OidcNotEnabled: {
+		"en-US": "OIDC single sign-on is not enabled",
+		"zh-CN": "未启用 OIDC 单点登录",
+	},
+	OidcStateInvalid: {
+		"en-US": "invalid or expired OIDC login request",
+		"zh-CN": "OIDC 登录请求无效或已过期",
+	},
+	OidcLoginFailed: {
+		"en-US": "OIDC login failed",
+		"zh-CN": "OIDC 登录失败",
+	},
+	OidcGroupRoleExisted: {
+		"en-US": "group role mapping already exists",
+		"zh-CN": "用户组角色映射已存在",
+	},
+	OidcGroupRoleNotExist: {
+		"en-US": "group role mapping does not exist",
+		"zh-CN": "用户组角色映射不存在",
+	},
+	OidcUserNotLinked: {
+		"en-US": "a user with this email already exists and must be allowed by an administrator to sign in with OIDC",
+		"zh-CN": "该邮箱的用户已存在，需要管理员允许后才能通过 OIDC 登录",
+	},
+	MfaCodeInvalid: {
+		"en-US": "invalid verification code",
+		"zh-CN": "验证码错误",
+	},
+	MfaNotEnabled: {
+		"en-US": "multi-factor authentication is not enabled",
+		"zh-CN": "未启用多因素认证",
+	},
+	MfaAlreadyEnabled: {
+		"en-US": "multi-factor authentication is already enabled",
+		"zh-CN": "已启用多因素认证",
+	},
+	MfaNotEnrolled: {
+		"en-US": "multi-factor authentication enrollment not started",
+		"zh-CN": "请先获取多因素认证密钥",
+	},
+	MfaEnforced: {
+		"en-US": "multi-factor authentication is required by the platform or organization",
+		"zh-CN": "平台或组织要求启用多因素认证",
+	},
+	MfaTokenInvalid: {
+		"en-US": "invalid or expired multi-factor authentication request",
+		"zh-CN": "多因素认证请求无效或已过期",
+	},
+	MfaLocked: {
+		"en-US": "too many failed attempts. Please try again later",
+		"zh-CN": "验证失败次数过多，请稍后重试",
+	},
+	RoleNotExist: {
+		"en-US": "role does not exist",
+		"zh-CN": "角色不存在",
+	},
+	RoleAlreadyExists: {
+		"en-US": "role name already exists",
+		"zh-CN": "角色名称已存在",
+	},
+	RolePermissionInvalid: {
+		"en-US": "invalid role permission",
+		"zh-CN": "无效的角色权限",
+	},
+	RoleInUse: {
+		"en-US": "role is in use and cannot be deleted",
+		"zh-CN": "角色正在被使用，不允许删除",
+	},
+	EnvProtected: {
+		"en-US": "protected environment can only be destroyed by its owners",
+		"zh-CN": "受保护的环境只允许环境所有者销毁",
+	},
+	EnvApproverRequired: {
+		"en-US": "only members of the approver group can approve tasks of a protected environment",
+		"zh-CN": "只有审批组成员可以审批受保护的环境",
+	},
+	TaskAlreadyVoted: {
+		"en-US": "you have already voted on this task",
+		"zh-CN": "已经审批过该任务",
+	},
+	ApproverGroupNotExist: {
+		"en-US": "approver group does not exist",
+		"zh-CN": "审批组不存在",
+	},
+	ApproverGroupAlreadyExists: {
+		"en-US": "approver group name already exists",
+		"zh-CN": "审批组名称已存在",
+	},
+	ApproverGroupInUse: {
+		"en-US": "approver group is in use by environments",
+		"zh-CN": "审批组正在被环境使用，不允许删除",
+	},
+	EnvUserNotExist: {
+		"en-US": "environment user does not exist",
+		"zh-CN": "环境用户不存在",
+	},
+	ApprovalRuleNotExist: {
+		"en-US": "approval rule does not exist",
+		"zh-CN": "审批规则不存在",
+	},
+	TaskSelfApprovalDenied: {
+		"en-US": "task creator is not allowed to approve their own task",
+		"zh-CN": "审批规则不允许任务创建者审批自己的任务",
+	},
+	TaskApproverNotEligible: {
+		"en-US": "user is not an eligible approver for this task",
+		"zh-CN": "用户不满足任务的审批规则",
+	},
+	ChangeWindowNotExist: {
+		"en-US": "change window does not exist",
+		"zh-CN": "变更窗口不存在",
+	},
+	ChangeWindowInvalid: {
+		"en-US": "invalid change window settings",
+		"zh-CN": "变更窗口设置不正确",
+	},
+	ChangeFrozen: {
+		"en-US": "changes are not allowed during a change freeze",
+		"zh-CN": "当前处于变更冻结期，不允许进行变更",
+	},
+	ChangeWindowClosed: {
+		"en-US": "changes are only allowed within a change window",
+		"zh-CN": "当前不在变更窗口内，不允许进行变更",
+	},
+	ChangeOverrideReasonRequired: {
+		"en-US": "a reason is required for an emergency override",
+		"zh-CN": "紧急变更需要填写原因",
+	},
+	DriftRecordNotExist: {
+		"en-US": "drift record does not exist",
+		"zh-CN": "漂移记录不存在",
+	},
+	DriftRecordStatusInvalid: {
+		"en-US": "the drift record status does not allow this operation",
+		"zh-CN": "漂移记录状态不允许该操作",
+	},
+	RunnerJoinTokenInvalid: {
+		"en-US": "the runner join token is invalid or has already been used",
+		"zh-CN": "runner 注册令牌无效或已被使用",
+	},
+	RunnerAgentNotExist: {
+		"en-US": "runner agent does not exist",
+		"zh-CN": "runner agent 不存在",
+	},
+	RunnerAgentAuthFailed: {
+		"en-US": "runner agent authentication failed",
+		"zh-CN": "runner agent 认证失败",
+	},
+	RunnerAgentNotConnected: {
+		"en-US": "runner agent is not connected",
+		"zh-CN": "runner agent 未连接",
+	},
 }
@@ -0,0 +1,32 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+// ApprovalRule 任务审批规则，可以关联到项目或者环境，关联到项目的规则对项目下所有环境生效。
+// 任务步骤需要满足所有生效的规则才能通过审批
+type ApprovalRule struct {
+	TimedModel
+
+	OrgId     Id     `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id     `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id     `json:"envId" gorm:"size:32;default:''"` // 为空表示对项目下所有环境生效
+	Name      string `json:"name" gorm:"size:64;not null"`
+	Enabled   bool   `json:"enabled" gorm:"default:false"`
+
+	ApproverGroupId    Id   `json:"approverGroupId" gorm:"size:32;default:''"` // 为空时所有有审批权限的用户都可以审批
+	RequiredApprovals  int  `json:"requiredApprovals" gorm:"default:1"`        // 需要的审批通过人数
+	ForbidSelfApproval bool `json:"forbidSelfApproval" gorm:"default:false"`   // 任务创建者不能审批自己的任务
+
+	// 自动审批条件，设置的条件都满足时无需人工审批
+	AutoApproveAdditionsOnly bool     `json:"autoApproveAdditionsOnly" gorm:"default:false"` // 执行计划只有新增资源
+	AutoApproveMaxCost       *float32 `json:"autoApproveMaxCost" gorm:"default:null"`        // 费用变化小于该值，为空表示不设置该条件
+}
+
+func (ApprovalRule) TableName() string {
+	return "iac_approval_rule"
+}
+
+// HasAutoApprove 规则是否设置了自动审批条件
+func (r ApprovalRule) HasAutoApprove() bool {
+	return r.AutoApproveAdditionsOnly || r.AutoApproveMaxCost != nil
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// ApproverGroup 审批组，受保护环境的部署及销毁只能由审批组的成员审批
+type ApproverGroup struct {
+	TimedModel
+
+	OrgId       Id       `json:"orgId" gorm:"size:32;not null;comment:组织ID"`
+	Name        string   `json:"name" gorm:"size:64;not null"`
+	Description string   `json:"description" gorm:"size:255;default:''"`
+	UserIds     StrSlice `json:"userIds" gorm:"type:json"` // 审批组成员
+}
+
+func (ApproverGroup) TableName() string {
+	return "iac_approver_group"
+}
+
+func (g ApproverGroup) Migrate(sess *db.Session) error {
+	return g.AddUniqueIndex(sess, "unique__org__name", "org_id", "name")
+}
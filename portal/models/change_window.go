@@ -0,0 +1,31 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+const (
+	ChangeWindowTypeWindow = "window" // 变更窗口，设置了变更窗口时只允许在窗口内进行变更
+	ChangeWindowTypeFreeze = "freeze" // 冻结期，冻结期内不允许进行变更
+)
+
+// ChangeWindow 变更窗口及冻结期，可以设置在组织或者项目上，组织的设置对组织下所有项目生效。
+// 时间段通过 cron 表达式(周期性时间段的开始时间)加持续时长，或者日期范围设置，两者同时设置时需要同时满足
+type ChangeWindow struct {
+	TimedModel
+
+	OrgId       Id     `json:"orgId" gorm:"size:32;not null"`
+	ProjectId   Id     `json:"projectId" gorm:"size:32;default:''"` // 为空表示对组织下所有项目生效
+	Name        string `json:"name" gorm:"size:64;not null"`
+	Type        string `json:"type" gorm:"type:enum('window','freeze');not null" enums:"window,freeze"`
+	Enabled     bool   `json:"enabled" gorm:"default:false"`
+	Description string `json:"description" gorm:"size:255;default:''"`
+
+	Timezone  string `json:"timezone" gorm:"size:64;default:'UTC'"` // 时区，如 Asia/Shanghai
+	Cron      string `json:"cron" gorm:"size:128;default:''"`       // 时间段开始时间的 cron 表达式，如 0 22 * * 5
+	Duration  int    `json:"duration" gorm:"default:0"`             // 时间段持续时长(分钟)，设置 cron 时必须设置
+	StartTime string `json:"startTime" gorm:"size:32;default:''"`   // 日期范围开始时间，格式 2006-01-02 15:04
+	EndTime   string `json:"endTime" gorm:"size:32;default:''"`     // 日期范围结束时间，格式 2006-01-02 15:04
+}
+
+func (ChangeWindow) TableName() string {
+	return "iac_change_window"
+}
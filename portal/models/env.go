@@ -45,7 +45,8 @@ type Env struct {
 
 	Tags string `json:"tags" gorm:"type:text"`
 
-	StatePath string `json:"statePath" gorm:"not null" swaggerignore:"true"` // Terraform tfstate 文件路径（内部）
+	StatePath    string `json:"statePath" gorm:"not null" swaggerignore:"true"` // Terraform tfstate 文件路径（内部）
+	StateBackend string `json:"stateBackend" gorm:"size:32;default:''"`         // Terraform state 存储后端(consul/s3/http/pg)，为空表示 consul
 
 	// 环境可以覆盖模板中的 vars file 配置，具体说明见 Template model
 	TfVarsFile   string `json:"tfVarsFile" gorm:"default:''"`   // Terraform tfvars 变量文件路径
@@ -59,6 +60,10 @@ type Env struct {
 	KeyId      Id     `json:"keyId" gorm:"size:32"`               // 部署密钥ID
 	Workdir    string `json:"workdir" gorm:"size:32;default:''"`  // 工作目录
 
+	// 环境可以覆盖模板的 IaC 引擎及版本，两者需要同时设置，为空时使用模板的配置
+	IacEngine string `json:"iacEngine" gorm:"size:16;default:''"` // IaC 引擎(terraform/opentofu)
+	TfVersion string `json:"tfVersion" gorm:"size:64;default:''"` // IaC 引擎版本号
+
 	LastTaskId    Id `json:"lastTaskId" gorm:"size:32"`          // 最后一次部署或销毁任务的 id(plan 任务不记录)
 	LastResTaskId Id `json:"lastResTaskId" gorm:"index;size:32"` // 最后一次进行了资源列表统计的部署任务的 id
 
@@ -107,6 +112,11 @@ type Env struct {
 	// 自动销毁相关
 	AutoDestroyCron string `json:"autoDestroyCron" gorm:"default:''"` // 自动销毁任务的Cron表达式
 	// 下次执行自动部署任务的时间 和 自动部署任务id 复用之前的
+
+	// 受保护环境，部署及销毁总是需要审批，且只有环境所有者可以发起销毁
+	Protected         bool `json:"protected" gorm:"default:false"`
+	ApproverGroupId   Id   `json:"approverGroupId" gorm:"size:32;default:''"` // 审批组，为空时有审批权限的用户都可以审批
+	RequiredApprovals int  `json:"requiredApprovals" gorm:"default:1"`        // 需要的审批人数
 }
 
 func (Env) TableName() string {
@@ -0,0 +1,56 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+)
+
+// EnvDependency 环境依赖关系，EnvId 依赖 DependsOn 环境(可以引用其 outputs)
+// 依赖的环境必须在同一个项目下
+type EnvDependency struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null;index"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null"`
+	DependsOn Id `json:"dependsOn" gorm:"size:32;not null;index"`
+}
+
+func (EnvDependency) TableName() string {
+	return "iac_env_dependency"
+}
+
+func (d EnvDependency) Migrate(sess *db.Session) error {
+	return d.AddUniqueIndex(sess, "unique__env__depends_on", "env_id", "depends_on")
+}
+
+const (
+	EnvChainActionDeploy  = "deploy"
+	EnvChainActionDestroy = "destroy"
+
+	EnvChainStatusRunning  = "running"
+	EnvChainStatusComplete = "complete"
+	EnvChainStatusFailed   = "failed"
+)
+
+// EnvChain 依赖链编排，按拓扑顺序依次对链上的环境执行部署或销毁
+// 部署时先部署所有依赖的环境，销毁时先销毁所有依赖当前环境的环境
+type EnvChain struct {
+	TimedModel
+
+	OrgId     Id     `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id     `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id     `json:"envId" gorm:"size:32;not null;index"` // 发起编排的环境
+	CreatorId Id     `json:"creatorId" gorm:"size:32;not null"`
+	Action    string `json:"action" gorm:"size:32;not null" enums:"'deploy','destroy'"`
+	Status    string `json:"status" gorm:"size:32;not null;index" enums:"'running','complete','failed'"`
+	Message   string `json:"message" gorm:"type:text"`
+
+	EnvIds  StrSlice `json:"envIds" gorm:"type:json"`  // 按执行顺序排列的环境 id
+	TaskIds StrSlice `json:"taskIds" gorm:"type:json"` // 已创建的任务 id，与 EnvIds 一一对应
+}
+
+func (EnvChain) TableName() string {
+	return "iac_env_chain"
+}
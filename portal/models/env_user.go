@@ -0,0 +1,22 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// EnvUser 环境级别的用户角色，覆盖用户在项目中的角色，只对项目成员生效
+type EnvUser struct {
+	AutoUintIdModel
+
+	EnvId  Id     `json:"envId" gorm:"size:32;not null"`
+	UserId Id     `json:"userId" gorm:"size:32;not null;comment:用户ID"`
+	Role   string `json:"role" gorm:"size:32;not null"` // 内置项目角色(manager,approver,operator,guest)或者自定义项目角色ID
+}
+
+func (EnvUser) TableName() string {
+	return "iac_env_user"
+}
+
+func (u EnvUser) Migrate(sess *db.Session) error {
+	return u.AddUniqueIndex(sess, "unique__env__user", "env_id", "user_id")
+}
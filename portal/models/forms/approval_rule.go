@@ -0,0 +1,49 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchApprovalRuleForm struct {
+	NoPageSizeForm
+
+	EnvId models.Id `json:"envId" form:"envId" binding:"omitempty,startswith=env-,max=32"` // 环境ID，不传时返回项目下所有规则
+}
+
+type CreateApprovalRuleForm struct {
+	BaseForm
+
+	Name                     string    `json:"name" form:"name" binding:"required,max=64"`                                        // 规则名称
+	EnvId                    models.Id `json:"envId" form:"envId" binding:"omitempty,startswith=env-,max=32"`                     // 环境ID，为空表示对项目下所有环境生效
+	Enabled                  *bool     `json:"enabled" form:"enabled"`                                                            // 是否启用，默认启用
+	ApproverGroupId          models.Id `json:"approverGroupId" form:"approverGroupId" binding:"omitempty,startswith=apg-,max=32"` // 审批组ID，为空时所有有审批权限的用户都可以审批
+	RequiredApprovals        int       `json:"requiredApprovals" form:"requiredApprovals" binding:"omitempty,min=1,max=10"`       // 需要的审批通过人数，默认为 1
+	ForbidSelfApproval       bool      `json:"forbidSelfApproval" form:"forbidSelfApproval"`                                      // 任务创建者不能审批自己的任务
+	AutoApproveAdditionsOnly bool      `json:"autoApproveAdditionsOnly" form:"autoApproveAdditionsOnly"`                          // 执行计划只有新增资源时自动审批
+	AutoApproveMaxCost       *float32  `json:"autoApproveMaxCost" form:"autoApproveMaxCost" binding:"omitempty,min=0"`            // 费用变化小于该值时自动审批
+}
+
+type UpdateApprovalRuleForm struct {
+	BaseForm
+
+	Id                       models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=apr-,max=32" swaggerignore:"true"`
+	Name                     string    `json:"name" form:"name" binding:"omitempty,max=64"`                                       // 规则名称
+	Enabled                  bool      `json:"enabled" form:"enabled"`                                                            // 是否启用
+	ApproverGroupId          models.Id `json:"approverGroupId" form:"approverGroupId" binding:"omitempty,startswith=apg-,max=32"` // 审批组ID
+	RequiredApprovals        int       `json:"requiredApprovals" form:"requiredApprovals" binding:"omitempty,min=1,max=10"`       // 需要的审批通过人数
+	ForbidSelfApproval       bool      `json:"forbidSelfApproval" form:"forbidSelfApproval"`                                      // 任务创建者不能审批自己的任务
+	AutoApproveAdditionsOnly bool      `json:"autoApproveAdditionsOnly" form:"autoApproveAdditionsOnly"`                          // 执行计划只有新增资源时自动审批
+	AutoApproveMaxCost       *float32  `json:"autoApproveMaxCost" form:"autoApproveMaxCost" binding:"omitempty,min=0"`            // 费用变化小于该值时自动审批，传 null 清除该条件
+}
+
+type DetailApprovalRuleForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=apr-,max=32" swaggerignore:"true"`
+}
+
+type DeleteApprovalRuleForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=apr-,max=32" swaggerignore:"true"`
+}
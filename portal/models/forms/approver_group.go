@@ -0,0 +1,40 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchApproverGroupForm struct {
+	NoPageSizeForm
+
+	Q string `json:"q" form:"q"` // 审批组名称，支持模糊搜索
+}
+
+type CreateApproverGroupForm struct {
+	BaseForm
+
+	Name        string   `json:"name" form:"name" binding:"required,max=64"`                                   // 审批组名称
+	Description string   `json:"description" form:"description" binding:"max=255"`                             // 审批组描述
+	UserIds     []string `json:"userIds" form:"userIds" binding:"required,dive,required,startswith=u-,max=32"` // 审批组成员
+}
+
+type UpdateApproverGroupForm struct {
+	BaseForm
+
+	Id          models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=apg-,max=32" swaggerignore:"true"`
+	Name        string    `json:"name" form:"name" binding:"omitempty,max=64"`                                   // 审批组名称
+	Description string    `json:"description" form:"description" binding:"max=255"`                              // 审批组描述
+	UserIds     []string  `json:"userIds" form:"userIds" binding:"omitempty,dive,required,startswith=u-,max=32"` // 审批组成员
+}
+
+type DetailApproverGroupForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=apg-,max=32" swaggerignore:"true"`
+}
+
+type DeleteApproverGroupForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=apg-,max=32" swaggerignore:"true"`
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchChangeWindowForm struct {
+	NoPageSizeForm
+
+	ProjectId models.Id `json:"projectId" form:"projectId" binding:"omitempty,startswith=p-,max=32"` // 项目ID，传入时返回组织及该项目的设置
+}
+
+type CreateChangeWindowForm struct {
+	BaseForm
+
+	ProjectId   models.Id `json:"projectId" form:"projectId" binding:"omitempty,startswith=p-,max=32"`           // 项目ID，为空表示对组织下所有项目生效
+	Name        string    `json:"name" form:"name" binding:"required,max=64"`                                    // 名称
+	Type        string    `json:"type" form:"type" binding:"required,oneof=window freeze" enums:"window,freeze"` // 类型，window 变更窗口，freeze 冻结期
+	Enabled     *bool     `json:"enabled" form:"enabled"`                                                        // 是否启用，默认启用
+	Description string    `json:"description" form:"description" binding:"max=255"`                              // 描述
+	Timezone    string    `json:"timezone" form:"timezone" binding:"max=64"`                                     // 时区，如 Asia/Shanghai，默认为 UTC
+	Cron        string    `json:"cron" form:"cron" binding:"max=128"`                                            // 时间段开始时间的 cron 表达式
+	Duration    int       `json:"duration" form:"duration" binding:"omitempty,min=1"`                            // 时间段持续时长(分钟)
+	StartTime   string    `json:"startTime" form:"startTime" binding:"max=32"`                                   // 日期范围开始时间，格式 2006-01-02 15:04
+	EndTime     string    `json:"endTime" form:"endTime" binding:"max=32"`                                       // 日期范围结束时间，格式 2006-01-02 15:04
+}
+
+type UpdateChangeWindowForm struct {
+	BaseForm
+
+	Id          models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=cw-,max=32" swaggerignore:"true"`
+	Name        string    `json:"name" form:"name" binding:"omitempty,max=64"`                                    // 名称
+	Type        string    `json:"type" form:"type" binding:"omitempty,oneof=window freeze" enums:"window,freeze"` // 类型
+	Enabled     bool      `json:"enabled" form:"enabled"`                                                         // 是否启用
+	Description string    `json:"description" form:"description" binding:"max=255"`                               // 描述
+	Timezone    string    `json:"timezone" form:"timezone" binding:"max=64"`                                      // 时区
+	Cron        string    `json:"cron" form:"cron" binding:"max=128"`                                             // 时间段开始时间的 cron 表达式
+	Duration    int       `json:"duration" form:"duration" binding:"omitempty,min=1"`                             // 时间段持续时长(分钟)
+	StartTime   string    `json:"startTime" form:"startTime" binding:"max=32"`                                    // 日期范围开始时间
+	EndTime     string    `json:"endTime" form:"endTime" binding:"max=32"`                                        // 日期范围结束时间
+}
+
+type DetailChangeWindowForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=cw-,max=32" swaggerignore:"true"`
+}
+
+type DeleteChangeWindowForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=cw-,max=32" swaggerignore:"true"`
+}
@@ -8,3 +8,22 @@ type ConsulTagUpdateForm struct {
 	Tags      []string `json:"tags" form:"tags" `
 	ServiceId string   `json:"serviceId" form:"serviceId" `
 }
+
+type UpdateRunnerTagsForm struct {
+	BaseForm
+
+	Id   string   `uri:"id" form:"id" json:"id" binding:"required,max=32" swaggerignore:"true"`
+	Tags []string `json:"tags" form:"tags"`
+}
+
+// RunnerHeartbeatForm 使用数据库作为注册中心时 runner 上报的心跳
+type RunnerHeartbeatForm struct {
+	BaseForm
+
+	Id      string   `json:"id" form:"id" binding:"required,max=32"`            // runner 服务 id
+	Address string   `json:"address" form:"address" binding:"required,max=255"` // runner 服务 IP
+	Port    int      `json:"port" form:"port" binding:"required,min=1,max=65535"`
+	Tags    []string `json:"tags" form:"tags"` // 首次注册时使用的 tags
+	Slots   int      `json:"slots" form:"slots" binding:"min=0"`
+	Version string   `json:"version" form:"version" binding:"max=64"`
+}
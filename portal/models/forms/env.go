@@ -38,11 +38,14 @@ type CreateEnvForm struct {
 	StepTimeout     int        `form:"stepTimeout" json:"stepTimeout" binding:""`                       // 部署超时时间（单位：秒）
 	Variables       []Variable `form:"variables" json:"variables" binding:"omitempty,dive,required"`    // 自定义变量列表，该变量列表会覆盖现有的变量
 
-	TfVarsFile   string    `form:"tfVarsFile" json:"tfVarsFile" binding:"max=255"`              // Terraform tfvars 变量文件路径
-	PlayVarsFile string    `form:"playVarsFile" json:"playVarsFile" binding:"max=255"`          // Ansible playbook 变量文件路径
-	Playbook     string    `form:"playbook" json:"playbook" binding:"omitempty,max=255"`        // Ansible playbook 入口文件路径
-	KeyId        models.Id `form:"keyId" json:"keyId" binding:"omitempty,startswith=k-,max=32"` // 部署密钥ID
-	Workdir      string    `form:"workdir" json:"workdir" `                                     // 工作目录
+	TfVarsFile   string    `form:"tfVarsFile" json:"tfVarsFile" binding:"max=255"`                                                         // Terraform tfvars 变量文件路径
+	PlayVarsFile string    `form:"playVarsFile" json:"playVarsFile" binding:"max=255"`                                                     // Ansible playbook 变量文件路径
+	Playbook     string    `form:"playbook" json:"playbook" binding:"omitempty,max=255"`                                                   // Ansible playbook 入口文件路径
+	KeyId        models.Id `form:"keyId" json:"keyId" binding:"omitempty,startswith=k-,max=32"`                                            // 部署密钥ID
+	Workdir      string    `form:"workdir" json:"workdir" `                                                                                // 工作目录
+	IacEngine    string    `form:"iacEngine" json:"iacEngine" binding:"omitempty,oneof=terraform opentofu" enums:"terraform,opentofu"`     // IaC 引擎，不传则使用云模板的配置
+	TfVersion    string    `form:"tfVersion" json:"tfVersion" binding:"max=64"`                                                            // IaC 引擎版本号，设置 iacEngine 时必传
+	StateBackend string    `form:"stateBackend" json:"stateBackend" binding:"omitempty,oneof=consul s3 http pg" enums:"consul,s3,http,pg"` // state 存储后端，不传则使用组织默认值
 
 	RetryNumber int         `form:"retryNumber" json:"retryNumber" binding:""` // 重试总次数
 	RetryDelay  int         `form:"retryDelay" json:"retryDelay" binding:""`   // 重试时间间隔
@@ -113,6 +116,10 @@ type UpdateEnvForm struct {
 
 	AutoDeployCron  string `json:"autoDeployCron" form:"autoDeployCron"`   // 自动部署任务的Cron表达式
 	AutoDestroyCron string `json:"autoDestroyCron" form:"autoDestroyCron"` // 自动销毁任务的Cron表达式
+
+	Protected         bool      `json:"protected" form:"protected" enums:"true,false"`                                     // 是否为受保护环境
+	ApproverGroupId   models.Id `json:"approverGroupId" form:"approverGroupId" binding:"omitempty,startswith=apg-,max=32"` // 受保护环境的审批组
+	RequiredApprovals int       `json:"requiredApprovals" form:"requiredApprovals" binding:"omitempty,min=1,max=10"`       // 受保护环境需要的审批人数
 }
 
 type DeployEnvForm struct {
@@ -127,12 +134,12 @@ type DeployEnvForm struct {
 	AutoApproval    bool     `form:"autoApproval" json:"autoApproval"  binding:"" enums:"true,false"`              // 是否自动审批
 	StopOnViolation bool     `form:"stopOnViolation" json:"stopOnViolation" enums:"true,false"`                    // 合规不通过是否中止任务
 
-	TaskType    string   `form:"taskType" json:"taskType" binding:"required,oneof=plan apply destroy" enums:"plan,apply,destroy"` // 环境创建后触发的任务步骤，plan计划,apply部署,destroy销毁资源
-	Targets     string   `form:"targets" json:"targets" binding:""`                                                               // Terraform target 参数列表
-	RunnerId    string   `form:"runnerId" json:"runnerId" binding:"max=32"`                                                       // 环境默认部署通道
-	RunnerTags  []string `form:"runnerTags" json:"runnerTags" binding:"omitempty,dive,required,max=256"`                          // 环境默认部署通道Tags
-	Revision    string   `form:"revision" json:"revision" binding:"max=64"`                                                       // 分支/标签
-	StepTimeout int      `form:"stepTimeout" json:"stepTimeout" binding:""`                                                       // 部署超时时间（单位：秒）
+	TaskType    string   `form:"taskType" json:"taskType" binding:"required,oneof=plan apply destroy import state" enums:"plan,apply,destroy,import,state"` // 环境创建后触发的任务步骤，plan计划,apply部署,destroy销毁资源,import导入资源,state操作state
+	Targets     string   `form:"targets" json:"targets" binding:""`                                                                                         // Terraform target 参数列表
+	RunnerId    string   `form:"runnerId" json:"runnerId" binding:"max=32"`                                                                                 // 环境默认部署通道
+	RunnerTags  []string `form:"runnerTags" json:"runnerTags" binding:"omitempty,dive,required,max=256"`                                                    // 环境默认部署通道Tags
+	Revision    string   `form:"revision" json:"revision" binding:"max=64"`                                                                                 // 分支/标签
+	StepTimeout int      `form:"stepTimeout" json:"stepTimeout" binding:""`                                                                                 // 部署超时时间（单位：秒）
 
 	RetryNumber int  `form:"retryNumber" json:"retryNumber" binding:""` // 重试总次数
 	RetryDelay  int  `form:"retryDelay" json:"retryDelay" binding:""`   // 重试时间间隔
@@ -142,11 +149,13 @@ type DeployEnvForm struct {
 
 	Variables []Variable `form:"variables" json:"variables" binding:"omitempty,dive,required"` // 自定义变量列表，该变量列表会覆盖现有的变量
 
-	TfVarsFile   string    `form:"tfVarsFile" json:"tfVarsFile" binding:"max=255"`              // Terraform tfvars 变量文件路径
-	PlayVarsFile string    `form:"playVarsFile" json:"playVarsFile" binding:"max=255"`          // Ansible playbook 变量文件路径
-	Playbook     string    `form:"playbook" json:"playbook" binding:"omitempty,max=255"`        // Ansible playbook 入口文件路径
-	KeyId        models.Id `form:"keyId" json:"keyId" binding:"omitempty,startswith=k-,max=32"` // 部署密钥ID
-	Workdir      string    `form:"workdir" json:"workdir" binding:"max=32"`                     // 工作目录
+	TfVarsFile   string    `form:"tfVarsFile" json:"tfVarsFile" binding:"max=255"`                                                     // Terraform tfvars 变量文件路径
+	PlayVarsFile string    `form:"playVarsFile" json:"playVarsFile" binding:"max=255"`                                                 // Ansible playbook 变量文件路径
+	Playbook     string    `form:"playbook" json:"playbook" binding:"omitempty,max=255"`                                               // Ansible playbook 入口文件路径
+	KeyId        models.Id `form:"keyId" json:"keyId" binding:"omitempty,startswith=k-,max=32"`                                        // 部署密钥ID
+	Workdir      string    `form:"workdir" json:"workdir" binding:"max=32"`                                                            // 工作目录
+	IacEngine    string    `form:"iacEngine" json:"iacEngine" binding:"omitempty,oneof=terraform opentofu" enums:"terraform,opentofu"` // IaC 引擎，传空值表示使用云模板的配置
+	TfVersion    string    `form:"tfVersion" json:"tfVersion" binding:"max=64"`                                                        // IaC 引擎版本号，设置 iacEngine 时必传
 
 	VarGroupIds    []models.Id `json:"varGroupIds" form:"varGroupIds" binding:"omitempty,dive,required,startswith=vg-,max=32"`
 	DelVarGroupIds []models.Id `json:"delVarGroupIds" form:"delVarGroupIds" binding:"omitempty,dive,required,startswith=vg-,max=32"`
@@ -165,6 +174,27 @@ type DeployEnvForm struct {
 
 	// 部署plan任务时生效，进行漂移检测时，从最后一次任务获取配置信息进行检测
 	IsDriftTask bool `json:"isDriftTask" form:"isDriftTask" `
+
+	// 紧急变更，不受变更窗口及冻结期的限制，需要组织管理员或者项目管理者权限
+	EmergencyOverride bool   `json:"emergencyOverride" form:"emergencyOverride"`
+	OverrideReason    string `json:"overrideReason" form:"overrideReason" binding:"max=255"` // 紧急变更原因
+
+	Imports  []ImportResource `json:"imports" form:"imports" binding:"omitempty,dive,required"`   // 需要导入的资源列表，taskType 为 import 时必传
+	StateOps []StateOperation `json:"stateOps" form:"stateOps" binding:"omitempty,dive,required"` // state 操作列表，taskType 为 state 时必传
+
+	Replaces    []string `json:"replaces" form:"replaces" binding:"omitempty,dive,required,max=512"` // 需要强制重建的资源地址，plan 和 apply 任务有效
+	RefreshOnly bool     `json:"refreshOnly" form:"refreshOnly"`                                     // 只刷新 state，不变更资源，plan 和 apply 任务有效
+}
+
+type StateOperation struct {
+	Op          string `json:"op" form:"op" binding:"required,oneof=mv rm taint untaint" enums:"mv,rm,taint,untaint"` // 操作类型
+	Address     string `json:"address" form:"address" binding:"required,max=512"`                                     // 资源地址
+	Destination string `json:"destination" form:"destination" binding:"max=512"`                                      // 目标地址，mv 操作时必传
+}
+
+type ImportResource struct {
+	Address string `json:"address" form:"address" binding:"required,max=512"` // 资源在代码中的地址，如 aws_instance.web
+	Id      string `json:"id" form:"id" binding:"required,max=512"`           // 资源在云上的 id
 }
 
 type ArchiveEnvForm struct {
@@ -248,6 +278,35 @@ type UpdateEnvTagsForm struct {
 	Tags string    `json:"tags" form:"tags" binding:"max=255"`
 }
 
+type EnvStateMigrateForm struct {
+	BaseForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true"`                                                            // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Backend string    `form:"backend" json:"backend" binding:"required,oneof=consul s3 http pg" enums:"consul,s3,http,pg"` // 目标 state 存储后端
+	Force   bool      `form:"force" json:"force"`                                                                          // 目标存储后端已存在 state 时强制覆盖
+}
+
+type SearchStateVersionForm struct {
+	PageForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type StateVersionParam struct {
+	BaseForm
+
+	Id        models.Id `uri:"id" json:"id" swaggerignore:"true"`               // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	VersionId models.Id `uri:"versionId" json:"versionId" swaggerignore:"true"` // state 版本ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type StateVersionDiffForm struct {
+	BaseForm
+
+	Id        models.Id `uri:"id" json:"id" swaggerignore:"true"`               // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	VersionId models.Id `uri:"versionId" json:"versionId" swaggerignore:"true"` // state 版本ID，swagger 参数通过 param path 指定，这里忽略
+	Target    models.Id `form:"target" json:"target"`                           // 对比的基准版本ID，默认为该版本的上一个版本
+}
+
 type EnvLockForm struct {
 	BaseForm
 
@@ -266,3 +325,23 @@ type EnvUnLockConfirmForm struct {
 
 	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
 }
+
+type UpdateEnvDependencyForm struct {
+	BaseForm
+
+	Id        models.Id   `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	DependsOn []models.Id `json:"dependsOn" form:"dependsOn"`       // 依赖的环境ID列表(全量)，环境变量可以通过 ${env:环境名称.outputs.名称} 引用其 outputs
+}
+
+type SearchEnvChainForm struct {
+	PageForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type EnvChainParam struct {
+	BaseForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true"`           // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	ChainId models.Id `uri:"chainId" json:"chainId" swaggerignore:"true"` // 编排ID，swagger 参数通过 param path 指定，这里忽略
+}
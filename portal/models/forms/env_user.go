@@ -0,0 +1,26 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchEnvUserForm struct {
+	NoPageSizeForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type SetEnvUserForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	UserId models.Id `json:"userId" form:"userId" binding:"required,startswith=u-,max=32"`               // 用户ID
+	Role   string    `json:"role" form:"role" binding:"required,max=32"`                                 // 用户在环境中的角色，覆盖用户的项目角色
+}
+
+type DeleteEnvUserForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"`       // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	UserId models.Id `uri:"userId" json:"userId" swaggerignore:"true" binding:"required,startswith=u-,max=32"` // 用户ID
+}
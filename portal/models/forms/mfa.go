@@ -0,0 +1,29 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+type LoginMfaForm struct {
+	BaseForm
+
+	MfaToken string `json:"mfaToken" form:"mfaToken" binding:"required"` // 登录接口返回的 mfaToken
+	Code     string `json:"code" form:"code" binding:"required,max=32"`  // 认证器应用中的验证码或者恢复码
+}
+
+type MfaEnrollForm struct {
+	BaseForm
+
+	MfaToken string `json:"mfaToken" form:"mfaToken" binding:"required"` // 登录接口返回的 mfaToken
+}
+
+type MfaEnrollConfirmForm struct {
+	BaseForm
+
+	MfaToken string `json:"mfaToken" form:"mfaToken" binding:"required"` // 登录接口返回的 mfaToken
+	Code     string `json:"code" form:"code" binding:"required,max=32"`  // 认证器应用中的验证码
+}
+
+type MfaCodeForm struct {
+	BaseForm
+
+	Code string `json:"code" form:"code" binding:"required,max=32"` // 认证器应用中的验证码或者恢复码
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type OidcLoginForm struct {
+	BaseForm
+
+	Redirect string `json:"redirect" form:"redirect"` // 登录成功后跳转的页面路径，如 /org/xxx，默认为 /
+}
+
+type OidcCallbackForm struct {
+	BaseForm
+
+	Code             string `json:"code" form:"code"`
+	State            string `json:"state" form:"state"`
+	Error            string `json:"error" form:"error"`
+	ErrorDescription string `json:"error_description" form:"error_description"`
+}
+
+type OidcTokenForm struct {
+	BaseForm
+
+	Code string `json:"code" form:"code" binding:"required"` // 登录成功后回调页面地址中的 oidcCode 参数
+}
+
+type SearchOidcGroupRoleForm struct {
+	NoPageSizeForm
+
+	Q         string    `json:"q" form:"q"`                 // 用户组名称，支持模糊搜索
+	ProjectId models.Id `json:"projectId" form:"projectId"` // 项目ID，不传时返回组织下的所有映射
+}
+
+type CreateOidcGroupRoleForm struct {
+	BaseForm
+
+	Group     string    `json:"group" form:"group" binding:"required,max=255"` // ID token 中的用户组名称
+	ProjectId models.Id `json:"projectId" form:"projectId"`                    // 项目ID，为空时映射为组织角色
+	Role      string    `json:"role" form:"role" binding:"required"`           // 组织角色(admin,complianceManager,member)或者项目角色(manager,approver,operator,guest)，也可以是自定义角色ID
+}
+
+type DeleteOidcGroupRoleForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" form:"id" json:"id" binding:"required,startswith=ogr-,max=32" swaggerignore:"true"`
+}
+
+type UserOidcLinkForm struct {
+	BaseForm
+
+	Id      models.Id `uri:"id" json:"id" binding:"required,startswith=u-,max=32" swaggerignore:"true"` // 用户ID
+	Allowed bool      `json:"allowed" form:"allowed"`                                                   // 是否允许用户在下次 oidc 登录时绑定身份
+}
@@ -21,6 +21,13 @@ type UpdateOrganizationForm struct {
 	Description string `form:"description" json:"description" binding:"max=255"`                                     // 组织描述
 	RunnerId    string `form:"runnerId" json:"runnerId" binding:"max=255"`                                           // 组织默认部署通道
 	Status      string `form:"status" json:"status" binding:"omitempty,oneof=enable disable" enums:"enable,disable"` // 组织状态
+
+	// 组织默认 state 存储后端，只影响之后新建的环境，传空值表示使用系统配置
+	StateBackend string `form:"stateBackend" json:"stateBackend" binding:"omitempty,oneof=consul s3 http pg" enums:"consul,s3,http,pg"`
+
+	MfaRequired bool `form:"mfaRequired" json:"mfaRequired"` // 是否要求组织成员启用多因素认证
+
+	QueueWeight int `form:"queueWeight" json:"queueWeight" binding:"omitempty,min=1,max=100"` // 任务调度权重，需要平台管理员权限
 }
 
 type SearchOrganizationForm struct {
@@ -60,12 +67,12 @@ type OrganizationParam struct {
 type InviteUserForm struct {
 	BaseForm
 
-	Id     models.Id `uri:"id" json:"id" binding:"required,startswith=org-,max=32" swaggerignore:"true"`                                       // 组织ID
-	UserId models.Id `form:"userId"  json:"userId" binding:"required_without_all=Name Email,omitempty,startswith=u-,max=32"`                   // 用户ID，用户ID 或 用户名+邮箱必须填写一个
-	Name   string    `form:"name" json:"name" binding:"required_without=UserId,required_with=Email,omitempty,gte=2,lte=32"`                    // 用户名
-	Email  string    `form:"email" json:"email" binding:"required_without=UserId,required_with=Name,omitempty,email,max=64"`                   // 电子邮件地址
-	Role   string    `form:"role" json:"role" binding:"omitempty,oneof=admin member complianceManager" enums:"admin,member,complianceManager"` // 受邀请用户在组织中的角色，组织管理员：admin，普通用户：member
-	Phone  string    `form:"phone" json:"phone" binding:"max=11"`                                                                              // 用户手机号
+	Id     models.Id `uri:"id" json:"id" binding:"required,startswith=org-,max=32" swaggerignore:"true"`                     // 组织ID
+	UserId models.Id `form:"userId"  json:"userId" binding:"required_without_all=Name Email,omitempty,startswith=u-,max=32"` // 用户ID，用户ID 或 用户名+邮箱必须填写一个
+	Name   string    `form:"name" json:"name" binding:"required_without=UserId,required_with=Email,omitempty,gte=2,lte=32"`  // 用户名
+	Email  string    `form:"email" json:"email" binding:"required_without=UserId,required_with=Name,omitempty,email,max=64"` // 电子邮件地址
+	Role   string    `form:"role" json:"role" binding:"omitempty,max=32" enums:"admin,member,complianceManager"`             // 受邀请用户在组织中的角色，组织管理员：admin，普通用户：member，也可以是自定义组织角色ID
+	Phone  string    `form:"phone" json:"phone" binding:"max=11"`                                                            // 用户手机号
 }
 
 type SearchOrgResourceForm struct {
@@ -78,9 +85,9 @@ type SearchOrgResourceForm struct {
 type InviteUsersBatchForm struct {
 	BaseForm
 
-	Id    models.Id `uri:"id" json:"id" binding:"required,startswith=org-,max=32" swaggerignore:"true"`   // 组织ID
-	Email []string  `form:"email" json:"email" binding:"required,dive,required,email,max=64"`             // 电子邮件地址
-	Role  string    `form:"role" json:"role" binding:"omitempty,oneof=admin member" enums:"admin,member"` // 受邀请用户在组织中的角色，组织管理员：admin，普通用户：member
+	Id    models.Id `uri:"id" json:"id" binding:"required,startswith=org-,max=32" swaggerignore:"true"` // 组织ID
+	Email []string  `form:"email" json:"email" binding:"required,dive,required,email,max=64"`           // 电子邮件地址
+	Role  string    `form:"role" json:"role" binding:"omitempty,max=32" enums:"admin,member"`           // 受邀请用户在组织中的角色，组织管理员：admin，普通用户：member，也可以是自定义组织角色ID
 }
 
 type OrgProjectsStatForm struct {
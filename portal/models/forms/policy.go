@@ -254,6 +254,8 @@ type PolicyTestForm struct {
 
 	Input string `form:"input" json:"input" binding:"required" example:"{\n\"alicloud_instance\": [\n\n{\t\n\"id\": \"alicloud_instance.instance\"..."` // 脚本验证源数据
 	Rego  string `form:"rego" json:"rego" binding:"required" example:"package accurics\ninstanceWithNoVpc[retVal] {..."`                                // rego脚本内容
+
+	InputType string `form:"inputType" json:"inputType" binding:"omitempty,oneof=hcl plan" enums:"'hcl','plan'"` // 策略输入类型，plan 类型的输入为执行计划策略的输入(plan/summary/cost)
 }
 
 type PolicyLastTasksForm struct {
@@ -0,0 +1,17 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+type UploadPriceCatalogForm struct {
+	BaseForm
+
+	Content string `json:"content" form:"content" binding:"required"`                                                     // 价格目录文件内容
+	Format  string `json:"format" form:"format" binding:"omitempty,oneof=yaml json" enums:"'yaml','json'" default:"yaml"` // 文件格式
+}
+
+type PriceCatalogParam struct {
+	BaseForm
+
+	Provider string `uri:"provider" json:"provider" swaggerignore:"true" binding:"required"`
+	Version  string `uri:"version" json:"version" swaggerignore:"true" binding:"required"`
+}
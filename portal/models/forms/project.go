@@ -30,9 +30,10 @@ type UpdateProjectForm struct {
 	BaseForm
 
 	Id          models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=p-,max=32"`
-	Status      string    `json:"status" form:"status" binding:"omitempty,oneof=enable disable"` // 项目状态 ('enable','disable')
-	Name        string    `json:"name" form:"name" binding:"omitempty,gte=2,lte=64" `            // 项目名称
-	Description string    `json:"description" form:"description" binding:"max=255"`              // 项目描述
+	Status      string    `json:"status" form:"status" binding:"omitempty,oneof=enable disable"`    // 项目状态 ('enable','disable')
+	Name        string    `json:"name" form:"name" binding:"omitempty,gte=2,lte=64" `               // 项目名称
+	Description string    `json:"description" form:"description" binding:"max=255"`                 // 项目描述
+	QueueWeight int       `json:"queueWeight" form:"queueWeight" binding:"omitempty,min=1,max=100"` // 任务调度权重，需要平台管理员权限
 }
 
 type DeleteProjectForm struct {
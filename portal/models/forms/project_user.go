@@ -7,8 +7,8 @@ import "cloudiac/portal/models"
 type CreateProjectUserForm struct {
 	BaseForm
 
-	UserId []models.Id `json:"userId" form:"userId" binding:"required,dive,required,startswith=u-,max=32"`                                         // 用户id
-	Role   string      `json:"role" form:"role" binding:"required,oneof=manager approver operator guest" enums:"'manager,approver,operator,guest"` // 角色 (manager,approver,operator,guest)
+	UserId []models.Id `json:"userId" form:"userId" binding:"required,dive,required,startswith=u-,max=32"`          // 用户id
+	Role   string      `json:"role" form:"role" binding:"required,max=32" enums:"'manager,approver,operator,guest"` // 角色 (manager,approver,operator,guest)，也可以是自定义项目角色ID
 }
 
 type DeleteProjectOrgUserForm struct {
@@ -20,7 +20,7 @@ type UpdateProjectUserForm struct {
 	BaseForm
 	Id models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=u-,max=32" swaggerignore:"true"`
 	//UserId models.Id `json:"userId" form:"userId" `                                     // 用户id
-	Role string `json:"role" form:"role" binding:"required,oneof=manager approver operator guest" enums:"'manager,approver,operator,guest"` // 角色 (manager,approver,operator,guest)
+	Role string `json:"role" form:"role" binding:"required,max=32" enums:"'manager,approver,operator,guest"` // 角色 (manager,approver,operator,guest)，也可以是自定义项目角色ID
 }
 
 type SearchProjectAuthorizationUserForm struct {
@@ -0,0 +1,34 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchEnvDriftForm struct {
+	PageForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true"`                                                                                                   // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Status string    `json:"status" form:"status" binding:"omitempty,oneof=drifted acknowledged ignored resolved" enums:"drifted,acknowledged,ignored,resolved"` // 漂移状态，默认返回所有未恢复的漂移
+	Q      string    `json:"q" form:"q" binding:"max=255"`                                                                                                       // 资源地址，支持模糊查询
+}
+
+type UpdateEnvDriftForm struct {
+	BaseForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true"`                                                                                // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	DriftId models.Id `uri:"driftId" json:"driftId" swaggerignore:"true"`                                                                      // 漂移记录ID，swagger 参数通过 param path 指定，这里忽略
+	Status  string    `json:"status" form:"status" binding:"required,oneof=drifted acknowledged ignored" enums:"drifted,acknowledged,ignored"` // acknowledged 确认漂移，ignored 忽略该属性的漂移，drifted 取消确认或忽略
+}
+
+type DriftTrendForm struct {
+	BaseForm
+
+	Days int `json:"days" form:"days" binding:"omitempty,min=1,max=180"` // 统计最近多少天的趋势，默认 30 天
+}
+
+type EnvDriftTrendForm struct {
+	BaseForm
+
+	Id   models.Id `uri:"id" json:"id" swaggerignore:"true"`                   // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Days int       `json:"days" form:"days" binding:"omitempty,min=1,max=180"` // 统计最近多少天的趋势，默认 30 天
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchRoleForm struct {
+	NoPageSizeForm
+
+	Q     string `json:"q" form:"q"`                                                                   // 角色名称，支持模糊搜索
+	Scope string `json:"scope" form:"scope" binding:"omitempty,oneof=org project" enums:"org,project"` // 角色类型，不传时返回所有自定义角色
+}
+
+type RolePermissionsForm struct {
+	BaseForm
+
+	Scope string `json:"scope" form:"scope" binding:"required,oneof=org project" enums:"org,project"` // 角色类型
+}
+
+type CreateRoleForm struct {
+	BaseForm
+
+	Name        string   `json:"name" form:"name" binding:"required,max=64"`                                  // 角色名称
+	Scope       string   `json:"scope" form:"scope" binding:"required,oneof=org project" enums:"org,project"` // 角色类型，组织角色或者项目角色
+	Description string   `json:"description" form:"description" binding:"max=255"`                            // 角色描述
+	Permissions []string `json:"permissions" form:"permissions" binding:"required,dive,required"`             // 权限列表，格式为 资源:动作，如 envs:deploy
+}
+
+type UpdateRoleForm struct {
+	BaseForm
+
+	Id          models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=role-,max=32" swaggerignore:"true"`
+	Name        string    `json:"name" form:"name" binding:"omitempty,max=64"`                      // 角色名称
+	Description string    `json:"description" form:"description" binding:"max=255"`                 // 角色描述
+	Permissions []string  `json:"permissions" form:"permissions" binding:"omitempty,dive,required"` // 权限列表，格式为 资源:动作，如 envs:deploy
+}
+
+type DetailRoleForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=role-,max=32" swaggerignore:"true"`
+}
+
+type DeleteRoleForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" form:"id" binding:"required,startswith=role-,max=32" swaggerignore:"true"`
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+import (
+	"cloudiac/portal/models"
+)
+
+type CreateRunnerJoinTokenForm struct {
+	BaseForm
+
+	Tags   []string `json:"tags" form:"tags"`                                            // 使用该令牌注册的 runner 的标签
+	Expire int      `json:"expire" form:"expire" binding:"omitempty,min=60,max=2592000"` // 令牌有效期(秒)，默认 1 小时
+}
+
+type SearchRunnerAgentForm struct {
+	PageForm
+
+	Q string `form:"q" json:"q" binding:""` // 按名称模糊搜索
+}
+
+type DeleteRunnerAgentForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" form:"id" json:"id" binding:"required,startswith=rag-,max=32" swaggerignore:"true"`
+}
+
+type RunnerAgentJoinForm struct {
+	BaseForm
+
+	Token string `json:"token" form:"token" binding:"required,max=128"` // 注册令牌
+	Name  string `json:"name" form:"name" binding:"required,max=255"`   // runner 名称
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type CreateStackRunForm struct {
+	BaseForm
+
+	Name        string      `form:"name" json:"name" binding:"required,lte=255"`                                                     // 编排名称
+	EnvIds      []models.Id `form:"envIds" json:"envIds" binding:"required,min=1"`                                                   // 环境ID列表
+	TaskType    string      `form:"taskType" json:"taskType" binding:"required,oneof=plan apply destroy" enums:"plan,apply,destroy"` // 任务类型
+	Mode        string      `form:"mode" json:"mode" binding:"omitempty,oneof=failFast continue" enums:"failFast,continue"`          // 任务失败时的处理方式: failFast 中止所有未开始的任务(默认), continue 只中止依赖失败任务的任务
+	AutoApprove bool        `form:"autoApprove" json:"autoApprove"`                                                                  // 是否自动审批
+}
+
+type SearchStackRunForm struct {
+	PageForm
+
+	Status string `form:"status" json:"status" binding:"omitempty"` // 编排状态
+}
+
+type StackRunParam struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=stack-,max=32"` // 编排ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type ApproveStackRunForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=stack-,max=32"`              // 编排ID，swagger 参数通过 param path 指定，这里忽略
+	Action string    `form:"action" json:"action" binding:"required,oneof=approved rejected" enums:"approved,rejected"` // 审批动作：approved通过, rejected驳回
+}
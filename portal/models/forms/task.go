@@ -71,8 +71,13 @@ const (
 type ApproveTaskForm struct {
 	BaseForm
 
-	Id     models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"`                // 任务ID，swagger 参数通过 param path 指定，这里忽略
-	Action string    `form:"action" json:"action" binding:"required,oneof=approved rejected" enums:"approved,rejected"` // 审批动作：approved通过, rejected驳回
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"`                // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	Action  string    `form:"action" json:"action" binding:"required,oneof=approved rejected" enums:"approved,rejected"` // 审批动作：approved通过, rejected驳回
+	Comment string    `form:"comment" json:"comment" binding:"max=1024"`                                                 // 审批意见
+
+	// 紧急变更，在冻结期或者变更窗口外通过审批，需要组织管理员或者项目管理者权限
+	EmergencyOverride bool   `form:"emergencyOverride" json:"emergencyOverride"`
+	OverrideReason    string `form:"overrideReason" json:"overrideReason" binding:"max=255"` // 紧急变更原因
 }
 
 type AbortTaskForm struct {
@@ -85,7 +90,7 @@ type SearchEnvTasksForm struct {
 	NoPageSizeForm
 
 	Id       models.Id `uri:"id" json:"id" swaggerignore:"true" bingding:"omitempty,startswith=env-,max=32"`                                        // 环境ID，swagger 参数通过 param path 指定，这里忽略
-	TaskType string    `form:"taskType" json:"taskType" binding:"omitempty,oneof=plan apply destroy scan"`                                          // 任务类型
+	TaskType string    `form:"taskType" json:"taskType" binding:"omitempty,oneof=plan apply destroy scan import state"`                             // 任务类型
 	Source   string    `form:"source" json:"source" binding:"omitempty,oneof=manual driftPlan driftApply webhookPlan webhookApply autoDestroy api"` // 触发类型
 	User     string    `form:"user" json:"user"`                                                                                                    // 可根据执行人姓名或邮箱模糊查询
 }
@@ -116,3 +121,16 @@ type SearchTaskResourceGraphForm struct {
 	Id        models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
 	Dimension string    `json:"dimension" form:"dimension" binding:"required"`                              // 资源名称，支持模糊查询
 }
+
+type SearchTaskEventForm struct {
+	NoPageSizeForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type RecoverTaskForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	LockId string    `json:"lockId" form:"lockId" binding:"max=64"`                                      // 需要解除的 state 锁 id，使用 portal 托管 state 时可不传
+}
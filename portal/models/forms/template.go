@@ -29,8 +29,9 @@ type CreateTemplateForm struct {
 	Playbook     string      `json:"playbook" form:"playbook" binding:"omitempty,max=255"`
 	PlayVarsFile string      `json:"playVarsFile" form:"playVarsFile" binding:"max=255"`
 	TfVarsFile   string      `form:"tfVarsFile" json:"tfVarsFile" binding:"max=255"`
-	ProjectId    []models.Id `form:"projectId" json:"projectId" binding:"omitempty,dive,required,startswith=p-,max=32"` // 项目ID
-	TfVersion    string      `form:"tfVersion" json:"tfVersion" binding:"max=255"`                                      // 模版使用terraform版本号
+	ProjectId    []models.Id `form:"projectId" json:"projectId" binding:"omitempty,dive,required,startswith=p-,max=32"`                  // 项目ID
+	TfVersion    string      `form:"tfVersion" json:"tfVersion" binding:"max=255"`                                                       // 模版使用terraform版本号
+	IacEngine    string      `form:"iacEngine" json:"iacEngine" binding:"omitempty,oneof=terraform opentofu" enums:"terraform,opentofu"` // IaC 引擎，默认为 terraform
 
 	Variables []Variable `json:"variables" form:"variables" binding:"omitempty,dive,required"`
 
@@ -69,6 +70,7 @@ type UpdateTemplateForm struct {
 	RepoId         string      `form:"repoId" json:"repoId" binding:"max=255"`
 	RepoFullName   string      `form:"repoFullName" json:"repoFullName" binding:"max=255"`
 	TfVersion      string      `form:"tfVersion" json:"tfVersion" binding:"max=64"`
+	IacEngine      string      `form:"iacEngine" json:"iacEngine" binding:"omitempty,oneof=terraform opentofu" enums:"terraform,opentofu"` // IaC 引擎
 	Variables      []Variable  `json:"variables" form:"variables" binding:"omitempty,dive,required"`
 	VarGroupIds    []models.Id `json:"varGroupIds" form:"varGroupIds" binding:"omitempty,dive,required,startswith=vg-,max=32"`
 	DelVarGroupIds []models.Id `json:"delVarGroupIds" form:"delVarGroupIds" binding:"omitempty,dive,required,startswith=vg-,max=32"`
@@ -115,8 +117,14 @@ type TemplateVariableSearchForm struct {
 	Workdir      string    `json:"workdir" form:"workdir" binding:"max=255"`
 }
 
+type TfVersionListForm struct {
+	BaseForm
+	IacEngine string `json:"iacEngine" form:"iacEngine" binding:"omitempty,oneof=terraform opentofu" enums:"terraform,opentofu"` // IaC 引擎，默认为 terraform
+}
+
 type TemplateTfVersionSearchForm struct {
 	BaseForm
+	IacEngine string    `json:"iacEngine" form:"iacEngine" binding:"omitempty,oneof=terraform opentofu" enums:"terraform,opentofu"` // IaC 引擎，默认为 terraform
 	VcsId     models.Id `json:"vcsId" form:"vcsId" binding:"required,max=32"`
 	VcsBranch string    `json:"vcsBranch" form:"vcsBranch" binding:"max=64"`
 	RepoId    string    `json:"repoId" form:"repoId" binding:"max=255"`
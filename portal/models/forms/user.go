@@ -53,9 +53,9 @@ type DetailUserForm struct {
 type AddUserOrgRelForm struct {
 	BaseForm
 
-	Id     models.Id `uri:"id" json:"id" binding:"required,startswith=org-,max=32" swaggerignore:"true"`  // 组织ID
-	UserId models.Id `form:"userId" json:"userId" binding:"required,startswith=u-,max=32"`                // 用户ID
-	Role   string    `form:"role" json:"role" binding:"required,oneof=admin member" enums:"admin,member"` // 用户在组织中的角色，组织管理员：admin，普通用户：member，默认 member
+	Id     models.Id `uri:"id" json:"id" binding:"required,startswith=org-,max=32" swaggerignore:"true"` // 组织ID
+	UserId models.Id `form:"userId" json:"userId" binding:"required,startswith=u-,max=32"`               // 用户ID
+	Role   string    `form:"role" json:"role" binding:"required,max=32" enums:"admin,member"`            // 用户在组织中的角色，组织管理员：admin，普通用户：member，也可以是自定义组织角色ID
 }
 
 type DeleteUserOrgRelForm struct {
@@ -68,9 +68,9 @@ type DeleteUserOrgRelForm struct {
 type UpdateUserOrgRelForm struct {
 	BaseForm
 
-	Id     models.Id `uri:"id" json:"id" binding:"required,startswith=org-,max=32" swaggerignore:"true"`                                      // 组织ID
-	UserId models.Id `uri:"userId" json:"userId" binding:"required,contains=u-,max=32" swaggerignore:"true"`                                  // 用户ID
-	Role   string    `form:"role" json:"role" binding:"required,oneof=admin complianceManager member" enums:"admin,complianceManager,member"` // 用户在组织中的角色，组织管理员：admin，普通用户：member，默认 member
+	Id     models.Id `uri:"id" json:"id" binding:"required,startswith=org-,max=32" swaggerignore:"true"`        // 组织ID
+	UserId models.Id `uri:"userId" json:"userId" binding:"required,contains=u-,max=32" swaggerignore:"true"`    // 用户ID
+	Role   string    `form:"role" json:"role" binding:"required,max=32" enums:"admin,complianceManager,member"` // 用户在组织中的角色，组织管理员：admin，普通用户：member，也可以是自定义组织角色ID
 }
 
 type UpdateUserOrgForm struct {
@@ -80,5 +80,5 @@ type UpdateUserOrgForm struct {
 	UserId models.Id `uri:"userId" json:"userId" binding:"required,contains=u-,max=32" swaggerignore:"true"` // 用户ID
 	Name   string    `form:"name" json:"name" binding:"gte=2,lte=32"`                                        // 用户名
 	Phone  string    `form:"phone" json:"phone" binding:"max=11"`
-	Role   string    `form:"role" json:"role" binding:"required,oneof=admin complianceManager member" enums:"admin,complianceManager,member"` // 用户在组织中的角色，组织管理员：admin，普通用户：member，默认 member
+	Role   string    `form:"role" json:"role" binding:"required,max=32" enums:"admin,complianceManager,member"` // 用户在组织中的角色，组织管理员：admin，普通用户：member，也可以是自定义组织角色ID
 }
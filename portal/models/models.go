@@ -228,6 +228,7 @@ func Init(migrate bool) {
 	autoMigrate(&Token{}, sess)
 	autoMigrate(&Key{}, sess)
 	autoMigrate(&TaskComment{}, sess)
+	autoMigrate(&TaskEvent{}, sess)
 	autoMigrate(&ProjectTemplate{}, sess)
 	autoMigrate(&Policy{}, sess)
 	autoMigrate(&PolicyGroup{}, sess)
@@ -237,14 +238,35 @@ func Init(migrate bool) {
 	autoMigrate(&VariableGroup{}, sess)
 	autoMigrate(&VariableGroupRel{}, sess)
 	autoMigrate(&ResourceDrift{}, sess)
+	autoMigrate(&ResourceDriftRecord{}, sess)
 	autoMigrate(&VariableGroupProjectRel{}, sess)
 
 	autoMigrate(&Bill{}, sess)
 	autoMigrate(&BillData{}, sess)
 	autoMigrate(&LdapOUOrg{}, sess)
 	autoMigrate(&LdapOUProject{}, sess)
+	autoMigrate(&OidcGroupRole{}, sess)
+	autoMigrate(&OidcLoginCode{}, sess)
+	autoMigrate(&Role{}, sess)
+	autoMigrate(&EnvUser{}, sess)
+	autoMigrate(&ApproverGroup{}, sess)
+	autoMigrate(&TaskApproval{}, sess)
+	autoMigrate(&ApprovalRule{}, sess)
+	autoMigrate(&ChangeWindow{}, sess)
 
 	autoMigrate(&UserOperationLog{}, sess)
 
+	autoMigrate(&StateVersion{}, sess)
+	autoMigrate(&StateLock{}, sess)
+	autoMigrate(&EnvDependency{}, sess)
+	autoMigrate(&EnvChain{}, sess)
+	autoMigrate(&StackRun{}, sess)
+	autoMigrate(&StackRunTask{}, sess)
+	autoMigrate(&RunnerAgent{}, sess)
+	autoMigrate(&RunnerJoinToken{}, sess)
+	autoMigrate(&ServiceInstance{}, sess)
+	autoMigrate(&Lease{}, sess)
+	autoMigrate(&RunnerEventConn{}, sess)
+
 	dbMigrate(sess)
 }
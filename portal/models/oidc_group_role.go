@@ -0,0 +1,24 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// OidcGroupRole OIDC 用户组与组织、项目角色的映射
+// 用户通过 OIDC 登录时，根据 ID token 中的用户组为用户授予对应的组织及项目角色
+type OidcGroupRole struct {
+	TimedModel
+
+	OrgId     Id     `json:"orgId" gorm:"size:32;not null;comment:组织ID"`
+	ProjectId Id     `json:"projectId" gorm:"size:32;not null;default:''"` // 为空时表示组织角色
+	Group     string `json:"group" gorm:"size:255;not null"`               // ID token 中的用户组名称
+	Role      string `json:"role" gorm:"size:32;not null"`                 // 组织或者项目角色
+}
+
+func (OidcGroupRole) TableName() string {
+	return "iac_oidc_group_role"
+}
+
+func (r OidcGroupRole) Migrate(sess *db.Session) error {
+	return r.AddUniqueIndex(sess, "unique__org__project__group", "org_id", "project_id", "`group`")
+}
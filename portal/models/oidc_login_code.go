@@ -0,0 +1,16 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+// OidcLoginCode oidc 登录成功后换取用户 token 的临时 code，换取时删除，保证每个 code 只能使用一次
+type OidcLoginCode struct {
+	AbstractModel
+
+	Id        string `json:"id" gorm:"size:64;primary_key"` // code 的 jwt id
+	UserId    Id     `json:"userId" gorm:"size:32;not null"`
+	ExpiredAt Time   `json:"expiredAt" gorm:"type:datetime;not null;index"`
+}
+
+func (OidcLoginCode) TableName() string {
+	return "iac_oidc_login_code"
+}
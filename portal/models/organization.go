@@ -21,8 +21,14 @@ type Organization struct {
 	Status      string `json:"status" gorm:"type:enum('enable','disable');default:'enable';comment:组织状态" example:"enable" enums:"enable,disable"` // 组织状态
 	CreatorId   Id     `json:"creatorId" gorm:"size:32;not null;comment:创建人" example:"u-c3ek0co6n88ldvq1n6ag"`                                    //创建人ID
 	RunnerId    string `json:"runnerId" gorm:"not null" example:"runner-01"`                                                                      // 组织默认部署通道
+	// 组织默认的 state 存储后端，组织下新建的环境未指定 backend 时使用该值，为空则使用系统配置
+	StateBackend string `json:"stateBackend" gorm:"size:32;default:''" example:"s3"`
 
 	IsDemo bool `json:"isDemo" gorm:"default:false"` // 是否演示组织
+
+	MfaRequired bool `json:"mfaRequired" gorm:"default:false"` // 是否要求组织成员启用多因素认证
+
+	QueueWeight int `json:"queueWeight" gorm:"default:1"` // 任务调度权重，权重越大可同时执行的任务越多
 }
 
 func (Organization) TableName() string {
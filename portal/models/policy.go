@@ -12,6 +12,14 @@ import (
 
 const MaxTagSize = 16
 
+const (
+	PolicyInputTypeHCL  = "hcl"  // 基于 terrascan 解析的 HCL 资源进行检查
+	PolicyInputTypePlan = "plan" // 基于 terraform show -json 输出的执行计划进行检查
+
+	PolicyEnforcementDeny     = "deny"     // 不通过时标记为违规，任务开启了 StopOnViolation 时中止任务
+	PolicyEnforcementApproval = "approval" // 不通过时任务需要人工审批(即使开启了自动审批)
+)
+
 type Policy struct {
 	SoftDeleteModel
 
@@ -32,6 +40,9 @@ type Policy struct {
 	Tags         string `json:"tags" gorm:"comment:标签" example:"security,aliyun"`
 
 	Rego string `json:"rego" gorm:"type:text;comment:rego脚本" example:"package idcos ..."`
+
+	InputType   string `json:"inputType" gorm:"size:32;default:'hcl';comment:策略输入类型" enums:"'hcl','plan'" example:"hcl"`
+	Enforcement string `json:"enforcement" gorm:"size:32;default:'deny';comment:执行计划策略不通过时的处理方式" enums:"'deny','approval'" example:"deny"`
 }
 
 func (Policy) TableName() string {
@@ -45,6 +56,11 @@ func (p *Policy) CustomBeforeCreate(*db.Session) error {
 	return nil
 }
 
+// IsPlanPolicy 是否为基于执行计划进行检查的策略
+func (p *Policy) IsPlanPolicy() bool {
+	return p.InputType == PolicyInputTypePlan
+}
+
 func (p *Policy) Validate() error {
 	return p.ValidateAttrs(Attrs{
 		"tags": p.Tags,
@@ -14,6 +14,8 @@ type Project struct {
 	Status      string `json:"status" gorm:"type:enum('enable','disable');default:'enable';comment:状态"`
 
 	IsDemo bool `json:"isDemo"`
+
+	QueueWeight int `json:"queueWeight" gorm:"default:1"` // 任务调度权重，权重越大可同时执行的任务越多
 }
 
 func (Project) TableName() string {
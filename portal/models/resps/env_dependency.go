@@ -0,0 +1,29 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package resps
+
+import "cloudiac/portal/models"
+
+type EnvDependencyItem struct {
+	Id     models.Id `json:"id"`
+	Name   string    `json:"name"`
+	Status string    `json:"status"`
+}
+
+type EnvDependencyResp struct {
+	DependsOn  []EnvDependencyItem `json:"dependsOn"`  // 当前环境依赖的环境
+	Dependents []EnvDependencyItem `json:"dependents"` // 依赖当前环境的环境
+}
+
+type EnvChainTaskItem struct {
+	EnvId      models.Id `json:"envId"`
+	EnvName    string    `json:"envName"`
+	TaskId     models.Id `json:"taskId"`     // 未创建任务时为空
+	TaskStatus string    `json:"taskStatus"` // 未创建任务时为空
+}
+
+type EnvChainResp struct {
+	models.EnvChain
+
+	Tasks []EnvChainTaskItem `json:"tasks"` // 按执行顺序排列
+}
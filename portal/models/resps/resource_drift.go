@@ -0,0 +1,11 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package resps
+
+// DriftTrendPoint 某一天结束时处于漂移状态的数量统计
+type DriftTrendPoint struct {
+	Date      string `json:"date" example:"2006-01-02"`
+	Attrs     int    `json:"attrs"`     // 漂移的属性数量
+	Resources int    `json:"resources"` // 漂移的资源数量
+	Envs      int    `json:"envs"`      // 存在漂移的环境数量
+}
@@ -0,0 +1,9 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package resps
+
+// RolePermissionResp 自定义角色可以授予的权限
+type RolePermissionResp struct {
+	Obj  string   `json:"obj"`  // 资源名称
+	Acts []string `json:"acts"` // 资源允许的动作
+}
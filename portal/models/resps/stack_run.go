@@ -0,0 +1,19 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package resps
+
+import "cloudiac/portal/models"
+
+type StackRunTaskItem struct {
+	EnvId      models.Id   `json:"envId"`
+	EnvName    string      `json:"envName"`
+	TaskId     models.Id   `json:"taskId"`
+	TaskStatus string      `json:"taskStatus"`
+	DependsOn  []models.Id `json:"dependsOn"` // 需要先执行完成的任务 id
+}
+
+type StackRunResp struct {
+	models.StackRun
+
+	Tasks []StackRunTaskItem `json:"tasks"` // 按执行顺序排列
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package resps
+
+type StateResourceChange struct {
+	Address    string   `json:"address"`    // 资源地址，如 module.vpc.aws_vpc.this[0]
+	Attributes []string `json:"attributes"` // 发生变化的属性
+}
+
+// StateVersionDiffResp 两个 state 版本之间的资源及输出差异
+type StateVersionDiffResp struct {
+	FromVersion string `json:"fromVersion"`
+	ToVersion   string `json:"toVersion"`
+
+	Added   []string              `json:"added"`
+	Removed []string              `json:"removed"`
+	Changed []StateResourceChange `json:"changed"`
+
+	OutputsAdded   []string `json:"outputsAdded"`
+	OutputsRemoved []string `json:"outputsRemoved"`
+	OutputsChanged []string `json:"outputsChanged"`
+}
@@ -2,7 +2,11 @@
 
 package resps
 
-import "cloudiac/portal/models"
+import (
+	"cloudiac/portal/models"
+
+	"github.com/hashicorp/consul/api"
+)
 
 type SearchSystemConfigResp struct {
 	Id          models.Id `json:"id"`
@@ -37,6 +41,24 @@ type SystemStatusResp struct {
 	//Warn     uint64 `json:"warn" form:"warn" `
 }
 
+type RunnerResp struct {
+	*api.AgentService
+
+	Slots int `json:"slots"` // 可同时执行的任务数量
+	Load  int `json:"load"`  // 正在执行的任务数量
+}
+
+type RunnerJoinTokenResp struct {
+	models.RunnerJoinToken
+
+	Token string `json:"token"` // 令牌明文，只在创建时返回
+}
+
+type RunnerAgentJoinResp struct {
+	RunnerId string `json:"runnerId"`
+	Secret   string `json:"secret"` // agent 连接 portal 使用的密钥
+}
+
 type RunnerTagsResp struct {
 	Tags []string `json:"tags"`
 }
@@ -7,6 +7,23 @@ import "cloudiac/portal/models"
 type LoginResp struct {
 	//UserInfo *models.User
 	Token string `json:"token" example:"eyJhbGciO..."` // 登陆令牌
+
+	// 用户需要进行多因素认证时不返回 token，而是返回 mfaToken，
+	// mfaRequired 为 true 时使用 mfaToken 和验证码调用 /auth/login/mfa 完成登录，
+	// mfaEnrollRequired 为 true 时用户被要求启用多因素认证，使用 mfaToken 调用 /auth/mfa/enroll 绑定认证器
+	MfaRequired       bool   `json:"mfaRequired,omitempty"`
+	MfaEnrollRequired bool   `json:"mfaEnrollRequired,omitempty"`
+	MfaToken          string `json:"mfaToken,omitempty"`
+}
+
+type MfaEnrollResp struct {
+	Secret string `json:"secret"` // base32 编码的 TOTP 密钥，用于手动输入
+	Url    string `json:"url"`    // otpauth 地址，用于生成二维码
+}
+
+type MfaEnrollConfirmResp struct {
+	RecoveryCodes []string `json:"recoveryCodes"`   // 恢复码，只返回一次，每个恢复码只能使用一次
+	Token         string   `json:"token,omitempty"` // 通过 mfaToken 绑定时返回登录令牌
 }
 
 type SsoResp struct {
@@ -17,3 +34,8 @@ type VerifySsoTokenResp struct {
 	UserId models.Id `json:"userId"`
 	Email  string    `json:"email"`
 }
+
+type OidcConfigResp struct {
+	Enabled      bool   `json:"enabled"`      // 是否启用 oidc 单点登录
+	ProviderName string `json:"providerName"` // 登录页面展示的 IdP 名称
+}
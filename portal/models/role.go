@@ -0,0 +1,35 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"strings"
+)
+
+const RoleIdPrefix = "role"
+
+// Role 组织自定义角色
+// 自定义角色的 id 即为 rbac 策略中的角色名称，可以像内置角色一样授予组织或者项目用户
+type Role struct {
+	TimedModel
+
+	OrgId       Id       `json:"orgId" gorm:"size:32;not null;comment:组织ID"`
+	Name        string   `json:"name" gorm:"size:64;not null"`
+	Scope       string   `json:"scope" gorm:"type:enum('org','project');not null" enums:"org,project"` // 角色类型，组织角色或者项目角色
+	Description string   `json:"description" gorm:"size:255;default:''"`
+	Permissions StrSlice `json:"permissions" gorm:"type:json"` // 权限列表，格式为 资源:动作，如 envs:deploy，动作为 * 表示资源的所有权限
+}
+
+func (Role) TableName() string {
+	return "iac_role"
+}
+
+func (r Role) Migrate(sess *db.Session) error {
+	return r.AddUniqueIndex(sess, "unique__org__name", "org_id", "name")
+}
+
+// IsCustomRole 判断角色是否为自定义角色
+func IsCustomRole(role string) bool {
+	return strings.HasPrefix(role, RoleIdPrefix+"-")
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+const (
+	RunnerAgentOnline  = "online"
+	RunnerAgentOffline = "offline"
+)
+
+// RunnerAgent 以 agent 模式运行的 runner，agent 主动连接 portal 接收任务，不需要注册到 consul
+type RunnerAgent struct {
+	TimedModel // Id 即为 runnerId
+
+	Name       string   `json:"name" gorm:"size:64;not null"`
+	Tags       StrSlice `json:"tags" gorm:"type:json"`
+	SecretHash string   `json:"-" gorm:"size:64;not null"` // agent 连接 portal 使用的密钥的 sha256 值
+	Slots      int      `json:"slots" gorm:"default:0"`    // 可同时执行的任务数量，为 0 时使用系统设置
+	Version    string   `json:"version" gorm:"size:64;default:''"`
+
+	Status     string `json:"status" gorm:"type:enum('online','offline');default:'offline'"`
+	PortalAddr string `json:"-" gorm:"size:255;default:''"` // 当前持有 agent 连接的 portal 实例地址
+	LastSeenAt *Time  `json:"lastSeenAt" gorm:"type:datetime"`
+}
+
+func (RunnerAgent) TableName() string {
+	return "iac_runner_agent"
+}
+
+// RunnerJoinToken runner agent 注册使用的一次性令牌
+type RunnerJoinToken struct {
+	TimedModel
+
+	TokenHash string   `json:"-" gorm:"size:64;not null"` // 令牌的 sha256 值
+	Tags      StrSlice `json:"tags" gorm:"type:json"`     // 使用该令牌注册的 runner 的 tags
+	CreatorId Id       `json:"creatorId" gorm:"size:32;not null"`
+	ExpiredAt *Time    `json:"expiredAt" gorm:"type:datetime"`
+	UsedAt    *Time    `json:"usedAt" gorm:"type:datetime"`
+	RunnerId  Id       `json:"runnerId" gorm:"size:32;default:''"` // 使用该令牌注册的 runner
+}
+
+func (RunnerJoinToken) TableName() string {
+	return "iac_runner_join_token"
+}
+
+func (t RunnerJoinToken) Migrate(sess *db.Session) error {
+	return t.AddUniqueIndex(sess, "unique__token_hash", "token_hash")
+}
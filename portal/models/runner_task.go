@@ -25,6 +25,10 @@ type BaseTask struct {
 	StepTimeout int `json:"stepTimeout" gorm:"default:3600;comment:执行超时"`
 
 	RunnerId string `json:"runnerId" gorm:"not null"` // 部署通道
+	// 部署通道由系统自动选择时，任务开始执行前会根据 RunnerTags 重新选择负载最低的 runner
+	AutoRunner bool   `json:"autoRunner" gorm:"default:false"`
+	RunnerTags string `json:"runnerTags" gorm:"default:''"`
+	Priority   int    `json:"priority" gorm:"default:0"` // 调度优先级，值越大越优先执行
 
 	Status   string `json:"status" gorm:"type:enum('pending','running','approving','rejected','failed','complete','timeout','aborted');default:'pending'" enums:"'pending','running','approving','rejected','failed','complete','timeout'"`
 	Message  string `json:"message" gorm:"type:text"` // 任务的状态描述信息，如失败原因等
@@ -61,6 +65,7 @@ type ScanTask struct {
 	Playbook     string `json:"playbook" gorm:"default:''"`
 	TfVarsFile   string `json:"tfVarsFile" gorm:"default:''"`
 	TfVersion    string `json:"tfVersion" gorm:"default:''"`
+	IacEngine    string `json:"iacEngine" gorm:"size:16;default:''"`
 	PlayVarsFile string `json:"playVarsFile" gorm:"default:''"`
 
 	Variables TaskVariables `json:"variables" gorm:"type:json"` // 本次执行使用的所有变量(继承、覆盖计算之后的)
@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+// ServiceInstance 使用数据库作为注册中心时注册的服务实例(portal、runner)，Id 即为服务 id
+type ServiceInstance struct {
+	TimedModel
+
+	Service string   `json:"service" gorm:"size:64;not null;index"` // 服务名称，如 CT-Runner
+	Address string   `json:"address" gorm:"size:255;not null"`
+	Port    int      `json:"port" gorm:"not null"`
+	Tags    StrSlice `json:"tags" gorm:"type:json"` // 首次注册时使用服务配置的 tags，之后只能通过 api 修改
+	Slots   int      `json:"slots" gorm:"default:0"`
+	Version string   `json:"version" gorm:"size:64;default:''"`
+
+	LastHeartbeatAt Time `json:"lastHeartbeatAt" gorm:"type:datetime"`
+}
+
+func (ServiceInstance) TableName() string {
+	return "iac_service_instance"
+}
+
+// Lease 基于数据库的分布式锁，持有者需要在过期前续期
+type Lease struct {
+	AbstractModel
+
+	Id        string `json:"id" gorm:"size:64;primary_key"` // 锁的名称
+	Holder    string `json:"holder" gorm:"size:64;not null"`
+	ExpiredAt Time   `json:"expiredAt" gorm:"type:datetime;not null"`
+}
+
+func (Lease) TableName() string {
+	return "iac_lease"
+}
+
+// RunnerEventConn runner 步骤事件连接所在的 portal 实例，其他实例的事件订阅会转发到该实例
+type RunnerEventConn struct {
+	AbstractModel
+
+	Id         string `json:"id" gorm:"size:64;primary_key"` // runner id
+	PortalAddr string `json:"portalAddr" gorm:"size:255;not null"`
+}
+
+func (RunnerEventConn) TableName() string {
+	return "iac_runner_event_conn"
+}
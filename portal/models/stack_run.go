@@ -0,0 +1,69 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+)
+
+const (
+	StackRunModeFailFast = "failFast" // 任一任务失败后中止所有未开始的任务
+	StackRunModeContinue = "continue" // 任务失败后只中止依赖它的任务，其他任务继续执行
+
+	StackRunStatusRunning   = "running"
+	StackRunStatusApproving = "approving"
+	StackRunStatusComplete  = "complete"
+	StackRunStatusFailed    = "failed"
+	StackRunStatusRejected  = "rejected"
+
+	StackRunApprovalApproved = "approved"
+	StackRunApprovalRejected = "rejected"
+)
+
+// StackRun 批量编排，对项目下的多个环境同时发起 plan、部署或销毁任务
+// 任务按环境依赖关系组成的 DAG 执行，没有依赖关系的任务可以并行执行，所有任务共用一次审批
+type StackRun struct {
+	TimedModel
+
+	OrgId       Id     `json:"orgId" gorm:"size:32;not null"`
+	ProjectId   Id     `json:"projectId" gorm:"size:32;not null;index"`
+	CreatorId   Id     `json:"creatorId" gorm:"size:32;not null"`
+	Name        string `json:"name" gorm:"not null"`
+	TaskType    string `json:"taskType" gorm:"size:32;not null" enums:"'plan','apply','destroy'"`
+	Mode        string `json:"mode" gorm:"size:32;not null" enums:"'failFast','continue'"`
+	AutoApprove bool   `json:"autoApprove" gorm:"default:false"`
+	Status      string `json:"status" gorm:"size:32;not null;index" enums:"'running','approving','complete','failed','rejected'"`
+	Message     string `json:"message" gorm:"type:text"`
+
+	// 审批通过后，之后进入待审批状态的任务也会被自动审批通过；驳回后所有待审批的任务被驳回，未开始的任务被中止
+	ApprovalStatus string `json:"approvalStatus" gorm:"size:32;default:''" enums:"'approved','rejected'"`
+	ApproverId     Id     `json:"approverId" gorm:"size:32;default:''"`
+	ApprovalAt     *Time  `json:"approvalAt" gorm:"type:datetime"`
+	EndAt          *Time  `json:"endAt" gorm:"type:datetime"`
+}
+
+func (StackRun) TableName() string {
+	return "iac_stack_run"
+}
+
+func (r *StackRun) Exited() bool {
+	return r.Status == StackRunStatusComplete || r.Status == StackRunStatusFailed || r.Status == StackRunStatusRejected
+}
+
+// StackRunTask 批量编排中每个环境对应的任务
+type StackRunTask struct {
+	TimedModel
+
+	StackRunId Id       `json:"stackRunId" gorm:"size:32;not null"`
+	EnvId      Id       `json:"envId" gorm:"size:32;not null"`
+	TaskId     Id       `json:"taskId" gorm:"size:32;not null;index"`
+	DependsOn  StrSlice `json:"dependsOn" gorm:"type:json"` // 需要先执行完成的任务 id
+}
+
+func (StackRunTask) TableName() string {
+	return "iac_stack_run_task"
+}
+
+func (t StackRunTask) Migrate(sess *db.Session) error {
+	return t.AddUniqueIndex(sess, "unique__stack_run__env", "stack_run_id", "env_id")
+}
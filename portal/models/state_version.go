@@ -0,0 +1,52 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+)
+
+const (
+	StateVersionSourceTask     = "task"     // 任务执行过程中由 terraform 写入
+	StateVersionSourceRollback = "rollback" // 回滚到历史版本
+	StateVersionSourceMigrate  = "migrate"  // 从其他 backend 迁移
+)
+
+// StateVersion portal 托管的 terraform state 版本，每次写入 state 都会生成一个新版本
+type StateVersion struct {
+	TimedModel
+
+	OrgId     Id     `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id     `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id     `json:"envId" gorm:"size:32;not null;index"`
+	TaskId    Id     `json:"taskId" gorm:"size:32;default:''"` // 写入该版本的任务
+	CreatorId Id     `json:"creatorId" gorm:"size:32;default:''"`
+	Source    string `json:"source" gorm:"size:32;not null" enums:"'task','rollback','migrate'"`
+
+	Serial  int    `json:"serial" gorm:"not null;default:0"` // terraform state 中的 serial
+	Lineage string `json:"lineage" gorm:"size:64;default:''"`
+	Md5     string `json:"md5" gorm:"size:32;not null"`
+	Size    int    `json:"size" gorm:"not null;default:0"`
+	Content []byte `json:"-" gorm:"type:LONGBLOB"`
+}
+
+func (StateVersion) TableName() string {
+	return "iac_state_version"
+}
+
+// StateLock 环境 state 锁，同一个环境同时只能有一个锁
+type StateLock struct {
+	TimedModel
+
+	EnvId  Id     `json:"envId" gorm:"size:32;not null"`
+	LockId string `json:"lockId" gorm:"size:64;not null"`
+	Info   string `json:"info" gorm:"type:text"` // terraform 提交的锁信息(json)
+}
+
+func (StateLock) TableName() string {
+	return "iac_state_lock"
+}
+
+func (l StateLock) Migrate(sess *db.Session) error {
+	return l.AddUniqueIndex(sess, "unique__env", "env_id")
+}
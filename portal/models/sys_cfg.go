@@ -11,6 +11,7 @@ const (
 	SysCfgNamePeriodOfLogSave  = "PERIOD_OF_LOG_SAVE"
 	SysCfgNamRegistryAddr      = "REGISTRY_ADDR"
 	SysCfgNameTaskStepTimeout  = "TASK_STEP_TIMEOUT"
+	SysCfgNameApprovalTTL      = "APPROVAL_TTL"
 )
 
 type SystemCfg struct {
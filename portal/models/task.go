@@ -53,6 +53,50 @@ func (v *TaskResult) Scan(value interface{}) error {
 	return UnmarshalValue(value, v)
 }
 
+// TaskImport 导入任务需要导入的资源，Address 为资源在代码中的地址，Id 为资源在云上的 id
+type TaskImport struct {
+	Address string `json:"address"`
+	Id      string `json:"id"`
+}
+
+type TaskImports []TaskImport
+
+func (v TaskImports) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TaskImports) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+const (
+	StateOpMv      = "mv"
+	StateOpRm      = "rm"
+	StateOpTaint   = "taint"
+	StateOpUntaint = "untaint"
+
+	// 以下操作用于恢复 runner 失联的任务，不支持通过部署接口直接使用
+	StateOpForceUnlock = "force-unlock" // Address 为 state 锁 id
+	StateOpRefresh     = "refresh"
+)
+
+// TaskStateOp state 操作，Destination 只在 mv 操作时使用
+type TaskStateOp struct {
+	Op          string `json:"op"`
+	Address     string `json:"address"`
+	Destination string `json:"destination,omitempty"`
+}
+
+type TaskStateOps []TaskStateOp
+
+func (v TaskStateOps) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TaskStateOps) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
 type TaskExtra struct {
 	Source       string `json:"source,omitempty"`
 	TransitionId string `json:"transitionId,omitempty"`
@@ -76,6 +120,8 @@ const (
 	TaskTypeEnvParse = common.TaskTypeEnvParse
 	TaskTypeTplScan  = common.TaskTypeTplScan
 	TaskTypeTplParse = common.TaskTypeTplParse
+	TaskTypeImport   = common.TaskTypeImport
+	TaskTypeState    = common.TaskTypeState
 
 	TaskPending   = common.TaskPending
 	TaskRunning   = common.TaskRunning
@@ -123,6 +169,7 @@ type Task struct {
 	Playbook     string   `json:"playbook" gorm:"default:''"`
 	TfVarsFile   string   `json:"tfVarsFile" gorm:"default:''"`
 	TfVersion    string   `json:"tfVersion" gorm:"default:''"`
+	IacEngine    string   `json:"iacEngine" gorm:"size:16;default:''"`
 	PlayVarsFile string   `json:"playVarsFile" gorm:"default:''"`
 	Targets      StrSlice `json:"targets" gorm:"type:json"` // 指定 terraform target 参数
 
@@ -148,6 +195,14 @@ type Task struct {
 	Applied     bool       `json:"applied" gorm:"default:false"`     // 是否漂移执行了terraformApply
 	Source      string     `json:"source" gorm:"not null;default:manual;enum('manual','driftPlan','driftApply','webhookPlan', 'webhookApply', 'autoDestroy', 'api')"`
 	SourceSys   string     `json:"sourceSys" gorm:"not null;default:''"`
+
+	ChangeWindowOverride bool `json:"changeWindowOverride" gorm:"default:false"` // 紧急变更，不受变更窗口及冻结期的限制
+
+	Imports  TaskImports  `json:"imports" gorm:"type:json"`  // 导入任务需要导入的资源列表
+	StateOps TaskStateOps `json:"stateOps" gorm:"type:json"` // state 任务需要执行的操作列表
+
+	Replaces    StrSlice `json:"replaces" gorm:"type:json"`        // 指定 terraform replace 参数，强制重建资源
+	RefreshOnly bool     `json:"refreshOnly" gorm:"default:false"` // 只刷新 state，不变更资源
 }
 
 func (Task) TableName() string {
@@ -207,9 +262,9 @@ func (t *BaseTask) IsEffectTask() bool {
 	return t.IsEffectTaskType(t.Type)
 }
 
-// IsEffectTaskType 是否产生实际数据变动的任务类型
+// IsEffectTaskType 是否产生实际数据变动的任务类型，导入任务和 state 任务会修改环境的 state
 func (BaseTask) IsEffectTaskType(typ string) bool {
-	return utils.StrInArray(typ, TaskTypeApply, TaskTypeDestroy)
+	return utils.StrInArray(typ, TaskTypeApply, TaskTypeDestroy, TaskTypeImport, TaskTypeState)
 }
 
 func (BaseTask) GetTaskNameByType(typ string) string {
@@ -232,6 +287,10 @@ func (BaseTask) GetTaskNameByType(typ string) string {
 		return common.TaskTypeTplScanName
 	case TaskTypeTplParse:
 		return common.TaskTypeTplParseName
+	case TaskTypeImport:
+		return common.TaskTypeImportName
+	case TaskTypeState:
+		return common.TaskTypeStateName
 	default:
 		panic("invalid task type")
 	}
@@ -0,0 +1,29 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+const (
+	TaskApprovalApproved = "approved"
+	TaskApprovalRejected = "rejected"
+)
+
+// TaskApproval 任务步骤的审批记录，需要多人审批时每个审批者一条记录
+type TaskApproval struct {
+	TimedModel
+
+	TaskId  Id     `json:"taskId" gorm:"size:32;not null"`
+	Step    int    `json:"step" gorm:"not null"` // 步骤 index
+	UserId  Id     `json:"userId" gorm:"size:32;not null"`
+	Action  string `json:"action" gorm:"type:enum('approved','rejected');not null" enums:"approved,rejected"`
+	Comment string `json:"comment" gorm:"type:text"` // 审批意见
+}
+
+func (TaskApproval) TableName() string {
+	return "iac_task_approval"
+}
+
+func (a TaskApproval) Migrate(sess *db.Session) error {
+	return a.AddUniqueIndex(sess, "unique__task__step__user", "task_id", "step", "user_id")
+}
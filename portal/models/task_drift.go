@@ -4,10 +4,50 @@ package models
 
 type ResourceDrift struct {
 	TimedModel
-	ResId       Id     `json:"resId" gorm:"size:32;not null"`
-	DriftDetail string `json:"driftDetail" gorm:"type:text"`
+	ResId       Id          `json:"resId" gorm:"size:32;not null"`
+	DriftDetail string      `json:"driftDetail" gorm:"type:text"`
+	Attrs       []DriftAttr `json:"attrs,omitempty" gorm:"-"` // 发生漂移的属性，不保存到该表
 }
 
 func (ResourceDrift) TableName() string {
 	return "iac_resource_drift"
 }
+
+// DriftAttr 资源属性的漂移信息，path 为空表示整个资源(资源被删除或者不在配置中)
+type DriftAttr struct {
+	Path     string      `json:"path"`     // 属性路径，如 tags.Name、ingress.0.from_port
+	Expected interface{} `json:"expected"` // 配置中的期望值
+	Actual   interface{} `json:"actual"`   // 资源的实际值
+}
+
+const (
+	DriftStatusDrifted      = "drifted"
+	DriftStatusAcknowledged = "acknowledged"
+	DriftStatusIgnored      = "ignored"
+	DriftStatusResolved     = "resolved"
+)
+
+// ResourceDriftRecord 资源属性漂移记录，记录首次及最后一次检测到漂移的时间，漂移恢复后保留记录用于统计漂移趋势
+type ResourceDriftRecord struct {
+	TimedModel
+
+	OrgId     Id     `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id     `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id     `json:"envId" gorm:"index;size:32;not null"`
+	Address   string `json:"address" gorm:"not null"`
+	Path      string `json:"path" gorm:"not null;default:''"`
+	Expected  JSON   `json:"expected" gorm:"type:text" swaggertype:"string"`
+	Actual    JSON   `json:"actual" gorm:"type:text" swaggertype:"string"`
+
+	// drifted: 漂移中; acknowledged: 已确认，实际值再次变化时重新标记为漂移; ignored: 忽略该属性的漂移; resolved: 已恢复
+	Status      string `json:"status" gorm:"type:enum('drifted','acknowledged','ignored','resolved');default:'drifted'"`
+	FirstSeenAt Time   `json:"firstSeenAt" gorm:"type:datetime"`
+	LastSeenAt  Time   `json:"lastSeenAt" gorm:"type:datetime"`
+	ResolvedAt  *Time  `json:"resolvedAt" gorm:"type:datetime"`
+	LastTaskId  Id     `json:"lastTaskId" gorm:"size:32;not null;default:''"` // 最后一次检测到漂移的任务
+	OperatorId  Id     `json:"operatorId" gorm:"size:32;not null;default:''"` // 确认或者忽略漂移的用户
+}
+
+func (ResourceDriftRecord) TableName() string {
+	return "iac_resource_drift_record"
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+const (
+	TaskEventRunnerLost       = "runnerLost"       // 执行步骤的 runner 失联
+	TaskEventRescheduled      = "rescheduled"      // 任务被重新调度到其他 runner 执行
+	TaskEventRecoveryRequired = "recoveryRequired" // 变更类步骤执行中 runner 失联，需要进行恢复操作
+	TaskEventRecoveryStarted  = "recoveryStarted"  // 已发起恢复任务
+)
+
+// TaskEvent 任务时间线中的事件，如 runner 失联、任务重新调度、发起恢复等
+type TaskEvent struct {
+	TimedModel
+
+	TaskId   Id     `json:"taskId" gorm:"size:32;not null;index"`
+	StepId   Id     `json:"stepId" gorm:"size:32;default:''"`
+	Step     int    `json:"step" gorm:"default:0"` // 事件关联的步骤序号
+	Type     string `json:"type" gorm:"size:32;not null"`
+	RunnerId string `json:"runnerId" gorm:"size:64;default:''"`
+	Message  string `json:"message" gorm:"type:text"`
+
+	// 事件关联的其他对象，如重新调度后的 runner、恢复任务 id
+	Related string `json:"related" gorm:"size:64;default:''"`
+}
+
+func (TaskEvent) TableName() string {
+	return "iac_task_event"
+}
@@ -119,6 +119,31 @@ destroy:
   - type: terraformDestroy
     name: Terraform Destroy
 
+import:
+  steps:
+  - type: checkout
+    name: Checkout Code
+
+  - type: terraformInit
+    name: Terraform Init
+
+  - type: terraformPlan
+    name: Terraform Plan
+
+  - type: terraformImport
+    name: Terraform Import
+
+state:
+  steps:
+  - type: checkout
+    name: Checkout Code
+
+  - type: terraformInit
+    name: Terraform Init
+
+  - type: terraformState
+    name: Terraform State
+
 # scan 和 parse 暂不开发自定义工作流
 envScan:
   steps:
@@ -157,6 +182,8 @@ type PipelineDot34 struct {
 	Plan    PipelineTaskDot34 `json:"plan" yaml:"plan"`
 	Apply   PipelineTaskDot34 `json:"apply" yaml:"apply"`
 	Destroy PipelineTaskDot34 `json:"destroy" yaml:"destroy"`
+	Import  PipelineTaskDot34 `json:"import" yaml:"import"`
+	State   PipelineTaskDot34 `json:"state" yaml:"state"`
 
 	// 0.3 pipeline 扫描步骤
 	PolicyScan  PipelineTaskDot34 `json:"scan" yaml:"scan"`
@@ -185,6 +212,10 @@ func (p PipelineDot34) GetTask(typ string) PipelineTaskDot34 {
 		return p.Apply
 	case common.TaskJobDestroy:
 		return p.Destroy
+	case common.TaskJobImport:
+		return p.Import
+	case common.TaskJobState:
+		return p.State
 	case common.TaskJobScan:
 		return p.PolicyScan
 	case common.TaskJobParse:
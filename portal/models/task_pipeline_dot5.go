@@ -66,6 +66,31 @@ destroy:
 
     terraformDestroy:
       name: Terraform Apply
+
+import:
+  steps:
+    checkout:
+      name: Checkout Code
+
+    terraformInit:
+      name: Terraform Init
+
+    terraformPlan:
+      name: Terraform Plan
+
+    terraformImport:
+      name: Terraform Import
+
+state:
+  steps:
+    checkout:
+      name: Checkout Code
+
+    terraformInit:
+      name: Terraform Init
+
+    terraformState:
+      name: Terraform State
 `
 
 type PipelineDot5 struct {
@@ -73,6 +98,8 @@ type PipelineDot5 struct {
 	Plan    PipelineDot5Task `json:"plan" yaml:"plan"`
 	Apply   PipelineDot5Task `json:"apply" yaml:"apply"`
 	Destroy PipelineDot5Task `json:"destroy" yaml:"destroy"`
+	Import  PipelineDot5Task `json:"import" yaml:"import"`
+	State   PipelineDot5Task `json:"state" yaml:"state"`
 
 	PolicyScan PipelineDot5Task `json:"scan" yaml:"scan"`
 	EnvScan    PipelineDot5Task `json:"envScan" yaml:"envScan"`
@@ -94,6 +121,10 @@ func (p PipelineDot5) GetTask(typ string) PipelineDot5Task {
 		return p.Apply
 	case common.TaskJobDestroy:
 		return p.Destroy
+	case common.TaskJobImport:
+		return p.Import
+	case common.TaskJobState:
+		return p.State
 	case common.TaskJobScan:
 		return p.PolicyScan
 	case common.TaskJobEnvScan:
@@ -146,6 +177,8 @@ var mTaskStepNames = map[string][]string{
 	common.TaskJobPlan:    {common.TaskStepCheckout, common.TaskStepTfInit, common.TaskStepTfPlan, common.TaskStepEnvScan},
 	common.TaskJobApply:   {common.TaskStepCheckout, common.TaskStepTfInit, common.TaskStepTfPlan, common.TaskStepEnvScan, common.TaskStepTfApply, common.TaskStepAnsiblePlay},
 	common.TaskJobDestroy: {common.TaskStepCheckout, common.TaskStepTfInit, common.TaskStepTfPlan, common.TaskStepEnvScan, common.TaskStepTfDestroy},
+	common.TaskJobImport:  {common.TaskStepCheckout, common.TaskStepTfInit, common.TaskStepTfPlan, common.TaskStepTfImport},
+	common.TaskJobState:   {common.TaskStepCheckout, common.TaskStepTfInit, common.TaskStepTfState},
 }
 
 func NewPipelineDot5(content string) (PipelineDot5, error) {
@@ -178,6 +211,26 @@ func CompletePipelineDot5(p *PipelineDot5) {
 		}
 	}
 
+	// import
+	if p.Import.Steps == nil {
+		p.Import.Steps = make(map[string]*PipelineStep)
+	}
+	for _, stepName := range mTaskStepNames[common.TaskJobImport] {
+		if _, ok := p.Import.Steps[stepName]; !ok {
+			p.Import.Steps[stepName] = &PipelineStep{Name: stepName}
+		}
+	}
+
+	// state
+	if p.State.Steps == nil {
+		p.State.Steps = make(map[string]*PipelineStep)
+	}
+	for _, stepName := range mTaskStepNames[common.TaskJobState] {
+		if _, ok := p.State.Steps[stepName]; !ok {
+			p.State.Steps[stepName] = &PipelineStep{Name: stepName}
+		}
+	}
+
 	// destroy
 	if p.Destroy.Steps == nil {
 		p.Destroy.Steps = make(map[string]*PipelineStep)
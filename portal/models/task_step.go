@@ -16,6 +16,8 @@ const (
 	TaskStepPlan     = common.TaskStepTfPlan
 	TaskStepApply    = common.TaskStepTfApply
 	TaskStepDestroy  = common.TaskStepTfDestroy
+	TaskStepImport   = common.TaskStepTfImport
+	TaskStepState    = common.TaskStepTfState
 	TaskStepPlay     = common.TaskStepAnsiblePlay
 	TaskStepCommand  = common.TaskStepCommand
 	TaskStepCollect  = common.TaskStepCollect
@@ -34,6 +36,7 @@ const (
 	TaskStepComplete  = common.TaskStepComplete
 	TaskStepTimeout   = common.TaskStepTimeout
 	TaskStepAborted   = common.TaskStepAborted
+	TaskStepLost      = common.TaskStepLost
 )
 
 type TaskStep struct {
@@ -46,15 +49,18 @@ type TaskStep struct {
 	TaskId    Id     `json:"taskId" gorm:"size:32;not null"`
 	NextStep  Id     `json:"nextStep" gorm:"size:32;default:''"`
 	Index     int    `json:"index" gorm:"size:32;not null"`
-	Status    string `json:"status" gorm:"type:enum('pending','approving','rejected','running','failed','complete','timeout','aborted')"`
+	Status    string `json:"status" gorm:"type:enum('pending','approving','rejected','running','failed','complete','timeout','aborted','lost')"`
 	ExitCode  int    `json:"exitCode" gorm:"default:0"` // 执行退出码，status 为 failed 时才有意义
 	Message   string `json:"message" gorm:"type:text"`
 	StartAt   *Time  `json:"startAt" gorm:"type:datetime"`
 	EndAt     *Time  `json:"endAt" gorm:"type:datetime"`
 	LogPath   string `json:"logPath" gorm:""`
 
-	MustApproval bool `json:"requireApproval" gorm:""`            // 步骤需要审批
-	ApproverId   Id   `json:"approverId" gorm:"size:32;not null"` // 审批者用户 id
+	MustApproval bool  `json:"requireApproval" gorm:""`            // 步骤需要审批
+	ApproverId   Id    `json:"approverId" gorm:"size:32;not null"` // 审批者用户 id
+	ApprovingAt  *Time `json:"approvingAt" gorm:"type:datetime"`   // 开始等待审批的时间
+
+	PolicyApproval bool `json:"policyApproval" gorm:"default:false"` // 执行计划策略要求人工审批，此时审批规则的自动审批条件不生效
 
 	CurrentRetryCount int   `json:"currentRetryCount" gorm:"size:32;default:0"` // 当前重试次数
 	NextRetryTime     int64 `json:"nextRetryTime" gorm:"default:0"`             // 下次重试时间
@@ -95,7 +101,8 @@ func (TaskStep) IsExitedStatus(status string) bool {
 		TaskStepComplete,
 		TaskStepFailed,
 		TaskStepTimeout,
-		TaskStepAborted)
+		TaskStepAborted,
+		TaskStepLost)
 }
 
 // 执行成功
@@ -111,6 +118,7 @@ func (s *TaskStep) IsFail() bool {
 		TaskStepFailed,
 		TaskStepTimeout,
 		TaskStepAborted,
+		TaskStepLost,
 	)
 }
 
@@ -128,6 +136,10 @@ func (s *TaskStep) IsRejected() bool {
 	return s.Status == TaskStepRejected
 }
 
+func (s *TaskStep) IsLost() bool {
+	return s.Status == TaskStepLost
+}
+
 func (s *TaskStep) GenLogPath() string {
 	return path.Join(
 		s.ProjectId.String(),
@@ -41,7 +41,8 @@ type Template struct {
 
 	LastScanTaskId Id `json:"lastScanTaskId" gorm:"size:32"` // 最后一次策略扫描任务 id
 
-	TfVersion string `json:"tfVersion" gorm:"default:''"` // 模版使用的terraform版本号
+	TfVersion string `json:"tfVersion" gorm:"default:''"`         // 模版使用的terraform版本号
+	IacEngine string `json:"iacEngine" gorm:"size:16;default:''"` // IaC 引擎(terraform/opentofu)，为空表示 terraform
 
 	// 触发器设置
 	Triggers     pq.StringArray `json:"tplTriggers" gorm:"type:text" swaggertype:"array,string"` // 触发器。commit（每次推送自动部署），prmr（提交PR/MR的时候自动执行plan）
@@ -19,6 +19,19 @@ type User struct {
 	ActiveStatus string `json:"activeStatus" gorm:"type:enum('active','inactive');default:'active';comment:用户激活状态" enums:"active,inactive" example:"active"` // 用户状态
 
 	Company string `json:"company"`
+
+	// 多因素认证(TOTP)
+	MfaEnabled       bool     `json:"mfaEnabled" gorm:"default:false;comment:是否启用多因素认证"`
+	MfaSecret        string   `json:"-" gorm:"size:255;default:'';comment:TOTP 密钥(加密)"` // 启用前保存待确认的密钥
+	MfaRecoveryCodes StrSlice `json:"-" gorm:"type:json;comment:恢复码(sha256)"`
+	MfaLastStep      int64    `json:"-" gorm:"default:0"` // 最近一次校验成功的 TOTP 时间步，用于防止验证码重放
+	MfaFailures      int      `json:"-" gorm:"default:0"` // 连续校验失败次数
+	MfaLockedUntil   int64    `json:"-" gorm:"default:0"` // 连续失败次数过多时锁定到该时间(unix 时间戳)
+
+	// oidc 登录绑定的身份，登录时按 issuer + subject 匹配用户
+	OidcIssuer      string `json:"-" gorm:"size:255;default:'';index:idx__oidc_identity"`
+	OidcSubject     string `json:"-" gorm:"size:255;default:'';index:idx__oidc_identity"`
+	OidcLinkAllowed bool   `json:"oidcLinkAllowed" gorm:"default:false;comment:是否允许 oidc 登录时绑定该用户"` // 已存在的用户需要管理员允许后才能绑定 oidc 身份
 }
 
 func (User) TableName() string {
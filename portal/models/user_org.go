@@ -7,10 +7,11 @@ import "cloudiac/portal/libs/db"
 type UserOrg struct {
 	BaseModel
 
-	UserId     Id     `json:"userId" gorm:"size:32;not null;comment:用户ID"`                                  // 用户ID
-	OrgId      Id     `json:"orgId" gorm:"size:32;not null;comment:组织ID"`                                   // 组织ID
-	Role       string `json:"role" gorm:"type:enum('admin','complianceManager','member');default:'member'"` // 角色
-	IsFromLdap bool   `json:"isFromLdap" gorm:"default:false"`                                              // 权限是否来自ldap
+	UserId     Id     `json:"userId" gorm:"size:32;not null;comment:用户ID"` // 用户ID
+	OrgId      Id     `json:"orgId" gorm:"size:32;not null;comment:组织ID"`  // 组织ID
+	Role       string `json:"role" gorm:"size:32;default:'member'"`        // 角色，内置角色(admin,complianceManager,member)或者自定义角色ID
+	IsFromLdap bool   `json:"isFromLdap" gorm:"default:false"`             // 权限是否来自ldap
+	IsFromOidc bool   `json:"isFromOidc" gorm:"default:false"`             // 权限是否来自oidc用户组
 }
 
 func (UserOrg) TableName() string {
@@ -23,5 +24,10 @@ func (m UserOrg) Migrate(sess *db.Session) (err error) {
 		return err
 	}
 
+	// 支持自定义角色，角色字段由 enum 改为 varchar
+	if err = sess.ModifyModelColumn(&UserOrg{}, "role"); err != nil {
+		return err
+	}
+
 	return nil
 }
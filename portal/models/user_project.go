@@ -11,8 +11,9 @@ type UserProject struct {
 
 	UserId     Id     `json:"userId" gorm:"size:32;not null;comment:用户ID"`
 	ProjectId  Id     `json:"projectId" gorm:"size:32;not null"`
-	Role       string `json:"role" gorm:"type:enum('manager','approver','operator','guest');default:'operator';comment:角色"`
-	IsFromLdap bool   `json:"isFromLdap" gorm:"default:false"` // 权限是否来自ldap
+	Role       string `json:"role" gorm:"size:32;default:'operator';comment:角色"` // 内置角色(manager,approver,operator,guest)或者自定义角色ID
+	IsFromLdap bool   `json:"isFromLdap" gorm:"default:false"`                   // 权限是否来自ldap
+	IsFromOidc bool   `json:"isFromOidc" gorm:"default:false"`                   // 权限是否来自oidc用户组
 }
 
 func (UserProject) TableName() string {
@@ -20,5 +21,9 @@ func (UserProject) TableName() string {
 }
 
 func (u UserProject) Migrate(sess *db.Session) error {
-	return u.AddUniqueIndex(sess, "unique__user__project", "user_id", "project_id")
+	if err := u.AddUniqueIndex(sess, "unique__user__project", "user_id", "project_id"); err != nil {
+		return err
+	}
+	// 支持自定义角色，角色字段由 enum 改为 varchar
+	return sess.ModifyModelColumn(&UserProject{}, "role")
 }
@@ -0,0 +1,239 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"net/http"
+)
+
+func CreateApprovalRule(tx *db.Session, rule models.ApprovalRule) (*models.ApprovalRule, e.Error) {
+	if rule.Id == "" {
+		rule.Id = models.NewId("apr")
+	}
+	if err := models.Create(tx, &rule); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &rule, nil
+}
+
+func GetApprovalRuleById(tx *db.Session, projectId, id models.Id) (*models.ApprovalRule, e.Error) {
+	rule := models.ApprovalRule{}
+	if err := tx.Where("project_id = ? AND id = ?", projectId, id).First(&rule); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ApprovalRuleNotExist, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &rule, nil
+}
+
+func SearchApprovalRule(query *db.Session, projectId, envId models.Id) *db.Session {
+	query = query.Model(&models.ApprovalRule{}).Where("project_id = ?", projectId)
+	if envId != "" {
+		query = query.Where("env_id = ?", envId)
+	}
+	return query.Order("created_at DESC")
+}
+
+func UpdateApprovalRule(tx *db.Session, projectId, id models.Id, attrs models.Attrs) (*models.ApprovalRule, e.Error) {
+	if _, err := tx.Model(&models.ApprovalRule{}).Where("project_id = ? AND id = ?", projectId, id).UpdateAttrs(attrs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return GetApprovalRuleById(tx, projectId, id)
+}
+
+func DeleteApprovalRule(tx *db.Session, projectId, id models.Id) e.Error {
+	n, err := tx.Where("project_id = ? AND id = ?", projectId, id).Delete(&models.ApprovalRule{})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n == 0 {
+		return e.New(e.ApprovalRuleNotExist, http.StatusNotFound)
+	}
+	return nil
+}
+
+// HasEnvApprovalRules 项目或环境是否设置了启用的审批规则
+func HasEnvApprovalRules(tx *db.Session, projectId, envId models.Id) (bool, e.Error) {
+	exists, err := tx.Model(&models.ApprovalRule{}).
+		Where("project_id = ? AND enabled = ?", projectId, true).
+		Where("env_id = '' OR env_id = ?", envId).Exists()
+	if err != nil {
+		return false, e.New(e.DBError, err)
+	}
+	return exists, nil
+}
+
+// GetTaskApprovalRules 获取对任务生效的审批规则，包括项目及环境的审批规则，以及受保护环境的审批要求。
+// 没有设置任何规则时返回默认规则：任意一个有审批权限的用户审批通过即可
+func GetTaskApprovalRules(tx *db.Session, task *models.Task, env *models.Env) ([]models.ApprovalRule, e.Error) {
+	rules := make([]models.ApprovalRule, 0)
+	if err := tx.Model(&models.ApprovalRule{}).
+		Where("project_id = ? AND enabled = ?", task.ProjectId, true).
+		Where("env_id = '' OR env_id = ?", task.EnvId).
+		Order("created_at").Find(&rules); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if env.Protected {
+		rules = append(rules, models.ApprovalRule{
+			Name:              "protected environment",
+			ApproverGroupId:   env.ApproverGroupId,
+			RequiredApprovals: EnvRequiredApprovals(env),
+		})
+	}
+	if len(rules) == 0 {
+		rules = append(rules, models.ApprovalRule{Name: "default", RequiredApprovals: 1})
+	}
+	return rules, nil
+}
+
+// approvalRuleEvaluator 根据审批规则计算任务步骤的审批结果
+type approvalRuleEvaluator struct {
+	task   *models.Task
+	rules  []models.ApprovalRule
+	groups map[models.Id][]string // 审批组 id => 审批组成员
+
+	noAutoApprove bool // 执行计划策略要求人工审批时不使用规则的自动审批条件
+}
+
+func newApprovalRuleEvaluator(tx *db.Session, task *models.Task, env *models.Env, step *models.TaskStep) (*approvalRuleEvaluator, e.Error) {
+	rules, er := GetTaskApprovalRules(tx, task, env)
+	if er != nil {
+		return nil, er
+	}
+	ev := &approvalRuleEvaluator{
+		task:          task,
+		rules:         rules,
+		groups:        make(map[models.Id][]string),
+		noAutoApprove: step.PolicyApproval,
+	}
+	for _, r := range rules {
+		if r.ApproverGroupId == "" {
+			continue
+		}
+		if _, ok := ev.groups[r.ApproverGroupId]; ok {
+			continue
+		}
+		group, er := GetApproverGroupById(tx, task.OrgId, r.ApproverGroupId)
+		if er != nil && er.Code() != e.ApproverGroupNotExist {
+			return nil, er
+		} else if er == nil {
+			ev.groups[r.ApproverGroupId] = group.UserIds
+		} else {
+			// 审批组已被删除，规则无法被满足，需要修改规则
+			ev.groups[r.ApproverGroupId] = []string{}
+		}
+	}
+	return ev, nil
+}
+
+// eligible 用户是否可以参与该规则的审批
+func (ev *approvalRuleEvaluator) eligible(rule models.ApprovalRule, userId models.Id) bool {
+	if rule.ForbidSelfApproval && userId == ev.task.CreatorId {
+		return false
+	}
+	if rule.ApproverGroupId != "" && !utils.StrInArray(userId.String(), ev.groups[rule.ApproverGroupId]...) {
+		return false
+	}
+	return true
+}
+
+// CheckVoter 检查用户是否可以审批该任务，用户需要满足至少一条规则的审批人要求
+func (ev *approvalRuleEvaluator) CheckVoter(userId models.Id) e.Error {
+	for _, r := range ev.rules {
+		if r.ForbidSelfApproval && userId == ev.task.CreatorId {
+			return e.New(e.TaskSelfApprovalDenied, http.StatusForbidden)
+		}
+	}
+	for _, r := range ev.rules {
+		if ev.eligible(r, userId) {
+			return nil
+		}
+	}
+	return e.New(e.TaskApproverNotEligible, http.StatusForbidden)
+}
+
+// autoApproved 执行计划是否满足规则的自动审批条件
+func (ev *approvalRuleEvaluator) autoApproved(rule models.ApprovalRule) bool {
+	if ev.noAutoApprove || !rule.HasAutoApprove() {
+		return false
+	}
+	return planMatchAutoApprove(ev.task.PlanResult, rule)
+}
+
+func planMatchAutoApprove(plan models.TaskResult, rule models.ApprovalRule) bool {
+	if rule.AutoApproveAdditionsOnly {
+		if plan.ResAdded == nil ||
+			(plan.ResChanged != nil && *plan.ResChanged > 0) ||
+			(plan.ResDestroyed != nil && *plan.ResDestroyed > 0) {
+			return false
+		}
+	}
+	if rule.AutoApproveMaxCost != nil {
+		// 没有询价结果时无法判断费用变化
+		if plan.ResAddedCost == nil && plan.ResUpdatedCost == nil && plan.ResDestroyedCost == nil {
+			return false
+		}
+		if len(plan.ForecastFailed) > 0 {
+			return false
+		}
+		// 删除或替换资源时费用可能减少，但变更本身有风险，不能自动审批
+		if plan.ResDestroyed == nil || *plan.ResDestroyed > 0 {
+			return false
+		}
+		var delta float32
+		if plan.ResAddedCost != nil {
+			delta += *plan.ResAddedCost
+		}
+		if plan.ResUpdatedCost != nil {
+			delta += *plan.ResUpdatedCost
+		}
+		if plan.ResDestroyedCost != nil {
+			delta -= *plan.ResDestroyedCost
+		}
+		if delta < 0 {
+			delta = -delta
+		}
+		if delta >= *rule.AutoApproveMaxCost {
+			return false
+		}
+	}
+	return true
+}
+
+// AutoApproved 所有规则都满足自动审批条件时步骤无需人工审批
+func (ev *approvalRuleEvaluator) AutoApproved() bool {
+	for _, r := range ev.rules {
+		if !ev.autoApproved(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Approved 所有规则都满足时审批通过，规则满足自动审批条件或者符合要求的审批通过人数达到规则要求的人数
+func (ev *approvalRuleEvaluator) Approved(approvals []models.TaskApproval) (bool, []string) {
+	unsatisfied := make([]string, 0)
+	for _, r := range ev.rules {
+		if ev.autoApproved(r) {
+			continue
+		}
+		cnt := 0
+		for _, a := range approvals {
+			if a.Action == models.TaskApprovalApproved && ev.eligible(r, a.UserId) {
+				cnt++
+			}
+		}
+		required := r.RequiredApprovals
+		if required < 1 {
+			required = 1
+		}
+		if cnt < required {
+			unsatisfied = append(unsatisfied, r.Name)
+		}
+	}
+	return len(unsatisfied) == 0, unsatisfied
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanMatchAutoApprove(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+	floatPtr := func(f float32) *float32 { return &f }
+
+	additions := models.TaskResult{ResAdded: intPtr(2), ResChanged: intPtr(0), ResDestroyed: intPtr(0)}
+	rule := models.ApprovalRule{AutoApproveAdditionsOnly: true}
+	assert.True(t, planMatchAutoApprove(additions, rule))
+
+	changes := models.TaskResult{ResAdded: intPtr(2), ResChanged: intPtr(1), ResDestroyed: intPtr(0)}
+	assert.False(t, planMatchAutoApprove(changes, rule))
+
+	// 没有询价结果时不满足费用条件
+	rule.AutoApproveMaxCost = floatPtr(10)
+	assert.False(t, planMatchAutoApprove(additions, rule))
+
+	additions.ResAddedCost = floatPtr(5)
+	assert.True(t, planMatchAutoApprove(additions, rule))
+	additions.ResAddedCost = floatPtr(12)
+	assert.False(t, planMatchAutoApprove(additions, rule))
+
+	// 删除或替换资源时即使费用减少也不能自动审批
+	rule = models.ApprovalRule{AutoApproveMaxCost: floatPtr(10)}
+	replaces := models.TaskResult{ResAdded: intPtr(1), ResChanged: intPtr(0), ResDestroyed: intPtr(1),
+		ResAddedCost: floatPtr(5), ResDestroyedCost: floatPtr(50)}
+	assert.False(t, planMatchAutoApprove(replaces, rule))
+	changes.ResUpdatedCost = floatPtr(-20)
+	assert.False(t, planMatchAutoApprove(changes, rule))
+}
+
+func TestApprovalRuleEvaluator(t *testing.T) {
+	ev := &approvalRuleEvaluator{
+		task: &models.Task{CreatorId: "u-1"},
+		rules: []models.ApprovalRule{
+			{Name: "ops", ApproverGroupId: "apg-1", RequiredApprovals: 2},
+			{Name: "no-self", ForbidSelfApproval: true},
+		},
+		groups: map[models.Id][]string{"apg-1": {"u-1", "u-2", "u-3"}},
+	}
+
+	assert.Equal(t, e.TaskSelfApprovalDenied, ev.CheckVoter("u-1").Code())
+	assert.Nil(t, ev.CheckVoter("u-4"))
+
+	ok, unsatisfied := ev.Approved([]models.TaskApproval{
+		{UserId: "u-2", Action: models.TaskApprovalApproved},
+		{UserId: "u-4", Action: models.TaskApprovalApproved},
+	})
+	assert.False(t, ok)
+	assert.Equal(t, []string{"ops"}, unsatisfied)
+
+	ok, _ = ev.Approved([]models.TaskApproval{
+		{UserId: "u-2", Action: models.TaskApprovalApproved},
+		{UserId: "u-3", Action: models.TaskApprovalApproved},
+	})
+	assert.True(t, ok)
+	assert.False(t, ev.AutoApproved())
+
+	// 执行计划策略要求审批时不使用自动审批条件
+	zero, one := 0, 1
+	ev.task.PlanResult = models.TaskResult{ResAdded: &one, ResChanged: &zero, ResDestroyed: &zero}
+	ev.rules = []models.ApprovalRule{{Name: "additions", AutoApproveAdditionsOnly: true, RequiredApprovals: 1}}
+	assert.True(t, ev.AutoApproved())
+	ev.noAutoApprove = true
+	assert.False(t, ev.AutoApproved())
+	ok, _ = ev.Approved(nil)
+	assert.False(t, ok)
+}
@@ -9,6 +9,7 @@ import (
 	"cloudiac/portal/services/billcollect"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
+	"strings"
 )
 
 func GetVgByBillConf(dbSess *db.Session) ([]models.VariableGroup, e.Error) {
@@ -86,6 +87,22 @@ func BuildBillData(resCost map[string]billcollect.ResourceCost, res []models.Res
 	return resp, resIds
 }
 
+// MatchResourceCostByArn 将 arn 对应的资源费用关联到资源 id 上，返回匹配到的资源
+func MatchResourceCostByArn(resCost map[string]billcollect.ResourceCost, res []models.Resource) []models.Resource {
+	matched := make([]models.Resource, 0, len(res))
+	for _, r := range res {
+		arn, _ := r.Attrs["arn"].(string)
+		cost, ok := resCost[arn]
+		if !ok || r.ResId == "" {
+			continue
+		}
+		cost.InstanceId = r.ResId.String()
+		resCost[r.ResId.String()] = cost
+		matched = append(matched, r)
+	}
+	return matched
+}
+
 func DeleteResourceBill(dbSess *db.Session, resIds []string, cycle string) error {
 	if _, err := dbSess.Where("instance_id in (?)", resIds).
 		Where("cycle = ?", cycle).
@@ -139,6 +156,20 @@ func BuildVgBilling(tx *db.Session, vg models.VariableGroup, lg logs.Logger, bil
 		return
 	}
 
+	// 账单中使用 arn 标识的资源通过资源属性中的 arn 进行匹配
+	arns := make([]string, 0)
+	for _, id := range resourceIds {
+		if strings.HasPrefix(id, "arn:") {
+			arns = append(arns, id)
+		}
+	}
+	arnRes, err := GetResourceByArnsInProvider(tx, arns, projectIds, vg)
+	if err != nil {
+		lg.Errorf("query iac resource by arn failed vgId: %s, vgName: %s, provider: %s, err: %s", vg.Id, vg.Name, vg.Provider, err)
+		return
+	}
+	res = append(res, MatchResourceCostByArn(resCostAttr, arnRes)...)
+
 	// 解析账单数据，构建入库数据
 	bills, resIds := BuildBillData(resCostAttr, res, vg.Id)
 	if len(bills) == 0 {
@@ -0,0 +1,301 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package billcollect
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"cloudiac/utils/objstorage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	awsDefaultS3Endpoint = "s3.amazonaws.com"
+	awsDefaultRegion     = "us-east-1"
+)
+
+// curSource 成本和使用情况报告(CUR)文件的来源，文件路径均为相对于报告根目录的路径
+type curSource interface {
+	List() ([]string, error)
+	Read(name string) ([]byte, error)
+}
+
+// NewAwsBillProvider 创建 aws 账单 provider，账单数据从 CUR 报告中读取
+// 资源账号中配置了 AWS_CUR_LOCAL_DIR 时从本地目录读取报告，否则从 AWS_CUR_BUCKET 指定的 s3 bucket 读取
+func NewAwsBillProvider(vg *models.VariableGroup) (*awsProvider, error) {
+	resAccount := parseResourceAccount(vg.Provider, vg.Variables)
+	if resAccount == nil {
+		return nil, fmt.Errorf("provider: %s, resource account is null", vg.Provider)
+	}
+
+	var source curSource
+	if subDir := resAccount[consts.AwsCurLocalDir]; subDir != "" {
+		dir, err := awsCurLocalDir(configs.Get().BillCollect.AwsCurLocalDir, subDir)
+		if err != nil {
+			return nil, err
+		}
+		source = &localCurSource{dir: dir}
+	} else {
+		if resAccount[consts.AwsAK] == "" || resAccount[consts.AwsSK] == "" || resAccount[consts.AwsCurBucket] == "" {
+			return nil, fmt.Errorf("provider: %s, resource account not exist", vg.Provider)
+		}
+
+		s, err := newS3CurSource(resAccount)
+		if err != nil {
+			return nil, err
+		}
+		source = s
+	}
+
+	return &awsProvider{
+		source:   source,
+		provider: vg.Provider,
+		vg:       vg,
+	}, nil
+}
+
+type awsProvider struct {
+	source   curSource
+	provider string
+	vg       *models.VariableGroup
+}
+
+func (p *awsProvider) Provider() string {
+	return p.provider
+}
+
+func (p *awsProvider) GetResourceDayCost(billingCycle string) ([]ResourceCost, error) {
+	return nil, nil
+}
+
+func (p *awsProvider) ParseMonthBill(billingCycle string) (map[string]ResourceCost, []string, []models.BillData, error) {
+	cycle, err := time.Parse("2006-01", billingCycle)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid billing cycle '%s': %v", billingCycle, err)
+	}
+
+	files, err := p.reportFiles(cycle)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	items := make([]curLineItem, 0)
+	for _, name := range files {
+		content, err := p.source.Read(name)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("read report file %s: %v", name, err)
+		}
+		fileItems, err := parseCurReport(name, content)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("parse report file %s: %v", name, err)
+		}
+		items = append(items, fileItems...)
+	}
+
+	resp, resourceIds := aggregateCurLineItems(items, billingCycle, p.provider)
+	insertDate := make([]models.BillData, 0, len(resourceIds))
+	for _, id := range resourceIds {
+		cost := resp[id]
+		insertDate = append(insertDate, models.BillData{
+			Provider:   p.provider,
+			InstanceId: id,
+			Attrs: models.ResAttrs{
+				"productCode":    cost.ProductCode,
+				"instanceConfig": cost.InstanceConfig,
+				"pretaxAmount":   cost.PretaxAmount,
+				"region":         cost.Region,
+				"currency":       cost.Currency,
+				"cycle":          cost.Cycle,
+			},
+		})
+	}
+	return resp, resourceIds, insertDate, nil
+}
+
+// reportFiles 返回账单周期对应的报告文件
+// 支持两种目录结构:
+//   - csv 格式: <prefix>/<report>/20220301-20220401/[<assemblyId>/]xxx.csv.gz，
+//     目录下有 Manifest 文件时只读取 Manifest 中 reportKeys 列出的文件，避免重复统计历史版本
+//   - parquet 格式: <prefix>/<report>/<report>/year=2022/month=3/xxx.parquet
+func (p *awsProvider) reportFiles(cycle time.Time) ([]string, error) {
+	names, err := p.source.List()
+	if err != nil {
+		return nil, fmt.Errorf("list report files: %v", err)
+	}
+
+	dateRange := fmt.Sprintf("%s-%s", cycle.Format("20060102"), cycle.AddDate(0, 1, 0).Format("20060102"))
+	partition := fmt.Sprintf("year=%d/month=%d/", cycle.Year(), int(cycle.Month()))
+
+	files := make([]string, 0)
+	manifests := make([]string, 0)
+	for _, name := range names {
+		if strings.Contains(name, "/"+dateRange+"/") || strings.HasPrefix(name, dateRange+"/") {
+			if strings.HasSuffix(name, "-Manifest.json") && path.Base(path.Dir(name)) == dateRange {
+				manifests = append(manifests, name)
+			} else if isCurReportFile(name) {
+				files = append(files, name)
+			}
+		} else if strings.Contains(name, partition) && isCurReportFile(name) {
+			files = append(files, name)
+		}
+	}
+
+	if len(manifests) > 0 {
+		return p.manifestReportFiles(manifests, names)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// manifestReportFiles 读取 Manifest 中的 reportKeys，reportKeys 为 bucket 下的完整路径，需要转换为相对路径
+func (p *awsProvider) manifestReportFiles(manifests []string, names []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, m := range manifests {
+		content, err := p.source.Read(m)
+		if err != nil {
+			return nil, fmt.Errorf("read manifest %s: %v", m, err)
+		}
+		manifest := struct {
+			ReportKeys []string `json:"reportKeys"`
+		}{}
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return nil, fmt.Errorf("unmarshal manifest %s: %v", m, err)
+		}
+
+		for _, key := range manifest.ReportKeys {
+			for _, name := range names {
+				if name == key || strings.HasSuffix(key, "/"+name) || strings.HasSuffix(name, "/"+key) {
+					files = append(files, name)
+					break
+				}
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func isCurReportFile(name string) bool {
+	for _, ext := range []string{".csv", ".csv.gz", ".csv.zip", ".parquet"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// awsCurLocalDir 返回资源账号的本地报告目录，资源账号变量由用户配置，所以只允许指定系统配置的根目录下的子目录
+func awsCurLocalDir(baseDir string, subDir string) (string, error) {
+	if baseDir == "" {
+		return "", fmt.Errorf("local cur report is not enabled, configuration 'bill_collect.aws_cur_local_dir' is empty")
+	}
+	if filepath.IsAbs(subDir) {
+		return "", fmt.Errorf("invalid %s '%s', must be a relative path", consts.AwsCurLocalDir, subDir)
+	}
+	dir := filepath.Join(baseDir, subDir)
+	if rel, err := filepath.Rel(baseDir, dir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid %s '%s', must be under the report base dir", consts.AwsCurLocalDir, subDir)
+	}
+	return dir, nil
+}
+
+type localCurSource struct {
+	dir string
+}
+
+func (s *localCurSource) List() ([]string, error) {
+	names := make([]string, 0)
+	err := filepath.Walk(s.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	return names, err
+}
+
+func (s *localCurSource) Read(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.dir, filepath.FromSlash(name)))
+}
+
+type s3CurSource struct {
+	cli    *minio.Client
+	bucket string
+	prefix string
+}
+
+func newS3CurSource(resAccount map[string]string) (*s3CurSource, error) {
+	conf := configs.ObjectStorageConfig{
+		Endpoint:  resAccount[consts.AwsCurEndpoint],
+		Region:    resAccount[consts.AwsCurRegion],
+		Bucket:    resAccount[consts.AwsCurBucket],
+		AccessKey: resAccount[consts.AwsAK],
+		SecretKey: resAccount[consts.AwsSK],
+		UseSSL:    true,
+	}
+	if conf.Endpoint == "" {
+		conf.Endpoint = awsDefaultS3Endpoint
+	}
+	if conf.Region == "" {
+		conf.Region = awsDefaultRegion
+	}
+
+	cli, err := objstorage.NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &s3CurSource{
+		cli:    cli,
+		bucket: conf.Bucket,
+		prefix: strings.Trim(resAccount[consts.AwsCurPrefix], "/"),
+	}, nil
+}
+
+func (s *s3CurSource) List() ([]string, error) {
+	opts := minio.ListObjectsOptions{Recursive: true}
+	if s.prefix != "" {
+		opts.Prefix = s.prefix + "/"
+	}
+
+	names := make([]string, 0)
+	for obj := range s.cli.ListObjects(context.Background(), s.bucket, opts) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		names = append(names, strings.TrimPrefix(obj.Key, opts.Prefix))
+	}
+	return names, nil
+}
+
+func (s *s3CurSource) Read(name string) ([]byte, error) {
+	key := name
+	if s.prefix != "" {
+		key = s.prefix + "/" + name
+	}
+	obj, err := s.cli.GetObject(context.Background(), s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return ioutil.ReadAll(obj)
+}
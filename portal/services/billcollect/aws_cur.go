@@ -0,0 +1,290 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package billcollect
+
+import (
+	"archive/zip"
+	"bytes"
+	"cloudiac/utils"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// CUR 报告中使用的列，csv 格式的列名(如 lineItem/ResourceId)统一转换为 parquet 格式的列名
+const (
+	curColResourceId   = "line_item_resource_id"
+	curColProductCode  = "line_item_product_code"
+	curColUsageType    = "line_item_usage_type"
+	curColCost         = "line_item_unblended_cost"
+	curColCurrency     = "line_item_currency_code"
+	curColRegion       = "product_region"
+	curColInstanceType = "product_instance_type"
+)
+
+var curColumns = []string{
+	curColResourceId, curColProductCode, curColUsageType, curColCost,
+	curColCurrency, curColRegion, curColInstanceType,
+}
+
+// curLineItem CUR 报告中的一条费用明细
+type curLineItem struct {
+	ResourceId   string
+	ProductCode  string
+	UsageType    string
+	Cost         float64
+	Currency     string
+	Region       string
+	InstanceType string
+}
+
+// normalizeCurColumn 将 csv 格式的列名转换为 parquet 格式，如 lineItem/ResourceId => line_item_resource_id
+func normalizeCurColumn(name string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(name) {
+		switch {
+		case r == '/' || r == '.' || r == ' ':
+			b.WriteRune('_')
+		case unicode.IsUpper(r):
+			if i > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteRune('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// parseCurReport 根据文件扩展名解析 csv(支持 gzip、zip 压缩) 或 parquet 格式的报告
+func parseCurReport(name string, content []byte) ([]curLineItem, error) {
+	switch {
+	case strings.HasSuffix(name, ".parquet"):
+		return parseCurParquet(content)
+	case strings.HasSuffix(name, ".csv.gz"):
+		r, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return parseCurCsv(r)
+	case strings.HasSuffix(name, ".csv.zip"):
+		zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return nil, err
+		}
+		items := make([]curLineItem, 0)
+		for _, f := range zr.File {
+			r, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			fileItems, err := parseCurCsv(r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, fileItems...)
+		}
+		return items, nil
+	default:
+		return parseCurCsv(bytes.NewReader(content))
+	}
+}
+
+func parseCurCsv(r io.Reader) ([]curLineItem, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int)
+	for i, h := range header {
+		index[normalizeCurColumn(h)] = i
+	}
+	if _, ok := index[curColResourceId]; !ok {
+		return nil, fmt.Errorf("column '%s' not found, make sure the report includes resource ids", curColResourceId)
+	}
+
+	items := make([]curLineItem, 0)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		value := func(col string) string {
+			if i, ok := index[col]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		if value(curColResourceId) == "" {
+			continue
+		}
+		cost, _ := strconv.ParseFloat(value(curColCost), 64)
+		items = append(items, curLineItem{
+			ResourceId:   value(curColResourceId),
+			ProductCode:  value(curColProductCode),
+			UsageType:    value(curColUsageType),
+			Cost:         cost,
+			Currency:     value(curColCurrency),
+			Region:       value(curColRegion),
+			InstanceType: value(curColInstanceType),
+		})
+	}
+	return items, nil
+}
+
+func parseCurParquet(content []byte) ([]curLineItem, error) {
+	pr, err := reader.NewParquetColumnReader(newMemParquetFile(content), 1)
+	if err != nil {
+		return nil, err
+	}
+	defer pr.ReadStop()
+
+	num := pr.GetNumRows()
+	if num == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string][]interface{})
+	for _, inPath := range pr.SchemaHandler.ValueColumns {
+		exPath := pr.SchemaHandler.InPathToExPath[inPath]
+		col := normalizeCurColumn(exPath[strings.LastIndex(exPath, common.PAR_GO_PATH_DELIMITER)+1:])
+		if !utils.StrInArray(col, curColumns...) {
+			continue
+		}
+		values, _, _, err := pr.ReadColumnByPath(inPath, num)
+		if err != nil {
+			return nil, err
+		}
+		columns[col] = values
+	}
+	if _, ok := columns[curColResourceId]; !ok {
+		return nil, fmt.Errorf("column '%s' not found, make sure the report includes resource ids", curColResourceId)
+	}
+
+	value := func(col string, i int) interface{} {
+		if values, ok := columns[col]; ok && i < len(values) {
+			return values[i]
+		}
+		return nil
+	}
+	str := func(col string, i int) string {
+		if v := value(col, i); v != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return ""
+	}
+
+	items := make([]curLineItem, 0)
+	for i := 0; i < int(num); i++ {
+		if str(curColResourceId, i) == "" {
+			continue
+		}
+		item := curLineItem{
+			ResourceId:   str(curColResourceId, i),
+			ProductCode:  str(curColProductCode, i),
+			UsageType:    str(curColUsageType, i),
+			Currency:     str(curColCurrency, i),
+			Region:       str(curColRegion, i),
+			InstanceType: str(curColInstanceType, i),
+		}
+		switch v := value(curColCost, i).(type) {
+		case float64:
+			item.Cost = v
+		case float32:
+			item.Cost = float64(v)
+		case string:
+			item.Cost, _ = strconv.ParseFloat(v, 64)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// aggregateCurLineItems 按资源汇总费用明细
+func aggregateCurLineItems(items []curLineItem, billingCycle string, provider string) (map[string]ResourceCost, []string) {
+	resp := make(map[string]ResourceCost)
+	resourceIds := make([]string, 0)
+	amounts := make(map[string]float64)
+	for _, item := range items {
+		cost, ok := resp[item.ResourceId]
+		if !ok {
+			resourceIds = append(resourceIds, item.ResourceId)
+			cost = ResourceCost{
+				InstanceId: item.ResourceId,
+				Cycle:      billingCycle,
+				Provider:   provider,
+			}
+		}
+		if cost.ProductCode == "" {
+			cost.ProductCode = item.ProductCode
+		}
+		if cost.Region == "" {
+			cost.Region = item.Region
+		}
+		if cost.Currency == "" {
+			cost.Currency = item.Currency
+		}
+		// 优先使用实例规格作为实例配置
+		if item.InstanceType != "" {
+			cost.InstanceConfig = item.InstanceType
+		} else if cost.InstanceConfig == "" {
+			cost.InstanceConfig = item.UsageType
+		}
+
+		amounts[item.ResourceId] += item.Cost
+		resp[item.ResourceId] = cost
+	}
+
+	for id, amount := range amounts {
+		cost := resp[id]
+		cost.PretaxAmount = float32(amount)
+		resp[id] = cost
+	}
+	return resp, resourceIds
+}
+
+// memParquetFile 基于内存数据实现只读的 source.ParquetFile
+type memParquetFile struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newMemParquetFile(data []byte) *memParquetFile {
+	return &memParquetFile{Reader: bytes.NewReader(data), data: data}
+}
+
+func (f *memParquetFile) Open(name string) (source.ParquetFile, error) {
+	return newMemParquetFile(f.data), nil
+}
+
+func (f *memParquetFile) Create(name string) (source.ParquetFile, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (f *memParquetFile) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("not supported")
+}
+
+func (f *memParquetFile) Close() error {
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package billcollect
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+func TestNormalizeCurColumn(t *testing.T) {
+	assert.Equal(t, "line_item_resource_id", normalizeCurColumn("lineItem/ResourceId"))
+	assert.Equal(t, "line_item_unblended_cost", normalizeCurColumn("lineItem/UnblendedCost"))
+	assert.Equal(t, "product_instance_type", normalizeCurColumn("product/instanceType"))
+	assert.Equal(t, "product_region", normalizeCurColumn("product_region"))
+}
+
+func TestAwsCurLocalDir(t *testing.T) {
+	dir, err := awsCurLocalDir("/data/cur", "tenant-a/report")
+	assert.NoError(t, err)
+	assert.Equal(t, "/data/cur/tenant-a/report", dir)
+
+	_, err = awsCurLocalDir("", "tenant-a")
+	assert.Error(t, err)
+	_, err = awsCurLocalDir("/data/cur", "/etc")
+	assert.Error(t, err)
+	_, err = awsCurLocalDir("/data/cur", "../../etc")
+	assert.Error(t, err)
+}
+
+func writeCurFile(t *testing.T, root string, name string, content []byte) {
+	p := filepath.Join(root, filepath.FromSlash(name))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	assert.NoError(t, os.WriteFile(p, content, 0644))
+}
+
+func TestAwsProviderParseCsvReport(t *testing.T) {
+	dir := t.TempDir()
+
+	csvContent := "identity/LineItemId,lineItem/ProductCode,lineItem/ResourceId,lineItem/UsageType,lineItem/UnblendedCost,lineItem/CurrencyCode,product/region,product/instanceType\n" +
+		"1,AmazonEC2,i-0001,BoxUsage:t3.micro,1.5,USD,us-east-1,t3.micro\n" +
+		"2,AmazonEC2,i-0001,EBS:VolumeUsage,0.5,USD,us-east-1,\n" +
+		"3,AmazonRDS,arn:aws:rds:us-east-1:123456789012:db:mydb,InstanceUsage:db.t3.micro,3,USD,us-east-1,db.t3.micro\n" +
+		"4,AWS,,Tax,0.2,USD,,\n"
+	buf := bytes.Buffer{}
+	gw := gzip.NewWriter(&buf)
+	_, _ = gw.Write([]byte(csvContent))
+	assert.NoError(t, gw.Close())
+
+	// 历史版本的报告不在 Manifest 中，不应该被统计
+	writeCurFile(t, dir, "cur/20220301-20220401/cur-Manifest.json",
+		[]byte(`{"reportKeys": ["prefix/cur/20220301-20220401/a2/cur-00001.csv.gz"]}`))
+	writeCurFile(t, dir, "cur/20220301-20220401/a1/cur-00001.csv.gz", buf.Bytes())
+	writeCurFile(t, dir, "cur/20220301-20220401/a2/cur-00001.csv.gz", buf.Bytes())
+	writeCurFile(t, dir, "cur/20220201-20220301/a0/cur-00001.csv.gz", buf.Bytes())
+
+	p := &awsProvider{source: &localCurSource{dir: dir}, provider: "aws"}
+	costs, ids, data, err := p.ParseMonthBill("2022-03")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"i-0001", "arn:aws:rds:us-east-1:123456789012:db:mydb"}, ids)
+	assert.Len(t, data, 2)
+
+	assert.Equal(t, float32(2), costs["i-0001"].PretaxAmount)
+	assert.Equal(t, "t3.micro", costs["i-0001"].InstanceConfig)
+	assert.Equal(t, "AmazonEC2", costs["i-0001"].ProductCode)
+	assert.Equal(t, "2022-03", costs["i-0001"].Cycle)
+	assert.Equal(t, float32(3), costs["arn:aws:rds:us-east-1:123456789012:db:mydb"].PretaxAmount)
+}
+
+type curParquetRow struct {
+	ResourceId  string  `parquet:"name=line_item_resource_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ProductCode string  `parquet:"name=line_item_product_code, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Cost        float64 `parquet:"name=line_item_unblended_cost, type=DOUBLE"`
+	Region      string  `parquet:"name=product_region, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+func TestAwsProviderParseParquetReport(t *testing.T) {
+	dir := t.TempDir()
+
+	buf := bytes.Buffer{}
+	pw, err := writer.NewParquetWriterFromWriter(&buf, new(curParquetRow), 1)
+	assert.NoError(t, err)
+	for _, row := range []curParquetRow{
+		{"i-0001", "AmazonEC2", 1.25, "us-west-2"},
+		{"i-0001", "AmazonEC2", 0.75, "us-west-2"},
+		{"vol-0001", "AmazonEC2", 0.5, "us-west-2"},
+	} {
+		assert.NoError(t, pw.Write(row))
+	}
+	assert.NoError(t, pw.WriteStop())
+	writeCurFile(t, dir, "cur/cur/year=2022/month=3/cur-00001.snappy.parquet", buf.Bytes())
+	writeCurFile(t, dir, "cur/cur/year=2022/month=4/cur-00001.snappy.parquet", buf.Bytes())
+
+	p := &awsProvider{source: &localCurSource{dir: dir}, provider: "aws"}
+	costs, ids, _, err := p.ParseMonthBill("2022-03")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"i-0001", "vol-0001"}, ids)
+	assert.Equal(t, float32(2), costs["i-0001"].PretaxAmount)
+	assert.Equal(t, "us-west-2", costs["vol-0001"].Region)
+}
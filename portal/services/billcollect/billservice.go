@@ -42,6 +42,8 @@ func GetBillProvider(vg *models.VariableGroup) (BillProvider, error) {
 	switch vg.Provider {
 	case consts.BillCollectAli:
 		return NewAlicloudBillProvider(vg)
+	case consts.BillCollectAws:
+		return NewAwsBillProvider(vg)
 	default:
 		logs.Get().Errorf("unsupported provider %s", vg.Provider)
 		return nil, fmt.Errorf("unsupported provider %s", vg.Provider)
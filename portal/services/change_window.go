@@ -0,0 +1,216 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils/logs"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const ChangeWindowTimeLayout = "2006-01-02 15:04"
+
+var changeWindowCronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// ValidChangeWindow 检查变更窗口的时区、cron 表达式及日期范围设置
+func ValidChangeWindow(w *models.ChangeWindow) e.Error {
+	if w.Timezone == "" {
+		w.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(w.Timezone); err != nil {
+		return e.New(e.ChangeWindowInvalid, fmt.Errorf("invalid timezone: %v", err), http.StatusBadRequest)
+	}
+	if w.Cron == "" && w.StartTime == "" && w.EndTime == "" {
+		return e.New(e.ChangeWindowInvalid, fmt.Errorf("cron or date range is required"), http.StatusBadRequest)
+	}
+	if w.Cron != "" {
+		if _, err := changeWindowCronParser.Parse(w.Cron); err != nil {
+			return e.New(e.ChangeWindowInvalid, fmt.Errorf("invalid cron: %v", err), http.StatusBadRequest)
+		}
+		if w.Duration <= 0 {
+			return e.New(e.ChangeWindowInvalid, fmt.Errorf("duration is required with cron"), http.StatusBadRequest)
+		}
+	}
+	if w.StartTime != "" || w.EndTime != "" {
+		start, err1 := time.Parse(ChangeWindowTimeLayout, w.StartTime)
+		end, err2 := time.Parse(ChangeWindowTimeLayout, w.EndTime)
+		if err1 != nil || err2 != nil {
+			return e.New(e.ChangeWindowInvalid,
+				fmt.Errorf("start and end time must be in format '%s'", ChangeWindowTimeLayout), http.StatusBadRequest)
+		}
+		if !end.After(start) {
+			return e.New(e.ChangeWindowInvalid, fmt.Errorf("end time must be after start time"), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// changeWindowActive 判断时间点是否处于变更窗口的时间段内，处于时间段内时同时返回时间段的结束时间
+func changeWindowActive(w models.ChangeWindow, now time.Time) (bool, time.Time, error) {
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	now = now.In(loc)
+
+	var end time.Time
+	if w.StartTime != "" || w.EndTime != "" {
+		start, err := time.ParseInLocation(ChangeWindowTimeLayout, w.StartTime, loc)
+		if err != nil {
+			return false, time.Time{}, err
+		}
+		end, err = time.ParseInLocation(ChangeWindowTimeLayout, w.EndTime, loc)
+		if err != nil {
+			return false, time.Time{}, err
+		}
+		if now.Before(start) || !now.Before(end) {
+			return false, time.Time{}, nil
+		}
+	}
+
+	if w.Cron != "" {
+		sched, err := changeWindowCronParser.Parse(fmt.Sprintf("CRON_TZ=%s %s", w.Timezone, w.Cron))
+		if err != nil {
+			return false, time.Time{}, err
+		}
+		// 最近一次在 (now - duration, now] 内开始的时间段包含当前时间
+		duration := time.Duration(w.Duration) * time.Minute
+		begin := sched.Next(now.Add(-duration))
+		if begin.After(now) {
+			return false, time.Time{}, nil
+		}
+		if cronEnd := begin.Add(duration); end.IsZero() || cronEnd.Before(end) {
+			end = cronEnd
+		}
+	}
+	return true, end, nil
+}
+
+// CheckChangeWindow 检查项目当前是否允许进行变更。
+// 处于任意冻结期内时不允许变更；设置了变更窗口时只允许在变更窗口内进行变更
+func CheckChangeWindow(tx *db.Session, orgId, projectId models.Id, now time.Time) e.Error {
+	windows := make([]models.ChangeWindow, 0)
+	if err := tx.Model(&models.ChangeWindow{}).
+		Where("org_id = ? AND enabled = ?", orgId, true).
+		Where("project_id = '' OR project_id = ?", projectId).
+		Find(&windows); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	windowNames := make([]string, 0)
+	inWindow := false
+	for _, w := range windows {
+		active, end, err := changeWindowActive(w, now)
+		if err != nil {
+			logs.Get().WithField("changeWindow", w.Id).Warnf("invalid change window: %v", err)
+			continue
+		}
+		switch w.Type {
+		case models.ChangeWindowTypeFreeze:
+			if active {
+				return e.New(e.ChangeFrozen, fmt.Errorf("change freeze '%s' is in effect until %s %s",
+					w.Name, end.Format(ChangeWindowTimeLayout), w.Timezone), http.StatusForbidden)
+			}
+		case models.ChangeWindowTypeWindow:
+			windowNames = append(windowNames, w.Name)
+			inWindow = inWindow || active
+		}
+	}
+	if len(windowNames) > 0 && !inWindow {
+		return e.New(e.ChangeWindowClosed, fmt.Errorf("changes are only allowed within change windows: %s",
+			strings.Join(windowNames, ", ")), http.StatusForbidden)
+	}
+	return nil
+}
+
+// CheckTaskChangeWindow 检查任务是否允许执行，plan 任务不修改资源，紧急变更的任务不受限制
+func CheckTaskChangeWindow(tx *db.Session, task *models.Task, now time.Time) e.Error {
+	if task.Type == common.TaskTypePlan || task.ChangeWindowOverride {
+		return nil
+	}
+	return CheckChangeWindow(tx, task.OrgId, task.ProjectId, now)
+}
+
+// OverrideTaskChangeWindow 将任务标记为紧急变更，并记录审计日志
+func OverrideTaskChangeWindow(tx *db.Session, task *models.Task, userId models.Id, reason string) e.Error {
+	if _, err := tx.Model(&models.Task{}).Where("id = ?", task.Id).
+		UpdateAttrs(models.Attrs{"change_window_override": true}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	task.ChangeWindowOverride = true
+	InsertUserOperateLog(userId, task.OrgId, task.EnvId, consts.OperatorObjectTypeEnv, "change_window_override", task.Name,
+		models.ResAttrs{"taskId": task.Id, "reason": reason})
+	return nil
+}
+
+func CreateChangeWindow(tx *db.Session, w models.ChangeWindow) (*models.ChangeWindow, e.Error) {
+	if er := ValidChangeWindow(&w); er != nil {
+		return nil, er
+	}
+	if w.Id == "" {
+		w.Id = models.NewId("cw")
+	}
+	if err := models.Create(tx, &w); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &w, nil
+}
+
+func GetChangeWindowById(tx *db.Session, orgId, id models.Id) (*models.ChangeWindow, e.Error) {
+	w := models.ChangeWindow{}
+	if err := tx.Where("org_id = ? AND id = ?", orgId, id).First(&w); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ChangeWindowNotExist, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &w, nil
+}
+
+func SearchChangeWindow(query *db.Session, orgId, projectId models.Id) *db.Session {
+	query = query.Model(&models.ChangeWindow{}).Where("org_id = ?", orgId)
+	if projectId != "" {
+		query = query.Where("project_id = '' OR project_id = ?", projectId)
+	}
+	return query.Order("created_at DESC")
+}
+
+func UpdateChangeWindow(tx *db.Session, w *models.ChangeWindow) (*models.ChangeWindow, e.Error) {
+	if er := ValidChangeWindow(w); er != nil {
+		return nil, er
+	}
+	if _, err := tx.Model(&models.ChangeWindow{}).Where("org_id = ? AND id = ?", w.OrgId, w.Id).
+		UpdateAttrs(models.Attrs{
+			"name":        w.Name,
+			"type":        w.Type,
+			"enabled":     w.Enabled,
+			"description": w.Description,
+			"timezone":    w.Timezone,
+			"cron":        w.Cron,
+			"duration":    w.Duration,
+			"start_time":  w.StartTime,
+			"end_time":    w.EndTime,
+		}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return GetChangeWindowById(tx, w.OrgId, w.Id)
+}
+
+func DeleteChangeWindow(tx *db.Session, orgId, id models.Id) e.Error {
+	n, err := tx.Where("org_id = ? AND id = ?", orgId, id).Delete(&models.ChangeWindow{})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n == 0 {
+		return e.New(e.ChangeWindowNotExist, http.StatusNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidChangeWindow(t *testing.T) {
+	w := models.ChangeWindow{Cron: "0 9 * * 1-5", Duration: 480}
+	assert.Nil(t, ValidChangeWindow(&w))
+	assert.Equal(t, "UTC", w.Timezone)
+
+	assert.NotNil(t, ValidChangeWindow(&models.ChangeWindow{}))
+	assert.NotNil(t, ValidChangeWindow(&models.ChangeWindow{Cron: "0 9 * * 1-5"}))
+	assert.NotNil(t, ValidChangeWindow(&models.ChangeWindow{Cron: "0 9 * *", Duration: 60}))
+	assert.NotNil(t, ValidChangeWindow(&models.ChangeWindow{Timezone: "Mars/Olympus", Cron: "0 9 * * *", Duration: 60}))
+	assert.NotNil(t, ValidChangeWindow(&models.ChangeWindow{StartTime: "2023-01-02 00:00", EndTime: "2023-01-01 00:00"}))
+}
+
+func TestChangeWindowActive(t *testing.T) {
+	// 工作日 9:00 - 17:00 (Asia/Shanghai)
+	w := models.ChangeWindow{Timezone: "Asia/Shanghai", Cron: "0 9 * * 1-5", Duration: 480}
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+
+	// 2023-03-06 为周一
+	active, end, err := changeWindowActive(w, time.Date(2023, 3, 6, 10, 30, 0, 0, loc))
+	assert.NoError(t, err)
+	assert.True(t, active)
+	assert.Equal(t, time.Date(2023, 3, 6, 17, 0, 0, 0, loc), end.In(loc))
+
+	active, _, _ = changeWindowActive(w, time.Date(2023, 3, 6, 17, 0, 0, 0, loc))
+	assert.False(t, active)
+	active, _, _ = changeWindowActive(w, time.Date(2023, 3, 5, 10, 0, 0, 0, loc))
+	assert.False(t, active)
+
+	// 日期范围
+	freeze := models.ChangeWindow{Timezone: "UTC", StartTime: "2023-12-20 00:00", EndTime: "2024-01-03 00:00"}
+	active, end, _ = changeWindowActive(freeze, time.Date(2023, 12, 25, 0, 0, 0, 0, time.UTC))
+	assert.True(t, active)
+	assert.Equal(t, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), end)
+	active, _, _ = changeWindowActive(freeze, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC))
+	assert.False(t, active)
+}
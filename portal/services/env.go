@@ -21,6 +21,7 @@ import (
 	"cloudiac/portal/models"
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services/statebackend"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
 )
@@ -40,6 +41,14 @@ func CreateEnv(tx *db.Session, env models.Env) (*models.Env, e.Error) {
 	if env.StatePath == "" {
 		env.StatePath = env.DefaultStatPath()
 	}
+	// 环境未指定 state backend 时使用组织默认值(组织未设置则使用系统配置)
+	if env.StateBackend == "" {
+		org, err := GetOrganizationById(tx, env.OrgId)
+		if err != nil {
+			return nil, err
+		}
+		env.StateBackend = statebackend.Resolve("", org.StateBackend)
+	}
 	if err := models.Create(tx, &env); err != nil {
 		if e.IsDuplicate(err) {
 			return nil, e.New(e.EnvNameDuplicated, err)
@@ -202,7 +211,10 @@ func ChangeEnvStatusWithTaskAndStep(tx *db.Session, id models.Id, task *models.T
 			// 任务驳回，环境状态不变
 			envStatus = ""
 		case models.TaskFailed:
-			envStatus = models.EnvStatusFailed
+			// 导入及 state 操作失败不会变更云资源，环境状态不变
+			if task.Type != models.TaskTypeImport && task.Type != models.TaskTypeState {
+				envStatus = models.EnvStatusFailed
+			}
 		case models.TaskAborted:
 			var err error
 			envStatus, err = getEnvStatusOnTaskAborted(tx, task.Id)
@@ -210,7 +222,7 @@ func ChangeEnvStatusWithTaskAndStep(tx *db.Session, id models.Id, task *models.T
 				return e.New(e.InternalError, errors.Wrap(err, "getEnvStatusOnTaskAborted"))
 			}
 		case models.TaskComplete:
-			if task.Type == models.TaskTypeApply {
+			if task.Type == models.TaskTypeApply || task.Type == models.TaskTypeImport {
 				envStatus = models.EnvStatusActive
 			} else if task.Type == models.TaskTypeDestroy {
 				envStatus = models.EnvStatusDestroyed
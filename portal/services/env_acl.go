@@ -0,0 +1,187 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// GetEnvUserRole 获取用户在环境中的角色，没有设置环境角色时返回空字符串。
+// 环境角色只在用户仍是环境所在项目的成员时生效
+func GetEnvUserRole(tx *db.Session, envId, userId models.Id) (string, e.Error) {
+	envUser := models.EnvUser{}
+	if err := tx.Model(&models.EnvUser{}).
+		Joins("JOIN iac_env ON iac_env.id = iac_env_user.env_id").
+		Joins("JOIN iac_user_project ON iac_user_project.project_id = iac_env.project_id AND "+
+			"iac_user_project.user_id = iac_env_user.user_id").
+		Where("iac_env_user.env_id = ? AND iac_env_user.user_id = ?", envId, userId).
+		First(&envUser); err != nil {
+		if e.IsRecordNotFound(err) {
+			return "", nil
+		}
+		return "", e.New(e.DBError, err)
+	}
+	return envUser.Role, nil
+}
+
+func SearchEnvUser(query *db.Session, envId models.Id) *db.Session {
+	return query.Model(&models.EnvUser{}).Where("env_id = ?", envId).Order("id")
+}
+
+// SetEnvUser 设置用户在环境中的角色，已存在时更新
+func SetEnvUser(tx *db.Session, envUser models.EnvUser) e.Error {
+	n, err := tx.Model(&models.EnvUser{}).Where("env_id = ? AND user_id = ?", envUser.EnvId, envUser.UserId).
+		UpdateAttrs(models.Attrs{"role": envUser.Role})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n > 0 {
+		return nil
+	}
+	// 角色未变化时更新的行数为 0，此时插入会出现唯一索引冲突
+	if err := tx.Insert(&envUser); err != nil && !e.IsDuplicate(err) {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+func DeleteEnvUser(tx *db.Session, envId, userId models.Id) e.Error {
+	n, err := tx.Where("env_id = ? AND user_id = ?", envId, userId).Delete(&models.EnvUser{})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n == 0 {
+		return e.New(e.EnvUserNotExist, http.StatusNotFound)
+	}
+	return nil
+}
+
+// DeleteProjectEnvUsers 删除用户在项目下所有环境中的角色，用户被移出项目时调用
+func DeleteProjectEnvUsers(tx *db.Session, projectId, userId models.Id) e.Error {
+	if _, err := tx.Where("user_id = ? AND env_id IN (?)", userId,
+		gorm.Expr("SELECT id FROM iac_env WHERE project_id = ?", projectId)).Delete(&models.EnvUser{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// DeleteOrgEnvUsers 删除用户在组织下所有环境中的角色，用户被移出组织时调用
+func DeleteOrgEnvUsers(tx *db.Session, orgId, userId models.Id) e.Error {
+	if _, err := tx.Where("user_id = ? AND env_id IN (?)", userId,
+		gorm.Expr("SELECT id FROM iac_env WHERE org_id = ?", orgId)).Delete(&models.EnvUser{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// IsEnvOwner 判断用户是否为环境的所有者：环境创建者、环境管理者，或者组织管理员
+func IsEnvOwner(tx *db.Session, env *models.Env, userId models.Id) (bool, e.Error) {
+	if env.CreatorId == userId || UserHasOrgRole(userId, env.OrgId, consts.OrgRoleAdmin) {
+		return true, nil
+	}
+	role, er := GetEnvUserRole(tx, env.Id, userId)
+	if er != nil {
+		return false, er
+	}
+	return role == consts.ProjectRoleManager, nil
+}
+
+// CheckEnvDestroyPerm 受保护的环境只允许环境所有者发起销毁
+func CheckEnvDestroyPerm(tx *db.Session, env *models.Env, userId models.Id, isSuperAdmin bool) e.Error {
+	if !env.Protected || isSuperAdmin {
+		return nil
+	}
+	if ok, er := IsEnvOwner(tx, env, userId); er != nil {
+		return er
+	} else if !ok {
+		return e.New(e.EnvProtected, http.StatusForbidden)
+	}
+	return nil
+}
+
+// CheckEnvApprover 检查用户是否可以审批环境的任务，受保护且设置了审批组的环境只能由审批组成员审批
+func CheckEnvApprover(tx *db.Session, env *models.Env, userId models.Id) e.Error {
+	if !env.Protected || env.ApproverGroupId == "" {
+		return nil
+	}
+	group, er := GetApproverGroupById(tx, env.OrgId, env.ApproverGroupId)
+	if er != nil {
+		return er
+	}
+	if !utils.StrInArray(userId.String(), group.UserIds...) {
+		return e.New(e.EnvApproverRequired, http.StatusForbidden)
+	}
+	return nil
+}
+
+// EnvRequiredApprovals 环境任务需要的审批人数，只有受保护的环境支持多人审批
+func EnvRequiredApprovals(env *models.Env) int {
+	if !env.Protected || env.RequiredApprovals < 1 {
+		return 1
+	}
+	return env.RequiredApprovals
+}
+
+func CreateApproverGroup(tx *db.Session, group models.ApproverGroup) (*models.ApproverGroup, e.Error) {
+	if group.Id == "" {
+		group.Id = models.NewId("apg")
+	}
+	if err := models.Create(tx, &group); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.ApproverGroupAlreadyExists, err, http.StatusBadRequest)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &group, nil
+}
+
+func GetApproverGroupById(tx *db.Session, orgId, id models.Id) (*models.ApproverGroup, e.Error) {
+	group := models.ApproverGroup{}
+	if err := tx.Where("org_id = ? AND id = ?", orgId, id).First(&group); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ApproverGroupNotExist, err, http.StatusBadRequest)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &group, nil
+}
+
+func SearchApproverGroup(query *db.Session, orgId models.Id, q string) *db.Session {
+	query = query.Model(&models.ApproverGroup{}).Where("org_id = ?", orgId)
+	if q != "" {
+		query = query.WhereLike("name", q)
+	}
+	return query.Order("created_at DESC")
+}
+
+func UpdateApproverGroup(tx *db.Session, orgId, id models.Id, attrs models.Attrs) (*models.ApproverGroup, e.Error) {
+	if _, err := tx.Model(&models.ApproverGroup{}).Where("org_id = ? AND id = ?", orgId, id).UpdateAttrs(attrs); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.ApproverGroupAlreadyExists, err, http.StatusBadRequest)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return GetApproverGroupById(tx, orgId, id)
+}
+
+// DeleteApproverGroup 删除审批组，审批组被环境使用时不允许删除
+func DeleteApproverGroup(tx *db.Session, orgId, id models.Id) e.Error {
+	if exists, err := tx.Model(&models.Env{}).Where("approver_group_id = ?", id).Exists(); err != nil {
+		return e.New(e.DBError, err)
+	} else if exists {
+		return e.New(e.ApproverGroupInUse, http.StatusBadRequest)
+	}
+
+	n, err := tx.Where("org_id = ? AND id = ?", orgId, id).Delete(&models.ApproverGroup{})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n == 0 {
+		return e.New(e.ApproverGroupNotExist, http.StatusNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvRequiredApprovals(t *testing.T) {
+	assert.Equal(t, 1, EnvRequiredApprovals(&models.Env{RequiredApprovals: 3}))
+	assert.Equal(t, 1, EnvRequiredApprovals(&models.Env{Protected: true}))
+	assert.Equal(t, 3, EnvRequiredApprovals(&models.Env{Protected: true, RequiredApprovals: 3}))
+}
+
+func TestUnprotectedEnvPerm(t *testing.T) {
+	// 未受保护的环境不需要查询数据库
+	env := &models.Env{CreatorId: "u-1", ApproverGroupId: "apg-1"}
+	assert.Nil(t, CheckEnvDestroyPerm(nil, env, "u-2", false))
+	assert.Nil(t, CheckEnvApprover(nil, env, "u-2"))
+
+	env.Protected = true
+	assert.Nil(t, CheckEnvDestroyPerm(nil, env, "u-2", true))
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"net/http"
+)
+
+// CreateEnvChain 创建依赖链编排
+// 部署时按依赖顺序部署环境及其所有上游环境，销毁时先销毁所有下游环境再销毁当前环境
+func CreateEnvChain(tx *db.Session, env *models.Env, action string, creatorId models.Id) (*models.EnvChain, e.Error) {
+	if action != models.EnvChainActionDeploy && action != models.EnvChainActionDestroy {
+		return nil, e.New(e.BadParam, fmt.Errorf("invalid action '%s'", action))
+	}
+
+	if exists, err := tx.Model(&models.EnvChain{}).
+		Where("env_id = ? AND status = ?", env.Id, models.EnvChainStatusRunning).Exists(); err != nil {
+		return nil, e.New(e.DBError, err)
+	} else if exists {
+		return nil, e.New(e.EnvChainActive)
+	}
+
+	g, er := GetProjectEnvGraph(tx, env.ProjectId)
+	if er != nil {
+		return nil, er
+	}
+	if action == models.EnvChainActionDestroy {
+		g = g.Reverse()
+	}
+	order, err := g.TopoSort(env.Id)
+	if err != nil {
+		return nil, e.New(e.EnvDependencyCycle, err)
+	}
+
+	isSuperAdmin := UserIsSuperAdmin(tx, creatorId)
+	envIds := make(models.StrSlice, 0, len(order))
+	for _, id := range order {
+		if action == models.EnvChainActionDestroy {
+			dep, er := GetEnvById(tx, id)
+			if er != nil {
+				return nil, er
+			}
+			// 未部署的下游环境不需要销毁
+			if id != env.Id && dep.Status != models.EnvStatusActive && dep.Status != models.EnvStatusFailed {
+				continue
+			}
+			if er := CheckEnvDestroyPerm(tx, dep, creatorId, isSuperAdmin); er != nil {
+				return nil, e.New(er.Code(), fmt.Errorf("env '%s' is protected", dep.Name), http.StatusForbidden)
+			}
+		}
+		envIds = append(envIds, id.String())
+	}
+
+	chain := models.EnvChain{
+		OrgId:     env.OrgId,
+		ProjectId: env.ProjectId,
+		EnvId:     env.Id,
+		CreatorId: creatorId,
+		Action:    action,
+		Status:    models.EnvChainStatusRunning,
+		EnvIds:    envIds,
+		TaskIds:   models.StrSlice{},
+	}
+	chain.Id = models.NewId("chain")
+	if err := tx.Insert(&chain); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	if er := AdvanceEnvChain(tx, &chain); er != nil {
+		return nil, er
+	}
+	return &chain, nil
+}
+
+func GetEnvChainById(sess *db.Session, id models.Id) (*models.EnvChain, e.Error) {
+	chain := models.EnvChain{}
+	if err := sess.Model(&models.EnvChain{}).Where("id = ?", id).First(&chain); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ObjectNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &chain, nil
+}
+
+func QueryEnvChains(sess *db.Session, envId models.Id) *db.Session {
+	return sess.Model(&models.EnvChain{}).Where("env_id = ?", envId).Order("created_at DESC")
+}
+
+func GetRunningEnvChains(sess *db.Session) ([]models.EnvChain, e.Error) {
+	chains := make([]models.EnvChain, 0)
+	if err := sess.Model(&models.EnvChain{}).
+		Where("status = ?", models.EnvChainStatusRunning).Find(&chains); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return chains, nil
+}
+
+// AdvanceEnvChain 推进编排进度: 上一个任务成功结束后为下一个环境创建任务，任务失败则编排失败
+func AdvanceEnvChain(tx *db.Session, chain *models.EnvChain) e.Error {
+	if chain.Status != models.EnvChainStatusRunning {
+		return nil
+	}
+
+	if n := len(chain.TaskIds); n > 0 {
+		task, er := GetTaskById(tx, models.Id(chain.TaskIds[n-1]))
+		if er != nil {
+			return er
+		}
+		if !task.Exited() {
+			return nil
+		}
+		if task.Status != models.TaskComplete {
+			return finishEnvChain(tx, chain, models.EnvChainStatusFailed,
+				fmt.Sprintf("task %s of env %s %s", task.Id, task.EnvId, task.Status))
+		}
+	}
+
+	if len(chain.TaskIds) >= len(chain.EnvIds) {
+		return finishEnvChain(tx, chain, models.EnvChainStatusComplete, "")
+	}
+
+	env, er := GetEnvById(tx, models.Id(chain.EnvIds[len(chain.TaskIds)]))
+	if er != nil {
+		return er
+	}
+	if env.Archived || env.Locked {
+		return finishEnvChain(tx, chain, models.EnvChainStatusFailed,
+			fmt.Sprintf("env %s is archived or locked", env.Id))
+	}
+	// 环境有其他任务在执行，等待其结束
+	if tasks, er := GetActiveTaskByEnvId(tx, env.Id); er != nil {
+		return er
+	} else if len(tasks) > 0 {
+		return nil
+	}
+
+	taskType := models.TaskTypeApply
+	if chain.Action == models.EnvChainActionDestroy {
+		taskType = models.TaskTypeDestroy
+	}
+	task, er := createEnvRunTask(tx, env, taskType, chain.CreatorId, consts.TaskSourceEnvChain, env.AutoApproval)
+	if er != nil {
+		return finishEnvChain(tx, chain, models.EnvChainStatusFailed,
+			fmt.Sprintf("create task of env %s: %v", env.Id, er))
+	}
+
+	chain.TaskIds = append(chain.TaskIds, task.Id.String())
+	if _, err := tx.Model(&models.EnvChain{}).Where("id = ?", chain.Id).
+		UpdateColumn("task_ids", chain.TaskIds); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+func finishEnvChain(tx *db.Session, chain *models.EnvChain, status string, message string) e.Error {
+	chain.Status = status
+	chain.Message = message
+	if _, err := tx.Model(&models.EnvChain{}).Where("id = ?", chain.Id).
+		UpdateAttrs(models.Attrs{"status": status, "message": message}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// createEnvRunTask 使用环境当前的配置创建部署、plan 或销毁任务
+func createEnvRunTask(tx *db.Session, env *models.Env, taskType string, creatorId models.Id, source string, autoApprove bool) (*models.Task, e.Error) {
+	tpl, er := GetTemplateById(tx, env.TplId)
+	if er != nil {
+		return nil, er
+	}
+	vars, err := GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+	if err != nil {
+		return nil, e.AutoNew(err, e.DBError)
+	}
+
+	paramTask := models.Task{
+		Name:            models.Task{}.GetTaskNameByType(taskType),
+		Targets:         env.Targets,
+		CreatorId:       creatorId,
+		KeyId:           env.KeyId,
+		Variables:       vars,
+		AutoApprove:     autoApprove,
+		Revision:        env.Revision,
+		StopOnViolation: env.StopOnViolation,
+		ExtraData:       env.ExtraData,
+		BaseTask: models.BaseTask{
+			Type:        taskType,
+			StepTimeout: env.StepTimeout,
+			RunnerId:    env.RunnerId,
+		},
+		Source: source,
+	}
+	if taskType == models.TaskTypeDestroy {
+		paramTask.Targets = nil
+	}
+
+	if env.LastResTaskId != "" {
+		// 与自动部署一致，使用环境最后一次部署时的 pipeline
+		lastResTask, er := GetTaskById(tx, env.LastResTaskId)
+		if er != nil {
+			return nil, er
+		}
+		paramTask.Pipeline = lastResTask.Pipeline
+		paramTask.CommitId = lastResTask.CommitId
+	}
+
+	return CreateTask(tx, tpl, env, paramTask)
+}
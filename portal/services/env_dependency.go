@@ -0,0 +1,286 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 引用其他环境 output 的变量值，如: ${env:net-prod.outputs.vpc_id}，环境名称需要在同一项目下
+var envOutputRefRegexp = regexp.MustCompile(`\$\{env:([^.}]+)\.outputs\.([^}]+)}`)
+
+// EnvGraph 环境依赖图，key 为环境 id，value 为其直接依赖(或被依赖)的环境 id 列表
+type EnvGraph map[models.Id][]models.Id
+
+// Reverse 返回反向依赖图(环境 -> 依赖该环境的环境)
+func (g EnvGraph) Reverse() EnvGraph {
+	r := make(EnvGraph)
+	for id, deps := range g {
+		for _, d := range deps {
+			r[d] = append(r[d], id)
+		}
+	}
+	// map 遍历顺序不固定，排序以保证编排顺序稳定
+	for _, ids := range r {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	return r
+}
+
+// TopoSort 返回 start 及其在图中可达的所有环境，每个环境都排在其依赖之后
+// 部署时对依赖图排序，销毁时对反向依赖图排序即可得到执行顺序
+func (g EnvGraph) TopoSort(start models.Id) ([]models.Id, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[models.Id]int)
+	order := make([]models.Id, 0)
+
+	var visit func(id models.Id, path []models.Id) error
+	visit = func(id models.Id, path []models.Id) error {
+		switch state[id] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %v", append(path, id))
+		}
+
+		state[id] = visiting
+		for _, dep := range g[id] {
+			if err := visit(dep, append(path, id)); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		order = append(order, id)
+		return nil
+	}
+
+	if err := visit(start, nil); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// GetProjectEnvGraph 获取项目下所有环境的依赖图
+func GetProjectEnvGraph(sess *db.Session, projectId models.Id) (EnvGraph, e.Error) {
+	deps := make([]models.EnvDependency, 0)
+	if err := sess.Model(&models.EnvDependency{}).Where("project_id = ?", projectId).Find(&deps); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	g := make(EnvGraph)
+	for _, d := range deps {
+		g[d.EnvId] = append(g[d.EnvId], d.DependsOn)
+	}
+	return g, nil
+}
+
+// GetEnvDependsOn 查询环境直接依赖的环境列表
+func GetEnvDependsOn(sess *db.Session, envId models.Id) ([]models.Env, e.Error) {
+	envs := make([]models.Env, 0)
+	subQuery := sess.Model(&models.EnvDependency{}).Select("depends_on").Where("env_id = ?", envId)
+	if err := sess.Model(&models.Env{}).Where("id IN (?)", subQuery.Expr()).Find(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return envs, nil
+}
+
+// GetEnvDependents 查询直接依赖该环境的环境列表
+func GetEnvDependents(sess *db.Session, envId models.Id) ([]models.Env, e.Error) {
+	envs := make([]models.Env, 0)
+	subQuery := sess.Model(&models.EnvDependency{}).Select("env_id").Where("depends_on = ?", envId)
+	if err := sess.Model(&models.Env{}).Where("id IN (?)", subQuery.Expr()).Find(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return envs, nil
+}
+
+// SetEnvDependencies 设置环境依赖的环境列表(全量覆盖)
+func SetEnvDependencies(tx *db.Session, env *models.Env, dependsOn []models.Id) e.Error {
+	g, er := GetProjectEnvGraph(tx, env.ProjectId)
+	if er != nil {
+		return er
+	}
+
+	deps := make([]models.Id, 0, len(dependsOn))
+	seen := make(map[models.Id]bool)
+	for _, id := range dependsOn {
+		if id == env.Id {
+			return e.New(e.EnvDependencyInvalid, fmt.Errorf("env cannot depend on itself"))
+		}
+		if _, er := GetEnvById(QueryWithProjectId(tx, env.ProjectId), id); er != nil {
+			if er.Code() == e.EnvNotExists {
+				return e.New(e.EnvDependencyInvalid, fmt.Errorf("env '%s' not exists in project", id))
+			}
+			return er
+		}
+		if !seen[id] {
+			seen[id] = true
+			deps = append(deps, id)
+		}
+	}
+
+	g[env.Id] = deps
+	if _, err := g.TopoSort(env.Id); err != nil {
+		return e.New(e.EnvDependencyCycle, err)
+	}
+
+	if _, err := tx.Where("env_id = ?", env.Id).Delete(&models.EnvDependency{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	for _, id := range deps {
+		if err := tx.Insert(&models.EnvDependency{
+			OrgId:     env.OrgId,
+			ProjectId: env.ProjectId,
+			EnvId:     env.Id,
+			DependsOn: id,
+		}); err != nil {
+			return e.New(e.DBError, err)
+		}
+	}
+	return nil
+}
+
+// CheckEnvDestroyable 检查环境是否可以销毁，有依赖该环境且未销毁的环境时不允许销毁
+func CheckEnvDestroyable(sess *db.Session, envId models.Id) e.Error {
+	dependents, er := GetEnvDependents(sess, envId)
+	if er != nil {
+		return er
+	}
+
+	names := make([]string, 0)
+	for _, env := range dependents {
+		if env.Status == models.EnvStatusActive || env.Status == models.EnvStatusFailed {
+			names = append(names, env.Name)
+		}
+	}
+	if len(names) > 0 {
+		return e.New(e.EnvHasDependents, fmt.Errorf("env is depended on by: %s", strings.Join(names, ", ")))
+	}
+	return nil
+}
+
+// GetEnvOutputs 获取环境最后一次部署的 outputs
+func GetEnvOutputs(sess *db.Session, env *models.Env) (map[string]TfStateVariable, e.Error) {
+	outputs := make(map[string]TfStateVariable)
+	if env.LastResTaskId == "" {
+		return outputs, nil
+	}
+
+	task, er := GetTaskById(sess, env.LastResTaskId)
+	if er != nil {
+		return nil, er
+	}
+	bs, err := json.Marshal(task.Result.Outputs)
+	if err != nil {
+		return nil, e.New(e.InternalError, err)
+	}
+	if err := json.Unmarshal(bs, &outputs); err != nil {
+		return nil, e.New(e.InternalError, err)
+	}
+	return outputs, nil
+}
+
+// envOutputValueString 字符串类型的 output 直接使用其值，其他类型使用 json 编码(runner 会将 json 解析为 map 或 list)
+func envOutputValueString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	bs, _ := json.Marshal(v)
+	return string(bs)
+}
+
+// ResolveEnvOutputRefs 将变量值中对其他环境 output 的引用替换为实际的值
+// 被引用的环境必须是当前环境声明的依赖，引用了敏感 output 的变量会被加密
+func ResolveEnvOutputRefs(sess *db.Session, env *models.Env, vars models.TaskVariables) (models.TaskVariables, e.Error) {
+	var (
+		depsByName map[string]*models.Env
+		outputsMap = make(map[models.Id]map[string]TfStateVariable)
+	)
+
+	lookup := func(envName, outputName string) (*TfStateVariable, e.Error) {
+		if depsByName == nil {
+			deps, er := GetEnvDependsOn(sess, env.Id)
+			if er != nil {
+				return nil, er
+			}
+			depsByName = make(map[string]*models.Env)
+			for i := range deps {
+				depsByName[deps[i].Name] = &deps[i]
+			}
+		}
+
+		dep, ok := depsByName[envName]
+		if !ok {
+			return nil, e.New(e.EnvOutputRefInvalid, fmt.Errorf("env '%s' is not a dependency", envName))
+		}
+		outputs, ok := outputsMap[dep.Id]
+		if !ok {
+			var er e.Error
+			if outputs, er = GetEnvOutputs(sess, dep); er != nil {
+				return nil, er
+			}
+			outputsMap[dep.Id] = outputs
+		}
+
+		out, ok := outputs[outputName]
+		if !ok {
+			return nil, e.New(e.EnvOutputRefInvalid, fmt.Errorf("env '%s' has no output '%s'", envName, outputName))
+		}
+		return &out, nil
+	}
+
+	resolved := make(models.TaskVariables, 0, len(vars))
+	for _, v := range vars {
+		// 敏感变量保存的是加密后的值，不会包含引用
+		if v.Sensitive || strings.HasPrefix(v.Value, utils.SecretValuePrefix) {
+			resolved = append(resolved, v)
+			continue
+		}
+		matches := envOutputRefRegexp.FindAllStringSubmatchIndex(v.Value, -1)
+		if len(matches) == 0 {
+			resolved = append(resolved, v)
+			continue
+		}
+
+		var (
+			buf       strings.Builder
+			last      int
+			sensitive bool
+		)
+		for _, m := range matches {
+			out, er := lookup(v.Value[m[2]:m[3]], v.Value[m[4]:m[5]])
+			if er != nil {
+				return nil, er
+			}
+			buf.WriteString(v.Value[last:m[0]])
+			buf.WriteString(envOutputValueString(out.Value))
+			sensitive = sensitive || out.Sensitive
+			last = m[1]
+		}
+		buf.WriteString(v.Value[last:])
+
+		v.Value = buf.String()
+		if sensitive {
+			value, err := utils.EncryptSecretVar(v.Value)
+			if err != nil {
+				return nil, e.New(e.InternalError, err)
+			}
+			v.Value = value
+			v.Sensitive = true
+		}
+		resolved = append(resolved, v)
+	}
+	return resolved, nil
+}
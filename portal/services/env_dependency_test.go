@@ -0,0 +1,72 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvGraphTopoSort(t *testing.T) {
+	// app -> db -> net, app -> net
+	g := EnvGraph{
+		"env-app": {"env-db", "env-net"},
+		"env-db":  {"env-net"},
+	}
+
+	order, err := g.TopoSort("env-app")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Id{"env-net", "env-db", "env-app"}, order)
+
+	// 销毁 net 时需要先销毁依赖它的 app 和 db
+	order, err = g.Reverse().TopoSort("env-net")
+	assert.NoError(t, err)
+	assert.Len(t, order, 3)
+	assert.Equal(t, models.Id("env-net"), order[2])
+	assert.Equal(t, models.Id("env-app"), order[0])
+
+	order, err = g.TopoSort("env-db")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Id{"env-net", "env-db"}, order)
+
+	g["env-net"] = []models.Id{"env-app"}
+	_, err = g.TopoSort("env-app")
+	assert.Error(t, err)
+}
+
+func TestEnvOutputRef(t *testing.T) {
+	m := envOutputRefRegexp.FindAllStringSubmatch("${env:net-prod.outputs.vpc_id}/${env:db.outputs.endpoint}", -1)
+	assert.Len(t, m, 2)
+	assert.Equal(t, []string{"net-prod", "vpc_id"}, m[0][1:])
+	assert.Equal(t, []string{"db", "endpoint"}, m[1][1:])
+
+	assert.Equal(t, "vpc-1", envOutputValueString("vpc-1"))
+	assert.Equal(t, `["a","b"]`, envOutputValueString([]interface{}{"a", "b"}))
+	assert.Equal(t, "3", envOutputValueString(float64(3)))
+}
+
+func TestStackRunOrder(t *testing.T) {
+	// app -> db -> net, web -> net, cache 无依赖
+	g := EnvGraph{
+		"env-app": {"env-db"},
+		"env-db":  {"env-net"},
+		"env-web": {"env-net"},
+	}
+
+	// db 不在编排中，app 仍需等待 net 执行完成
+	order, deps, err := StackRunOrder(g, []models.Id{"env-app", "env-web", "env-net", "env-cache"})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Id{"env-net", "env-app", "env-web", "env-cache"}, order)
+	assert.Equal(t, []models.Id{"env-net"}, deps["env-app"])
+	assert.Equal(t, []models.Id{"env-net"}, deps["env-web"])
+	assert.Empty(t, deps["env-net"])
+	assert.Empty(t, deps["env-cache"])
+
+	// 销毁时使用反向依赖图，net 需要等待 app 和 web 销毁完成
+	order, deps, err = StackRunOrder(g.Reverse(), []models.Id{"env-net", "env-app", "env-web"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.Id("env-net"), order[2])
+	assert.ElementsMatch(t, []models.Id{"env-app", "env-web"}, deps["env-net"])
+}
@@ -0,0 +1,415 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services/statebackend"
+	"cloudiac/utils/logs"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MigrateEnvState 将环境的 state 从当前 backend 迁移到目标 backend，tx 需要为事务。
+// 迁移完成后源 backend 中的 state 不会被删除，作为备份保留。
+// 目标 backend 已存在 state 时拒绝迁移，force 为 true 时覆盖目标 backend 中的 state
+func MigrateEnvState(tx *db.Session, env *models.Env, to string, force bool) e.Error {
+	logger := logs.Get().WithField("func", "MigrateEnvState").WithField("envId", env.Id)
+
+	// 迁移过程中锁定环境记录，创建任务等更新环境的操作需要等待迁移完成，
+	// 锁定后重新查询环境，避免使用迁移开始前查询到的旧数据
+	if err := tx.Raw("SELECT * FROM iac_env WHERE id = ? FOR UPDATE", env.Id).Scan(env); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	from := env.StateBackend
+	if from == "" {
+		from = common.StateBackendConsul
+	}
+	if from == to {
+		return nil
+	}
+
+	if tasks, err := GetActiveTaskByEnvId(tx, env.Id); err != nil {
+		return err
+	} else if len(tasks) > 0 {
+		return e.New(e.EnvStateMigrateActive, http.StatusConflict)
+	}
+
+	// 迁移过程中持有 state 锁，terraform 的加锁请求会等待迁移事务结束。
+	// 锁在同一事务中释放，迁移失败回滚时不会残留
+	lockId := models.NewId("migrate").String()
+	if _, err := LockEnvState(tx, env.Id, lockId, ""); err != nil {
+		return e.New(err.Code(), err, http.StatusConflict)
+	}
+
+	src, err := statebackend.Get(from)
+	if err != nil {
+		return e.New(e.EnvStateBackendError, err)
+	}
+	dst, err := statebackend.Get(to)
+	if err != nil {
+		return e.New(e.EnvStateBackendError, err)
+	}
+
+	content, err := src.Read(env.StatePath)
+	if err != nil && !os.IsNotExist(err) {
+		return e.New(e.EnvStateBackendError, fmt.Errorf("read state from %s: %v", from, err))
+	}
+
+	// 环境未部署过时没有 state，只需要切换 backend
+	if len(content) > 0 {
+		if !force {
+			exists, err := dst.Read(env.StatePath)
+			if err != nil && !os.IsNotExist(err) {
+				return e.New(e.EnvStateBackendError, fmt.Errorf("read state from %s: %v", to, err))
+			} else if len(exists) > 0 {
+				return e.New(e.EnvStateMigrateExists, http.StatusConflict)
+			}
+		}
+		if err := dst.Write(env.StatePath, content); err != nil {
+			return e.New(e.EnvStateBackendError, fmt.Errorf("write state to %s: %v", to, err))
+		}
+	}
+
+	if err := UnlockEnvState(tx, env.Id, lockId); err != nil {
+		return err
+	}
+	if _, err := tx.Model(&models.Env{}).Where("id = ?", env.Id).
+		UpdateColumn("state_backend", to); err != nil {
+		return e.New(e.DBError, err)
+	}
+	logger.Infof("state migrated from %s to %s, size %d", from, to, len(content))
+	env.StateBackend = to
+	return nil
+}
+
+// VerifyStateToken 校验任务访问 portal 内置 http backend 的凭证，返回凭证对应的环境及任务 id
+func VerifyStateToken(sess *db.Session, token string, statePath string) (*models.Env, models.Id, e.Error) {
+	claims, err := statebackend.ParseStateToken(token)
+	if err != nil {
+		return nil, "", e.New(e.InvalidToken, err)
+	}
+
+	env, er := GetEnvById(sess, claims.EnvId)
+	if er != nil {
+		return nil, "", er
+	}
+	if strings.Trim(env.StatePath, "/") != strings.Trim(statePath, "/") {
+		return nil, "", e.New(e.PermissionDeny, fmt.Errorf("state path not match"))
+	}
+	if !statebackend.IsHosted(env.StateBackend) {
+		return nil, "", e.New(e.EnvStateNotHosted)
+	}
+	return env, claims.TaskId, nil
+}
+
+// GetEnvState 获取环境最新的 state 内容，环境没有 state 时返回 nil
+func GetEnvState(sess *db.Session, envId models.Id) ([]byte, e.Error) {
+	version, err := statebackend.LatestStateVersion(sess, envId)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return version.Content, nil
+}
+
+// SaveEnvState 保存任务写入的 state，state 被锁定时需要提供匹配的锁 ID
+func SaveEnvState(tx *db.Session, env *models.Env, taskId models.Id, lockId string, content []byte) (*models.StateVersion, e.Error) {
+	lock, er := GetEnvStateLock(tx, env.Id)
+	if er != nil {
+		return nil, er
+	}
+	if lock != nil {
+		if lockId == "" {
+			return nil, e.New(e.EnvStateLocked)
+		} else if lock.LockId != lockId {
+			return nil, e.New(e.EnvStateLockIdMismatch)
+		}
+	}
+
+	version, err := statebackend.SaveStateVersion(tx, env, content, models.StateVersionSourceTask, taskId, "")
+	if err != nil {
+		return nil, e.New(e.EnvStateBackendError, err)
+	}
+	return version, nil
+}
+
+// GetEnvStateLock 获取环境 state 锁，未锁定时返回 nil
+func GetEnvStateLock(sess *db.Session, envId models.Id) (*models.StateLock, e.Error) {
+	lock := models.StateLock{}
+	if err := sess.Where("env_id = ?", envId).First(&lock); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &lock, nil
+}
+
+// LockEnvState 锁定环境 state，已被锁定时返回当前的锁及 EnvStateLocked 错误
+func LockEnvState(tx *db.Session, envId models.Id, lockId string, info string) (*models.StateLock, e.Error) {
+	lock, er := GetEnvStateLock(tx, envId)
+	if er != nil {
+		return nil, er
+	} else if lock != nil {
+		return lock, e.New(e.EnvStateLocked)
+	}
+
+	lock = &models.StateLock{
+		EnvId:  envId,
+		LockId: lockId,
+		Info:   info,
+	}
+	lock.Id = models.NewId("sl")
+	if err := tx.Insert(lock); err != nil {
+		if e.IsDuplicate(err) {
+			// 并发加锁，返回先加锁成功的锁信息
+			if lock, er := GetEnvStateLock(tx, envId); er == nil && lock != nil {
+				return lock, e.New(e.EnvStateLocked)
+			}
+			return nil, e.New(e.EnvStateLocked)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return lock, nil
+}
+
+// UnlockEnvState 解锁环境 state，环境未锁定时直接返回成功
+func UnlockEnvState(tx *db.Session, envId models.Id, lockId string) e.Error {
+	lock, er := GetEnvStateLock(tx, envId)
+	if er != nil {
+		return er
+	} else if lock == nil {
+		return nil
+	}
+	// terraform force-unlock 也会带上锁 ID，所以这里总是校验锁 ID
+	if lock.LockId != lockId {
+		return e.New(e.EnvStateLockIdMismatch)
+	}
+
+	if _, err := tx.Where("env_id = ?", envId).Delete(&models.StateLock{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// ReleaseStepStateLock 释放步骤执行过程中创建的环境 state 锁，只在确认执行步骤的 runner 已失联时使用。
+// 只释放在步骤开始之后创建的锁，之前的锁(如等待恢复的变更任务持有的锁)保持不变
+func ReleaseStepStateLock(tx *db.Session, envId models.Id, step *models.TaskStep) e.Error {
+	if step.StartAt == nil {
+		return nil
+	}
+	if _, err := tx.Where("env_id = ? AND created_at >= ?", envId, *step.StartAt).
+		Delete(&models.StateLock{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// QueryStateVersion 查询环境的 state 版本列表，不返回 state 内容
+func QueryStateVersion(sess *db.Session, envId models.Id) *db.Session {
+	return sess.Model(&models.StateVersion{}).Omit("content").Where("env_id = ?", envId)
+}
+
+func GetStateVersionById(sess *db.Session, envId models.Id, id models.Id) (*models.StateVersion, e.Error) {
+	version := models.StateVersion{}
+	if err := sess.Where("env_id = ? AND id = ?", envId, id).First(&version); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.EnvStateVersionNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &version, nil
+}
+
+// RollbackEnvState 将环境 state 回滚到指定版本。
+// 回滚会以该版本的内容生成一个新版本(serial 递增)，不会删除之后的版本，因此回滚操作本身也可以再次回滚。
+func RollbackEnvState(tx *db.Session, env *models.Env, version *models.StateVersion, userId models.Id) (*models.StateVersion, e.Error) {
+	// 非托管的 backend 中的 state 不由平台写入，回滚数据库中的版本不会生效
+	if !statebackend.IsHosted(env.StateBackend) {
+		return nil, e.New(e.EnvStateNotHosted, http.StatusBadRequest)
+	}
+	if tasks, er := GetActiveTaskByEnvId(tx, env.Id); er != nil {
+		return nil, er
+	} else if len(tasks) > 0 {
+		return nil, e.New(e.EnvStateRollbackActive)
+	}
+	if lock, er := GetEnvStateLock(tx, env.Id); er != nil {
+		return nil, er
+	} else if lock != nil {
+		return nil, e.New(e.EnvStateLocked)
+	}
+
+	latest, err := statebackend.LatestStateVersion(tx, env.Id)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if latest.Id == version.Id {
+		return latest, nil
+	}
+
+	// terraform 要求新写入的 state serial 大于当前值，否则会被认为是过期的 state
+	content, err := setStateSerial(version.Content, latest.Serial+1)
+	if err != nil {
+		return nil, e.New(e.EnvStateBackendError, err)
+	}
+	newVersion, err := statebackend.SaveStateVersion(tx, env, content, models.StateVersionSourceRollback, "", userId)
+	if err != nil {
+		return nil, e.New(e.EnvStateBackendError, err)
+	}
+	return newVersion, nil
+}
+
+func setStateSerial(content []byte, serial int) ([]byte, error) {
+	state := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, err
+	}
+	state["serial"] = json.RawMessage(strconv.Itoa(serial))
+	return json.MarshalIndent(state, "", "  ")
+}
+
+type tfState struct {
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   interface{}            `json:"index_key"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+	Outputs map[string]struct {
+		Value interface{} `json:"value"`
+	} `json:"outputs"`
+}
+
+// parseStateResources 解析 state 中的资源实例，返回 资源地址 -> 属性
+func parseStateResources(state *tfState) map[string]map[string]interface{} {
+	resources := make(map[string]map[string]interface{})
+	for _, r := range state.Resources {
+		addr := fmt.Sprintf("%s.%s", r.Type, r.Name)
+		if r.Mode == "data" {
+			addr = "data." + addr
+		}
+		if r.Module != "" {
+			addr = fmt.Sprintf("%s.%s", r.Module, addr)
+		}
+		for _, ins := range r.Instances {
+			insAddr := addr
+			switch key := ins.IndexKey.(type) {
+			case string:
+				insAddr = fmt.Sprintf("%s[%q]", addr, key)
+			case float64:
+				insAddr = fmt.Sprintf("%s[%d]", addr, int(key))
+			}
+			resources[insAddr] = ins.Attributes
+		}
+	}
+	return resources
+}
+
+func jsonEqual(a, b interface{}) bool {
+	// json 序列化时 map 的 key 是有序的，可以直接比较序列化结果
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// DiffStateContent 比较两个 state 的资源及输出差异(from -> to)
+func DiffStateContent(from []byte, to []byte) (*resps.StateVersionDiffResp, error) {
+	var fromState, toState tfState
+	if err := json.Unmarshal(from, &fromState); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(to, &toState); err != nil {
+		return nil, err
+	}
+
+	diff := resps.StateVersionDiffResp{
+		Added:          make([]string, 0),
+		Removed:        make([]string, 0),
+		Changed:        make([]resps.StateResourceChange, 0),
+		OutputsAdded:   make([]string, 0),
+		OutputsRemoved: make([]string, 0),
+		OutputsChanged: make([]string, 0),
+	}
+
+	fromRes, toRes := parseStateResources(&fromState), parseStateResources(&toState)
+	for addr, toAttrs := range toRes {
+		fromAttrs, ok := fromRes[addr]
+		if !ok {
+			diff.Added = append(diff.Added, addr)
+			continue
+		}
+
+		changed := make([]string, 0)
+		for k, v := range toAttrs {
+			if fv, ok := fromAttrs[k]; !ok || !jsonEqual(fv, v) {
+				changed = append(changed, k)
+			}
+		}
+		for k := range fromAttrs {
+			if _, ok := toAttrs[k]; !ok {
+				changed = append(changed, k)
+			}
+		}
+		if len(changed) > 0 {
+			sort.Strings(changed)
+			diff.Changed = append(diff.Changed, resps.StateResourceChange{Address: addr, Attributes: changed})
+		}
+	}
+	for addr := range fromRes {
+		if _, ok := toRes[addr]; !ok {
+			diff.Removed = append(diff.Removed, addr)
+		}
+	}
+
+	for name, out := range toState.Outputs {
+		if fromOut, ok := fromState.Outputs[name]; !ok {
+			diff.OutputsAdded = append(diff.OutputsAdded, name)
+		} else if !jsonEqual(fromOut.Value, out.Value) {
+			diff.OutputsChanged = append(diff.OutputsChanged, name)
+		}
+	}
+	for name := range fromState.Outputs {
+		if _, ok := toState.Outputs[name]; !ok {
+			diff.OutputsRemoved = append(diff.OutputsRemoved, name)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Address < diff.Changed[j].Address })
+	sort.Strings(diff.OutputsAdded)
+	sort.Strings(diff.OutputsRemoved)
+	sort.Strings(diff.OutputsChanged)
+	return &diff, nil
+}
+
+// GetPreviousStateVersion 获取指定版本的上一个版本，没有上一个版本时返回 nil
+func GetPreviousStateVersion(sess *db.Session, version *models.StateVersion) (*models.StateVersion, e.Error) {
+	prev := models.StateVersion{}
+	err := sess.Where("env_id = ? AND id != ?", version.EnvId, version.Id).
+		Where("created_at < ? OR (created_at = ? AND serial < ?)", version.CreatedAt, version.CreatedAt, version.Serial).
+		Order("created_at DESC, serial DESC").First(&prev)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &prev, nil
+}
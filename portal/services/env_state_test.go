@@ -0,0 +1,72 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffStateContent(t *testing.T) {
+	from := `{
+  "version": 4, "serial": 3, "lineage": "l-1",
+  "outputs": {"vpc_id": {"value": "vpc-1"}, "old": {"value": 1}},
+  "resources": [
+    {"mode": "managed", "type": "aws_vpc", "name": "this", "instances": [
+      {"attributes": {"id": "vpc-1", "cidr_block": "10.0.0.0/16"}}
+    ]},
+    {"module": "module.app", "mode": "managed", "type": "aws_instance", "name": "web", "instances": [
+      {"index_key": 0, "attributes": {"id": "i-0"}},
+      {"index_key": 1, "attributes": {"id": "i-1"}}
+    ]}
+  ]
+}`
+	to := `{
+  "version": 4, "serial": 4, "lineage": "l-1",
+  "outputs": {"vpc_id": {"value": "vpc-2"}, "new": {"value": true}},
+  "resources": [
+    {"mode": "managed", "type": "aws_vpc", "name": "this", "instances": [
+      {"attributes": {"id": "vpc-2", "cidr_block": "10.0.0.0/16"}}
+    ]},
+    {"module": "module.app", "mode": "managed", "type": "aws_instance", "name": "web", "instances": [
+      {"index_key": 0, "attributes": {"id": "i-0"}}
+    ]},
+    {"mode": "data", "type": "aws_ami", "name": "ubuntu", "instances": [
+      {"index_key": "a", "attributes": {"id": "ami-1"}}
+    ]}
+  ]
+}`
+
+	diff, err := DiffStateContent([]byte(from), []byte(to))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`data.aws_ami.ubuntu["a"]`}, diff.Added)
+	assert.Equal(t, []string{"module.app.aws_instance.web[1]"}, diff.Removed)
+	if assert.Len(t, diff.Changed, 1) {
+		assert.Equal(t, "aws_vpc.this", diff.Changed[0].Address)
+		assert.Equal(t, []string{"id"}, diff.Changed[0].Attributes)
+	}
+	assert.Equal(t, []string{"new"}, diff.OutputsAdded)
+	assert.Equal(t, []string{"old"}, diff.OutputsRemoved)
+	assert.Equal(t, []string{"vpc_id"}, diff.OutputsChanged)
+
+	// 与空 state 对比时所有资源都是新增的
+	diff, err = DiffStateContent([]byte("{}"), []byte(from))
+	assert.NoError(t, err)
+	assert.Len(t, diff.Added, 3)
+	assert.Empty(t, diff.Changed)
+}
+
+func TestSetStateSerial(t *testing.T) {
+	content, err := setStateSerial([]byte(`{"version": 4, "serial": 3, "lineage": "l-1"}`), 10)
+	assert.NoError(t, err)
+
+	state := struct {
+		Serial  int    `json:"serial"`
+		Lineage string `json:"lineage"`
+	}{}
+	assert.NoError(t, json.Unmarshal(content, &state))
+	assert.Equal(t, 10, state.Serial)
+	assert.Equal(t, "l-1", state.Lineage)
+}
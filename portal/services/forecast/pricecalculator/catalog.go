@@ -0,0 +1,372 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package pricecalculator
+
+import (
+	"cloudiac/portal/services/forecast/schema"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	CatalogFormatYaml = "yaml"
+	CatalogFormatJson = "json"
+)
+
+// 价格目录文件可能被其他 portal 实例或手动修改，加载后按该间隔检查文件是否有变化
+const catalogCheckInterval = 30 * time.Second
+
+// 云商名称和版本号会作为目录及文件名
+var catalogNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Catalog 价格目录，一个云商可以有多个版本的价格目录，询价时使用版本号最大的目录
+//
+//	provider: alicloud
+//	version: "2023.01"
+//	currency: CNY
+//	prices:
+//	  - type: ecs
+//	    region: cn-beijing          # 不指定时对所有区域生效，指定区域的价格优先
+//	    match: {instanceId: ecs.g6.large}
+//	    price: 0.5                  # 每小时价格
+//	  - type: disk
+//	    match: {type: cloud_efficiency}
+//	    price: 0.0005
+//	    unitAttr: size              # 价格乘以 size 属性的值
+type Catalog struct {
+	Provider string         `json:"provider" yaml:"provider"`
+	Version  string         `json:"version" yaml:"version"`
+	Currency string         `json:"currency" yaml:"currency"`
+	Prices   []CatalogPrice `json:"prices" yaml:"prices"`
+}
+
+type CatalogPrice struct {
+	Type     string            `json:"type" yaml:"type"`                             // 询价类型，与 schema.PriceRequest.Type 对应，如 ecs, disk
+	Region   string            `json:"region,omitempty" yaml:"region,omitempty"`     // 区域
+	Match    map[string]string `json:"match,omitempty" yaml:"match,omitempty"`       // 需要匹配的询价属性
+	Price    float64           `json:"price" yaml:"price"`                           // 每小时价格
+	UnitAttr string            `json:"unitAttr,omitempty" yaml:"unitAttr,omitempty"` // 按属性值计价的属性名称
+}
+
+// ParseCatalog 解析 yaml 或 json 格式的价格目录(json 是 yaml 的子集，统一按 yaml 解析)
+func ParseCatalog(content []byte) (*Catalog, error) {
+	c := Catalog{}
+	if err := yaml.Unmarshal(content, &c); err != nil {
+		return nil, fmt.Errorf("unmarshal catalog: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *Catalog) Validate() error {
+	if !catalogNameRegex.MatchString(c.Provider) {
+		return fmt.Errorf("invalid provider '%s'", c.Provider)
+	}
+	if !catalogNameRegex.MatchString(c.Version) {
+		return fmt.Errorf("invalid version '%s'", c.Version)
+	}
+	for i, p := range c.Prices {
+		if p.Type == "" {
+			return fmt.Errorf("prices[%d]: type is required", i)
+		}
+		if p.Price < 0 {
+			return fmt.Errorf("prices[%d]: price must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// Lookup 查找询价请求对应的价格，区域匹配的价格优先，其次是匹配属性最多的价格
+func (c *Catalog) Lookup(region string, req schema.PriceRequest) (float64, bool) {
+	var (
+		found *CatalogPrice
+		score = -1
+	)
+	for i := range c.Prices {
+		p := &c.Prices[i]
+		if p.Type != req.Type || (p.Region != "" && p.Region != region) {
+			continue
+		}
+		matched := true
+		for k, v := range p.Match {
+			if req.Attribute[k] != v {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		s := len(p.Match)
+		if p.Region != "" {
+			s += 1000
+		}
+		if s > score {
+			found, score = p, s
+		}
+	}
+	if found == nil {
+		return 0, false
+	}
+
+	if found.UnitAttr != "" {
+		return found.Price * utils.Str2float(req.Attribute[found.UnitAttr]), true
+	}
+	return found.Price, true
+}
+
+// CatalogInfo 价格目录的摘要信息
+type CatalogInfo struct {
+	Provider   string `json:"provider"`
+	Version    string `json:"version"`
+	Currency   string `json:"currency"`
+	PriceCount int    `json:"priceCount"`
+	Active     bool   `json:"active"` // 是否为询价时使用的版本
+}
+
+// catalogPriceSource 使用本地价格目录文件询价，目录文件保存在 <dir>/<provider>/<version>.(yaml|json)
+type catalogPriceSource struct {
+	dir string
+
+	lock      sync.RWMutex
+	loaded    bool
+	checkedAt time.Time
+	signature string                // 加载时目录文件的名称、大小及修改时间，用于判断文件是否有变化
+	catalogs  map[string][]*Catalog // provider => 按版本从小到大排序的价格目录
+}
+
+func newCatalogPriceSource(dir string) *catalogPriceSource {
+	return &catalogPriceSource{dir: dir}
+}
+
+func (s *catalogPriceSource) Name() string {
+	return PriceSourceCatalog
+}
+
+func (s *catalogPriceSource) GetPrice(r *schema.Resource) (float32, error) {
+	if err := s.ensureLoaded(); err != nil {
+		return 0, err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	catalogs := s.catalogs[r.Provider]
+	if len(catalogs) == 0 {
+		return 0, fmt.Errorf("price catalog of provider '%s' not found", r.Provider)
+	}
+	catalog := catalogs[len(catalogs)-1]
+
+	var sum float64
+	for _, req := range r.RequestData {
+		price, ok := catalog.Lookup(r.Region, req)
+		if !ok {
+			return 0, fmt.Errorf("price of %s %v not found in catalog %s/%s", req.Type, req.Attribute, catalog.Provider, catalog.Version)
+		}
+		sum += price
+	}
+	return float32(sum), nil
+}
+
+// ensureLoaded 首次使用时加载价格目录，之后定期检查目录文件，有变化时重新加载
+func (s *catalogPriceSource) ensureLoaded() error {
+	s.lock.RLock()
+	loaded, checkedAt := s.loaded, s.checkedAt
+	s.lock.RUnlock()
+	if loaded && time.Since(checkedAt) < catalogCheckInterval {
+		return nil
+	}
+
+	files, signature, err := s.scan()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	if s.loaded && s.signature == signature {
+		s.checkedAt = time.Now()
+		s.lock.Unlock()
+		return nil
+	}
+	s.lock.Unlock()
+	s.load(files, signature)
+	return nil
+}
+
+// scan 返回目录下的价格目录文件及其签名
+func (s *catalogPriceSource) scan() ([]string, string, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*", "*"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	files := make([]string, 0, len(matches))
+	sb := strings.Builder{}
+	for _, f := range matches {
+		ext := strings.TrimPrefix(filepath.Ext(f), ".")
+		if ext != CatalogFormatYaml && ext != CatalogFormatJson {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, f)
+		sb.WriteString(fmt.Sprintf("%s:%d:%d;", f, info.Size(), info.ModTime().UnixNano()))
+	}
+	return files, sb.String(), nil
+}
+
+// load 加载价格目录文件，无效的文件会被忽略
+func (s *catalogPriceSource) load(files []string, signature string) {
+	logger := logs.Get().WithField("func", "catalogPriceSource.load")
+
+	catalogs := make(map[string][]*Catalog)
+	for _, f := range files {
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			logger.Warnf("read catalog %s: %v", f, err)
+			continue
+		}
+		c, err := ParseCatalog(content)
+		if err != nil {
+			logger.Warnf("load catalog %s: %v", f, err)
+			continue
+		}
+		catalogs[c.Provider] = append(catalogs[c.Provider], c)
+	}
+	for _, cs := range catalogs {
+		sort.SliceStable(cs, func(i, j int) bool {
+			return compareCatalogVersion(cs[i].Version, cs[j].Version) < 0
+		})
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.catalogs = catalogs
+	s.signature = signature
+	s.checkedAt = time.Now()
+	s.loaded = true
+}
+
+// Reload 重新加载目录下的所有价格目录文件
+func (s *catalogPriceSource) Reload() error {
+	files, signature, err := s.scan()
+	if err != nil {
+		return err
+	}
+	s.load(files, signature)
+	return nil
+}
+
+// List 返回所有的价格目录
+func (s *catalogPriceSource) List() ([]CatalogInfo, error) {
+	if err := s.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	providers := make([]string, 0, len(s.catalogs))
+	for p := range s.catalogs {
+		providers = append(providers, p)
+	}
+	sort.Strings(providers)
+
+	infos := make([]CatalogInfo, 0)
+	for _, p := range providers {
+		cs := s.catalogs[p]
+		for i, c := range cs {
+			infos = append(infos, CatalogInfo{
+				Provider:   c.Provider,
+				Version:    c.Version,
+				Currency:   c.Currency,
+				PriceCount: len(c.Prices),
+				Active:     i == len(cs)-1,
+			})
+		}
+	}
+	return infos, nil
+}
+
+// Get 返回指定版本的价格目录
+func (s *catalogPriceSource) Get(provider, version string) (*Catalog, error) {
+	if err := s.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, c := range s.catalogs[provider] {
+		if c.Version == version {
+			return c, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// Save 保存价格目录文件，相同云商及版本的目录会被覆盖
+func (s *catalogPriceSource) Save(content []byte, format string) (*Catalog, error) {
+	c, err := ParseCatalog(content)
+	if err != nil {
+		return nil, err
+	}
+	if format != CatalogFormatJson {
+		format = CatalogFormatYaml
+	}
+
+	dir := filepath.Join(s.dir, c.Provider)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	// 删除其他格式的同版本文件
+	for _, ext := range []string{CatalogFormatYaml, CatalogFormatJson} {
+		if ext != format {
+			_ = os.Remove(filepath.Join(dir, fmt.Sprintf("%s.%s", c.Version, ext)))
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%s.%s", c.Version, format)), content, 0644); err != nil { //nolint:gosec
+		return nil, err
+	}
+	return c, s.Reload()
+}
+
+// Delete 删除价格目录文件
+func (s *catalogPriceSource) Delete(provider, version string) error {
+	if _, err := s.Get(provider, version); err != nil {
+		return err
+	}
+	for _, ext := range []string{CatalogFormatYaml, CatalogFormatJson} {
+		p := filepath.Join(s.dir, provider, fmt.Sprintf("%s.%s", version, ext))
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return s.Reload()
+}
+
+// compareCatalogVersion 比较价格目录版本，可以按语义化版本解析时按语义化版本比较，否则按字符串比较
+func compareCatalogVersion(a, b string) int {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+	if errA == nil && errB == nil {
+		return va.Compare(vb)
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package pricecalculator
+
+import (
+	"cloudiac/portal/services/forecast/schema"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCatalog = `
+provider: alicloud
+version: "1.0.0"
+currency: CNY
+prices:
+  - type: ecs
+    match: {instanceId: ecs.g6.large}
+    price: 0.5
+  - type: ecs
+    region: cn-beijing
+    match: {instanceId: ecs.g6.large}
+    price: 0.6
+  - type: disk
+    match: {type: cloud_efficiency}
+    price: 0.001
+    unitAttr: size
+`
+
+func TestCatalogPriceSource(t *testing.T) {
+	s := newCatalogPriceSource(t.TempDir())
+
+	_, err := s.Save([]byte(testCatalog), CatalogFormatYaml)
+	assert.NoError(t, err)
+
+	res := &schema.Resource{
+		Name:     "alicloud_instance.web",
+		Provider: "alicloud",
+		Region:   "cn-hangzhou",
+		RequestData: []schema.PriceRequest{
+			{Type: "ecs", Attribute: map[string]string{"instanceId": "ecs.g6.large"}},
+			{Type: "disk", Attribute: map[string]string{"type": "cloud_efficiency", "size": "40"}},
+		},
+	}
+	price, err := s.GetPrice(res)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.54, price, 0.0001)
+
+	// 指定区域的价格优先
+	res.Region = "cn-beijing"
+	price, err = s.GetPrice(res)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.64, price, 0.0001)
+
+	res.RequestData[0].Attribute["instanceId"] = "ecs.g7.large"
+	_, err = s.GetPrice(res)
+	assert.Error(t, err)
+
+	// 使用版本号最大的价格目录询价
+	_, err = s.Save([]byte(`{"provider": "alicloud", "version": "1.10.0", "prices": [{"type": "ecs", "price": 1}, {"type": "disk", "price": 0}]}`), CatalogFormatJson)
+	assert.NoError(t, err)
+	price, err = s.GetPrice(res)
+	assert.NoError(t, err)
+	assert.InDelta(t, 1, price, 0.0001)
+
+	infos, err := s.List()
+	assert.NoError(t, err)
+	assert.Len(t, infos, 2)
+	assert.Equal(t, "1.10.0", infos[1].Version)
+	assert.True(t, infos[1].Active)
+
+	assert.NoError(t, s.Delete("alicloud", "1.10.0"))
+	infos, err = s.List()
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+	assert.True(t, infos[0].Active)
+}
+
+func TestParseCatalogInvalid(t *testing.T) {
+	_, err := ParseCatalog([]byte(`{"provider": "../alicloud", "version": "1"}`))
+	assert.Error(t, err)
+	_, err = ParseCatalog([]byte(`{"provider": "alicloud", "version": "1", "prices": [{"price": 1}]}`))
+	assert.Error(t, err)
+}
+
+func TestCatalogPriceSourceReload(t *testing.T) {
+	dir := t.TempDir()
+	s := newCatalogPriceSource(dir)
+	_, err := s.Save([]byte(testCatalog), CatalogFormatYaml)
+	assert.NoError(t, err)
+
+	// 无效的文件被忽略，不影响其他价格目录
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "alicloud", "broken.yaml"), []byte("prices: ["), 0644))
+	assert.NoError(t, s.Reload())
+	infos, err := s.List()
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+
+	// 文件被外部修改后，超过检查间隔时重新加载
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "aws"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "aws", "1.0.0.json"),
+		[]byte(`{"provider": "aws", "version": "1.0.0", "prices": [{"type": "ec2", "price": 1}]}`), 0644))
+	infos, err = s.List()
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+
+	s.lock.Lock()
+	s.checkedAt = time.Time{}
+	s.lock.Unlock()
+	infos, err = s.List()
+	assert.NoError(t, err)
+	assert.Len(t, infos, 2)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package pricecalculator
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/services/forecast/schema"
+	"sync"
+)
+
+const (
+	PriceSourceHttp    = "http"
+	PriceSourceCatalog = "catalog"
+
+	defaultCatalogDir = "var/price_catalogs"
+)
+
+// PriceSource 资源询价接口，返回资源每小时的价格
+type PriceSource interface {
+	Name() string
+	GetPrice(r *schema.Resource) (float32, error)
+}
+
+var (
+	catalogSource     *catalogPriceSource
+	catalogSourceOnce sync.Once
+)
+
+// GetPriceSource 根据配置返回询价来源
+// 未配置询价来源时，配置了 cost_serve 则使用外部询价服务，否则使用内置的价格目录
+func GetPriceSource() PriceSource {
+	conf := configs.Get()
+	switch conf.PriceSource.Type {
+	case PriceSourceHttp:
+		return &httpPriceSource{}
+	case PriceSourceCatalog:
+		return GetCatalogSource()
+	default:
+		if conf.CostServe != "" {
+			return &httpPriceSource{}
+		}
+		return GetCatalogSource()
+	}
+}
+
+// GetCatalogSource 返回内置的价格目录询价来源
+func GetCatalogSource() *catalogPriceSource {
+	catalogSourceOnce.Do(func() {
+		dir := configs.Get().PriceSource.CatalogDir
+		if dir == "" {
+			dir = defaultCatalogDir
+		}
+		catalogSource = newCatalogPriceSource(dir)
+	})
+	return catalogSource
+}
+
+// httpPriceSource 通过外部询价服务(cost_serve)询价
+type httpPriceSource struct{}
+
+func (s *httpPriceSource) Name() string {
+	return PriceSourceHttp
+}
+
+func (s *httpPriceSource) GetPrice(r *schema.Resource) (float32, error) {
+	resp, err := GetResourcePrice(r)
+	if err != nil {
+		return 0, err
+	}
+	return GetPriceFromResponse(resp)
+}
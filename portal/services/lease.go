@@ -0,0 +1,103 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils/logs"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// tryAcquireLease 尝试获取或续期锁，锁未被其他持有者持有或已过期时获取成功。
+// 过期时间统一使用数据库时间计算，避免各节点时钟不一致导致锁被提前抢占
+func tryAcquireLease(tx *db.Session, key string, holder string, ttl time.Duration) (bool, error) {
+	ttlSeconds := int64(ttl / time.Second)
+	expiredAt := gorm.Expr("DATE_ADD(NOW(), INTERVAL ? SECOND)", ttlSeconds)
+	n, err := tx.Model(&models.Lease{}).
+		Where("id = ? AND (holder = ? OR expired_at < NOW())", key, holder).
+		UpdateAttrs(models.Attrs{"holder": holder, "expired_at": expiredAt})
+	if err != nil {
+		return false, err
+	} else if n > 0 {
+		return true, nil
+	}
+
+	_, err = tx.Exec("INSERT INTO iac_lease (id, holder, expired_at) VALUES (?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND))",
+		key, holder, ttlSeconds)
+	if err == nil {
+		return true, nil
+	} else if !e.IsDuplicate(err) {
+		return false, err
+	}
+
+	// 同一秒内续期时更新的行数为 0，需要再确认锁的持有者
+	return tx.Model(&models.Lease{}).
+		Where("id = ? AND holder = ? AND expired_at > NOW()", key, holder).Exists()
+}
+
+func releaseLease(tx *db.Session, key string, holder string) error {
+	_, err := tx.Model(&models.Lease{}).Where("id = ? AND holder = ?", key, holder).
+		UpdateAttrs(models.Attrs{"expired_at": gorm.Expr("NOW()")})
+	return err
+}
+
+// AcquireLease 获取基于数据库的分布式锁，阻塞直到获取成功或 ctx 结束。
+// 获取成功后自动续期，返回的 channel 在锁丢失或 ctx 结束释放锁后关闭
+func AcquireLease(ctx context.Context, key string, holder string, ttl time.Duration) (<-chan struct{}, error) {
+	logger := logs.Get().WithField("func", "AcquireLease").WithField("key", key)
+	interval := ttl / 3
+
+	for {
+		ok, err := tryAcquireLease(db.Get(), key, holder, ttl)
+		if err != nil {
+			logger.Warnf("acquire lease: %v", err)
+		} else if ok {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+
+	lostCh := make(chan struct{})
+	go func() {
+		defer close(lostCh)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		renewedAt := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				if err := releaseLease(db.Get(), key, holder); err != nil {
+					logger.Errorf("release lease: %v", err)
+				}
+				return
+			case <-ticker.C:
+			}
+
+			ok, err := tryAcquireLease(db.Get(), key, holder, ttl)
+			if err != nil {
+				logger.Warnf("renew lease: %v", err)
+				// 续期失败时锁在过期前仍然有效
+				if time.Since(renewedAt) < ttl-interval {
+					continue
+				}
+				return
+			} else if !ok {
+				logger.Warnf("lease is held by others")
+				return
+			}
+			renewedAt = time.Now()
+		}
+	}()
+	return lostCh, nil
+}
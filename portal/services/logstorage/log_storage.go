@@ -3,32 +3,96 @@
 package logstorage
 
 import (
+	"cloudiac/configs"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/libs/db"
+	"fmt"
+	"os"
 	"sync"
 )
 
+const (
+	TypeDB    = "db"
+	TypeS3    = "s3"
+	TypeLocal = "local"
+)
+
 type LogStorage interface {
 	Write(path string, content []byte) error
+	// Read 读取内容，内容不存在时返回 os.ErrNotExist
 	Read(path string) ([]byte, error)
+	// Delete 删除内容，内容不存在时不返回错误
+	Delete(path string) error
 }
 
 var (
 	logStorage LogStorage
+	initErr    error
 	initOnce   = sync.Once{}
 )
 
-func Get() LogStorage {
+// New 按配置创建日志存储
+func New(conf configs.LogStorageConfig) (LogStorage, error) {
+	switch conf.Type {
+	case "", TypeDB:
+		return &dBLogStorage{db: db.Get()}, nil
+	case TypeS3:
+		return newS3LogStorage(conf.S3)
+	case TypeLocal:
+		return newLocalLogStorage(conf.Local)
+	default:
+		return nil, fmt.Errorf("unknown log storage type '%s'", conf.Type)
+	}
+}
+
+// Init 按系统配置初始化日志存储，服务启动时调用以便尽早发现配置错误
+func Init() error {
 	initOnce.Do(func() {
 		if logStorage == nil {
-			logStorage = &dBLogStorage{db: db.Get()}
+			logStorage, initErr = New(configs.Get().LogStorage)
+			if _, ok := logStorage.(*dBLogStorage); initErr == nil && !ok {
+				logStorage = &legacyFallbackStorage{LogStorage: logStorage, legacy: &dBLogStorage{db: db.Get()}}
+			}
 		}
 	})
+	return initErr
+}
+
+func Get() LogStorage {
+	if err := Init(); err != nil {
+		panic(fmt.Errorf("init log storage: %v", err))
+	}
 	return logStorage
 }
 
-// CutLogContent 判断内容日志长度是否超限，若超限则截断(保留最新内容)
+// legacyFallbackStorage 切换到 s3 或 local 存储后，切换前保存在 db 中的内容仍然可以读取和删除
+type legacyFallbackStorage struct {
+	LogStorage
+	legacy *dBLogStorage
+}
+
+func (s *legacyFallbackStorage) Read(path string) ([]byte, error) {
+	content, err := s.LogStorage.Read(path)
+	if os.IsNotExist(err) {
+		return s.legacy.Read(path)
+	}
+	return content, err
+}
+
+func (s *legacyFallbackStorage) Delete(path string) error {
+	if err := s.LogStorage.Delete(path); err != nil {
+		return err
+	}
+	return s.legacy.Delete(path)
+}
+
+// CutLogContent 判断内容日志长度是否超限，若超限则截断(保留最新内容)。
+// 只有 db 存储有大小限制，其他存储保存完整的日志
 func CutLogContent(content []byte) []byte {
+	if _, ok := Get().(*dBLogStorage); !ok {
+		return content
+	}
+
 	size := len(content)
 	if size > consts.MaxLogContentSize {
 		content = content[size-consts.MaxLogContentSize:]
@@ -28,3 +28,8 @@ func (s *dBLogStorage) Read(path string) ([]byte, error) {
 	}
 	return dbLog.Content, nil
 }
+
+func (s *dBLogStorage) Delete(path string) error {
+	_, err := s.db.Where("path = ?", path).Delete(&models.DBStorage{})
+	return err
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package logstorage
+
+import (
+	"cloudiac/configs"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// localLogStorage 将日志 gzip 压缩后保存到本地目录
+type localLogStorage struct {
+	dir string
+}
+
+func newLocalLogStorage(conf configs.LocalStorageConfig) (*localLogStorage, error) {
+	if conf.Dir == "" {
+		return nil, fmt.Errorf("local log storage dir is required")
+	}
+	if err := os.MkdirAll(conf.Dir, 0755); err != nil {
+		return nil, err
+	}
+	return &localLogStorage{dir: conf.Dir}, nil
+}
+
+func (s *localLogStorage) filePath(path string) string {
+	// 先基于根目录 Clean，避免 path 中的 ".." 访问到存储目录之外
+	return filepath.Join(s.dir, filepath.Clean("/"+path)) + gzipExt
+}
+
+func (s *localLogStorage) Write(path string, content []byte) error {
+	data, err := gzipCompress(content)
+	if err != nil {
+		return err
+	}
+
+	fp := s.filePath(path)
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return err
+	}
+	// 先写临时文件再 rename，避免读取到写了一半的内容
+	tmpFile := fp + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0644); err != nil { //nolint:gosec
+		return err
+	}
+	return os.Rename(tmpFile, fp)
+}
+
+func (s *localLogStorage) Read(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.filePath(path))
+	if err != nil {
+		return nil, err
+	}
+	return gzipDecompress(data)
+}
+
+func (s *localLogStorage) Delete(path string) error {
+	if err := os.Remove(s.filePath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package logstorage
+
+import (
+	"bytes"
+	"cloudiac/configs"
+	"cloudiac/utils/objstorage"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// s3LogStorage 将日志 gzip 压缩后保存到 S3 兼容的对象存储
+type s3LogStorage struct {
+	cli    *minio.Client
+	bucket string
+}
+
+func newS3LogStorage(conf configs.ObjectStorageConfig) (*s3LogStorage, error) {
+	cli, err := objstorage.NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := objstorage.EnsureBucket(ctx, cli, conf); err != nil {
+		return nil, err
+	}
+	return &s3LogStorage{cli: cli, bucket: conf.Bucket}, nil
+}
+
+func (s *s3LogStorage) objectKey(path string) string {
+	return strings.TrimPrefix(path, "/") + gzipExt
+}
+
+func (s *s3LogStorage) Write(path string, content []byte) error {
+	data, err := gzipCompress(content)
+	if err != nil {
+		return err
+	}
+	_, err = s.cli.PutObject(context.Background(), s.bucket, s.objectKey(path),
+		bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/gzip"})
+	return err
+}
+
+func (s *s3LogStorage) Read(path string) ([]byte, error) {
+	obj, err := s.cli.GetObject(context.Background(), s.bucket, s.objectKey(path), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	// GetObject 是延迟请求的，对象不存在的错误在读取时才返回
+	data, err := ioutil.ReadAll(obj)
+	if objstorage.IsNotFound(err) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	return gzipDecompress(data)
+}
+
+func (s *s3LogStorage) Delete(path string) error {
+	// 删除不存在的对象不会返回错误
+	return s.cli.RemoveObject(context.Background(), s.bucket, s.objectKey(path), minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package logstorage
+
+import (
+	"cloudiac/configs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalLogStorage(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(configs.LogStorageConfig{Type: TypeLocal, Local: configs.LocalStorageConfig{Dir: dir}})
+	assert.NoError(t, err)
+
+	// 超过 db 存储大小限制的日志也需要完整保存
+	content := []byte(strings.Repeat("terraform apply log\n", 100000))
+	path := "p-xxx/env-xxx/run-xxx/step1/content.log"
+	assert.NoError(t, s.Write(path, content))
+
+	got, err := s.Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	// 保存的是压缩后的内容
+	info, err := os.Stat(filepath.Join(dir, path+gzipExt))
+	assert.NoError(t, err)
+	assert.Less(t, info.Size(), int64(len(content)))
+
+	// 不允许访问存储目录之外的文件
+	assert.Equal(t, filepath.Join(dir, "etc/passwd"+gzipExt), s.(*localLogStorage).filePath("../../etc/passwd"))
+
+	assert.NoError(t, s.Delete(path))
+	_, err = s.Read(path)
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, s.Delete(path))
+}
+
+func TestNewUnknownStorage(t *testing.T) {
+	_, err := New(configs.LogStorageConfig{Type: "ftp"})
+	assert.Error(t, err)
+}
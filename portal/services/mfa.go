@@ -0,0 +1,223 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"cloudiac/utils/totp"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	MfaIssuer             = "CloudIaC"
+	MfaPendingTokenExpire = 5 * time.Minute
+	MfaRecoveryCodeCount  = 10
+	MfaMaxFailures        = 5               // 连续校验失败该次数后锁定
+	MfaLockDuration       = 5 * time.Minute // 锁定时长
+)
+
+// MfaPendingClaims 密码校验通过、等待多因素认证的临时 token
+type MfaPendingClaims struct {
+	jwt.RegisteredClaims
+
+	UserId models.Id `json:"userId"`
+	Enroll bool      `json:"enroll"` // 用户未启用多因素认证但被要求启用，该 token 只能用于绑定认证器
+}
+
+func GenerateMfaPendingToken(uid models.Id, enroll bool) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, MfaPendingClaims{
+		UserId: uid,
+		Enroll: enroll,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MfaPendingTokenExpire)),
+			Subject:   consts.JwtSubjectMfaPending,
+		},
+	})
+	return token.SignedString([]byte(configs.Get().JwtSecretKey))
+}
+
+func VerifyMfaPendingToken(tokenStr string, enroll bool) (models.Id, e.Error) {
+	claims := MfaPendingClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(configs.Get().JwtSecretKey), nil
+	})
+	if err != nil {
+		return "", e.New(e.MfaTokenInvalid, err, http.StatusUnauthorized)
+	}
+	if !token.Valid || claims.Subject != consts.JwtSubjectMfaPending || claims.Enroll != enroll {
+		return "", e.New(e.MfaTokenInvalid, http.StatusUnauthorized)
+	}
+	return claims.UserId, nil
+}
+
+// UserMfaEnforced 用户是否被要求启用多因素认证，平台管理员及开启了 mfaRequired 的组织成员必须启用
+func UserMfaEnforced(tx *db.Session, user *models.User) (bool, e.Error) {
+	if user.IsAdmin {
+		return true, nil
+	}
+	cnt, err := tx.Table(models.UserOrg{}.TableName()).
+		Joins("JOIN iac_org ON iac_org.id = iac_user_org.org_id").
+		Where("iac_user_org.user_id = ? AND iac_org.mfa_required = ?", user.Id, true).
+		Count()
+	if err != nil {
+		return false, e.New(e.DBError, err)
+	}
+	return cnt > 0, nil
+}
+
+// StartMfaEnroll 为用户生成新的 TOTP 密钥，密钥在用户使用验证码确认后才会启用
+func StartMfaEnroll(tx *db.Session, user *models.User) (secret string, url string, er e.Error) {
+	if user.MfaEnabled {
+		return "", "", e.New(e.MfaAlreadyEnabled, http.StatusBadRequest)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", e.New(e.InternalError, err)
+	}
+	encrypted, err := utils.AesEncrypt(secret)
+	if err != nil {
+		return "", "", e.New(e.InternalError, err)
+	}
+	if _, err := tx.Model(&models.User{}).Where("id = ?", user.Id).
+		UpdateAttrs(models.Attrs{"mfa_secret": encrypted, "mfa_last_step": 0}); err != nil {
+		return "", "", e.New(e.DBError, err)
+	}
+	return secret, totp.URL(MfaIssuer, user.Email, secret), nil
+}
+
+// ConfirmMfaEnroll 校验验证码并启用多因素认证，返回恢复码明文，恢复码只在启用时返回一次
+func ConfirmMfaEnroll(tx *db.Session, user *models.User, code string) ([]string, e.Error) {
+	if user.MfaEnabled {
+		return nil, e.New(e.MfaAlreadyEnabled, http.StatusBadRequest)
+	}
+	if user.MfaSecret == "" {
+		return nil, e.New(e.MfaNotEnrolled, http.StatusBadRequest)
+	}
+	secret, err := utils.AesDecrypt(user.MfaSecret)
+	if err != nil {
+		return nil, e.New(e.InternalError, err)
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), 0)
+	if !ok {
+		return nil, e.New(e.MfaCodeInvalid, http.StatusBadRequest)
+	}
+
+	codes, hashes, err := generateMfaRecoveryCodes()
+	if err != nil {
+		return nil, e.New(e.InternalError, err)
+	}
+	if _, err := tx.Model(&models.User{}).Where("id = ?", user.Id).UpdateAttrs(models.Attrs{
+		"mfa_enabled":        true,
+		"mfa_recovery_codes": hashes,
+		"mfa_last_step":      step,
+		"mfa_failures":       0,
+		"mfa_locked_until":   0,
+	}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return codes, nil
+}
+
+// VerifyUserMfa 校验 TOTP 验证码或恢复码，恢复码使用后失效。
+// 连续失败 MfaMaxFailures 次后锁定 MfaLockDuration，避免验证码被暴力破解
+func VerifyUserMfa(tx *db.Session, user *models.User, code string) e.Error {
+	if !user.MfaEnabled {
+		return e.New(e.MfaNotEnabled, http.StatusBadRequest)
+	}
+	now := time.Now()
+	if user.MfaLockedUntil > now.Unix() {
+		return e.New(e.MfaLocked, http.StatusForbidden)
+	}
+
+	secret, err := utils.AesDecrypt(user.MfaSecret)
+	if err != nil {
+		return e.New(e.InternalError, err)
+	}
+
+	attrs := models.Attrs{"mfa_failures": 0, "mfa_locked_until": 0}
+	if step, ok := totp.Validate(secret, code, now, user.MfaLastStep); ok {
+		attrs["mfa_last_step"] = step
+	} else if idx := matchMfaRecoveryCode(user.MfaRecoveryCodes, code); idx >= 0 {
+		codes := make(models.StrSlice, 0, len(user.MfaRecoveryCodes)-1)
+		codes = append(codes, user.MfaRecoveryCodes[:idx]...)
+		codes = append(codes, user.MfaRecoveryCodes[idx+1:]...)
+		attrs["mfa_recovery_codes"] = codes
+	} else {
+		failures := user.MfaFailures + 1
+		attrs = models.Attrs{"mfa_failures": failures}
+		if failures >= MfaMaxFailures {
+			attrs = models.Attrs{"mfa_failures": 0, "mfa_locked_until": now.Add(MfaLockDuration).Unix()}
+		}
+		if _, err := tx.Model(&models.User{}).Where("id = ?", user.Id).UpdateAttrs(attrs); err != nil {
+			return e.New(e.DBError, err)
+		}
+		return e.New(e.MfaCodeInvalid, http.StatusBadRequest)
+	}
+
+	if _, err := tx.Model(&models.User{}).Where("id = ?", user.Id).UpdateAttrs(attrs); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// ResetUserMfa 清除用户的多因素认证信息，用户下次登录时需要重新绑定(被要求启用时)
+func ResetUserMfa(tx *db.Session, userId models.Id) e.Error {
+	if _, err := tx.Model(&models.User{}).Where("id = ?", userId).UpdateAttrs(models.Attrs{
+		"mfa_enabled":        false,
+		"mfa_secret":         "",
+		"mfa_recovery_codes": models.StrSlice{},
+		"mfa_last_step":      0,
+		"mfa_failures":       0,
+		"mfa_locked_until":   0,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// generateMfaRecoveryCodes 生成恢复码，返回明文及 sha256 值
+func generateMfaRecoveryCodes() ([]string, models.StrSlice, error) {
+	codes := make([]string, 0, MfaRecoveryCodeCount)
+	hashes := make(models.StrSlice, 0, MfaRecoveryCodeCount)
+	for i := 0; i < MfaRecoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		s := hex.EncodeToString(b)
+		code := fmt.Sprintf("%s-%s", s[:5], s[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashMfaRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func hashMfaRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func matchMfaRecoveryCode(hashes []string, code string) int {
+	h := hashMfaRecoveryCode(code)
+	for i := range hashes {
+		if hashes[i] == h {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMfaRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateMfaRecoveryCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, MfaRecoveryCodeCount)
+	assert.Len(t, hashes, MfaRecoveryCodeCount)
+
+	assert.Equal(t, 3, matchMfaRecoveryCode(hashes, codes[3]))
+	// 忽略大小写及分隔符
+	assert.Equal(t, 3, matchMfaRecoveryCode(hashes, strings.ToUpper(strings.ReplaceAll(codes[3], "-", ""))))
+	assert.Equal(t, -1, matchMfaRecoveryCode(hashes, "00000-00000"))
+}
+
+func TestMfaPendingToken(t *testing.T) {
+	configs.Set(&configs.Config{JwtSecretKey: "test-secret"})
+
+	token, err := GenerateMfaPendingToken("u-1", false)
+	assert.NoError(t, err)
+	uid, er := VerifyMfaPendingToken(token, false)
+	assert.Nil(t, er)
+	assert.Equal(t, models.Id("u-1"), uid)
+
+	// 登录验证的 token 不能用于绑定认证器
+	_, er = VerifyMfaPendingToken(token, true)
+	assert.NotNil(t, er)
+
+	// 其他用途的 token 不能用于多因素认证
+	code, _, _ := newOidcLoginCode("u-1")
+	_, er = VerifyMfaPendingToken(code, false)
+	assert.NotNil(t, er)
+}
@@ -0,0 +1,520 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/oauth2"
+)
+
+const (
+	OidcAuthRequestExpire = 10 * time.Minute
+	OidcLoginCodeExpire   = time.Minute
+
+	defaultOidcGroupsClaim = "groups"
+)
+
+var (
+	oidcProviderLock sync.Mutex
+	oidcProviders    = make(map[string]*oidc.Provider) // issuer => provider
+)
+
+// 角色优先级，多个用户组映射到同一个组织或项目时使用优先级最高的角色，自定义角色的优先级低于内置角色
+var (
+	oidcOrgRolePriority = map[string]int{
+		consts.OrgRoleAdmin:  3,
+		"complianceManager":  2,
+		consts.OrgRoleMember: 1,
+	}
+	oidcProjectRolePriority = map[string]int{
+		consts.ProjectRoleManager:  4,
+		consts.ProjectRoleApprover: 3,
+		consts.ProjectRoleOperator: 2,
+		consts.ProjectRoleGuest:    1,
+	}
+)
+
+// OidcAuthRequest 一次 oidc 登录请求的信息，签名后保存在浏览器 cookie 中，回调时用于校验 state 及换取 token
+type OidcAuthRequest struct {
+	jwt.RegisteredClaims
+
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"` // PKCE code verifier
+	Redirect     string `json:"redirect"`     // 登录成功后跳转的页面
+}
+
+// OidcUserInfo 从 ID token 中获取的用户信息
+type OidcUserInfo struct {
+	Issuer  string
+	Subject string
+	Email   string
+	Name    string
+	Groups  []string
+}
+
+func getOidcProvider(ctx context.Context) (*oidc.Provider, error) {
+	issuer := configs.Get().Oidc.Issuer
+
+	oidcProviderLock.Lock()
+	defer oidcProviderLock.Unlock()
+	if p, ok := oidcProviders[issuer]; ok {
+		return p, nil
+	}
+
+	p, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	oidcProviders[issuer] = p
+	return p, nil
+}
+
+func getOidcOAuth2Config(ctx context.Context) (*oauth2.Config, *oidc.Provider, error) {
+	provider, err := getOidcProvider(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conf := configs.Get()
+	redirectUrl := conf.Oidc.RedirectUrl
+	if redirectUrl == "" {
+		redirectUrl = utils.JoinURL(conf.Portal.Address, "/api/v1/auth/oidc/callback")
+	}
+	scopes := make([]string, 0)
+	for _, s := range strings.Split(conf.Oidc.Scopes, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	} else if !utils.StrInArray(oidc.ScopeOpenID, scopes...) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	return &oauth2.Config{
+		ClientID:     conf.Oidc.ClientId,
+		ClientSecret: conf.Oidc.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectUrl,
+		Scopes:       scopes,
+	}, provider, nil
+}
+
+func oidcRandomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// NewOidcAuthRequest 生成登录请求的 state, nonce 及 PKCE code verifier
+func NewOidcAuthRequest(redirect string) *OidcAuthRequest {
+	return &OidcAuthRequest{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(OidcAuthRequestExpire)),
+			Subject:   consts.JwtSubjectOidcState,
+		},
+		State:        oidcRandomString(),
+		Nonce:        oidcRandomString(),
+		CodeVerifier: oidcRandomString(),
+		Redirect:     redirect,
+	}
+}
+
+// OidcAuthCodeURL 返回 IdP 的认证地址，使用 S256 方式的 PKCE
+func OidcAuthCodeURL(ctx context.Context, req *OidcAuthRequest) (string, error) {
+	conf, _, err := getOidcOAuth2Config(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(req.CodeVerifier))
+	return conf.AuthCodeURL(req.State,
+		oidc.Nonce(req.Nonce),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+// EncodeOidcAuthRequest 签名登录请求信息
+func EncodeOidcAuthRequest(req *OidcAuthRequest) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, req)
+	return token.SignedString([]byte(configs.Get().JwtSecretKey))
+}
+
+// DecodeOidcAuthRequest 校验并解析登录请求信息
+func DecodeOidcAuthRequest(tokenStr string) (*OidcAuthRequest, error) {
+	req := OidcAuthRequest{}
+	token, err := jwt.ParseWithClaims(tokenStr, &req, func(token *jwt.Token) (interface{}, error) {
+		return []byte(configs.Get().JwtSecretKey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || req.Subject != consts.JwtSubjectOidcState {
+		return nil, fmt.Errorf("invalid oidc auth request")
+	}
+	return &req, nil
+}
+
+// OidcExchange 使用授权码换取 token，并校验 ID token 后返回用户信息
+func OidcExchange(ctx context.Context, req *OidcAuthRequest, code string) (*OidcUserInfo, error) {
+	conf, provider, err := getOidcOAuth2Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := conf.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", req.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange token: %v", err)
+	}
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("id_token not found in token response")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: conf.ClientID}).Verify(ctx, rawIdToken)
+	if err != nil {
+		return nil, fmt.Errorf("verify id_token: %v", err)
+	}
+	if idToken.Nonce != req.Nonce {
+		return nil, fmt.Errorf("id_token nonce mismatch")
+	}
+
+	claims := make(map[string]interface{})
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("parse id_token claims: %v", err)
+	}
+	info, err := parseOidcClaims(idToken.Subject, claims, configs.Get().Oidc.GroupsClaim)
+	if err != nil {
+		return nil, err
+	}
+	info.Issuer = idToken.Issuer
+	return info, nil
+}
+
+func parseOidcClaims(subject string, claims map[string]interface{}, groupsClaim string) (*OidcUserInfo, error) {
+	info := &OidcUserInfo{Subject: subject}
+	info.Email, _ = claims["email"].(string)
+	if info.Email == "" {
+		return nil, fmt.Errorf("email claim is required")
+	}
+	// 未声明 email_verified 的 IdP 同样视为未验证
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return nil, fmt.Errorf("email '%s' is not verified", info.Email)
+	}
+
+	for _, k := range []string{"name", "preferred_username"} {
+		if name, _ := claims[k].(string); name != "" {
+			info.Name = name
+			break
+		}
+	}
+	if info.Name == "" {
+		info.Name = strings.Split(info.Email, "@")[0]
+	}
+
+	if groupsClaim == "" {
+		groupsClaim = defaultOidcGroupsClaim
+	}
+	info.Groups = oidcClaimStrings(claims, groupsClaim)
+	return info, nil
+}
+
+// oidcClaimStrings 获取字符串列表类型的 claim，支持 realm_access.roles 形式的嵌套路径
+func oidcClaimStrings(claims map[string]interface{}, path string) []string {
+	var val interface{} = claims
+	for _, k := range strings.Split(path, ".") {
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		val = m[k]
+	}
+
+	rs := make([]string, 0)
+	switch v := val.(type) {
+	case string:
+		rs = append(rs, v)
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				rs = append(rs, s)
+			}
+		}
+	}
+	return rs
+}
+
+// GetUserByOidcIdentity 查询绑定了 oidc 身份的用户
+func GetUserByOidcIdentity(tx *db.Session, issuer, subject string) (*models.User, e.Error) {
+	u := models.User{}
+	if err := tx.Where("oidc_issuer = ? AND oidc_subject = ?", issuer, subject).First(&u); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.UserNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &u, nil
+}
+
+// LinkUserOidc 绑定用户的 oidc 身份，绑定后清除允许绑定的标记
+func LinkUserOidc(tx *db.Session, userId models.Id, issuer, subject string) e.Error {
+	if _, err := tx.Model(&models.User{}).Where("id = ?", userId).UpdateAttrs(models.Attrs{
+		"oidc_issuer":       issuer,
+		"oidc_subject":      subject,
+		"oidc_link_allowed": false,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// SetUserOidcLinkAllowed 设置是否允许用户在下次 oidc 登录时绑定身份，同时解除已绑定的身份
+func SetUserOidcLinkAllowed(tx *db.Session, userId models.Id, allowed bool) e.Error {
+	if _, err := tx.Model(&models.User{}).Where("id = ?", userId).UpdateAttrs(models.Attrs{
+		"oidc_issuer":       "",
+		"oidc_subject":      "",
+		"oidc_link_allowed": allowed,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+type OidcCodeClaims struct {
+	jwt.RegisteredClaims
+
+	UserId models.Id `json:"userId"`
+}
+
+func newOidcLoginCode(uid models.Id) (code string, jti string, err error) {
+	jti = models.NewId("lc").String()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, OidcCodeClaims{
+		UserId: uid,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(OidcLoginCodeExpire)),
+			Subject:   consts.JwtSubjectOidcCode,
+		},
+	})
+	code, err = token.SignedString([]byte(configs.Get().JwtSecretKey))
+	return code, jti, err
+}
+
+// GenerateOidcLoginCode 生成 oidc 登录成功后换取用户 token 的临时 code，code 记录到数据库中，换取时删除
+func GenerateOidcLoginCode(tx *db.Session, uid models.Id) (string, error) {
+	code, jti, err := newOidcLoginCode(uid)
+	if err != nil {
+		return "", err
+	}
+
+	// 顺便清理过期未使用的 code
+	if _, err := tx.Where("expired_at < ?", time.Now().Add(-OidcLoginCodeExpire)).
+		Delete(&models.OidcLoginCode{}); err != nil {
+		return "", err
+	}
+	if err := tx.Insert(&models.OidcLoginCode{
+		Id:        jti,
+		UserId:    uid,
+		ExpiredAt: models.Time(time.Now().Add(OidcLoginCodeExpire)),
+	}); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+func parseOidcLoginCode(code string) (*OidcCodeClaims, e.Error) {
+	claims := OidcCodeClaims{}
+	token, err := jwt.ParseWithClaims(code, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(configs.Get().JwtSecretKey), nil
+	})
+	if err != nil {
+		return nil, e.New(e.InvalidToken, err, http.StatusUnauthorized)
+	}
+	if !token.Valid || claims.Subject != consts.JwtSubjectOidcCode || claims.ID == "" {
+		return nil, e.New(e.InvalidToken, http.StatusUnauthorized)
+	}
+	return &claims, nil
+}
+
+// ConsumeOidcLoginCode 校验临时 code 并删除 code 记录，返回用户 id。
+// 删除失败(code 已被使用)时返回错误，并发换取同一个 code 时只有一个请求成功
+func ConsumeOidcLoginCode(tx *db.Session, code string) (models.Id, e.Error) {
+	claims, er := parseOidcLoginCode(code)
+	if er != nil {
+		return "", er
+	}
+	n, err := tx.Where("id = ? AND user_id = ?", claims.ID, claims.UserId).Delete(&models.OidcLoginCode{})
+	if err != nil {
+		return "", e.New(e.DBError, err)
+	} else if n == 0 {
+		return "", e.New(e.InvalidToken, fmt.Errorf("code already used"), http.StatusUnauthorized)
+	}
+	return claims.UserId, nil
+}
+
+// GetOidcGroupRoles 查询用户组对应的角色映射
+func GetOidcGroupRoles(tx *db.Session, groups []string) ([]models.OidcGroupRole, e.Error) {
+	rs := make([]models.OidcGroupRole, 0)
+	if len(groups) == 0 {
+		return rs, nil
+	}
+	if err := tx.Model(&models.OidcGroupRole{}).Where("`group` IN (?)", groups).Find(&rs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return rs, nil
+}
+
+// MergeOidcGroupRoles 合并用户组的角色映射，同一组织或项目映射了多个角色时使用权限最高的角色。
+// 用户有项目角色但没有所属组织的角色时，自动授予组织的普通成员角色
+func MergeOidcGroupRoles(userId models.Id, groupRoles []models.OidcGroupRole) ([]models.UserOrg, []models.UserProject) {
+	orgRoles := make(map[models.Id]string)
+	projectRoles := make(map[models.Id]string)
+	orgIds := make([]models.Id, 0)
+	projectIds := make([]models.Id, 0)
+	// 因项目角色自动授予的组织成员角色，有组织角色映射时直接替换
+	implicitOrgs := make(map[models.Id]bool)
+
+	for _, r := range groupRoles {
+		if r.ProjectId == "" {
+			if cur, ok := orgRoles[r.OrgId]; !ok {
+				orgIds = append(orgIds, r.OrgId)
+				orgRoles[r.OrgId] = r.Role
+			} else if implicitOrgs[r.OrgId] || oidcOrgRolePriority[r.Role] > oidcOrgRolePriority[cur] {
+				orgRoles[r.OrgId] = r.Role
+			}
+			delete(implicitOrgs, r.OrgId)
+			continue
+		}
+
+		if cur, ok := projectRoles[r.ProjectId]; !ok {
+			projectIds = append(projectIds, r.ProjectId)
+			projectRoles[r.ProjectId] = r.Role
+		} else if oidcProjectRolePriority[r.Role] > oidcProjectRolePriority[cur] {
+			projectRoles[r.ProjectId] = r.Role
+		}
+		if _, ok := orgRoles[r.OrgId]; !ok {
+			orgIds = append(orgIds, r.OrgId)
+			orgRoles[r.OrgId] = consts.OrgRoleMember
+			implicitOrgs[r.OrgId] = true
+		}
+	}
+
+	userOrgs := make([]models.UserOrg, 0, len(orgIds))
+	for _, id := range orgIds {
+		userOrgs = append(userOrgs, models.UserOrg{
+			UserId:     userId,
+			OrgId:      id,
+			Role:       orgRoles[id],
+			IsFromOidc: true,
+		})
+	}
+	userProjects := make([]models.UserProject, 0, len(projectIds))
+	for _, id := range projectIds {
+		userProjects = append(userProjects, models.UserProject{
+			UserId:     userId,
+			ProjectId:  id,
+			Role:       projectRoles[id],
+			IsFromOidc: true,
+		})
+	}
+	return userOrgs, userProjects
+}
+
+// RefreshUserOidcRoles 根据用户组刷新用户的组织及项目角色，
+// 只替换之前由 oidc 用户组授予的角色，用户已经手动授权的组织或项目保持不变
+func RefreshUserOidcRoles(tx *db.Session, userId models.Id, groups []string) e.Error {
+	groupRoles, er := GetOidcGroupRoles(tx, groups)
+	if er != nil {
+		return er
+	}
+	userOrgs, userProjects := MergeOidcGroupRoles(userId, groupRoles)
+
+	if _, err := tx.Where("user_id = ? AND is_from_oidc = ?", userId, true).Delete(&models.UserOrg{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	if _, err := tx.Where("user_id = ? AND is_from_oidc = ?", userId, true).Delete(&models.UserProject{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	for _, uo := range userOrgs {
+		// 用户在组织下是否已经有角色
+		cnt, err := tx.Model(&models.UserOrg{}).Where("user_id = ? AND org_id = ?", userId, uo.OrgId).Count()
+		if err != nil {
+			return e.New(e.DBError, err)
+		} else if cnt > 0 {
+			continue
+		}
+		if err := tx.Insert(&uo); err != nil {
+			return e.New(e.DBError, err)
+		}
+	}
+	for _, up := range userProjects {
+		// 用户在项目中是否已经有角色
+		cnt, err := tx.Model(&models.UserProject{}).Where("user_id = ? AND project_id = ?", userId, up.ProjectId).Count()
+		if err != nil {
+			return e.New(e.DBError, err)
+		} else if cnt > 0 {
+			continue
+		}
+		if err := tx.Insert(&up); err != nil {
+			return e.New(e.DBError, err)
+		}
+	}
+	return nil
+}
+
+func CreateOidcGroupRole(tx *db.Session, r models.OidcGroupRole) (*models.OidcGroupRole, e.Error) {
+	if r.Id == "" {
+		r.Id = models.NewId("ogr")
+	}
+	if err := models.Create(tx, &r); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.OidcGroupRoleExisted, err, http.StatusBadRequest)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &r, nil
+}
+
+func SearchOidcGroupRole(query *db.Session, orgId, projectId models.Id, q string) *db.Session {
+	query = query.Model(&models.OidcGroupRole{}).Where("org_id = ?", orgId)
+	if projectId != "" {
+		query = query.Where("project_id = ?", projectId)
+	}
+	if q != "" {
+		query = query.WhereLike("`group`", q)
+	}
+	return query.Order("created_at DESC")
+}
+
+func DeleteOidcGroupRole(tx *db.Session, orgId, id models.Id) e.Error {
+	n, err := tx.Where("org_id = ? AND id = ?", orgId, id).Delete(&models.OidcGroupRole{})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n == 0 {
+		return e.New(e.OidcGroupRoleNotExist, http.StatusNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/models"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockIdP 本地模拟的 OpenID Connect 服务，用于测试授权码及 PKCE 流程
+type mockIdP struct {
+	*httptest.Server
+
+	key       *rsa.PrivateKey
+	challenge string // 认证请求中的 code_challenge
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	idp := &mockIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/auth",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "test-code" ||
+			base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   idp.URL,
+			"aud":   "cloudiac",
+			"sub":   "user-1",
+			"nonce": idp.nonce,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, _ := token.SignedString(key)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     idToken,
+		})
+	})
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+func TestOidcLoginFlow(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.Close()
+
+	configs.Set(&configs.Config{
+		JwtSecretKey: "test-secret",
+		Portal:       configs.PortalConfig{Address: "http://cloudiac.example.com"},
+		Oidc: configs.OidcConfig{
+			Issuer:      idp.URL,
+			ClientId:    "cloudiac",
+			GroupsClaim: "realm_access.roles",
+		},
+	})
+
+	req := NewOidcAuthRequest("/org/o-1")
+	authUrl, err := OidcAuthCodeURL(context.Background(), req)
+	assert.NoError(t, err)
+
+	u, err := url.Parse(authUrl)
+	assert.NoError(t, err)
+	q := u.Query()
+	assert.Equal(t, idp.URL+"/auth", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, req.State, q.Get("state"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	assert.Equal(t, "http://cloudiac.example.com/api/v1/auth/oidc/callback", q.Get("redirect_uri"))
+
+	// 登录请求信息经过签名保存在 cookie 中
+	encoded, err := EncodeOidcAuthRequest(req)
+	assert.NoError(t, err)
+	decoded, err := DecodeOidcAuthRequest(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, req.CodeVerifier, decoded.CodeVerifier)
+	_, err = DecodeOidcAuthRequest(encoded + "x")
+	assert.Error(t, err)
+
+	idp.challenge = q.Get("code_challenge")
+	idp.nonce = q.Get("nonce")
+	idp.claims = jwt.MapClaims{
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"realm_access":       map[string]interface{}{"roles": []string{"devops", "offline_access"}},
+	}
+	info, err := OidcExchange(context.Background(), decoded, "test-code")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", info.Subject)
+	assert.Equal(t, idp.URL, info.Issuer)
+	assert.Equal(t, "alice@example.com", info.Email)
+	assert.Equal(t, "alice", info.Name)
+	assert.Equal(t, []string{"devops", "offline_access"}, info.Groups)
+
+	// code verifier 不匹配
+	decoded.CodeVerifier = "invalid"
+	_, err = OidcExchange(context.Background(), decoded, "test-code")
+	assert.Error(t, err)
+
+	// nonce 不匹配
+	decoded.CodeVerifier = req.CodeVerifier
+	idp.nonce = "invalid"
+	_, err = OidcExchange(context.Background(), decoded, "test-code")
+	assert.Error(t, err)
+
+	code, jti, err := newOidcLoginCode("u-1")
+	assert.NoError(t, err)
+	claims, er := parseOidcLoginCode(code)
+	assert.Nil(t, er)
+	assert.Equal(t, models.Id("u-1"), claims.UserId)
+	assert.Equal(t, jti, claims.ID)
+	// 登录请求信息不能作为 code 使用
+	_, er = parseOidcLoginCode(encoded)
+	assert.NotNil(t, er)
+}
+
+func TestParseOidcClaims(t *testing.T) {
+	_, err := parseOidcClaims("sub", map[string]interface{}{"email": "a@example.com", "email_verified": false}, "")
+	assert.Error(t, err)
+	// 未声明 email_verified 时视为未验证
+	_, err = parseOidcClaims("sub", map[string]interface{}{"email": "a@example.com"}, "")
+	assert.Error(t, err)
+
+	info, err := parseOidcClaims("sub", map[string]interface{}{
+		"email":          "bob@example.com",
+		"email_verified": true,
+		"groups":         []interface{}{"/dev", "/ops"},
+	}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", info.Name)
+	assert.Equal(t, []string{"/dev", "/ops"}, info.Groups)
+}
+
+func TestMergeOidcGroupRoles(t *testing.T) {
+	userOrgs, userProjects := MergeOidcGroupRoles("u-1", []models.OidcGroupRole{
+		{OrgId: "o-1", Group: "dev", Role: "member"},
+		{OrgId: "o-1", Group: "ops", Role: "admin"},
+		{OrgId: "o-2", ProjectId: "p-1", Group: "dev", Role: "guest"},
+		{OrgId: "o-2", ProjectId: "p-1", Group: "ops", Role: "approver"},
+	})
+
+	assert.Len(t, userOrgs, 2)
+	assert.Equal(t, "admin", userOrgs[0].Role)
+	// 只有项目角色时授予组织的普通成员角色
+	assert.Equal(t, models.Id("o-2"), userOrgs[1].OrgId)
+	assert.Equal(t, "member", userOrgs[1].Role)
+	assert.True(t, userOrgs[1].IsFromOidc)
+
+	assert.Len(t, userProjects, 1)
+	assert.Equal(t, "approver", userProjects[0].Role)
+}
@@ -101,7 +101,8 @@ func GetTaskPolicies(query *db.Session, task models.Tasker) ([]runner.TaskPolicy
 		return nil, err
 	}
 
-	for _, p := range policies {
+	// 执行计划策略由 portal 在 plan 完成后检查，不需要下发到 runner
+	for _, p := range FilterPoliciesByInputType(policies, models.PolicyInputTypeHCL) {
 		category := "general"
 		group, _ := GetPolicyGroupById(query, p.GroupId)
 		if group != nil {
@@ -127,6 +128,21 @@ func GetTaskPolicies(query *db.Session, task models.Tasker) ([]runner.TaskPolicy
 	return taskPolicies, nil
 }
 
+// FilterPoliciesByInputType 按输入类型过滤策略，未设置输入类型的策略为 hcl 策略
+func FilterPoliciesByInputType(policies []models.Policy, inputType string) []models.Policy {
+	filtered := make([]models.Policy, 0, len(policies))
+	for _, p := range policies {
+		typ := p.InputType
+		if typ == "" {
+			typ = models.PolicyInputTypeHCL
+		}
+		if typ == inputType {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
 // GetValidPolicies 获取云模板/环境关联的策略
 func GetValidPolicies(query *db.Session, tplId, envId models.Id) (validPolicies []models.Policy, suppressedPolicies []models.Policy, err e.Error) {
 	var (
@@ -0,0 +1,170 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/policy"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PlanPolicyResult 执行计划策略的检查结果
+type PlanPolicyResult struct {
+	Violated        bool // 有 deny 策略不通过
+	RequireApproval bool // 有 approval 策略不通过
+	Messages        []string
+}
+
+// BuildPlanPolicyInput 构造执行计划策略的输入，包含执行计划、资源变更数量及费用预估
+func BuildPlanPolicyInput(planJson []byte, result models.TaskResult) (*policy.PlanInput, error) {
+	input := policy.PlanInput{}
+	if err := json.Unmarshal(planJson, &input.Plan); err != nil {
+		return nil, fmt.Errorf("unmarshal plan json: %v", err)
+	}
+
+	intVal := func(v *int) int {
+		if v == nil {
+			return 0
+		}
+		return *v
+	}
+	floatVal := func(v *float32) float32 {
+		if v == nil {
+			return 0
+		}
+		return *v
+	}
+
+	input.Summary = policy.PlanSummary{
+		Add:     intVal(result.ResAdded),
+		Change:  intVal(result.ResChanged),
+		Destroy: intVal(result.ResDestroyed),
+	}
+	input.Cost = policy.PlanCost{
+		Added:          floatVal(result.ResAddedCost),
+		Destroyed:      floatVal(result.ResDestroyedCost),
+		Updated:        floatVal(result.ResUpdatedCost),
+		ForecastFailed: result.ForecastFailed,
+	}
+	input.Cost.Delta = input.Cost.Added + input.Cost.Destroyed + input.Cost.Updated
+	if input.Cost.ForecastFailed == nil {
+		input.Cost.ForecastFailed = []string{}
+	}
+	return &input, nil
+}
+
+// HasTaskPlanPolicies 任务的环境(或云模板)是否绑定了生效的执行计划策略
+func HasTaskPlanPolicies(tx *db.Session, task *models.Task) (bool, e.Error) {
+	validPolicies, _, er := GetValidPolicies(tx, task.TplId, task.EnvId)
+	if er != nil {
+		return false, er
+	}
+	return len(FilterPoliciesByInputType(validPolicies, models.PolicyInputTypePlan)) > 0, nil
+}
+
+// CheckTaskPlanPolicies 使用环境关联的执行计划策略检查任务的执行计划，并保存检查结果
+func CheckTaskPlanPolicies(tx *db.Session, task *models.Task, planJson []byte) (*PlanPolicyResult, e.Error) {
+	validPolicies, suppressedPolicies, er := GetValidPolicies(tx, task.TplId, task.EnvId)
+	if er != nil {
+		return nil, er
+	}
+	validPolicies = FilterPoliciesByInputType(validPolicies, models.PolicyInputTypePlan)
+	suppressedPolicies = FilterPoliciesByInputType(suppressedPolicies, models.PolicyInputTypePlan)
+
+	result := &PlanPolicyResult{}
+	if len(validPolicies) == 0 && len(suppressedPolicies) == 0 {
+		return result, nil
+	}
+
+	input, err := BuildPlanPolicyInput(planJson, task.PlanResult)
+	if err != nil {
+		return nil, e.New(e.InternalError, err)
+	}
+
+	policyIds := make([]models.Id, 0)
+	for _, p := range append(validPolicies, suppressedPolicies...) {
+		policyIds = append(policyIds, p.Id)
+	}
+	// 任务重新执行时覆盖之前的检查结果
+	if _, err := tx.Where("task_id = ? AND policy_id IN (?)", task.Id, policyIds).
+		Delete(models.PolicyResult{}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	newResult := func(p models.Policy, status string) *models.PolicyResult {
+		return &models.PolicyResult{
+			OrgId:         task.OrgId,
+			ProjectId:     task.ProjectId,
+			TplId:         task.TplId,
+			EnvId:         task.EnvId,
+			TaskId:        task.Id,
+			PolicyId:      p.Id,
+			PolicyGroupId: p.GroupId,
+			StartAt:       models.Time(time.Now()),
+			Status:        status,
+			Violation: models.Violation{
+				RuleName: p.Name,
+				RuleId:   string(p.Id),
+				Severity: p.Severity,
+			},
+		}
+	}
+
+	policyResults := make([]*models.PolicyResult, 0, len(validPolicies)+len(suppressedPolicies))
+	for _, p := range validPolicies {
+		pr := newResult(p, common.PolicyStatusPassed)
+		if group, _ := GetPolicyGroupById(tx, p.GroupId); group != nil {
+			pr.Category = group.Name
+		}
+
+		values, err := policy.EvalRego(p.RuleName, p.Rego, input)
+		if err != nil {
+			pr.Status = common.PolicyStatusFailed
+			pr.Message = err.Error()
+		} else if len(values) > 0 {
+			messages, resources := policy.ParseViolations(values)
+			if len(messages) == 0 {
+				messages = []string{fmt.Sprintf("policy '%s' violated", p.Name)}
+			}
+			pr.Status = common.PolicyStatusViolated
+			pr.Message = strings.Join(messages, "; ")
+			if len(resources) > 0 {
+				pr.ResourceType, pr.ResourceName = policy.SplitResourceAddress(resources[0])
+			}
+
+			if p.Enforcement == models.PolicyEnforcementApproval {
+				result.RequireApproval = true
+			} else {
+				result.Violated = true
+			}
+			result.Messages = append(result.Messages, fmt.Sprintf("%s: %s", p.Name, pr.Message))
+		}
+		policyResults = append(policyResults, pr)
+	}
+	for _, p := range suppressedPolicies {
+		policyResults = append(policyResults, newResult(p, common.PolicyStatusSuppressed))
+	}
+
+	if err := models.CreateBatch(tx, policyResults); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return result, nil
+}
+
+// HasViolatedPlanPolicy 任务的执行计划策略检查是否有不通过的结果
+func HasViolatedPlanPolicy(sess *db.Session, taskId models.Id) (bool, e.Error) {
+	planPolicies := sess.Model(&models.Policy{}).Select("id").Where("input_type = ?", models.PolicyInputTypePlan)
+	exists, err := sess.Model(&models.PolicyResult{}).
+		Where("task_id = ? AND status = ? AND policy_id IN (?)", taskId, common.PolicyStatusViolated, planPolicies.Expr()).
+		Exists()
+	if err != nil {
+		return false, e.New(e.DBError, err)
+	}
+	return exists, nil
+}
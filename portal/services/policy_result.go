@@ -46,6 +46,9 @@ func InitScanResult(tx *db.Session, task *models.ScanTask) e.Error {
 	if validPolicies, suppressedPolicies, err = GetValidPolicies(tx, task.TplId, task.EnvId); err != nil {
 		return err
 	}
+	// 执行计划策略的结果在 plan 完成后检查时创建
+	validPolicies = FilterPoliciesByInputType(validPolicies, models.PolicyInputTypeHCL)
+	suppressedPolicies = FilterPoliciesByInputType(suppressedPolicies, models.PolicyInputTypeHCL)
 
 	if len(validPolicies) == 0 && len(suppressedPolicies) == 0 {
 		return nil
@@ -173,9 +176,10 @@ func finishPendingScanResult(tx *db.Session, task models.Tasker, message string,
 	return nil
 }
 
-// CleanScanResult 任务失败的时候清除扫描结果
+// CleanScanResult 任务失败的时候清除扫描结果(执行计划策略的检查结果不受扫描步骤影响，予以保留)
 func CleanScanResult(tx *db.Session, task models.Tasker) e.Error {
-	if _, err := tx.Where("task_id = ?", task.GetId()).
+	planPolicies := tx.Model(&models.Policy{}).Select("id").Where("input_type = ?", models.PolicyInputTypePlan)
+	if _, err := tx.Where("task_id = ? AND policy_id NOT IN (?)", task.GetId(), planPolicies.Expr()).
 		Delete(models.PolicyResult{}); err != nil {
 		return e.New(e.DBError, err)
 	}
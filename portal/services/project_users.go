@@ -164,7 +164,7 @@ func DeleteProjectUser(dbSess *db.Session, id string, projectId models.Id) e.Err
 	if _, err := dbSess.Where("user_id = ? and project_id = ?", id, projectId).Delete(&models.UserProject{}); err != nil {
 		return e.New(e.DBError, fmt.Errorf("delete project error: %v", err))
 	}
-	return nil
+	return DeleteProjectEnvUsers(dbSess, projectId, models.Id(id))
 }
 
 // GetDemoProject 获取演示项目
@@ -184,5 +184,5 @@ func DeleteUserAllProject(tx *db.Session, userId models.Id, orgId models.Id) e.E
 		gorm.Expr("select id from iac_project where org_id = ?", orgId), userId).Delete(&models.UserProject{}); err != nil {
 		return e.New(e.DBError, fmt.Errorf("delete user %v for all project error: %v", userId, err))
 	}
-	return nil
+	return DeleteOrgEnvUsers(tx, orgId, userId)
 }
@@ -15,6 +15,10 @@ import (
 var (
 	enforcer *casbin.Enforcer
 	initOnce sync.Once
+
+	// 自定义角色策略会在运行时更新，enforcer 的读写需要加锁
+	lock       sync.RWMutex
+	customSubs = make(map[string]struct{})
 )
 
 // InitPolicy 初始化权限策略
@@ -52,5 +56,31 @@ func InitPolicy() {
 
 func Enforce(vals ...interface{}) (bool, error) {
 	InitPolicy()
+	lock.RLock()
+	defer lock.RUnlock()
 	return enforcer.Enforce(vals...)
 }
+
+// SetCustomPolicies 使用 policies 替换当前加载的所有自定义角色策略，
+// 自定义角色以角色 id 作为策略的角色名称，与内置角色不会冲突
+func SetCustomPolicies(policies []configs.Policy) error {
+	InitPolicy()
+	lock.Lock()
+	defer lock.Unlock()
+
+	for sub := range customSubs {
+		if _, err := enforcer.RemoveFilteredPolicy(0, sub); err != nil {
+			return err
+		}
+		delete(customSubs, sub)
+	}
+	for _, policy := range policies {
+		customSubs[policy.Sub] = struct{}{}
+		for _, act := range strings.Split(policy.Act, "/") {
+			if _, err := enforcer.AddPolicy(policy.Sub, policy.Obj, act); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -52,3 +52,24 @@ func GetResourceByIdsInProvider(dbSess *db.Session, ids, projectIds []string, vg
 	}
 	return resp, nil
 }
+
+// GetResourceByArnsInProvider 通过资源属性中的 arn 查询资源，aws 账单中部分资源(如 rds、lambda)使用 arn 作为资源 id
+func GetResourceByArnsInProvider(dbSess *db.Session, arns, projectIds []string, vg models.VariableGroup) ([]models.Resource, e.Error) {
+	resp := make([]models.Resource, 0)
+	if len(arns) == 0 {
+		return resp, nil
+	}
+
+	query := dbSess.Model(models.Resource{}).
+		Where("provider like ?", fmt.Sprintf("%%%s", vg.Provider)).
+		Where("org_id = ?", vg.OrgId).
+		Where("JSON_UNQUOTE(JSON_EXTRACT(attrs, '$.arn')) in (?)", arns)
+	if !(len(projectIds) == 1 && projectIds[0] == "") {
+		query = query.Where("project_id  in  (?)", projectIds)
+	}
+
+	if err := query.Find(&resp); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return resp, nil
+}
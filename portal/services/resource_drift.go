@@ -0,0 +1,407 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	driftSensitiveValue = "(sensitive)"
+	driftResourceExists = "(exists)"
+	driftResourceAbsent = "(absent)"
+)
+
+// ParsePlanResourceDrift 解析 plan json 中 refresh 时检测到的资源漂移(resource_drift)，返回 资源地址 -> 发生漂移的属性。
+// 资源的期望值为 before(上次执行后记录的状态)，实际值为 after(refresh 后的状态)，
+// 配置变更产生的资源变更(resource_changes)不是漂移，不做比较
+func ParsePlanResourceDrift(bs []byte) (map[string][]models.DriftAttr, error) {
+	plan, err := UnmarshalPlanJson(bs)
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := make(map[string][]models.DriftAttr)
+	for _, r := range plan.ResourceDrift {
+		if r.Mode == "data" {
+			continue
+		}
+		actions := r.Change.Actions
+		attrs := make([]models.DriftAttr, 0)
+		switch {
+		case utils.SliceEqualStr(actions, []string{"delete"}):
+			// 资源在外部被删除
+			attrs = append(attrs, models.DriftAttr{Expected: driftResourceExists, Actual: driftResourceAbsent})
+		case utils.SliceEqualStr(actions, []string{"update"}):
+			diffDriftAttrs("", r.Change.Before, r.Change.After, r.Change.AfterUnknown,
+				r.Change.BeforeSensitive, r.Change.AfterSensitive, &attrs)
+		default:
+			// no-op, read
+			continue
+		}
+		if len(attrs) > 0 {
+			sort.Slice(attrs, func(i, j int) bool { return attrs[i].Path < attrs[j].Path })
+			drifts[r.Address] = attrs
+		}
+	}
+	return drifts, nil
+}
+
+// driftChild 获取属性的子属性，父属性值为 true 时(如整个属性为 sensitive)子属性同样为 true
+func driftChild(v interface{}, key string) interface{} {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case map[string]interface{}:
+		return val[key]
+	case []interface{}:
+		if i, err := strconv.Atoi(key); err == nil && i < len(val) {
+			return val[i]
+		}
+	}
+	return nil
+}
+
+func diffDriftAttrs(path string, expected, actual, unknown, expectedSensitive, actualSensitive interface{},
+	attrs *[]models.DriftAttr) {
+	if b, _ := unknown.(bool); b {
+		// apply 后才能确定的值不认为是漂移
+		return
+	}
+
+	keys := make([]string, 0)
+	expMap, ok1 := expected.(map[string]interface{})
+	actMap, ok2 := actual.(map[string]interface{})
+	expList, ok3 := expected.([]interface{})
+	actList, ok4 := actual.([]interface{})
+	if ok1 && ok2 {
+		for k := range expMap {
+			keys = append(keys, k)
+		}
+		for k := range actMap {
+			if _, ok := expMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+	} else if ok3 && ok4 && len(expList) == len(actList) {
+		for i := range expList {
+			keys = append(keys, strconv.Itoa(i))
+		}
+	} else {
+		if jsonEqual(expected, actual) {
+			return
+		}
+		// 类型或列表长度不同、属性块增加或删除时记录整个值，其中的敏感属性同样需要隐藏
+		*attrs = append(*attrs, models.DriftAttr{
+			Path:     path,
+			Expected: maskDriftSensitive(expected, expectedSensitive),
+			Actual:   maskDriftSensitive(actual, actualSensitive),
+		})
+		return
+	}
+
+	for _, k := range keys {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+		diffDriftAttrs(p, driftChild(expected, k), driftChild(actual, k), driftChild(unknown, k),
+			driftChild(expectedSensitive, k), driftChild(actualSensitive, k), attrs)
+	}
+}
+
+// maskDriftSensitive 将值中标记为 sensitive 的部分替换为 (sensitive)，
+// 标记与值的结构不一致时，只要标记中有 sensitive 的属性就隐藏整个值
+func maskDriftSensitive(v interface{}, sensitive interface{}) interface{} {
+	switch mark := sensitive.(type) {
+	case bool:
+		if mark {
+			return driftSensitiveValue
+		}
+		return v
+	case map[string]interface{}:
+		val, ok := v.(map[string]interface{})
+		if !ok {
+			break
+		}
+		masked := make(map[string]interface{}, len(val))
+		for k := range val {
+			masked[k] = maskDriftSensitive(val[k], mark[k])
+		}
+		return masked
+	case []interface{}:
+		val, ok := v.([]interface{})
+		if !ok {
+			break
+		}
+		masked := make([]interface{}, len(val))
+		for i := range val {
+			masked[i] = maskDriftSensitive(val[i], driftChild(mark, strconv.Itoa(i)))
+		}
+		return masked
+	default:
+		return v
+	}
+
+	if v != nil && hasDriftSensitive(sensitive) {
+		return driftSensitiveValue
+	}
+	return v
+}
+
+func hasDriftSensitive(sensitive interface{}) bool {
+	switch mark := sensitive.(type) {
+	case bool:
+		return mark
+	case map[string]interface{}:
+		for _, m := range mark {
+			if hasDriftSensitive(m) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, m := range mark {
+			if hasDriftSensitive(m) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DriftAttrsDetail 生成资源漂移的文本描述
+func DriftAttrsDetail(attrs []models.DriftAttr) string {
+	lines := make([]string, 0, len(attrs))
+	for _, a := range attrs {
+		exp, _ := json.Marshal(a.Expected)
+		act, _ := json.Marshal(a.Actual)
+		path := a.Path
+		if path == "" {
+			path = "(resource)"
+		}
+		lines = append(lines, fmt.Sprintf("  ~ %s: expected %s, actual %s", path, exp, act))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func driftRecordKey(address, path string) string {
+	return address + "\x00" + path
+}
+
+func getEnvActiveDriftRecords(tx *db.Session, envId models.Id) (map[string]*models.ResourceDriftRecord, e.Error) {
+	records := make([]*models.ResourceDriftRecord, 0)
+	if err := tx.Model(&models.ResourceDriftRecord{}).
+		Where("env_id = ? AND status != ?", envId, models.DriftStatusResolved).
+		Find(&records); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	recordMap := make(map[string]*models.ResourceDriftRecord, len(records))
+	for _, r := range records {
+		recordMap[driftRecordKey(r.Address, r.Path)] = r
+	}
+	return recordMap, nil
+}
+
+func filterIgnoredDrift(records map[string]*models.ResourceDriftRecord,
+	drifts map[string]models.ResourceDrift) map[string]models.ResourceDrift {
+	filtered := make(map[string]models.ResourceDrift, len(drifts))
+	for address, drift := range drifts {
+		attrs := make([]models.DriftAttr, 0, len(drift.Attrs))
+		for _, a := range drift.Attrs {
+			if r, ok := records[driftRecordKey(address, a.Path)]; ok && r.Status == models.DriftStatusIgnored {
+				continue
+			}
+			attrs = append(attrs, a)
+		}
+		if len(attrs) == 0 {
+			continue
+		}
+		if len(attrs) != len(drift.Attrs) {
+			drift.Attrs = attrs
+			drift.DriftDetail = DriftAttrsDetail(attrs)
+		}
+		filtered[address] = drift
+	}
+	return filtered
+}
+
+// FilterIgnoredResourceDrift 去除环境中已忽略的漂移属性，所有漂移属性都被忽略的资源视为未漂移
+func FilterIgnoredResourceDrift(tx *db.Session, envId models.Id,
+	drifts map[string]models.ResourceDrift) (map[string]models.ResourceDrift, e.Error) {
+	records, er := getEnvActiveDriftRecords(tx, envId)
+	if er != nil {
+		return nil, er
+	}
+	return filterIgnoredDrift(records, drifts), nil
+}
+
+// SaveEnvDriftRecords 根据偏移检测结果更新环境的漂移记录，本次未检测到的漂移标记为已恢复(忽略的属性保持忽略状态)。
+// 返回去除了已忽略属性后的漂移信息
+func SaveEnvDriftRecords(tx *db.Session, task *models.Task, drifts map[string]models.ResourceDrift,
+	now time.Time) (map[string]models.ResourceDrift, e.Error) {
+	records, er := getEnvActiveDriftRecords(tx, task.EnvId)
+	if er != nil {
+		return nil, er
+	}
+
+	seenAt := models.Time(now)
+	seen := make(map[string]bool)
+	for address, drift := range drifts {
+		for _, a := range drift.Attrs {
+			key := driftRecordKey(address, a.Path)
+			seen[key] = true
+
+			expected, _ := json.Marshal(a.Expected)
+			actual, _ := json.Marshal(a.Actual)
+			r, ok := records[key]
+			if !ok {
+				r = &models.ResourceDriftRecord{
+					OrgId:       task.OrgId,
+					ProjectId:   task.ProjectId,
+					EnvId:       task.EnvId,
+					Address:     address,
+					Path:        a.Path,
+					Expected:    expected,
+					Actual:      actual,
+					Status:      models.DriftStatusDrifted,
+					FirstSeenAt: seenAt,
+					LastSeenAt:  seenAt,
+					LastTaskId:  task.Id,
+				}
+				r.Id = models.NewId("rdr")
+				if err := models.Create(tx, r); err != nil {
+					return nil, e.New(e.DBError, err)
+				}
+				continue
+			}
+
+			attrs := models.Attrs{
+				"expected":     models.JSON(expected),
+				"actual":       models.JSON(actual),
+				"last_seen_at": seenAt,
+				"last_task_id": task.Id,
+			}
+			// 已确认的漂移在实际值再次变化时重新标记为漂移
+			if r.Status == models.DriftStatusAcknowledged && string(r.Actual) != string(actual) {
+				attrs["status"] = models.DriftStatusDrifted
+				attrs["operator_id"] = ""
+			}
+			if _, err := tx.Model(&models.ResourceDriftRecord{}).Where("id = ?", r.Id).
+				UpdateAttrs(attrs); err != nil {
+				return nil, e.New(e.DBError, err)
+			}
+		}
+	}
+
+	resolvedIds := make([]models.Id, 0)
+	for key, r := range records {
+		if !seen[key] && r.Status != models.DriftStatusIgnored {
+			resolvedIds = append(resolvedIds, r.Id)
+		}
+	}
+	if len(resolvedIds) > 0 {
+		if _, err := tx.Model(&models.ResourceDriftRecord{}).Where("id IN (?)", resolvedIds).
+			UpdateAttrs(models.Attrs{"status": models.DriftStatusResolved, "resolved_at": seenAt}); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+	}
+	return filterIgnoredDrift(records, drifts), nil
+}
+
+// SearchEnvDriftRecord 查询环境的漂移记录，默认不返回已恢复的记录
+func SearchEnvDriftRecord(query *db.Session, envId models.Id, status string, q string) *db.Session {
+	query = query.Model(&models.ResourceDriftRecord{}).Where("env_id = ?", envId)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	} else {
+		query = query.Where("status != ?", models.DriftStatusResolved)
+	}
+	if q != "" {
+		query = query.WhereLike("address", q)
+	}
+	return query.Order("last_seen_at DESC, address, path")
+}
+
+func GetDriftRecordById(tx *db.Session, envId, id models.Id) (*models.ResourceDriftRecord, e.Error) {
+	r := models.ResourceDriftRecord{}
+	if err := tx.Where("env_id = ? AND id = ?", envId, id).First(&r); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.DriftRecordNotExist, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &r, nil
+}
+
+// UpdateDriftRecordStatus 确认、忽略漂移属性或者重新标记为漂移，已恢复的记录不允许修改
+func UpdateDriftRecordStatus(tx *db.Session, r *models.ResourceDriftRecord, status string,
+	userId models.Id) (*models.ResourceDriftRecord, e.Error) {
+	if r.Status == models.DriftStatusResolved {
+		return nil, e.New(e.DriftRecordStatusInvalid, fmt.Errorf("drift is resolved"), http.StatusBadRequest)
+	}
+	if r.Status == status {
+		return r, nil
+	}
+
+	operatorId := userId
+	if status == models.DriftStatusDrifted {
+		operatorId = ""
+	}
+	if _, err := tx.Model(&models.ResourceDriftRecord{}).Where("id = ?", r.Id).
+		UpdateAttrs(models.Attrs{"status": status, "operator_id": operatorId}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	r.Status = status
+	r.OperatorId = operatorId
+	return r, nil
+}
+
+// GetDriftTrend 统计每天结束时处于漂移状态(不包括忽略的漂移)的属性、资源及环境数量
+func GetDriftTrend(query *db.Session, start time.Time, days int) ([]resps.DriftTrendPoint, e.Error) {
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	end := start.AddDate(0, 0, days)
+
+	records := make([]models.ResourceDriftRecord, 0)
+	if err := query.Model(&models.ResourceDriftRecord{}).
+		Where("status != ?", models.DriftStatusIgnored).
+		Where("first_seen_at < ?", end).
+		Where("resolved_at IS NULL OR resolved_at >= ?", start).
+		Find(&records); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return driftTrend(records, start, days), nil
+}
+
+func driftTrend(records []models.ResourceDriftRecord, start time.Time, days int) []resps.DriftTrendPoint {
+	points := make([]resps.DriftTrendPoint, 0, days)
+	for i := 0; i < days; i++ {
+		dayEnd := start.AddDate(0, 0, i+1)
+		resources := make(map[string]bool)
+		envs := make(map[models.Id]bool)
+		point := resps.DriftTrendPoint{Date: start.AddDate(0, 0, i).Format("2006-01-02")}
+		for _, r := range records {
+			if !time.Time(r.FirstSeenAt).Before(dayEnd) ||
+				(r.ResolvedAt != nil && time.Time(*r.ResolvedAt).Before(dayEnd)) {
+				continue
+			}
+			point.Attrs += 1
+			resources[string(r.EnvId)+"/"+r.Address] = true
+			envs[r.EnvId] = true
+		}
+		point.Resources = len(resources)
+		point.Envs = len(envs)
+		points = append(points, point)
+	}
+	return points
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterIgnoredDrift(t *testing.T) {
+	records := map[string]*models.ResourceDriftRecord{
+		driftRecordKey("aws_instance.web", "tags.Name"): {Status: models.DriftStatusIgnored},
+		driftRecordKey("aws_instance.web", "ami"):       {Status: models.DriftStatusAcknowledged},
+		driftRecordKey("aws_instance.db", "tags.Name"):  {Status: models.DriftStatusIgnored},
+	}
+	filtered := filterIgnoredDrift(records, map[string]models.ResourceDrift{
+		"aws_instance.web": {Attrs: []models.DriftAttr{{Path: "ami"}, {Path: "tags.Name"}}},
+		"aws_instance.db":  {Attrs: []models.DriftAttr{{Path: "tags.Name"}}},
+	})
+	// 所有漂移属性都被忽略的资源视为未漂移
+	assert.Len(t, filtered, 1)
+	assert.Equal(t, []models.DriftAttr{{Path: "ami"}}, filtered["aws_instance.web"].Attrs)
+}
+
+func TestDriftTrend(t *testing.T) {
+	day := func(d, h int) models.Time {
+		return models.Time(time.Date(2023, 3, d, h, 0, 0, 0, time.Local))
+	}
+	resolvedAt := day(3, 12)
+	records := []models.ResourceDriftRecord{
+		{EnvId: "env-1", Address: "aws_instance.web", Path: "ami", FirstSeenAt: day(1, 8), ResolvedAt: &resolvedAt},
+		{EnvId: "env-1", Address: "aws_instance.web", Path: "tags.Name", FirstSeenAt: day(2, 8)},
+		{EnvId: "env-2", Address: "aws_instance.web", Path: "ami", FirstSeenAt: day(2, 23)},
+	}
+
+	points := driftTrend(records, time.Date(2023, 3, 1, 0, 0, 0, 0, time.Local), 4)
+	assert.Len(t, points, 4)
+	assert.Equal(t, "2023-03-01", points[0].Date)
+	assert.Equal(t, 1, points[0].Attrs)
+	assert.Equal(t, 3, points[1].Attrs)
+	assert.Equal(t, 2, points[1].Resources)
+	assert.Equal(t, 2, points[1].Envs)
+	// 03-03 当天恢复的漂移不再统计
+	assert.Equal(t, 2, points[2].Attrs)
+	assert.Equal(t, 2, points[3].Resources)
+}
@@ -2,7 +2,24 @@
 
 package services
 
-import "cloudiac/portal/consts"
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services/rbac"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
 
 var roleLevels = map[string]int{
 	consts.RoleRoot:            1000,
@@ -20,6 +37,8 @@ var roleLevels = map[string]int{
 func GetRoleLevel(role string) int {
 	if level, ok := roleLevels[role]; ok {
 		return level
+	} else if models.IsCustomRole(role) {
+		return customRoleLevel
 	}
 	return 0
 }
@@ -40,3 +59,267 @@ func GetHighestRole(roles ...string) string {
 	}
 	return highestRole
 }
+
+// 内置的组织及项目角色，自定义角色可以授予的权限从对应内置角色的策略中生成
+var (
+	builtinOrgRoles     = []string{consts.OrgRoleAdmin, "complianceManager", consts.OrgRoleMember}
+	builtinProjectRoles = []string{consts.ProjectRoleManager, consts.ProjectRoleApprover,
+		consts.ProjectRoleOperator, consts.ProjectRoleGuest}
+)
+
+// 自定义角色默认拥有的权限，保证用户可以正常进入组织或项目
+var roleBasePermissions = map[string][]configs.Policy{
+	consts.ScopeOrg: {
+		{Obj: "self", Act: "read/update"},
+		{Obj: "orgs", Act: "read"},
+	},
+	consts.ScopeProject: {
+		{Obj: "projects", Act: "read"},
+	},
+}
+
+// 策略动作为 * 时，自定义角色可以选择的动作
+var roleDefaultActs = []string{"read", "create", "update", "delete"}
+
+// 自定义角色的等级低于所有内置角色
+const customRoleLevel = 100
+
+// IsBuiltinRole 判断 role 是否为 scope 下的内置角色
+func IsBuiltinRole(scope string, role string) bool {
+	if scope == consts.ScopeProject {
+		return utils.StrInArray(role, builtinProjectRoles...)
+	}
+	return utils.StrInArray(role, builtinOrgRoles...)
+}
+
+// RolePermissions 返回 scope 下自定义角色可以授予的权限
+func RolePermissions(scope string) []resps.RolePermissionResp {
+	subs := builtinOrgRoles
+	if scope == consts.ScopeProject {
+		subs = builtinProjectRoles
+	}
+
+	perms := make([]resps.RolePermissionResp, 0)
+	index := make(map[string]int)
+	for _, policy := range configs.Polices {
+		if !utils.StrInArray(policy.Sub, subs...) {
+			continue
+		}
+		i, ok := index[policy.Obj]
+		if !ok {
+			i = len(perms)
+			index[policy.Obj] = i
+			perms = append(perms, resps.RolePermissionResp{Obj: policy.Obj, Acts: []string{}})
+		}
+		acts := strings.Split(policy.Act, "/")
+		if policy.Act == "*" {
+			acts = roleDefaultActs
+		}
+		for _, act := range acts {
+			if !utils.StrInArray(act, perms[i].Acts...) {
+				perms[i].Acts = append(perms[i].Acts, act)
+			}
+		}
+	}
+	return perms
+}
+
+// ValidRolePermissions 检查权限列表是否都在 scope 允许的权限范围内，动作为 * 表示资源的所有权限
+func ValidRolePermissions(scope string, permissions []string) e.Error {
+	perms := RolePermissions(scope)
+	for _, p := range permissions {
+		parts := strings.SplitN(p, ":", 2)
+		if len(parts) != 2 {
+			return e.New(e.RolePermissionInvalid, fmt.Errorf("invalid permission '%s'", p), http.StatusBadRequest)
+		}
+		valid := false
+		for _, perm := range perms {
+			if perm.Obj == parts[0] && (parts[1] == "*" || utils.StrInArray(parts[1], perm.Acts...)) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return e.New(e.RolePermissionInvalid, fmt.Errorf("invalid permission '%s'", p), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// ValidOrgRole 检查组织角色是否有效，role 需要是 builtin 中的内置角色或者组织下的自定义组织角色
+func ValidOrgRole(tx *db.Session, orgId models.Id, role string, builtin ...string) e.Error {
+	if utils.StrInArray(role, builtin...) {
+		return nil
+	}
+	return validCustomRole(tx, orgId, consts.ScopeOrg, role)
+}
+
+// ValidProjectRole 检查项目角色是否有效，role 需要是内置项目角色或者组织下的自定义项目角色
+func ValidProjectRole(tx *db.Session, orgId models.Id, role string) e.Error {
+	if IsBuiltinRole(consts.ScopeProject, role) {
+		return nil
+	}
+	return validCustomRole(tx, orgId, consts.ScopeProject, role)
+}
+
+func validCustomRole(tx *db.Session, orgId models.Id, scope string, role string) e.Error {
+	if !models.IsCustomRole(role) {
+		return e.New(e.InvalidRoleName, http.StatusBadRequest)
+	}
+	exists, err := tx.Model(&models.Role{}).
+		Where("id = ? AND org_id = ? AND scope = ?", role, orgId, scope).Exists()
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if !exists {
+		return e.New(e.InvalidRoleName, http.StatusBadRequest)
+	}
+	return nil
+}
+
+func CreateRole(tx *db.Session, role models.Role) (*models.Role, e.Error) {
+	if role.Id == "" {
+		role.Id = models.NewId(models.RoleIdPrefix)
+	}
+	if err := models.Create(tx, &role); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.RoleAlreadyExists, err, http.StatusBadRequest)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &role, nil
+}
+
+func GetRoleById(tx *db.Session, orgId, id models.Id) (*models.Role, e.Error) {
+	role := models.Role{}
+	if err := tx.Where("org_id = ? AND id = ?", orgId, id).First(&role); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.RoleNotExist, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &role, nil
+}
+
+func SearchRole(query *db.Session, orgId models.Id, scope string, q string) *db.Session {
+	query = query.Model(&models.Role{}).Where("org_id = ?", orgId)
+	if scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	if q != "" {
+		query = query.WhereLike("name", q)
+	}
+	return query.Order("created_at DESC")
+}
+
+func UpdateRole(tx *db.Session, orgId, id models.Id, attrs models.Attrs) (*models.Role, e.Error) {
+	if _, err := tx.Model(&models.Role{}).Where("org_id = ? AND id = ?", orgId, id).UpdateAttrs(attrs); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.RoleAlreadyExists, err, http.StatusBadRequest)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return GetRoleById(tx, orgId, id)
+}
+
+// DeleteRole 删除自定义角色，角色已授予用户或者被 oidc 用户组映射使用时不允许删除
+func DeleteRole(tx *db.Session, orgId, id models.Id) e.Error {
+	for _, m := range []interface{}{&models.UserOrg{}, &models.UserProject{}, &models.EnvUser{}, &models.OidcGroupRole{}} {
+		if exists, err := tx.Model(m).Where("role = ?", id).Exists(); err != nil {
+			return e.New(e.DBError, err)
+		} else if exists {
+			return e.New(e.RoleInUse, http.StatusBadRequest)
+		}
+	}
+
+	n, err := tx.Where("org_id = ? AND id = ?", orgId, id).Delete(&models.Role{})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n == 0 {
+		return e.New(e.RoleNotExist, http.StatusNotFound)
+	}
+	return nil
+}
+
+// rolePolicies 生成自定义角色的 rbac 策略
+func rolePolicies(roles []models.Role) []configs.Policy {
+	policies := make([]configs.Policy, 0)
+	for _, role := range roles {
+		for _, p := range roleBasePermissions[role.Scope] {
+			policies = append(policies, configs.Policy{Sub: role.Id.String(), Obj: p.Obj, Act: p.Act})
+		}
+		for _, p := range role.Permissions {
+			if parts := strings.SplitN(p, ":", 2); len(parts) == 2 {
+				act := parts[1]
+				if act == "*" {
+					act = roleWildcardAct(role.Scope, parts[0])
+				}
+				if act != "" {
+					policies = append(policies, configs.Policy{Sub: role.Id.String(), Obj: parts[0], Act: act})
+				}
+			}
+		}
+	}
+	return policies
+}
+
+// roleWildcardAct 返回自定义角色权限动作为 * 时实际授予的动作。
+// 只有内置角色对该资源有 * 权限时才保留 *，否则展开为内置角色对该资源的所有动作，
+// 避免自定义角色获得超出内置角色的权限(如删除组织)
+func roleWildcardAct(scope string, obj string) string {
+	subs := builtinOrgRoles
+	if scope == consts.ScopeProject {
+		subs = builtinProjectRoles
+	}
+	for _, policy := range configs.Polices {
+		if policy.Obj == obj && policy.Act == "*" && utils.StrInArray(policy.Sub, subs...) {
+			return "*"
+		}
+	}
+	for _, perm := range RolePermissions(scope) {
+		if perm.Obj == obj {
+			return strings.Join(perm.Acts, "/")
+		}
+	}
+	return ""
+}
+
+var (
+	rolePoliciesLock    sync.Mutex
+	rolePoliciesVersion string
+)
+
+// ReloadRolePolicies 从数据库加载所有自定义角色并更新 rbac 策略，角色权限没有变化时不重复加载
+func ReloadRolePolicies(tx *db.Session) error {
+	roles := make([]models.Role, 0)
+	if err := tx.Model(&models.Role{}).Order("id").Find(&roles); err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	for _, role := range roles {
+		_, _ = fmt.Fprintf(h, "%s|%s|%s\n", role.Id, role.Scope, strings.Join(role.Permissions, ","))
+	}
+	version := hex.EncodeToString(h.Sum(nil))
+
+	rolePoliciesLock.Lock()
+	defer rolePoliciesLock.Unlock()
+	if version == rolePoliciesVersion {
+		return nil
+	}
+	if err := rbac.SetCustomPolicies(rolePolicies(roles)); err != nil {
+		return err
+	}
+	rolePoliciesVersion = version
+	return nil
+}
+
+// SyncRolePolicies 定期从数据库同步自定义角色策略，保证多个 portal 实例的角色权限一致
+func SyncRolePolicies(interval time.Duration) {
+	logger := logs.Get().WithField("func", "SyncRolePolicies")
+	for {
+		if err := ReloadRolePolicies(db.Get()); err != nil {
+			logger.Errorf("reload role policies: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/rbac"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidRolePermissions(t *testing.T) {
+	assert.Nil(t, ValidRolePermissions(consts.ScopeProject, []string{"envs:deploy", "tasks:read", "variables:*"}))
+	// 组织角色不能授予项目资源的权限
+	assert.NotNil(t, ValidRolePermissions(consts.ScopeOrg, []string{"envs:deploy"}))
+	assert.NotNil(t, ValidRolePermissions(consts.ScopeProject, []string{"envs:fly"}))
+	assert.NotNil(t, ValidRolePermissions(consts.ScopeProject, []string{"envs"}))
+}
+
+func TestCustomRolePolicies(t *testing.T) {
+	deployer := models.Role{
+		Scope:       consts.ScopeProject,
+		Permissions: models.StrSlice{"envs:read", "envs:deploy", "tasks:read"},
+	}
+	deployer.Id = "role-deployer"
+	assert.NoError(t, rbac.SetCustomPolicies(rolePolicies([]models.Role{deployer})))
+
+	enforce := func(proj, obj, act string) bool {
+		ok, err := rbac.Enforce("", proj, obj, act)
+		assert.NoError(t, err)
+		return ok
+	}
+	assert.True(t, enforce("role-deployer", "envs", "deploy"))
+	assert.True(t, enforce("role-deployer", "projects", "read"))
+	assert.False(t, enforce("role-deployer", "envs", "destroy"))
+	assert.True(t, enforce(consts.ProjectRoleOperator, "envs", "destroy"))
+	assert.True(t, enforce(consts.ProjectRoleGuest, "stack_runs", "read"))
+	assert.True(t, enforce(consts.ProjectRoleOperator, "tasks", "recover"))
+	assert.False(t, enforce(consts.ProjectRoleGuest, "tasks", "recover"))
+
+	// 重新加载后旧的策略失效
+	deployer.Permissions = models.StrSlice{"envs:read"}
+	assert.NoError(t, rbac.SetCustomPolicies(rolePolicies([]models.Role{deployer})))
+	assert.False(t, enforce("role-deployer", "envs", "deploy"))
+	assert.True(t, enforce("role-deployer", "envs", "read"))
+
+	// 动作为 * 时不能获得超出内置角色的权限
+	orgAdmin := models.Role{Scope: consts.ScopeOrg, Permissions: models.StrSlice{"orgs:*"}}
+	orgAdmin.Id = "role-org-admin"
+	assert.NoError(t, rbac.SetCustomPolicies(rolePolicies([]models.Role{orgAdmin, deployer})))
+	orgEnforce := func(obj, act string) bool {
+		ok, err := rbac.Enforce("role-org-admin", "", obj, act)
+		assert.NoError(t, err)
+		return ok
+	}
+	assert.True(t, orgEnforce("orgs", "update"))
+	assert.True(t, orgEnforce("orgs", "adduser"))
+	assert.False(t, orgEnforce("orgs", "delete"))
+
+	assert.Equal(t, consts.ProjectRoleGuest, GetHighestRole("role-deployer", consts.ProjectRoleGuest))
+	assert.Equal(t, "role-deployer", GetHighestRole("role-deployer"))
+}
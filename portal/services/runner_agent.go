@@ -0,0 +1,285 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils/tunnel"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"gorm.io/gorm"
+)
+
+const (
+	RunnerAgentIdPrefix = "rag"
+	// RunnerAgentProxyPath portal 内部转发 agent 请求的接口，其他 portal 实例通过该接口访问连接在当前实例上的 agent
+	RunnerAgentProxyPath = "/api/v1/runner_agent/proxy/%s"
+	// RunnerAgentPingInterval portal 向 agent 发送 ping 并更新 last_seen_at 的间隔
+	RunnerAgentPingInterval = 30 * time.Second
+	// runnerAgentOfflineTimeout last_seen_at 超过该时长未更新的 agent 视为离线(如持有连接的 portal 实例异常退出)
+	runnerAgentOfflineTimeout = 3 * RunnerAgentPingInterval
+)
+
+// 当前 portal 实例持有的 agent 连接
+var (
+	runnerAgentSessions   = make(map[string]*tunnel.Session)
+	runnerAgentSessionsMu sync.Mutex
+)
+
+func hashRunnerSecret(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func genRunnerSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IsRunnerAgent 判断 runnerId 是否为 agent 模式的 runner
+func IsRunnerAgent(runnerId string) bool {
+	return strings.HasPrefix(runnerId, RunnerAgentIdPrefix+"-")
+}
+
+// CreateRunnerJoinToken 创建 runner agent 注册令牌，令牌明文只在创建时返回
+func CreateRunnerJoinToken(tx *db.Session, creatorId models.Id, tags []string, expire time.Duration) (
+	string, *models.RunnerJoinToken, e.Error) {
+	token, err := genRunnerSecret()
+	if err != nil {
+		return "", nil, e.New(e.InternalError, err)
+	}
+	expiredAt := models.Time(time.Now().Add(expire))
+	t := models.RunnerJoinToken{
+		TokenHash: hashRunnerSecret(token),
+		Tags:      tags,
+		CreatorId: creatorId,
+		ExpiredAt: &expiredAt,
+	}
+	t.Id = models.NewId("rjt")
+	if err := models.Create(tx, &t); err != nil {
+		return "", nil, e.New(e.DBError, err)
+	}
+	return token, &t, nil
+}
+
+// JoinRunnerAgent 使用注册令牌注册 runner agent，返回 agent 信息及 agent 连接 portal 使用的密钥
+func JoinRunnerAgent(tx *db.Session, token string, name string) (*models.RunnerAgent, string, e.Error) {
+	t := models.RunnerJoinToken{}
+	if err := tx.Where("token_hash = ?", hashRunnerSecret(token)).First(&t); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, "", e.New(e.RunnerJoinTokenInvalid, http.StatusUnauthorized)
+		}
+		return nil, "", e.New(e.DBError, err)
+	}
+	if t.UsedAt != nil || (t.ExpiredAt != nil && time.Now().After(time.Time(*t.ExpiredAt))) {
+		return nil, "", e.New(e.RunnerJoinTokenInvalid, http.StatusUnauthorized)
+	}
+
+	secret, err := genRunnerSecret()
+	if err != nil {
+		return nil, "", e.New(e.InternalError, err)
+	}
+	agent := models.RunnerAgent{
+		Name:       name,
+		Tags:       t.Tags,
+		SecretHash: hashRunnerSecret(secret),
+		Status:     models.RunnerAgentOffline,
+	}
+	agent.Id = models.NewId(RunnerAgentIdPrefix)
+
+	// 令牌只能使用一次，通过 used_at 条件更新避免并发注册
+	now := models.Time(time.Now())
+	if n, err := tx.Model(&models.RunnerJoinToken{}).Where("id = ? AND used_at IS NULL", t.Id).
+		UpdateAttrs(models.Attrs{"used_at": &now, "runner_id": agent.Id}); err != nil {
+		return nil, "", e.New(e.DBError, err)
+	} else if n == 0 {
+		return nil, "", e.New(e.RunnerJoinTokenInvalid, http.StatusUnauthorized)
+	}
+	if err := models.Create(tx, &agent); err != nil {
+		return nil, "", e.New(e.DBError, err)
+	}
+	return &agent, secret, nil
+}
+
+// AuthRunnerAgent 校验 agent 连接使用的密钥
+func AuthRunnerAgent(tx *db.Session, runnerId string, secret string) (*models.RunnerAgent, e.Error) {
+	agent, er := GetRunnerAgent(tx, models.Id(runnerId))
+	if er != nil {
+		if er.Code() == e.RunnerAgentNotExist {
+			return nil, e.New(e.RunnerAgentAuthFailed, http.StatusUnauthorized)
+		}
+		return nil, er
+	}
+	if secret == "" || agent.SecretHash != hashRunnerSecret(secret) {
+		return nil, e.New(e.RunnerAgentAuthFailed, http.StatusUnauthorized)
+	}
+	return agent, nil
+}
+
+func GetRunnerAgent(tx *db.Session, id models.Id) (*models.RunnerAgent, e.Error) {
+	agent := models.RunnerAgent{}
+	if err := tx.Where("id = ?", id).First(&agent); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.RunnerAgentNotExist, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &agent, nil
+}
+
+func SearchRunnerAgent(query *db.Session, q string) *db.Session {
+	query = query.Model(&models.RunnerAgent{})
+	if q != "" {
+		query = query.WhereLike("name", q)
+	}
+	return query.Order("created_at DESC")
+}
+
+func DeleteRunnerAgent(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.RunnerAgent{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	CloseRunnerAgentSession(id.String())
+	return nil
+}
+
+func UpdateRunnerAgentTags(tx *db.Session, id models.Id, tags []string) e.Error {
+	if _, er := GetRunnerAgent(tx, id); er != nil {
+		return er
+	}
+	if _, err := tx.Model(&models.RunnerAgent{}).Where("id = ?", id).
+		UpdateAttrs(models.Attrs{"tags": models.StrSlice(tags)}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// UpdateRunnerAgentStatus 更新 agent 在线状态，agent 上线时记录持有连接的 portal 实例地址
+func UpdateRunnerAgentStatus(tx *db.Session, runnerId string, status string, attrs models.Attrs) e.Error {
+	if attrs == nil {
+		attrs = models.Attrs{}
+	}
+	attrs["status"] = status
+	attrs["last_seen_at"] = gorm.Expr("NOW()")
+	query := tx.Model(&models.RunnerAgent{}).Where("id = ?", runnerId)
+	if status == models.RunnerAgentOffline {
+		// agent 可能已重新连接到其他 portal 实例，只更新由当前实例持有的连接状态
+		query = query.Where("portal_addr = ?", PortalInternalAddr())
+	} else {
+		attrs["portal_addr"] = PortalInternalAddr()
+	}
+	if _, err := query.UpdateAttrs(attrs); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// TouchRunnerAgent 更新 agent 最后活跃时间，使用数据库时间避免各 portal 实例时钟不一致
+func TouchRunnerAgent(tx *db.Session, runnerId string) e.Error {
+	if _, err := tx.Model(&models.RunnerAgent{}).
+		Where("id = ? AND portal_addr = ?", runnerId, PortalInternalAddr()).
+		UpdateAttrs(models.Attrs{"last_seen_at": gorm.Expr("NOW()")}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// RegisterRunnerAgentSession 保存 agent 连接，agent 重复连接时关闭旧的连接
+func RegisterRunnerAgentSession(runnerId string, sess *tunnel.Session) {
+	runnerAgentSessionsMu.Lock()
+	old := runnerAgentSessions[runnerId]
+	runnerAgentSessions[runnerId] = sess
+	runnerAgentSessionsMu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+}
+
+// UnregisterRunnerAgentSession 删除 agent 连接，返回 false 表示该连接已被新的连接替换
+func UnregisterRunnerAgentSession(runnerId string, sess *tunnel.Session) bool {
+	runnerAgentSessionsMu.Lock()
+	defer runnerAgentSessionsMu.Unlock()
+	if runnerAgentSessions[runnerId] != sess {
+		return false
+	}
+	delete(runnerAgentSessions, runnerId)
+	return true
+}
+
+func GetRunnerAgentSession(runnerId string) *tunnel.Session {
+	runnerAgentSessionsMu.Lock()
+	defer runnerAgentSessionsMu.Unlock()
+	return runnerAgentSessions[runnerId]
+}
+
+func CloseRunnerAgentSession(runnerId string) {
+	if sess := GetRunnerAgentSession(runnerId); sess != nil {
+		sess.Close()
+	}
+}
+
+// PortalInternalAddr 当前 portal 实例的内部访问地址，用于 portal 实例间转发 agent 请求
+func PortalInternalAddr() string {
+	return configs.Get().PortalInternalAddr()
+}
+
+// GetRunnerAgentAddress 获取访问 agent 的地址，请求会通过持有 agent 连接的 portal 实例转发
+func GetRunnerAgentAddress(runnerId string) (string, error) {
+	agent := models.RunnerAgent{}
+	if err := queryOnlineRunnerAgents(db.Get()).Where("id = ?", runnerId).First(&agent); err != nil {
+		if e.IsRecordNotFound(err) {
+			return "", e.New(e.RunnerAgentNotConnected, fmt.Errorf("runner agent %s is offline", runnerId))
+		}
+		return "", e.New(e.DBError, err)
+	}
+	if agent.PortalAddr == "" {
+		return "", e.New(e.RunnerAgentNotConnected, fmt.Errorf("runner agent %s is offline", runnerId))
+	}
+	return strings.TrimSuffix(agent.PortalAddr, "/") + fmt.Sprintf(RunnerAgentProxyPath, runnerId), nil
+}
+
+// queryOnlineRunnerAgents 查询在线的 agent，status 为 online 但 last_seen_at 超时未更新的 agent 视为离线
+func queryOnlineRunnerAgents(tx *db.Session) *db.Session {
+	return tx.Model(&models.RunnerAgent{}).Where("status = ? AND last_seen_at > DATE_SUB(NOW(), INTERVAL ? SECOND)",
+		models.RunnerAgentOnline, int64(runnerAgentOfflineTimeout/time.Second))
+}
+
+// onlineRunnerAgents 查询在线的 agent，返回与 consul 注册的 runner 相同的结构
+func onlineRunnerAgents(tx *db.Session) ([]*api.AgentService, e.Error) {
+	agents := make([]models.RunnerAgent, 0)
+	if err := queryOnlineRunnerAgents(tx).Order("id").Find(&agents); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	services := make([]*api.AgentService, 0, len(agents))
+	for _, a := range agents {
+		meta := map[string]string{"mode": "agent"}
+		if a.Slots > 0 {
+			meta[common.RunnerMetaSlots] = strconv.Itoa(a.Slots)
+		}
+		services = append(services, &api.AgentService{
+			ID:      a.Id.String(),
+			Service: common.RunnerServiceName,
+			Tags:    a.Tags,
+			Meta:    meta,
+		})
+	}
+	return services, nil
+}
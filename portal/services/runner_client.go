@@ -0,0 +1,36 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/utils"
+	"cloudiac/utils/runnerauth"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+/*
+portal 调用 runner api 的客户端，所有请求都会使用 runnerApiSecret 签名，runner 会拒绝未签名的请求
+*/
+
+// RunnerPost 向 runner 发送签名的 json POST 请求
+func RunnerPost(runnerAddr string, urlPath string, data interface{}, connTimeout, deadline int) ([]byte, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	header := runnerauth.SignHeader(configs.Get().RunnerApiSecret, http.MethodPost, urlPath, "", body)
+	header.Set("Content-Type", "application/json")
+	return utils.HttpService(utils.JoinURL(runnerAddr, urlPath), http.MethodPost, &header, body, connTimeout, deadline)
+}
+
+// RunnerWebsocketDial 与 runner 建立签名的 websocket 连接
+func RunnerWebsocketDial(runnerAddr string, urlPath string, params url.Values) (*websocket.Conn, *http.Response, error) {
+	header := runnerauth.SignHeader(configs.Get().RunnerApiSecret, http.MethodGet, urlPath, params.Encode(), nil)
+	return utils.WebsocketDailWithHeader(runnerAddr, urlPath, params, header)
+}
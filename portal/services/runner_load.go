@@ -0,0 +1,43 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// RunnerSlots 获取 runner 可同时执行的任务数量，runner 未上报时使用系统设置的 MAX_JOBS_PER_RUNNER
+func RunnerSlots(runner *api.AgentService) int {
+	if n := utils.Str2int(runner.Meta[common.RunnerMetaSlots]); n > 0 {
+		return n
+	}
+	return GetRunnerMax()
+}
+
+// GetRunnerLoads 统计每个 runner 当前正在执行的任务数量，等待审批的任务不占用 runner 的并发任务数
+func GetRunnerLoads(sess *db.Session) (map[string]int, e.Error) {
+	loads := make(map[string]int)
+	statuses := []string{models.TaskRunning}
+	for _, query := range []*db.Session{
+		sess.Model(&models.Task{}).Where("status IN (?)", statuses),
+		sess.Model(&models.ScanTask{}).Where("status IN (?) AND mirror = 0", statuses),
+	} {
+		rows := make([]struct {
+			RunnerId string
+			Cnt      int
+		}, 0)
+		if err := query.Select("runner_id, COUNT(*) AS cnt").Group("runner_id").Scan(&rows); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		for _, r := range rows {
+			loads[r.RunnerId] += r.Cnt
+		}
+	}
+	return loads, nil
+}
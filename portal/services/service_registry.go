@@ -0,0 +1,242 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+/*
+基于数据库的服务注册中心
+
+配置 service_registry: db 后 portal 与 runner 不再依赖 consul:
+portal 实例定时将自身信息写入 iac_service_instance 表，runner 通过 portal 的心跳接口上报，
+服务的健康状态由最后一次心跳的时间判断，超过 ServiceHeartbeatTTL 未上报心跳视为异常。
+*/
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils/logs"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"gorm.io/gorm"
+)
+
+const (
+	ServiceHeartbeatInterval = time.Duration(common.ServiceHeartbeatInterval) * time.Second
+	ServiceHeartbeatTTL      = 3 * ServiceHeartbeatInterval
+	// ServiceDeregisterAfter 超过该时间未上报心跳的服务不再展示
+	ServiceDeregisterAfter = 24 * time.Hour
+)
+
+// dbNow 返回数据库的当前时间，心跳时间的写入及判断都使用数据库时间，避免各实例的时钟偏差
+func dbNow(tx *db.Session) (time.Time, error) {
+	now := time.Time{}
+	err := tx.Raw("SELECT NOW()").Scan(&now)
+	return now, err
+}
+
+func serviceInstanceHealthy(s *models.ServiceInstance, now time.Time) bool {
+	return now.Sub(time.Time(s.LastHeartbeatAt)) < ServiceHeartbeatTTL
+}
+
+// ServiceHeartbeat 上报服务心跳，服务不存在时注册服务。
+// 服务已存在时不更新 tags，以保留通过 api 修改的 tags
+func ServiceHeartbeat(tx *db.Session, s *models.ServiceInstance) e.Error {
+	n, err := tx.Model(&models.ServiceInstance{}).Where("id = ?", s.Id).UpdateAttrs(models.Attrs{
+		"service":           s.Service,
+		"address":           s.Address,
+		"port":              s.Port,
+		"slots":             s.Slots,
+		"version":           s.Version,
+		"last_heartbeat_at": gorm.Expr("NOW()"),
+	})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n > 0 {
+		return nil
+	}
+
+	now, err := dbNow(tx)
+	if err != nil {
+		return e.New(e.DBError, err)
+	}
+	s.LastHeartbeatAt = models.Time(now)
+	if err := models.Create(tx, s); err != nil && !e.IsDuplicate(err) {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// ServiceKeepAlive 定时上报当前 portal 实例的心跳，直到 ctx 结束
+func ServiceKeepAlive(ctx context.Context, serviceName string) {
+	logger := logs.Get().WithField("func", "ServiceKeepAlive")
+	conf := configs.Get().Consul
+
+	ticker := time.NewTicker(ServiceHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		s := &models.ServiceInstance{
+			Service: serviceName,
+			Address: conf.ServiceIP,
+			Port:    conf.ServicePort,
+			Version: common.VERSION,
+		}
+		s.Id = models.Id(conf.ServiceID)
+		if conf.ServiceTags != "" {
+			s.Tags = strings.Split(conf.ServiceTags, ";")
+		}
+		if er := ServiceHeartbeat(db.Get(), s); er != nil {
+			logger.Warnf("service heartbeat: %v", er)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// registeredServices 查询注册的服务，name 为空时查询所有服务
+func registeredServices(tx *db.Session, name string) ([]models.ServiceInstance, e.Error) {
+	query := tx.Model(&models.ServiceInstance{}).
+		Where("last_heartbeat_at > DATE_SUB(NOW(), INTERVAL ? SECOND)", int64(ServiceDeregisterAfter/time.Second))
+	if name != "" {
+		query = query.Where("service = ?", name)
+	}
+
+	services := make([]models.ServiceInstance, 0)
+	if err := query.Order("service, id").Find(&services); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return services, nil
+}
+
+func serviceInstanceToAgentService(s *models.ServiceInstance) *api.AgentService {
+	as := &api.AgentService{
+		ID:      s.Id.String(),
+		Service: s.Service,
+		Tags:    s.Tags,
+		Address: s.Address,
+		Port:    s.Port,
+	}
+	if s.Slots > 0 {
+		as.Meta = map[string]string{common.RunnerMetaSlots: strconv.Itoa(s.Slots)}
+	}
+	return as
+}
+
+func getServiceInstance(tx *db.Session, serviceId string) (*models.ServiceInstance, e.Error) {
+	s := models.ServiceInstance{}
+	if err := tx.Where("id = ?", serviceId).First(&s); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ObjectNotExists, fmt.Errorf("service %s not exists", serviceId), http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &s, nil
+}
+
+func dbSystemStatusSearch() ([]api.AgentService, map[string]api.AgentCheck, []string, e.Error) {
+	services, er := registeredServices(db.Get(), "")
+	if er != nil {
+		return nil, nil, nil, er
+	}
+	now, err := dbNow(db.Get())
+	if err != nil {
+		return nil, nil, nil, e.New(e.DBError, err)
+	}
+
+	serviceList := make([]string, 0)
+	IdInfo := make([]api.AgentService, 0, len(services))
+	serviceStatus := make(map[string]api.AgentCheck)
+	for i := range services {
+		s := &services[i]
+		serviceList = append(serviceList, s.Service)
+		IdInfo = append(IdInfo, *serviceInstanceToAgentService(s))
+
+		status := api.HealthPassing
+		if !serviceInstanceHealthy(s, now) {
+			status = api.HealthCritical
+		}
+		serviceStatus[s.Id.String()] = api.AgentCheck{
+			ServiceID: s.Id.String(),
+			Status:    status,
+			Output:    fmt.Sprintf("last heartbeat at %s", time.Time(s.LastHeartbeatAt).Format("2006-01-02 15:04:05")),
+		}
+	}
+	return IdInfo, serviceStatus, serviceList, nil
+}
+
+func dbRunnerSearch() ([]*api.AgentService, e.Error) {
+	services, er := registeredServices(db.Get(), common.RunnerServiceName)
+	if er != nil {
+		return nil, er
+	}
+	now, err := dbNow(db.Get())
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	resp := make([]*api.AgentService, 0, len(services))
+	for i := range services {
+		if serviceInstanceHealthy(&services[i], now) {
+			resp = append(resp, serviceInstanceToAgentService(&services[i]))
+		}
+	}
+	return resp, nil
+}
+
+func dbRunnerTags() ([]string, e.Error) {
+	services, er := registeredServices(db.Get(), common.RunnerServiceName)
+	if er != nil {
+		return nil, er
+	}
+
+	tags := make([]string, 0)
+	for _, s := range services {
+		tags = append(tags, s.Tags...)
+	}
+	return tags, nil
+}
+
+// dbServiceTags 返回 json 格式的服务 tags，与 consul kv 中保存的格式一致
+func dbServiceTags(serviceId string) (interface{}, e.Error) {
+	s, er := getServiceInstance(db.Get(), serviceId)
+	if er != nil {
+		if er.Code() == e.ObjectNotExists {
+			return nil, nil
+		}
+		return nil, er
+	}
+	b, _ := json.Marshal(s.Tags)
+	return string(b), nil
+}
+
+// UpdateServiceTags 修改注册中心中保存的服务 tags
+func UpdateServiceTags(tx *db.Session, serviceId string, tags []string) e.Error {
+	if _, er := getServiceInstance(tx, serviceId); er != nil {
+		return er
+	}
+	if _, err := tx.Model(&models.ServiceInstance{}).Where("id = ?", serviceId).
+		UpdateAttrs(models.Attrs{"tags": models.StrSlice(tags)}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+func dbServiceAddress(serviceId string) (string, error) {
+	s, er := getServiceInstance(db.Get(), serviceId)
+	if er != nil {
+		return "", er
+	}
+	return fmt.Sprintf("http://%s:%d", s.Address, s.Port), nil
+}
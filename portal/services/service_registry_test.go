@@ -0,0 +1,40 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceInstanceHealthy(t *testing.T) {
+	now := time.Now()
+	s := &models.ServiceInstance{LastHeartbeatAt: models.Time(now.Add(-ServiceHeartbeatInterval))}
+	assert.True(t, serviceInstanceHealthy(s, now))
+
+	s.LastHeartbeatAt = models.Time(now.Add(-ServiceHeartbeatTTL - time.Second))
+	assert.False(t, serviceInstanceHealthy(s, now))
+}
+
+func TestServiceInstanceToAgentService(t *testing.T) {
+	s := &models.ServiceInstance{
+		Service: common.RunnerServiceName,
+		Address: "10.0.0.1",
+		Port:    19030,
+		Tags:    []string{"aws"},
+		Slots:   4,
+	}
+	s.Id = "ct-runner-01"
+
+	as := serviceInstanceToAgentService(s)
+	assert.Equal(t, "ct-runner-01", as.ID)
+	assert.Equal(t, []string{"aws"}, as.Tags)
+	assert.Equal(t, 4, RunnerSlots(as))
+
+	s.Slots = 0
+	assert.Nil(t, serviceInstanceToAgentService(s).Meta)
+}
@@ -45,7 +45,8 @@ func VerifySsoToken(tx *db.Session, tokenStr string) (*models.User, e.Error) {
 	}
 
 	// get user info from db
-	if claims, ok := token.Claims.(*SsoTokenClaims); ok && token.Valid {
+	// 只接受 sso token，避免其他携带 userId 的 token(如多因素认证的临时 token)被当作 sso token 使用
+	if claims, ok := token.Claims.(*SsoTokenClaims); ok && token.Valid && claims.Subject == consts.JwtSubjectSsoCode {
 		// 根据用户ID获取用户信息
 		var user = models.User{}
 		if err = tx.Where("id = ?", claims.UserId).First(&user); err != nil {
@@ -0,0 +1,372 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StackRunOrder 计算批量编排中环境的执行顺序及每个环境需要等待的环境
+// 依赖关系基于项目的环境依赖图，只保留编排内的环境(间接依赖也会被保留)，销毁时使用反向依赖图
+func StackRunOrder(g EnvGraph, envIds []models.Id) (order []models.Id, deps map[models.Id][]models.Id, err error) {
+	selected := make(map[models.Id]bool)
+	for _, id := range envIds {
+		selected[id] = true
+	}
+
+	deps = make(map[models.Id][]models.Id)
+	added := make(map[models.Id]bool)
+	for _, id := range envIds {
+		reachable, err := g.TopoSort(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		// TopoSort 返回的结果中每个环境都排在其依赖之后，按该顺序加入即可保证依赖先执行
+		for _, r := range reachable {
+			if !selected[r] {
+				continue
+			}
+			if r != id {
+				deps[id] = append(deps[id], r)
+			}
+			if !added[r] {
+				added[r] = true
+				order = append(order, r)
+			}
+		}
+	}
+	return order, deps, nil
+}
+
+// CreateStackRun 创建批量编排，按执行顺序为每个环境创建任务
+func CreateStackRun(tx *db.Session, run *models.StackRun, envs []*models.Env) ([]models.StackRunTask, e.Error) {
+	if len(envs) == 0 {
+		return nil, e.New(e.StackRunEnvInvalid, fmt.Errorf("no env selected"))
+	}
+
+	envMap := make(map[models.Id]*models.Env)
+	envIds := make([]models.Id, 0, len(envs))
+	for _, env := range envs {
+		if _, ok := envMap[env.Id]; ok {
+			continue
+		}
+		if env.ProjectId != run.ProjectId {
+			return nil, e.New(e.StackRunEnvInvalid, fmt.Errorf("env '%s' not exists in project", env.Id))
+		}
+		if env.Archived || env.Locked {
+			return nil, e.New(e.StackRunEnvInvalid, fmt.Errorf("env '%s' is archived or locked", env.Name))
+		}
+		if run.TaskType == models.TaskTypeDestroy {
+			if er := CheckEnvDestroyPerm(tx, env, run.CreatorId, UserIsSuperAdmin(tx, run.CreatorId)); er != nil {
+				return nil, e.New(er.Code(), fmt.Errorf("env '%s' is protected", env.Name), http.StatusForbidden)
+			}
+		}
+		envMap[env.Id] = env
+		envIds = append(envIds, env.Id)
+	}
+
+	g, er := GetProjectEnvGraph(tx, run.ProjectId)
+	if er != nil {
+		return nil, er
+	}
+	if run.TaskType == models.TaskTypeDestroy {
+		// 依赖被销毁环境的环境需要一起销毁
+		for _, id := range envIds {
+			dependents, er := GetEnvDependents(tx, id)
+			if er != nil {
+				return nil, er
+			}
+			names := make([]string, 0)
+			for _, d := range dependents {
+				if _, ok := envMap[d.Id]; !ok && (d.Status == models.EnvStatusActive || d.Status == models.EnvStatusFailed) {
+					names = append(names, d.Name)
+				}
+			}
+			if len(names) > 0 {
+				return nil, e.New(e.EnvHasDependents, fmt.Errorf("env '%s' is depended on by: %s",
+					envMap[id].Name, strings.Join(names, ", ")))
+			}
+		}
+		g = g.Reverse()
+	}
+	order, deps, err := StackRunOrder(g, envIds)
+	if err != nil {
+		return nil, e.New(e.EnvDependencyCycle, err)
+	}
+
+	run.Id = models.NewId("stack")
+	run.Status = models.StackRunStatusRunning
+	if err := tx.Insert(run); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	taskIds := make(map[models.Id]models.Id)
+	items := make([]models.StackRunTask, 0, len(order))
+	for _, envId := range order {
+		env := envMap[envId]
+		task, er := createEnvRunTask(tx, env, run.TaskType, run.CreatorId, consts.TaskSourceStackRun, run.AutoApprove)
+		if er != nil {
+			return nil, e.New(er.Code(), fmt.Errorf("create task of env '%s': %v", env.Name, er))
+		}
+		taskIds[envId] = task.Id
+
+		item := models.StackRunTask{
+			StackRunId: run.Id,
+			EnvId:      envId,
+			TaskId:     task.Id,
+			DependsOn:  models.StrSlice{},
+		}
+		for _, d := range deps[envId] {
+			item.DependsOn = append(item.DependsOn, taskIds[d].String())
+		}
+		if err := tx.Insert(&item); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func GetStackRunById(sess *db.Session, id models.Id) (*models.StackRun, e.Error) {
+	run := models.StackRun{}
+	if err := sess.Model(&models.StackRun{}).Where("id = ?", id).First(&run); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ObjectNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &run, nil
+}
+
+func QueryStackRuns(sess *db.Session, projectId models.Id) *db.Session {
+	return sess.Model(&models.StackRun{}).Where("project_id = ?", projectId).Order("created_at DESC")
+}
+
+func GetStackRunTasks(sess *db.Session, runId models.Id) ([]models.StackRunTask, e.Error) {
+	items := make([]models.StackRunTask, 0)
+	if err := sess.Model(&models.StackRunTask{}).Where("stack_run_id = ?", runId).
+		Order("id").Find(&items); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return items, nil
+}
+
+func GetActiveStackRuns(sess *db.Session) ([]models.StackRun, e.Error) {
+	runs := make([]models.StackRun, 0)
+	if err := sess.Model(&models.StackRun{}).Where("status IN (?)",
+		[]string{models.StackRunStatusRunning, models.StackRunStatusApproving}).Find(&runs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return runs, nil
+}
+
+// StackRunTaskReady 检查任务是否可以开始执行，批量编排中的任务需要等待其依赖的任务全部执行成功
+func StackRunTaskReady(sess *db.Session, taskId models.Id) (bool, e.Error) {
+	item := models.StackRunTask{}
+	if err := sess.Model(&models.StackRunTask{}).Where("task_id = ?", taskId).First(&item); err != nil {
+		if e.IsRecordNotFound(err) {
+			return true, nil
+		}
+		return false, e.New(e.DBError, err)
+	}
+	if len(item.DependsOn) == 0 {
+		return true, nil
+	}
+
+	n, err := sess.Model(&models.Task{}).
+		Where("id IN (?) AND status != ?", []string(item.DependsOn), models.TaskComplete).Count()
+	if err != nil {
+		return false, e.New(e.DBError, err)
+	}
+	return n == 0, nil
+}
+
+// ApproveStackRun 审批批量编排，审批结果会在推进编排时应用到编排中的所有任务
+func ApproveStackRun(tx *db.Session, run *models.StackRun, action string, userId models.Id) e.Error {
+	if run.Status != models.StackRunStatusApproving || run.ApprovalStatus != "" {
+		return e.New(e.StackRunNotApproving)
+	}
+
+	now := models.Time(time.Now())
+	run.ApprovalStatus = action
+	run.ApproverId = userId
+	run.ApprovalAt = &now
+	if _, err := tx.Model(&models.StackRun{}).Where("id = ?", run.Id).UpdateAttrs(models.Attrs{
+		"approval_status": run.ApprovalStatus,
+		"approver_id":     run.ApproverId,
+		"approval_at":     run.ApprovalAt,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return AdvanceStackRun(tx, run)
+}
+
+// AdvanceStackRun 推进批量编排:
+// 1. 中止因依赖任务失败(或 failFast 模式下有任务失败)而无法执行的任务
+// 2. 根据编排的审批结果审批处于待审批状态的任务
+// 3. 根据所有任务的状态更新编排的状态
+// 任务的启动由 task manager 完成，启动前会通过 StackRunTaskReady 检查依赖的任务是否已执行成功
+func AdvanceStackRun(tx *db.Session, run *models.StackRun) e.Error { //nolint:cyclop
+	if run.Exited() {
+		return nil
+	}
+
+	items, er := GetStackRunTasks(tx, run.Id)
+	if er != nil {
+		return er
+	}
+	taskIds := make([]models.Id, 0, len(items))
+	for _, item := range items {
+		taskIds = append(taskIds, item.TaskId)
+	}
+	tasks := make([]*models.Task, 0, len(items))
+	if err := tx.Model(&models.Task{}).Where("id IN (?)", taskIds).Find(&tasks); err != nil {
+		return e.New(e.DBError, err)
+	}
+	taskMap := make(map[string]*models.Task)
+	for _, t := range tasks {
+		taskMap[t.Id.String()] = t
+	}
+
+	failed := func(t *models.Task) bool {
+		return t != nil && t.Exited() && t.Status != models.TaskComplete
+	}
+	hasFailed := func() bool {
+		for _, t := range taskMap {
+			if failed(t) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 中止的任务可能导致依赖它的任务也需要中止，循环处理直到没有新的任务被中止
+	for changed := true; changed; {
+		changed = false
+		for _, item := range items {
+			task := taskMap[item.TaskId.String()]
+			if task == nil || task.Status != models.TaskPending {
+				continue
+			}
+
+			reason := ""
+			if run.ApprovalStatus == models.StackRunApprovalRejected {
+				reason = "stack run rejected"
+			} else if run.Mode == models.StackRunModeFailFast && hasFailed() {
+				reason = "stack run failed"
+			} else {
+				for _, dep := range item.DependsOn {
+					if dt := taskMap[dep]; failed(dt) {
+						reason = fmt.Sprintf("dependency task %s %s", dt.Id, dt.Status)
+						break
+					}
+				}
+			}
+			if reason == "" {
+				continue
+			}
+
+			if _, err := tx.Model(&models.Task{}).Where("id = ? AND status = ?", task.Id, models.TaskPending).
+				UpdateAttrs(models.Attrs{"status": models.TaskAborted, "message": reason}); err != nil {
+				return e.New(e.DBError, err)
+			}
+			task.Status = models.TaskAborted
+			task.Message = reason
+			changed = true
+		}
+	}
+
+	if run.ApprovalStatus != "" {
+		for _, task := range tasks {
+			if task.Status != models.TaskApproving || task.Aborting {
+				continue
+			}
+			step, er := GetTaskStep(tx, task.Id, task.CurrStep)
+			if er != nil {
+				return er
+			}
+			if step.Status != models.TaskStepApproving || step.ApproverId != "" {
+				continue
+			}
+			if run.ApprovalStatus == models.StackRunApprovalApproved {
+				// 任务需要满足审批规则，不满足时任务保持待审批状态，需要单独审批
+				var done bool
+				done, er = VoteTaskStep(tx, task, step, run.ApproverId, models.TaskApprovalApproved, "")
+				if er != nil && (er.Code() == e.EnvApproverRequired || er.Code() == e.TaskAlreadyVoted ||
+					er.Code() == e.TaskSelfApprovalDenied || er.Code() == e.TaskApproverNotEligible) {
+					continue
+				} else if done {
+					task.Status = models.TaskRunning
+				}
+			} else {
+				er = RejectTaskStep(tx, task.Id, step.Index, run.ApproverId)
+				task.Status = models.TaskRejected
+			}
+			if er != nil {
+				return er
+			}
+		}
+	}
+
+	var (
+		exited    = true
+		approving = false
+		failedNum = 0
+	)
+	for _, task := range tasks {
+		if !task.Exited() {
+			exited = false
+		}
+		if task.Status == models.TaskApproving {
+			approving = true
+		}
+		if failed(task) {
+			failedNum += 1
+		}
+	}
+
+	switch {
+	case exited && run.ApprovalStatus == models.StackRunApprovalRejected:
+		return finishStackRun(tx, run, models.StackRunStatusRejected, "")
+	case exited && failedNum > 0:
+		return finishStackRun(tx, run, models.StackRunStatusFailed,
+			fmt.Sprintf("%d of %d tasks failed", failedNum, len(tasks)))
+	case exited:
+		return finishStackRun(tx, run, models.StackRunStatusComplete, "")
+	case approving && run.ApprovalStatus == "":
+		return updateStackRunStatus(tx, run, models.StackRunStatusApproving)
+	default:
+		return updateStackRunStatus(tx, run, models.StackRunStatusRunning)
+	}
+}
+
+func updateStackRunStatus(tx *db.Session, run *models.StackRun, status string) e.Error {
+	if run.Status == status {
+		return nil
+	}
+	run.Status = status
+	if _, err := tx.Model(&models.StackRun{}).Where("id = ?", run.Id).
+		UpdateColumn("status", status); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+func finishStackRun(tx *db.Session, run *models.StackRun, status string, message string) e.Error {
+	now := models.Time(time.Now())
+	run.Status = status
+	run.Message = message
+	run.EndAt = &now
+	if _, err := tx.Model(&models.StackRun{}).Where("id = ?", run.Id).
+		UpdateAttrs(models.Attrs{"status": status, "message": message, "end_at": run.EndAt}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package statebackend
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"cloudiac/utils"
+	"fmt"
+)
+
+/*
+terraform state 存储后端
+
+环境的 state 存储位置由 Env.StateBackend + Env.StatePath 决定，
+环境创建时 backend 按 "环境指定 > 组织默认 > 系统配置 > consul" 的优先级确定并保存到环境上
+(使用数据库作为注册中心时不依赖 consul，默认使用 portal 托管的 http backend)，
+之后修改组织或系统的默认值不会影响已有环境，已有环境需要通过 state 迁移切换 backend。
+*/
+
+// Backend terraform state 存储后端
+type Backend interface {
+	Type() string
+
+	// StateStore 生成 runner 执行任务时使用的 terraform backend 配置
+	StateStore(statePath string) runner.StateStore
+
+	// Read 读取 state 内容，state 不存在时返回 os.ErrNotExist
+	Read(statePath string) ([]byte, error)
+	Write(statePath string, content []byte) error
+}
+
+func IsValid(typ string) bool {
+	return utils.StrInArray(typ, common.StateBackends...)
+}
+
+// Resolve 按优先级返回环境应该使用的 backend 类型
+func Resolve(envBackend string, orgBackend string) string {
+	for _, typ := range []string{envBackend, orgBackend, configs.Get().StateBackend.Type} {
+		if typ != "" {
+			return typ
+		}
+	}
+	if configs.Get().UseDBRegistry() {
+		return common.StateBackendHttp
+	}
+	return common.StateBackendConsul
+}
+
+func Get(typ string) (Backend, error) {
+	conf := configs.Get().StateBackend
+	switch typ {
+	case "", common.StateBackendConsul:
+		return &consulBackend{}, nil
+	case common.StateBackendS3:
+		return &s3Backend{conf: conf.S3}, nil
+	case common.StateBackendHttp:
+		return &httpBackend{conf: conf.Http}, nil
+	case common.StateBackendPg:
+		return &pgBackend{conf: conf.Pg}, nil
+	default:
+		return nil, fmt.Errorf("unknown state backend '%s'", typ)
+	}
+}
+
+// TaskStateStore 返回任务执行时使用的环境 state 配置，
+// 使用 portal 内置 http backend 时会为任务签发访问该环境 state 的凭证
+func TaskStateStore(env *models.Env, taskId models.Id) (runner.StateStore, error) {
+	b, err := Get(env.StateBackend)
+	if err != nil {
+		return runner.StateStore{}, err
+	}
+
+	store := b.StateStore(env.StatePath)
+	if hb, ok := b.(*httpBackend); ok && hb.hosted() {
+		token, err := GenerateStateToken(env.Id, taskId)
+		if err != nil {
+			return runner.StateStore{}, err
+		}
+		store.Config["username"] = StateTokenUser
+		store.Config["password"] = token
+	}
+	return store, nil
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package statebackend
+
+import (
+	"cloudiac/configs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	configs.Set(&configs.Config{})
+	assert.Equal(t, "consul", Resolve("", ""))
+	assert.Equal(t, "s3", Resolve("", "s3"))
+	assert.Equal(t, "pg", Resolve("pg", "s3"))
+
+	configs.Set(&configs.Config{ServiceRegistry: configs.ServiceRegistryDB})
+	assert.Equal(t, "http", Resolve("", ""))
+
+	configs.Set(&configs.Config{StateBackend: configs.StateBackendConfig{Type: "http"}})
+	assert.Equal(t, "http", Resolve("", ""))
+	assert.Equal(t, "s3", Resolve("", "s3"))
+}
+
+func TestPgSchemaName(t *testing.T) {
+	b := pgBackend{}
+	assert.Equal(t, "iac_env_c3ek0co6n88ldvq1n6ag",
+		b.schemaName("org-c3ek0co6n88ldvq1n6a0/p-c3ek0co6n88ldvq1n6a1/env-c3ek0co6n88ldvq1n6ag/terraform.tfstate"))
+	assert.LessOrEqual(t, len(b.schemaName(strings.Repeat("a", 100)+"/terraform.tfstate")), pgSchemaMaxLen)
+}
+
+func TestHttpStateStore(t *testing.T) {
+	b := httpBackend{conf: configs.HttpStateConfig{Address: "http://portal.example.com/state/"}}
+	store := b.StateStore("org/project/env/terraform.tfstate")
+	assert.Equal(t, "http", store.Backend)
+	assert.Equal(t, "http://portal.example.com/state/org/project/env/terraform.tfstate", store.Config["address"])
+	assert.Equal(t, store.Config["address"], store.Config["lock_address"])
+	assert.NotContains(t, store.Config, "username")
+}
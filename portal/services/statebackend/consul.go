@@ -0,0 +1,67 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package statebackend
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/runner"
+	"cloudiac/utils/consulClient"
+	"os"
+	"path"
+
+	"github.com/hashicorp/consul/api"
+)
+
+type consulBackend struct{}
+
+func (consulBackend) Type() string {
+	return common.StateBackendConsul
+}
+
+func (consulBackend) StateStore(statePath string) runner.StateStore {
+	conf := configs.Get().Consul
+	stateStore := runner.StateStore{
+		Backend: common.StateBackendConsul,
+		Scheme:  "http",
+		Path:    statePath,
+		Address: "", // 由 runner 自动设置
+	}
+
+	if conf.ConsulAcl {
+		stateStore.ConsulAcl = conf.ConsulAcl
+		stateStore.ConsulToken = conf.ConsulAclToken
+	}
+
+	if conf.ConsulTls {
+		stateStore.ConsulTls = conf.ConsulTls
+		stateStore.CaPath = path.Join(common.ConsulContainerPath, common.ConsulCa)
+		stateStore.CakeyPath = path.Join(common.ConsulContainerPath, common.ConsulCakey)
+		stateStore.CapemPath = path.Join(common.ConsulContainerPath, common.ConsulCapem)
+	}
+	return stateStore
+}
+
+func (consulBackend) Read(statePath string) ([]byte, error) {
+	client, err := consulClient.NewConsulClient()
+	if err != nil {
+		return nil, err
+	}
+	pair, _, err := client.KV().Get(statePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil || len(pair.Value) == 0 {
+		return nil, os.ErrNotExist
+	}
+	return pair.Value, nil
+}
+
+func (consulBackend) Write(statePath string, content []byte) error {
+	client, err := consulClient.NewConsulClient()
+	if err != nil {
+		return err
+	}
+	_, err = client.KV().Put(&api.KVPair{Key: statePath, Value: content}, nil)
+	return err
+}
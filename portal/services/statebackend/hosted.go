@@ -0,0 +1,135 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package statebackend
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"crypto/md5" //nolint:gosec
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+/*
+portal 内置的 terraform http backend
+
+未配置外部 http backend 地址时，http backend 由 portal 提供(/api/v1/tfstate/{statePath})，
+state 保存在数据库中，每次写入生成一个新的 StateVersion，读取时返回最新版本。
+*/
+
+// IsHosted 判断该类型的 backend 是否由 portal 内置的 http backend 提供
+func IsHosted(typ string) bool {
+	return typ == common.StateBackendHttp && configs.Get().StateBackend.Http.Address == ""
+}
+
+// HostedAddress portal 内置 http backend 的服务地址
+func HostedAddress() string {
+	return fmt.Sprintf("%s/api/v1/tfstate", strings.TrimSuffix(configs.Get().Portal.Address, "/"))
+}
+
+type stateMeta struct {
+	Serial  int    `json:"serial"`
+	Lineage string `json:"lineage"`
+}
+
+// ParseStateMeta 解析 state 文件中的 serial 和 lineage
+func ParseStateMeta(content []byte) (serial int, lineage string, err error) {
+	meta := stateMeta{}
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return 0, "", fmt.Errorf("invalid state content: %v", err)
+	}
+	return meta.Serial, meta.Lineage, nil
+}
+
+// LatestStateVersion 返回环境最新的 state 版本，环境没有 state 时返回 os.ErrNotExist
+func LatestStateVersion(sess *db.Session, envId models.Id) (*models.StateVersion, error) {
+	version := models.StateVersion{}
+	err := sess.Where("env_id = ?", envId).Order("created_at DESC, serial DESC").First(&version)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// SaveStateVersion 保存环境 state 的新版本，内容与最新版本一致时不重复保存，直接返回最新版本
+func SaveStateVersion(sess *db.Session, env *models.Env, content []byte,
+	source string, taskId models.Id, creatorId models.Id) (*models.StateVersion, error) {
+	serial, lineage, err := ParseStateMeta(content)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := md5.Sum(content) //nolint:gosec
+	md5sum := hex.EncodeToString(sum[:])
+
+	latest, err := LatestStateVersion(sess, env.Id)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if latest != nil && latest.Md5 == md5sum {
+		return latest, nil
+	}
+
+	version := models.StateVersion{
+		OrgId:     env.OrgId,
+		ProjectId: env.ProjectId,
+		EnvId:     env.Id,
+		TaskId:    taskId,
+		CreatorId: creatorId,
+		Source:    source,
+		Serial:    serial,
+		Lineage:   lineage,
+		Md5:       md5sum,
+		Size:      len(content),
+		Content:   content,
+	}
+	version.Id = models.NewId("sv")
+	if err := sess.Insert(&version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func getEnvByStatePath(sess *db.Session, statePath string) (*models.Env, error) {
+	env := models.Env{}
+	if err := sess.Where("state_path = ?", statePath).First(&env); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+func readHostedState(statePath string) ([]byte, error) {
+	sess := db.Get()
+	env, err := getEnvByStatePath(sess, statePath)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	version, err := LatestStateVersion(sess, env.Id)
+	if err != nil {
+		return nil, err
+	}
+	return version.Content, nil
+}
+
+func writeHostedState(statePath string, content []byte) error {
+	sess := db.Get()
+	env, err := getEnvByStatePath(sess, statePath)
+	if err != nil {
+		return err
+	}
+	_, err = SaveStateVersion(sess, env, content, models.StateVersionSourceMigrate, "", "")
+	return err
+}
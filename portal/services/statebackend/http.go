@@ -0,0 +1,110 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package statebackend
+
+import (
+	"bytes"
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/runner"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// httpBackend 使用 terraform http backend 协议保存 state
+type httpBackend struct {
+	conf configs.HttpStateConfig
+}
+
+func (b *httpBackend) hosted() bool {
+	return b.conf.Address == ""
+}
+
+func (b *httpBackend) Type() string {
+	return common.StateBackendHttp
+}
+
+func (b *httpBackend) stateAddress(statePath string) string {
+	address := b.conf.Address
+	if b.hosted() {
+		address = HostedAddress()
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(address, "/"), strings.TrimPrefix(statePath, "/"))
+}
+
+func (b *httpBackend) StateStore(statePath string) runner.StateStore {
+	address := b.stateAddress(statePath)
+	config := map[string]interface{}{
+		"address":        address,
+		"lock_address":   address,
+		"unlock_address": address,
+	}
+	// 内置 backend 的访问凭证由 TaskStateStore() 按任务签发
+	if b.conf.Username != "" {
+		config["username"] = b.conf.Username
+		config["password"] = b.conf.Password
+	}
+	return runner.StateStore{
+		Backend: common.StateBackendHttp,
+		Path:    statePath,
+		Config:  config,
+	}
+}
+
+func (b *httpBackend) do(method string, statePath string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, b.stateAddress(statePath), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if b.conf.Username != "" {
+		req.SetBasicAuth(b.conf.Username, b.conf.Password)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := http.Client{Timeout: consts.HttpClientTimeout * time.Second}
+	return client.Do(req)
+}
+
+func (b *httpBackend) Read(statePath string) ([]byte, error) {
+	if b.hosted() {
+		return readHostedState(statePath)
+	}
+
+	resp, err := b.do(http.MethodGet, statePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return ioutil.ReadAll(resp.Body)
+	case http.StatusNoContent, http.StatusNotFound:
+		return nil, os.ErrNotExist
+	default:
+		return nil, fmt.Errorf("read state: unexpected http status %s", resp.Status)
+	}
+}
+
+func (b *httpBackend) Write(statePath string, content []byte) error {
+	if b.hosted() {
+		return writeHostedState(statePath, content)
+	}
+
+	resp, err := b.do(http.MethodPost, statePath, content)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("write state: unexpected http status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package statebackend
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/runner"
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// terraform pg backend 固定使用 default workspace，每个环境使用独立的 schema
+	pgStateName    = "default"
+	pgStateTable   = "states"
+	pgSchemaMaxLen = 63
+)
+
+var pgInvalidIdentChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// pgBackend 使用 PostgreSQL 保存 state (terraform pg backend)
+type pgBackend struct {
+	conf configs.PgStateConfig
+}
+
+func (b *pgBackend) Type() string {
+	return common.StateBackendPg
+}
+
+// schemaName 基于 statePath 生成环境的 schema 名称。
+// 默认的 statePath 为 {orgId}/{projectId}/{envId}/terraform.tfstate，所以这里取 state 文件的父目录(即环境 id)
+func (b *pgBackend) schemaName(statePath string) string {
+	name := "iac_" + pgInvalidIdentChars.ReplaceAllString(strings.ToLower(path.Base(path.Dir(statePath))), "_")
+	if len(name) > pgSchemaMaxLen {
+		name = name[len(name)-pgSchemaMaxLen:]
+	}
+	return name
+}
+
+func (b *pgBackend) StateStore(statePath string) runner.StateStore {
+	return runner.StateStore{
+		Backend: common.StateBackendPg,
+		Path:    statePath,
+		Config: map[string]interface{}{
+			"conn_str":    b.conf.ConnStr,
+			"schema_name": b.schemaName(statePath),
+		},
+	}
+}
+
+func (b *pgBackend) open() (*sql.DB, error) {
+	if b.conf.ConnStr == "" {
+		return nil, fmt.Errorf("pg state backend conn_str is required")
+	}
+	return sql.Open("postgres", b.conf.ConnStr)
+}
+
+func (b *pgBackend) Read(statePath string) ([]byte, error) {
+	db, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var data string
+	query := fmt.Sprintf("SELECT data FROM %s.%s WHERE name = $1",
+		pq.QuoteIdentifier(b.schemaName(statePath)), pgStateTable)
+	if err := db.QueryRow(query, pgStateName).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, os.ErrNotExist
+		}
+		// schema 或者表不存在
+		if pqErr, ok := err.(*pq.Error); ok && (pqErr.Code == "42P01" || pqErr.Code == "3F000") {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	return []byte(data), nil
+}
+
+func (b *pgBackend) Write(statePath string, content []byte) error {
+	db, err := b.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	schema := pq.QuoteIdentifier(b.schemaName(statePath))
+	// 表结构与 terraform pg backend 创建的保持一致
+	stmts := []string{
+		fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", schema),
+		"CREATE SEQUENCE IF NOT EXISTS public.global_states_id_seq AS bigint",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+			id bigint NOT NULL DEFAULT nextval('public.global_states_id_seq') PRIMARY KEY,
+			name text UNIQUE,
+			data text)`, schema, pgStateTable),
+		fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS states_by_name ON %s.%s (name)", schema, pgStateTable),
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(fmt.Sprintf(
+		"INSERT INTO %s.%s (name, data) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET data = EXCLUDED.data",
+		schema, pgStateTable), pgStateName, string(content))
+	return err
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package statebackend
+
+import (
+	"bytes"
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/runner"
+	"cloudiac/utils/objstorage"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// s3Backend 使用 S3 兼容对象存储(aws s3、minio 等)保存 state
+type s3Backend struct {
+	conf configs.ObjectStorageConfig
+}
+
+func (b *s3Backend) Type() string {
+	return common.StateBackendS3
+}
+
+func (b *s3Backend) StateStore(statePath string) runner.StateStore {
+	scheme := "http"
+	if b.conf.UseSSL {
+		scheme = "https"
+	}
+	region := b.conf.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return runner.StateStore{
+		Backend: common.StateBackendS3,
+		Path:    statePath,
+		Config: map[string]interface{}{
+			"bucket":     b.conf.Bucket,
+			"key":        statePath,
+			"region":     region,
+			"endpoint":   fmt.Sprintf("%s://%s", scheme, b.conf.Endpoint),
+			"access_key": b.conf.AccessKey,
+			"secret_key": b.conf.SecretKey,
+			// 以下配置用于兼容 minio 等非 aws 的对象存储
+			"force_path_style":            true,
+			"skip_credentials_validation": true,
+			"skip_region_validation":      true,
+			"skip_metadata_api_check":     true,
+		},
+	}
+}
+
+func (b *s3Backend) Read(statePath string) ([]byte, error) {
+	cli, err := objstorage.NewClient(b.conf)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := cli.GetObject(context.Background(), b.conf.Bucket, statePath, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	content, err := ioutil.ReadAll(obj)
+	if err != nil {
+		if objstorage.IsNotFound(err) {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	return content, nil
+}
+
+func (b *s3Backend) Write(statePath string, content []byte) error {
+	cli, err := objstorage.NewClient(b.conf)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := objstorage.EnsureBucket(ctx, cli, b.conf); err != nil {
+		return err
+	}
+	_, err = cli.PutObject(ctx, b.conf.Bucket, statePath, bytes.NewReader(content), int64(len(content)),
+		minio.PutObjectOptions{ContentType: "application/json"})
+	return err
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package statebackend
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// StateTokenUser 任务访问 portal 内置 http backend 时使用的 basic auth 用户名，密码为 state token
+	StateTokenUser = "cloudiac"
+
+	// state token 在生成任务步骤的执行参数时签发，只需要覆盖单个步骤的执行时长
+	stateTokenExpire = 24 * time.Hour
+)
+
+// StateTokenClaims 任务访问环境 state 的凭证，只允许访问签发时指定的环境
+type StateTokenClaims struct {
+	EnvId  models.Id `json:"envId"`
+	TaskId models.Id `json:"taskId"`
+	jwt.RegisteredClaims
+}
+
+func GenerateStateToken(envId models.Id, taskId models.Id) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, StateTokenClaims{
+		EnvId:  envId,
+		TaskId: taskId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(stateTokenExpire)),
+			Subject:   consts.JwtSubjectStateAccess,
+		},
+	})
+	return token.SignedString([]byte(configs.Get().JwtSecretKey))
+}
+
+func ParseStateToken(tokenStr string) (*StateTokenClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &StateTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(configs.Get().JwtSecretKey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*StateTokenClaims)
+	if !ok || !token.Valid || claims.Subject != consts.JwtSubjectStateAccess {
+		return nil, fmt.Errorf("invalid state token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
+	"cloudiac/portal/services/stepbroker"
+	"cloudiac/utils/logs"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// stepLogSaveGrowthRatio 日志增长超过已保存内容的 1/stepLogSaveGrowthRatio 时才重新保存。
+// 存储只支持全量写入，按比例保存使长日志的总写入量与日志长度成线性关系
+const stepLogSaveGrowthRatio = 4
+
+// StepLogSaver 保存 runner 推送的执行中步骤的日志，步骤执行过程中即可从存储读取日志
+type StepLogSaver struct {
+	logPaths   map[string]string
+	savedSizes map[string]int // 已保存的日志长度
+}
+
+func NewStepLogSaver() *StepLogSaver {
+	return &StepLogSaver{logPaths: make(map[string]string), savedSizes: make(map[string]int)}
+}
+
+func (s *StepLogSaver) Save(stepLogs []stepbroker.StepLog) {
+	logger := logs.Get().WithField("func", "StepLogSaver.Save")
+	for _, l := range stepLogs {
+		key := fmt.Sprintf("%s/%d", l.TaskId, l.Step)
+		saved := s.savedSizes[key]
+		if saved > 0 && len(l.Content)-saved < saved/stepLogSaveGrowthRatio {
+			continue
+		}
+		logPath, ok := s.logPaths[key]
+		if !ok {
+			step, er := GetTaskStep(db.Get(), models.Id(l.TaskId), l.Step)
+			if er != nil {
+				logger.WithField("taskId", l.TaskId).Warnf("get task step %d: %v", l.Step, er)
+				continue
+			}
+			logPath = step.LogPath
+			s.logPaths[key] = logPath
+		}
+		if err := logstorage.Get().Write(logPath, logstorage.CutLogContent(l.Content)); err != nil {
+			logger.WithField("path", logPath).Errorf("write task log error: %v", err)
+			continue
+		}
+		s.savedSizes[key] = len(l.Content)
+	}
+}
+
+// Forget 步骤退出后删除缓存的日志路径
+func (s *StepLogSaver) Forget(taskId string, step int) {
+	key := fmt.Sprintf("%s/%d", taskId, step)
+	delete(s.logPaths, key)
+	delete(s.savedSizes, key)
+}
+
+// followTaskStepLog 获取执行中步骤的日志，直到步骤结束。
+// 优先订阅 runner 推送的日志事件，runner 未推送事件(或事件连接不在当前 portal 实例)时连接 runner 获取
+func followTaskStepLog(ctx context.Context, task models.Tasker, step *models.TaskStep, writer io.Writer) error {
+	if sub := stepbroker.Get().Subscribe(task.GetRunnerId(), step.TaskId.String(), step.Index); sub != nil {
+		written, done, err := followTaskStepLogEvents(ctx, sub, writer)
+		if err != nil || done {
+			return err
+		}
+		if written > 0 {
+			// 已输出部分日志，等待步骤结束后从存储读取剩余的日志，避免重复输出
+			return tailTaskStepLog(ctx, task, step, writer, written)
+		}
+	}
+
+	sleepDuration := consts.DbTaskPollInterval
+	for {
+		if err := fetchRunnerTaskStepLog(ctx, task.GetRunnerId(), step, writer); err != nil {
+			if errors.Is(err, ErrRunnerTaskNotExists) && step.StartAt != nil &&
+				time.Since(time.Time(*step.StartAt)) < consts.RunnerConnectTimeout*2 {
+				// 某些情况下可能步骤被标识为了 running 状态，但调用 runner 执行任务时因为网络等原因导致没有及时启动执行。
+				// 所以这里加一个判断, 如果是刚启动的任务会进行重试
+				time.Sleep(sleepDuration)
+				continue
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// followTaskStepLogEvents 输出订阅到的步骤日志，返回输出的日志长度及是否已完成输出。
+// 订阅中断(runner 事件连接断开或长时间未收到事件)时 done 为 false
+func followTaskStepLogEvents(ctx context.Context, sub *stepbroker.Subscription, writer io.Writer) (
+	written int, done bool, err error) {
+	defer sub.Close()
+
+	write := func(content []byte) error {
+		n, err := writer.Write(content)
+		written += n
+		return err
+	}
+	if err = write(sub.Log); err != nil {
+		return written, true, ignoreClosedPipe(err)
+	}
+
+	idle := time.NewTimer(consts.StepEventIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return written, true, nil
+		case <-idle.C:
+			return written, false, nil
+		case ev, ok := <-sub.C:
+			if !ok {
+				return written, false, nil
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(consts.StepEventIdleTimeout)
+
+			if len(ev.Content) > 0 {
+				err = write(ev.Content)
+			} else if ev.IsExited() {
+				// 退出事件包含全量日志，用于补全丢失的日志事件
+				if len(ev.Status.LogContent) > written {
+					err = write(ev.Status.LogContent[written:])
+				}
+				return written, true, ignoreClosedPipe(err)
+			}
+			if err != nil {
+				return written, true, ignoreClosedPipe(err)
+			}
+		}
+	}
+}
+
+// tailTaskStepLog 等待步骤结束后从存储读取日志，输出 offset 之后的内容
+func tailTaskStepLog(ctx context.Context, task models.Tasker, step *models.TaskStep, writer io.Writer, offset int) error {
+	ticker := time.NewTicker(consts.DbTaskPollInterval)
+	defer ticker.Stop()
+
+	for !step.IsExited() {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		var er error
+		if step, er = GetTaskStep(db.Get(), task.GetId(), step.Index); er != nil {
+			return er
+		}
+	}
+
+	content, err := ReadTaskStepLog(step)
+	if err != nil {
+		return err
+	}
+	if len(content) > offset {
+		_, err = writer.Write(content[offset:])
+	}
+	return ignoreClosedPipe(err)
+}
+
+func ignoreClosedPipe(err error) error {
+	if errors.Is(err, io.ErrClosedPipe) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package stepbroker
+
+import (
+	"cloudiac/configs"
+	"cloudiac/runner"
+	"fmt"
+	"sync"
+)
+
+const (
+	TypeMemory  = "memory"
+	TypeForward = "forward"
+)
+
+// Broker 分发 runner 推送的步骤事件。
+// runner 通过一个连接推送所有步骤的状态和日志，portal 内等待步骤结束的协程及日志查看请求订阅对应步骤的事件
+type Broker interface {
+	// RunnerConnected runner 事件连接建立
+	RunnerConnected(runnerId string)
+	// RunnerDisconnected runner 事件连接断开，关闭该 runner 所有步骤的订阅
+	RunnerDisconnected(runnerId string)
+
+	// Publish 发布 runner 推送的步骤事件
+	Publish(runnerId string, ev *runner.TaskStepEvent)
+	// Subscribe 订阅步骤事件，runner 未连接或步骤日志事件不完整时返回 nil，调用方需要改为主动连接 runner 获取
+	Subscribe(runnerId string, taskId string, step int) *Subscription
+
+	// TakeDirtyLogs 返回上次调用后有新内容的步骤日志(全量内容)，用于增量保存日志
+	TakeDirtyLogs(runnerId string) []StepLog
+}
+
+type StepLog struct {
+	TaskId  string
+	Step    int
+	Content []byte
+}
+
+// Subscription 步骤事件订阅，C 在步骤退出、runner 连接断开或订阅者处理过慢时关闭
+type Subscription struct {
+	Log []byte // 订阅时已收到的步骤日志
+	C   <-chan *runner.TaskStepEvent
+
+	closeOnce sync.Once
+	closeFunc func()
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	s.closeOnce.Do(s.closeFunc)
+}
+
+var (
+	broker   Broker
+	initErr  error
+	initOnce = sync.Once{}
+)
+
+// New 按配置创建事件代理
+func New(conf configs.StepBrokerConfig) (Broker, error) {
+	switch conf.Type {
+	case "", TypeMemory:
+		return newMemoryBroker(), nil
+	case TypeForward:
+		return newForwardBroker(), nil
+	default:
+		return nil, fmt.Errorf("unknown step broker type '%s'", conf.Type)
+	}
+}
+
+// Init 按系统配置初始化事件代理，服务启动时调用以便尽早发现配置错误
+func Init() error {
+	initOnce.Do(func() {
+		if broker == nil {
+			broker, initErr = New(configs.Get().StepBroker)
+		}
+	})
+	return initErr
+}
+
+func Get() Broker {
+	if err := Init(); err != nil {
+		panic(fmt.Errorf("init step broker: %v", err))
+	}
+	return broker
+}
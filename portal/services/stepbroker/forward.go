@@ -0,0 +1,177 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package stepbroker
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"cloudiac/utils/logs"
+	"cloudiac/utils/runnerauth"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// ForwardSubscribePath portal 实例间转发步骤事件订阅的接口
+	ForwardSubscribePath = "/api/v1/runners/events/subscribe"
+	forwardDialTimeout   = 5 * time.Second
+)
+
+// forwardBroker 在当前实例内分发事件，并在数据库中记录 runner 事件连接所在的实例。
+// 订阅的 runner 未连接到当前实例时，将订阅转发到接收该 runner 连接的实例
+type forwardBroker struct {
+	*memoryBroker
+}
+
+func newForwardBroker() *forwardBroker {
+	return &forwardBroker{memoryBroker: newMemoryBroker()}
+}
+
+func saveRunnerEventConn(tx *db.Session, runnerId string, portalAddr string) error {
+	n, err := tx.Model(&models.RunnerEventConn{}).Where("id = ?", runnerId).
+		UpdateAttrs(models.Attrs{"portal_addr": portalAddr})
+	if err != nil || n > 0 {
+		return err
+	}
+	err = tx.Insert(&models.RunnerEventConn{Id: runnerId, PortalAddr: portalAddr})
+	if err != nil && !e.IsDuplicate(err) {
+		return err
+	}
+	return nil
+}
+
+func (b *forwardBroker) connected(runnerId string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.runners[runnerId] > 0
+}
+
+func (b *forwardBroker) RunnerConnected(runnerId string) {
+	b.memoryBroker.RunnerConnected(runnerId)
+	if err := saveRunnerEventConn(db.Get(), runnerId, configs.Get().PortalInternalAddr()); err != nil {
+		logs.Get().WithField("runnerId", runnerId).Warnf("save runner event conn: %v", err)
+	}
+}
+
+func (b *forwardBroker) RunnerDisconnected(runnerId string) {
+	b.memoryBroker.RunnerDisconnected(runnerId)
+	if b.connected(runnerId) {
+		return
+	}
+	// runner 可能已经重新连接到了其他实例，只删除当前实例的记录
+	if _, err := db.Get().Where("id = ? AND portal_addr = ?", runnerId, configs.Get().PortalInternalAddr()).
+		Delete(&models.RunnerEventConn{}); err != nil {
+		logs.Get().WithField("runnerId", runnerId).Warnf("delete runner event conn: %v", err)
+	}
+}
+
+func (b *forwardBroker) Subscribe(runnerId string, taskId string, step int) *Subscription {
+	if sub := b.memoryBroker.Subscribe(runnerId, taskId, step); sub != nil {
+		return sub
+	}
+	if b.connected(runnerId) {
+		// runner 连接在当前实例，但步骤日志事件不完整
+		return nil
+	}
+
+	logger := logs.Get().WithField("runnerId", runnerId).WithField("taskId", taskId).WithField("step", step)
+	conn := models.RunnerEventConn{}
+	if err := db.Get().Where("id = ?", runnerId).First(&conn); err != nil {
+		if !e.IsRecordNotFound(err) {
+			logger.Warnf("query runner event conn: %v", err)
+		}
+		return nil
+	}
+	if conn.PortalAddr == "" || conn.PortalAddr == configs.Get().PortalInternalAddr() {
+		return nil
+	}
+
+	sub, err := dialSubscription(conn.PortalAddr, runnerId, taskId, step)
+	if err != nil {
+		logger.Warnf("forward step events subscription to %s: %v", conn.PortalAddr, err)
+		return nil
+	}
+	return sub
+}
+
+// dialSubscription 向接收 runner 连接的实例订阅步骤事件，
+// 对方实例先返回订阅时已收到的日志，之后依次推送步骤事件，订阅结束时断开连接
+func dialSubscription(portalAddr string, runnerId string, taskId string, step int) (*Subscription, error) {
+	u, err := url.Parse(portalAddr)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + ForwardSubscribePath
+	u.RawQuery = url.Values{
+		"runnerId": []string{runnerId},
+		"taskId":   []string{taskId},
+		"step":     []string{strconv.Itoa(step)},
+	}.Encode()
+
+	header := runnerauth.SignHeader(configs.Get().RunnerApiSecret, http.MethodGet, u.Path, u.RawQuery, nil)
+	dialer := websocket.Dialer{HandshakeTimeout: forwardDialTimeout}
+	conn, resp, err := dialer.Dial(u.String(), header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("%v, status %d", err, resp.StatusCode)
+		}
+		return nil, err
+	}
+
+	first := runner.TaskStepEvent{}
+	_ = conn.SetReadDeadline(time.Now().Add(forwardDialTimeout))
+	if err := conn.ReadJSON(&first); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	ch := make(chan *runner.TaskStepEvent, subscriptionBufferSize)
+	go func() {
+		defer close(ch)
+		for {
+			ev := runner.TaskStepEvent{}
+			if err := conn.ReadJSON(&ev); err != nil {
+				return
+			}
+			select {
+			case ch <- &ev:
+			default:
+				// 订阅者处理过慢，关闭订阅，由订阅者改为从存储读取
+				_ = conn.Close()
+				return
+			}
+		}
+	}()
+
+	return &Subscription{
+		Log: first.Content,
+		C:   ch,
+		closeFunc: func() {
+			_ = conn.Close()
+		},
+	}, nil
+}
+
+// SubscribeLocal 只订阅当前实例内分发的步骤事件，用于响应其他实例转发的订阅，避免循环转发
+func SubscribeLocal(runnerId string, taskId string, step int) *Subscription {
+	if b, ok := Get().(*forwardBroker); ok {
+		return b.memoryBroker.Subscribe(runnerId, taskId, step)
+	}
+	return Get().Subscribe(runnerId, taskId, step)
+}
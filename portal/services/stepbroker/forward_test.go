@@ -0,0 +1,57 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package stepbroker
+
+import (
+	"cloudiac/configs"
+	"cloudiac/runner"
+	"cloudiac/runner/ws"
+	"cloudiac/utils/runnerauth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialSubscription(t *testing.T) {
+	configs.Set(&configs.Config{RunnerApiSecret: "test-secret"})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != ForwardSubscribePath || r.URL.Query().Get("taskId") != "run-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := runnerauth.Verify("test-secret", r, nil); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := ws.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.WriteJSON(&runner.TaskStepEvent{Type: runner.TaskStepEventLog, Content: []byte("hello ")})
+		_ = conn.WriteJSON(&runner.TaskStepEvent{Type: runner.TaskStepEventLog, TaskId: "run-1", Step: 1,
+			Offset: 6, Content: []byte("world")})
+	}))
+	defer srv.Close()
+
+	sub, err := dialSubscription(srv.URL, "runner-1", "run-1", 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer sub.Close()
+	assert.Equal(t, "hello ", string(sub.Log))
+
+	ev := <-sub.C
+	assert.Equal(t, int64(6), ev.Offset)
+	assert.Equal(t, "world", string(ev.Content))
+
+	// 对方实例断开连接后订阅关闭
+	_, ok := <-sub.C
+	assert.False(t, ok)
+
+	_, err = dialSubscription(srv.URL, "runner-1", "run-2", 1)
+	assert.Error(t, err)
+}
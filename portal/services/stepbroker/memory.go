@@ -0,0 +1,227 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package stepbroker
+
+import (
+	"cloudiac/runner"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	subscriptionBufferSize = 256
+	// exitedStepRetention 步骤退出后保留事件的时长，以便稍后订阅的请求可以直接获取退出状态和日志
+	exitedStepRetention = time.Minute
+	sweepInterval       = 10 * time.Second
+)
+
+type memoryStep struct {
+	runnerId string
+	taskId   string
+	step     int
+	log      []byte
+	dirty    bool
+	broken   bool                  // 日志事件不连续(runner 丢弃了部分事件)，不再分发和保存日志
+	exited   *runner.TaskStepEvent // 步骤退出事件
+	exitedAt time.Time
+	subs     map[chan *runner.TaskStepEvent]struct{}
+}
+
+// memoryBroker 在当前 portal 实例内分发事件，只有接收 runner 连接的实例可以订阅到该 runner 的事件
+type memoryBroker struct {
+	mu        sync.Mutex
+	runners   map[string]int // runner 当前的事件连接数
+	steps     map[string]*memoryStep
+	lastSweep time.Time
+}
+
+func newMemoryBroker() *memoryBroker {
+	return &memoryBroker{
+		runners:   make(map[string]int),
+		steps:     make(map[string]*memoryStep),
+		lastSweep: time.Now(),
+	}
+}
+
+func stepKey(taskId string, step int) string {
+	return fmt.Sprintf("%s/%d", taskId, step)
+}
+
+func (b *memoryBroker) RunnerConnected(runnerId string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.runners[runnerId]++
+}
+
+func (b *memoryBroker) RunnerDisconnected(runnerId string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.runners[runnerId]--; b.runners[runnerId] > 0 {
+		return
+	}
+	delete(b.runners, runnerId)
+	for k, s := range b.steps {
+		if s.runnerId == runnerId {
+			b.removeStep(k, s)
+		}
+	}
+}
+
+func (b *memoryBroker) closeSubs(s *memoryStep) {
+	for ch := range s.subs {
+		close(ch)
+		delete(s.subs, ch)
+	}
+}
+
+func (b *memoryBroker) removeStep(key string, s *memoryStep) {
+	b.closeSubs(s)
+	delete(b.steps, key)
+}
+
+// sweep 清理退出超过保留时长的步骤
+func (b *memoryBroker) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < sweepInterval {
+		return
+	}
+	b.lastSweep = now
+	for k, s := range b.steps {
+		if s.exited != nil && now.Sub(s.exitedAt) > exitedStepRetention {
+			b.removeStep(k, s)
+		}
+	}
+}
+
+func (b *memoryBroker) getStep(runnerId string, taskId string, step int) *memoryStep {
+	key := stepKey(taskId, step)
+	s := b.steps[key]
+	if s != nil && s.runnerId != runnerId {
+		// 任务被重新调度到了其他 runner
+		b.removeStep(key, s)
+		s = nil
+	}
+	if s == nil {
+		s = &memoryStep{
+			runnerId: runnerId,
+			taskId:   taskId,
+			step:     step,
+			subs:     make(map[chan *runner.TaskStepEvent]struct{}),
+		}
+		b.steps[key] = s
+	}
+	return s
+}
+
+func (b *memoryBroker) Publish(runnerId string, ev *runner.TaskStepEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.sweep(now)
+	s := b.getStep(runnerId, ev.TaskId, ev.Step)
+	if s.exited != nil {
+		return
+	}
+	if s.broken {
+		if ev.IsExited() {
+			s.exited = ev
+			s.exitedAt = now
+		}
+		return
+	}
+
+	switch ev.Type {
+	case runner.TaskStepEventLog:
+		if ev.Offset > int64(len(s.log)) {
+			// runner 事件队列满时会丢弃日志事件，缓存的日志已不完整。
+			// 停止增量保存并关闭订阅，订阅者改为从 runner 或者存储获取完整日志
+			s.broken = true
+			s.dirty = false
+			s.log = nil
+			b.closeSubs(s)
+			return
+		}
+		// runner 重连后可能重复发送日志，只保留新的部分
+		if skip := int64(len(s.log)) - ev.Offset; skip > 0 {
+			if skip >= int64(len(ev.Content)) {
+				return
+			}
+			ev = &runner.TaskStepEvent{Type: ev.Type, EnvId: ev.EnvId, TaskId: ev.TaskId, Step: ev.Step,
+				Offset: int64(len(s.log)), Content: ev.Content[skip:]}
+		}
+		s.log = append(s.log, ev.Content...)
+		s.dirty = true
+	case runner.TaskStepEventStatus:
+		if ev.IsExited() {
+			s.exited = ev
+			s.exitedAt = now
+		}
+	}
+
+	for ch := range s.subs {
+		select {
+		case ch <- ev:
+		default:
+			// 订阅者处理过慢，关闭订阅，由订阅者改为从存储读取
+			close(ch)
+			delete(s.subs, ch)
+		}
+	}
+	if s.exited != nil {
+		b.closeSubs(s)
+	}
+}
+
+func (b *memoryBroker) Subscribe(runnerId string, taskId string, step int) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.runners[runnerId] == 0 {
+		return nil
+	}
+
+	s := b.getStep(runnerId, taskId, step)
+	if s.broken {
+		return nil
+	}
+	ch := make(chan *runner.TaskStepEvent, subscriptionBufferSize)
+	sub := &Subscription{
+		// 日志只会追加，返回当前内容的切片即可
+		Log: s.log[:len(s.log):len(s.log)],
+		C:   ch,
+	}
+	if s.exited != nil {
+		ch <- s.exited
+		close(ch)
+		sub.closeFunc = func() {}
+		return sub
+	}
+
+	s.subs[ch] = struct{}{}
+	sub.closeFunc = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := s.subs[ch]; ok {
+			close(ch)
+			delete(s.subs, ch)
+		}
+	}
+	return sub
+}
+
+func (b *memoryBroker) TakeDirtyLogs(runnerId string) []StepLog {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	logs := make([]StepLog, 0)
+	for _, s := range b.steps {
+		if s.runnerId != runnerId || !s.dirty {
+			continue
+		}
+		s.dirty = false
+		logs = append(logs, StepLog{TaskId: s.taskId, Step: s.step, Content: s.log[:len(s.log):len(s.log)]})
+	}
+	return logs
+}
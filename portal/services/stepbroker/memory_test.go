@@ -0,0 +1,84 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package stepbroker
+
+import (
+	"cloudiac/runner"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	b := newMemoryBroker()
+	logEvent := func(offset int64, content string) *runner.TaskStepEvent {
+		return &runner.TaskStepEvent{Type: runner.TaskStepEventLog, TaskId: "run-1", Step: 1,
+			Offset: offset, Content: []byte(content)}
+	}
+
+	// runner 未连接时无法订阅
+	assert.Nil(t, b.Subscribe("runner-1", "run-1", 1))
+
+	b.RunnerConnected("runner-1")
+	b.Publish("runner-1", logEvent(0, "hello "))
+	sub := b.Subscribe("runner-1", "run-1", 1)
+	assert.NotNil(t, sub)
+	assert.Equal(t, "hello ", string(sub.Log))
+
+	// 重复发送的日志只保留新的部分
+	b.Publish("runner-1", logEvent(3, "lo world"))
+	ev := <-sub.C
+	assert.Equal(t, "world", string(ev.Content))
+	assert.Equal(t, int64(6), ev.Offset)
+
+	logs := b.TakeDirtyLogs("runner-1")
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "hello world", string(logs[0].Content))
+	assert.Len(t, b.TakeDirtyLogs("runner-1"), 0)
+
+	// 步骤退出后关闭订阅，之后的订阅直接返回退出事件
+	b.Publish("runner-1", &runner.TaskStepEvent{Type: runner.TaskStepEventStatus, TaskId: "run-1", Step: 1,
+		Status: &runner.TaskStatusMessage{Exited: true}})
+	ev = <-sub.C
+	assert.True(t, ev.IsExited())
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	sub.Close()
+
+	sub = b.Subscribe("runner-1", "run-1", 1)
+	assert.Equal(t, "hello world", string(sub.Log))
+	assert.True(t, (<-sub.C).IsExited())
+
+	// runner 断开连接时关闭订阅
+	sub = b.Subscribe("runner-1", "run-1", 2)
+	b.RunnerDisconnected("runner-1")
+	_, ok = <-sub.C
+	assert.False(t, ok)
+	sub.Close()
+	assert.Nil(t, b.Subscribe("runner-1", "run-1", 2))
+}
+
+func TestMemoryBrokerLogGap(t *testing.T) {
+	b := newMemoryBroker()
+	logEvent := func(offset int64, content string) *runner.TaskStepEvent {
+		return &runner.TaskStepEvent{Type: runner.TaskStepEventLog, TaskId: "run-1", Step: 1,
+			Offset: offset, Content: []byte(content)}
+	}
+
+	b.RunnerConnected("runner-1")
+	b.Publish("runner-1", logEvent(0, "hello "))
+	sub := b.Subscribe("runner-1", "run-1", 1)
+	assert.NotNil(t, sub)
+
+	// runner 丢弃了部分日志事件，关闭订阅并停止保存日志
+	b.Publish("runner-1", logEvent(10, "world"))
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	sub.Close()
+	assert.Len(t, b.TakeDirtyLogs("runner-1"), 0)
+	assert.Nil(t, b.Subscribe("runner-1", "run-1", 1))
+
+	b.Publish("runner-1", logEvent(15, "!"))
+	assert.Len(t, b.TakeDirtyLogs("runner-1"), 0)
+	assert.Nil(t, b.Subscribe("runner-1", "run-1", 1))
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -33,6 +34,11 @@ func UpdateSystemConfig(tx *db.Session, name string, attrs models.Attrs) (cfg *m
 		}
 		attrs["value"] = strconv.Itoa(timeoutInMinute * 60)
 	}
+	if name == models.SysCfgNameApprovalTTL {
+		if ttl, err := strconv.Atoi(attrs["value"].(string)); err != nil || ttl < 0 {
+			return nil, e.New(e.BadRequest, fmt.Errorf("%s update err: invalid value", models.SysCfgNameApprovalTTL))
+		}
+	}
 	cfg = &models.SystemCfg{}
 	if _, err := models.UpdateAttr(tx.Where("name = ?", name), &models.SystemCfg{}, attrs); err != nil {
 		return nil, e.New(e.DBError, fmt.Errorf("update sys config error: %v", err))
@@ -102,3 +108,16 @@ func GetSystemTaskStepTimeout(tx *db.Session) (int, e.Error) {
 		return timeout, nil
 	}
 }
+
+// GetApprovalTTL 返回审批超时时间，未设置或者设置为 0 时返回 0，表示不超时
+func GetApprovalTTL(tx *db.Session) time.Duration {
+	sysConfig, err := GetSystemConfigByName(tx, models.SysCfgNameApprovalTTL)
+	if err != nil {
+		return 0
+	}
+	hours, er := strconv.Atoi(sysConfig.Value)
+	if er != nil || hours < 0 {
+		return 0
+	}
+	return time.Duration(hours) * time.Hour
+}
@@ -6,6 +6,7 @@ import (
 	"cloudiac/common"
 	"cloudiac/configs"
 	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
 	"cloudiac/utils"
 	"cloudiac/utils/consulClient"
 	"encoding/json"
@@ -16,6 +17,10 @@ import (
 )
 
 func SystemStatusSearch() ([]api.AgentService, map[string]api.AgentCheck, []string, e.Error) {
+	if configs.Get().UseDBRegistry() {
+		return dbSystemStatusSearch()
+	}
+
 	serviceList := make([]string, 0)
 	IdInfo := make([]api.AgentService, 0)
 	serviceStatus := make(map[string]api.AgentCheck)
@@ -50,6 +55,27 @@ func SystemStatusSearch() ([]api.AgentService, map[string]api.AgentCheck, []stri
 }
 
 func SystemRunnerTags() ([]string, e.Error) {
+	tags, er := consulRunnerTags()
+	if er != nil {
+		return nil, er
+	}
+
+	agents, er := onlineRunnerAgents(db.Get())
+	if er != nil {
+		return nil, er
+	}
+	for _, a := range agents {
+		tags = append(tags, a.Tags...)
+	}
+
+	return utils.RemoveDuplicateElement(tags), nil
+}
+
+func consulRunnerTags() ([]string, e.Error) {
+	if configs.Get().UseDBRegistry() {
+		return dbRunnerTags()
+	}
+
 	tags := make([]string, 0)
 	client, err := consulClient.NewConsulClient()
 
@@ -69,11 +95,14 @@ func SystemRunnerTags() ([]string, e.Error) {
 		}
 		tags = append(tags, info.Tags...)
 	}
-
-	return utils.RemoveDuplicateElement(tags), nil
+	return tags, nil
 }
 
 func ConsulKVSearch(key string) (interface{}, e.Error) {
+	if configs.Get().UseDBRegistry() {
+		return dbServiceTags(key)
+	}
+
 	client, err := consulClient.NewConsulClient()
 
 	if err != nil {
@@ -91,6 +120,40 @@ func ConsulKVSearch(key string) (interface{}, e.Error) {
 }
 
 func RunnerSearch() ([]*api.AgentService, e.Error) {
+	resp, er := consulRunnerSearch()
+	if er != nil {
+		return nil, er
+	}
+
+	// agent 模式的 runner 不注册到 consul，在线状态由 portal 维护
+	agents, er := onlineRunnerAgents(db.Get())
+	if er != nil {
+		return nil, er
+	}
+	resp = append(resp, agents...)
+
+	return resp, nil
+}
+
+// IsRunnerAlive runner 是否在线(consul 健康检查通过、心跳未超时或 agent 连接未断开)
+func IsRunnerAlive(runnerId string) (bool, e.Error) {
+	runners, er := RunnerSearch()
+	if er != nil {
+		return false, er
+	}
+	for _, r := range runners {
+		if r.ID == runnerId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func consulRunnerSearch() ([]*api.AgentService, e.Error) {
+	if configs.Get().UseDBRegistry() {
+		return dbRunnerSearch()
+	}
+
 	resp := make([]*api.AgentService, 0)
 	client, err := consulClient.NewConsulClient()
 	if err != nil {
@@ -107,7 +170,6 @@ func RunnerSearch() ([]*api.AgentService, e.Error) {
 			resp = append(resp, s.Service)
 		}
 	}
-
 	return resp, nil
 }
 
@@ -154,6 +216,7 @@ func ConsulServiceRegistered(serviceInfo *api.AgentService, tags []string) e.Err
 	registration.Port = serviceInfo.Port       // 服务端口
 	registration.Tags = tags                   // tag，可以为空
 	registration.Address = serviceInfo.Address // 服务 IP
+	registration.Meta = serviceInfo.Meta       // 保留 runner 上报的 slots 等信息
 
 	checkPort := serviceInfo.Port
 	registration.Check = &api.AgentServiceCheck{ // 健康检查
@@ -171,6 +234,11 @@ func ConsulServiceRegistered(serviceInfo *api.AgentService, tags []string) e.Err
 }
 
 func GetRunnerAddress(serviceId string) (string, error) {
+	if IsRunnerAgent(serviceId) {
+		return GetRunnerAgentAddress(serviceId)
+	} else if configs.Get().UseDBRegistry() {
+		return dbServiceAddress(serviceId)
+	}
 	s, err := ConsulServiceInfo(serviceId)
 	if err != nil {
 		return "", errors.Wrapf(err, "get runner address, runnerId %s", serviceId)
@@ -173,6 +173,14 @@ func CloneNewDriftTask(tx *db.Session, src models.Task, env *models.Env) (*model
 func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models.Task) (*models.Task, e.Error) {
 	// logger := logs.Get().WithField("func", "CreateTask")
 	// logger = logger.WithField("taskId", task.Id)
+	// 批量编排创建时已检查依赖该环境的环境都在编排中，且会先于该环境销毁
+	if pt.Type == models.TaskTypeDestroy && pt.Source != consts.TaskSourceStackRun {
+		// 有其他环境依赖该环境时不允许销毁
+		if er := CheckEnvDestroyable(tx, env.Id); er != nil {
+			return nil, er
+		}
+	}
+
 	task, er := newCommonTask(tpl, env, pt)
 	if er != nil {
 		return nil, er
@@ -198,8 +206,29 @@ func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models
 	return doCreateTask(tx, *task, tpl, env)
 }
 
+// GetTaskPriority 根据任务来源获取任务的调度优先级
+func GetTaskPriority(source string) int {
+	switch source {
+	case consts.TaskSourceDriftPlan, consts.TaskSourceDriftApply:
+		return consts.TaskPriorityLow
+	case "", consts.TaskSourceManual, consts.TaskSourceApi:
+		return consts.TaskPriorityHigh
+	default:
+		return consts.TaskPriorityNormal
+	}
+}
+
+// GetIacEngine 获取任务使用的 IaC 引擎及版本，环境设置了引擎时使用环境的配置，否则使用云模板的配置
+func GetIacEngine(tpl *models.Template, env *models.Env) (engine string, version string) {
+	if env.IacEngine != "" {
+		return env.IacEngine, env.TfVersion
+	}
+	return tpl.IacEngine, tpl.TfVersion
+}
+
 func newCommonTask(tpl *models.Template, env *models.Env, pt models.Task) (*models.Task, e.Error) {
 	firstVal := utils.FirstValueStr
+	iacEngine, tfVersion := GetIacEngine(tpl, env)
 	task := models.Task{
 		// 以下为需要外部传入的属性
 		Name:            pt.Name,
@@ -226,7 +255,8 @@ func newCommonTask(tpl *models.Template, env *models.Env, pt models.Task) (*mode
 
 		// 任务、环境工作目录为空，工作目录就应该为空，这里不需要在引用云模板的工作目录
 		Workdir:   firstVal(pt.Workdir, env.Workdir),
-		TfVersion: tpl.TfVersion,
+		TfVersion: tfVersion,
+		IacEngine: iacEngine,
 
 		Playbook:     env.Playbook,
 		TfVarsFile:   env.TfVarsFile,
@@ -246,6 +276,10 @@ func newCommonTask(tpl *models.Template, env *models.Env, pt models.Task) (*mode
 		Source:      pt.Source,
 		SourceSys:   pt.SourceSys,
 		IsDriftTask: pt.IsDriftTask,
+		Imports:     pt.Imports,
+		StateOps:    pt.StateOps,
+		Replaces:    pt.Replaces,
+		RefreshOnly: pt.RefreshOnly,
 	}
 	task.Id = models.Task{}.NewId()
 	return &task, nil
@@ -257,6 +291,24 @@ func doCreateTask(tx *db.Session, task models.Task, tpl *models.Template, env *m
 	if er := createTaskParamCheck(task); er != nil {
 		return nil, er
 	}
+	// 受保护环境的部署及销毁总是需要审批
+	if env.Protected {
+		task.AutoApprove = false
+	}
+	// 设置了审批规则时由规则的自动审批条件决定是否需要人工审批，任务的自动审批配置不生效
+	if task.AutoApprove {
+		hasRules, er := HasEnvApprovalRules(tx, env.ProjectId, env.Id)
+		if er != nil {
+			return nil, er
+		}
+		task.AutoApprove = !hasRules
+	}
+	// 环境未指定 runner 时，任务开始执行前根据 runner 负载重新选择
+	if env.RunnerId == "" {
+		task.AutoRunner = true
+		task.RunnerTags = env.RunnerTags
+	}
+	task.Priority = GetTaskPriority(task.Source)
 
 	if task.Pipeline == "" {
 		task.Pipeline, err = GetTplPipeline(tx, tpl.Id, task.Revision, task.Workdir)
@@ -317,6 +369,12 @@ func createTaskParamCheck(task models.Task) e.Error {
 	if task.RunnerId == "" {
 		return e.New(e.BadParam, fmt.Errorf("'runnerId' is required"))
 	}
+	if task.Type == models.TaskTypeImport && len(task.Imports) == 0 {
+		return e.New(e.BadParam, fmt.Errorf("'imports' is required"))
+	}
+	if task.Type == models.TaskTypeState && len(task.StateOps) == 0 {
+		return e.New(e.BadParam, fmt.Errorf("'stateOps' is required"))
+	}
 	return nil
 }
 
@@ -344,6 +402,16 @@ func createTaskStep(tx *db.Session, env *models.Env, task models.Task, pipelineS
 		}
 	}
 
+	// apply 步骤执行的是 plan 文件，replace 和 refresh-only 参数只需要传给 plan 步骤
+	if pipelineStep.Type == models.TaskStepPlan {
+		for _, r := range task.Replaces {
+			pipelineStep.Args = append(pipelineStep.Args, fmt.Sprintf("-replace=%s", shellescape.Quote(r)))
+		}
+		if task.RefreshOnly {
+			pipelineStep.Args = append(pipelineStep.Args, "-refresh-only")
+		}
+	}
+
 	if pipelineStep.Type == models.TaskStepEnvScan || pipelineStep.Type == models.TaskStepOpaScan {
 		// 对于包含扫描的任务，创建一个对应的 scanTask 作为扫描任务记录，便于后期扫描状态的查询
 		scanTask := CreateMirrorScanTask(&task)
@@ -499,6 +567,7 @@ var stepStatus2TaskStatusMap = map[string]string{
 	models.TaskStepFailed:    models.TaskFailed,
 	models.TaskStepTimeout:   models.TaskFailed,
 	models.TaskStepAborted:   models.TaskAborted,
+	models.TaskStepLost:      models.TaskFailed,
 	models.TaskStepComplete:  models.TaskComplete,
 }
 
@@ -761,6 +830,7 @@ type TfPlan struct {
 	FormatVersion string `json:"format_version"`
 
 	ResourceChanges []TfPlanResource `json:"resource_changes"`
+	ResourceDrift   []TfPlanResource `json:"resource_drift"` // refresh 时检测到的在 terraform 之外发生的变更
 }
 
 type TfPlanResource struct {
@@ -781,6 +851,10 @@ type TfPlanResourceChange struct {
 	Actions []string    `json:"actions"` // no-op, create, read, update, delete
 	Before  interface{} `json:"before"`
 	After   interface{} `json:"after"`
+
+	AfterUnknown    interface{} `json:"after_unknown,omitempty"` // 值为 true 的属性需要在 apply 后才能确定
+	BeforeSensitive interface{} `json:"before_sensitive,omitempty"`
+	AfterSensitive  interface{} `json:"after_sensitive,omitempty"`
 }
 
 func UnmarshalPlanJson(bs []byte) (*TfPlan, error) {
@@ -923,8 +997,6 @@ func fetchTaskStepLog(ctx context.Context, task models.Tasker, writer io.Writer,
 		return err
 	}
 
-	storage := logstorage.Get()
-
 	if task, step, err = waitTaskStepStarted(ctx, task, step.Index); err != nil {
 		return err
 	}
@@ -937,35 +1009,30 @@ func fetchTaskStepLog(ctx context.Context, task models.Tasker, writer io.Writer,
 
 	if step.IsExited() {
 		var content []byte
-		if content, err = storage.Read(step.LogPath); err != nil {
-			if os.IsNotExist(err) {
-				// 当前步骤没有日志文件
-				return nil
-			}
+		if content, err = ReadTaskStepLog(step); err != nil {
 			return err
 		} else if _, err = writer.Write(content); err != nil {
 			return err
 		}
 	} else if step.IsStarted() { // running
-		sleepDuration := consts.DbTaskPollInterval
-		for {
-			if err = fetchRunnerTaskStepLog(ctx, task.GetRunnerId(), step, writer); err != nil {
-				if errors.Is(err, ErrRunnerTaskNotExists) && step.StartAt != nil &&
-					time.Since(time.Time(*step.StartAt)) < consts.RunnerConnectTimeout*2 {
-					// 某些情况下可能步骤被标识为了 running 状态，但调用 runner 执行任务时因为网络等原因导致没有及时启动执行。
-					// 所以这里加一个判断, 如果是刚启动的任务会进行重试
-					time.Sleep(sleepDuration)
-					continue
-				}
-				return err
-			}
-			break
-		}
+		return followTaskStepLog(ctx, task, step, writer)
 	}
 
 	return nil
 }
 
+// ReadTaskStepLog 读取步骤日志，步骤没有日志时返回空内容，日志已按保留天数清理时返回提示信息
+func ReadTaskStepLog(step *models.TaskStep) ([]byte, error) {
+	if step.LogPath == "" {
+		return utils.TaskLogMsgBytes("Log has been purged"), nil
+	}
+	content, err := logstorage.Get().Read(step.LogPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return content, err
+}
+
 func waitTaskStepStarted(ctx context.Context, tasker models.Tasker, stepIndex int) (task models.Tasker, step *models.TaskStep, err error) {
 	sleepDuration := consts.DbTaskPollInterval
 	ticker := time.NewTicker(sleepDuration)
@@ -1013,7 +1080,7 @@ func fetchRunnerTaskStepLog(ctx context.Context, runnerId string, step *models.T
 	params.Add("envId", string(step.EnvId))
 	params.Add("taskId", string(step.TaskId))
 	params.Add("step", fmt.Sprintf("%d", step.Index))
-	wsConn, resp, err := utils.WebsocketDail(runnerAddr, consts.RunnerTaskStepLogFollowURL, params)
+	wsConn, resp, err := RunnerWebsocketDial(runnerAddr, consts.RunnerTaskStepLogFollowURL, params)
 	if err != nil {
 		if resp != nil {
 			if resp.StatusCode == http.StatusNotFound {
@@ -1163,10 +1230,12 @@ func CreateEnvScanTask(tx *db.Session, tpl *models.Template, env *models.Env, ta
 		err e.Error
 	)
 
-	// 使用默认 runner 执行扫描
-	runnerId, err := GetDefaultRunnerId()
-	if err != nil {
-		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	// 环境指定了 runner 时使用该 runner 执行扫描，否则使用默认 runner，并在任务开始执行前根据 runner 负载重新选择
+	runnerId := env.RunnerId
+	if runnerId == "" {
+		if runnerId, err = GetDefaultRunnerId(); err != nil {
+			return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+		}
 	}
 
 	vars, er := GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
@@ -1175,11 +1244,15 @@ func CreateEnvScanTask(tx *db.Session, tpl *models.Template, env *models.Env, ta
 		return nil, e.New(e.InternalError, er, http.StatusInternalServerError)
 	}
 
+	iacEngine, tfVersion := GetIacEngine(tpl, env)
 	task := models.ScanTask{
 		BaseTask: models.BaseTask{
 			Type:        taskType,
 			StepTimeout: common.DefaultTaskStepTimeout,
 			RunnerId:    runnerId,
+			AutoRunner:  env.RunnerId == "",
+			RunnerTags:  env.RunnerTags,
+			Priority:    consts.TaskPriorityNormal,
 			Status:      models.TaskPending,
 		},
 		Name:         models.ScanTask{}.GetTaskNameByType(taskType),
@@ -1191,7 +1264,8 @@ func CreateEnvScanTask(tx *db.Session, tpl *models.Template, env *models.Env, ta
 		Revision:     env.Revision,
 		Variables:    vars,
 		Workdir:      tpl.Workdir,
-		TfVersion:    tpl.TfVersion,
+		TfVersion:    tfVersion,
+		IacEngine:    iacEngine,
 		TfVarsFile:   env.TfVarsFile,
 		PlayVarsFile: env.PlayVarsFile,
 		Playbook:     env.Playbook,
@@ -1277,6 +1351,9 @@ func CreateScanTask(tx *db.Session, tpl *models.Template, env *models.Env, pt mo
 			Type:        pt.Type,
 			StepTimeout: utils.FirstValueInt(pt.StepTimeout, common.DefaultTaskStepTimeout),
 			RunnerId:    pt.RunnerId,
+			AutoRunner:  pt.AutoRunner,
+			RunnerTags:  pt.RunnerTags,
+			Priority:    consts.TaskPriorityNormal,
 
 			Status:   models.TaskPending,
 			Message:  "",
@@ -1284,6 +1361,16 @@ func CreateScanTask(tx *db.Session, tpl *models.Template, env *models.Env, pt mo
 		},
 	}
 
+	if env != nil {
+		// 环境扫描任务使用环境的 runner 配置
+		if env.RunnerId != "" {
+			task.RunnerId, task.AutoRunner = env.RunnerId, false
+		} else {
+			task.AutoRunner = true
+		}
+		task.RunnerTags = env.RunnerTags
+	}
+
 	task.Id = models.NewId("run")
 	task.RepoAddr, task.CommitId, err = GetTaskRepoAddrAndCommitId(tx, tpl, task.Revision)
 	if err != nil {
@@ -1364,6 +1451,7 @@ func CreateMirrorScanTask(task *models.Task) *models.ScanTask {
 		Playbook:     task.Playbook,
 		TfVarsFile:   task.TfVarsFile,
 		TfVersion:    task.TfVersion,
+		IacEngine:    task.IacEngine,
 		PlayVarsFile: task.PlayVarsFile,
 		Variables:    task.Variables,
 		StatePath:    task.StatePath,
@@ -1379,15 +1467,18 @@ func QueryTaskStepsById(query *db.Session, taskId models.Id) *db.Session {
 
 // 查询任务下某一个单独步骤的具体执行日志
 func GetTaskStepLogById(tx *db.Session, stepId models.Id) ([]byte, e.Error) {
-	query := tx.Joins("left join iac_task_step on iac_task_step.log_path=iac_storage.path").
-		Where("iac_task_step.id = ?", stepId).
-		LazySelectAppend("iac_storage.content")
-
-	var dbStorage models.DBStorage
-	if err := query.Find(&dbStorage); err != nil {
+	step := models.TaskStep{}
+	if err := tx.Where("id = ?", stepId).First(&step); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.TaskStepNotExists, err, http.StatusNotFound)
+		}
 		return nil, e.New(e.DBError, err)
 	}
-	return dbStorage.Content, nil
+	content, err := ReadTaskStepLog(&step)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return content, nil
 }
 
 func SendKafkaMessage(session *db.Session, task *models.Task, taskStatus string) {
@@ -1589,7 +1680,7 @@ func SendVcsComment(session *db.Session, task *models.Task, taskStatus string) {
 		return
 	}
 
-	logContent, err := logstorage.Get().Read(taskStep.LogPath)
+	logContent, err := ReadTaskStepLog(taskStep)
 	if err != nil {
 		logs.Get().Errorf("vcs comment err, get task plan log err: %v", err)
 		return
@@ -1666,17 +1757,12 @@ func CheckRunnerTaskCanAbort(task models.Task) e.Error {
 func doAbortRunnerTask(task models.Task, justCheck bool) e.Error {
 	logger := logs.Get().WithField("taskId", task.Id).WithField("action", "AbortTask")
 
-	header := &http.Header{}
-	header.Set("Content-Type", "application/json")
-
 	var runnerAddr string
 	runnerAddr, err := GetRunnerAddress(task.RunnerId)
 	if err != nil {
 		return e.AutoNew(err, e.InternalError)
 	}
-
-	requestUrl := utils.JoinURL(runnerAddr, consts.RunnerAbortTaskURL)
-	logger.Debugf("request runner: %s", requestUrl)
+	logger.Debugf("request runner: %s", utils.JoinURL(runnerAddr, consts.RunnerAbortTaskURL))
 
 	param := runner.TaskAbortReq{
 		EnvId:     task.EnvId.String(),
@@ -1684,7 +1770,7 @@ func doAbortRunnerTask(task models.Task, justCheck bool) e.Error {
 		JustCheck: justCheck,
 	}
 
-	respData, err := utils.HttpService(requestUrl, "POST", header, param,
+	respData, err := RunnerPost(runnerAddr, consts.RunnerAbortTaskURL, param,
 		int(consts.RunnerConnectTimeout.Seconds()),
 		int(consts.RunnerConnectTimeout.Seconds())*10,
 	)
@@ -0,0 +1,172 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func createTaskApproval(tx *db.Session, approval models.TaskApproval) e.Error {
+	approval.Id = models.NewId("apv")
+	if err := models.Create(tx, &approval); err != nil {
+		if e.IsDuplicate(err) {
+			return e.New(e.TaskAlreadyVoted, err, http.StatusBadRequest)
+		}
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+func getTaskStepApprovals(tx *db.Session, taskId models.Id, step int) ([]models.TaskApproval, e.Error) {
+	approvals := make([]models.TaskApproval, 0)
+	if err := tx.Model(&models.TaskApproval{}).
+		Where("task_id = ? AND step = ?", taskId, step).Find(&approvals); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return approvals, nil
+}
+
+func SearchTaskApproval(query *db.Session, taskId models.Id) *db.Session {
+	return query.Model(&models.TaskApproval{}).Where("task_id = ?", taskId).Order("created_at")
+}
+
+// VoteTaskStep 用户审批任务步骤并记录审批结果及审批意见。
+// 每次审批后重新计算任务的审批规则，所有规则都满足后步骤才会通过审批，任何一个审批者驳回则步骤被驳回，返回步骤是否已结束审批
+func VoteTaskStep(tx *db.Session, task *models.Task, step *models.TaskStep, userId models.Id, action string, comment string) (bool, e.Error) {
+	if action != models.TaskApprovalApproved && action != models.TaskApprovalRejected {
+		return false, e.New(e.BadParam, fmt.Errorf("invalid action '%s'", action), http.StatusBadRequest)
+	}
+
+	env, er := GetEnvById(tx, task.EnvId)
+	if er != nil {
+		return false, er
+	}
+	if er := CheckEnvApprover(tx, env, userId); er != nil {
+		return false, er
+	}
+	ev, er := newApprovalRuleEvaluator(tx, task, env, step)
+	if er != nil {
+		return false, er
+	}
+	if er := ev.CheckVoter(userId); er != nil {
+		return false, er
+	}
+
+	if er := createTaskApproval(tx, models.TaskApproval{
+		TaskId:  task.Id,
+		Step:    step.Index,
+		UserId:  userId,
+		Action:  action,
+		Comment: comment,
+	}); er != nil {
+		return false, er
+	}
+
+	if action == models.TaskApprovalRejected {
+		return true, RejectTaskStep(tx, task.Id, step.Index, userId)
+	}
+
+	approvals, er := getTaskStepApprovals(tx, task.Id, step.Index)
+	if er != nil {
+		return false, er
+	}
+	if ok, _ := ev.Approved(approvals); !ok {
+		return false, nil
+	}
+	return true, ApproveTaskStep(tx, task.Id, step.Index, userId)
+}
+
+// AutoApproveTaskStep 执行计划满足所有审批规则的自动审批条件时自动通过审批，返回是否已自动审批
+func AutoApproveTaskStep(tx *db.Session, taskId models.Id, step *models.TaskStep) (bool, e.Error) {
+	// 重新查询任务以获取 plan 结果
+	task, er := GetTaskById(tx, taskId)
+	if er != nil {
+		return false, er
+	}
+	env, er := GetEnvById(tx, task.EnvId)
+	if er != nil {
+		return false, er
+	}
+	ev, er := newApprovalRuleEvaluator(tx, task, env, step)
+	if er != nil {
+		return false, er
+	}
+	if !ev.AutoApproved() {
+		return false, nil
+	}
+
+	if er := createTaskApproval(tx, models.TaskApproval{
+		TaskId:  task.Id,
+		Step:    step.Index,
+		UserId:  consts.SysUserId,
+		Action:  models.TaskApprovalApproved,
+		Comment: "auto approved by approval rules",
+	}); er != nil && er.Code() != e.TaskAlreadyVoted {
+		return false, er
+	}
+	return true, ApproveTaskStep(tx, task.Id, step.Index, consts.SysUserId)
+}
+
+// CheckTaskStepApprovals 检查已通过审批的步骤是否满足审批规则，
+// 审批规则或者环境保护设置在任务审批过程中被修改时，之前的审批可能不满足要求
+func CheckTaskStepApprovals(tx *db.Session, task *models.Task, step *models.TaskStep) e.Error {
+	task, er := GetTaskById(tx, task.Id)
+	if er != nil {
+		return er
+	}
+	env, er := GetEnvById(tx, task.EnvId)
+	if er != nil {
+		return er
+	}
+	ev, er := newApprovalRuleEvaluator(tx, task, env, step)
+	if er != nil {
+		return er
+	}
+	approvals, er := getTaskStepApprovals(tx, task.Id, step.Index)
+	if er != nil {
+		return er
+	}
+	if len(approvals) == 0 && step.ApproverId != "" {
+		// 没有审批记录时(如升级前已审批的任务)以步骤的审批人作为审批记录
+		approvals = append(approvals, models.TaskApproval{UserId: step.ApproverId, Action: models.TaskApprovalApproved})
+	}
+	// 受保护环境只统计审批组成员的审批
+	valid := make([]models.TaskApproval, 0, len(approvals))
+	for _, a := range approvals {
+		if CheckEnvApprover(tx, env, a.UserId) == nil {
+			valid = append(valid, a)
+		}
+	}
+	if ok, unsatisfied := ev.Approved(valid); !ok {
+		return e.New(e.TaskApproverNotEligible,
+			fmt.Errorf("approval rules not satisfied: %s", strings.Join(unsatisfied, ", ")))
+	}
+	return nil
+}
+
+// ExpireTaskStepApproval 超过审批超时时间未完成审批的步骤自动驳回
+func ExpireTaskStepApproval(tx *db.Session, task *models.Task, step *models.TaskStep, ttl time.Duration) e.Error {
+	message := fmt.Sprintf("approval expired: not approved within %s", ttl)
+	if er := createTaskApproval(tx, models.TaskApproval{
+		TaskId:  task.Id,
+		Step:    step.Index,
+		UserId:  consts.SysUserId,
+		Action:  models.TaskApprovalRejected,
+		Comment: message,
+	}); er != nil && er.Code() != e.TaskAlreadyVoted {
+		return er
+	}
+	step.ApproverId = consts.SysUserId
+	if _, err := tx.Model(&models.TaskStep{}).Where("id = ?", step.Id).
+		UpdateAttrs(models.Attrs{"approver_id": consts.SysUserId}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return ChangeTaskStepStatus(tx, task, step, models.TaskStepRejected, message)
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils/logs"
+)
+
+// AddTaskEvent 记录任务时间线事件，step 为 nil 时表示事件与具体步骤无关
+func AddTaskEvent(tx *db.Session, task models.Tasker, step *models.TaskStep, typ, message, related string) (*models.TaskEvent, e.Error) {
+	event := models.TaskEvent{
+		TaskId:   task.GetId(),
+		Type:     typ,
+		RunnerId: task.GetRunnerId(),
+		Message:  message,
+		Related:  related,
+	}
+	if step != nil {
+		event.StepId = step.Id
+		event.Step = step.Index
+	}
+	if err := models.Create(tx, &event); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	logs.Get().WithField("taskId", task.GetId()).Infof("task event %s: %s", typ, message)
+	return &event, nil
+}
+
+// QueryTaskEvents 查询任务时间线，按事件发生的先后排序
+func QueryTaskEvents(sess *db.Session, taskId models.Id) *db.Session {
+	return sess.Model(&models.TaskEvent{}).Where("task_id = ?", taskId).Order("created_at")
+}
+
+func CountTaskEvents(sess *db.Session, taskId models.Id, typ string) (int64, e.Error) {
+	n, err := sess.Model(&models.TaskEvent{}).Where("task_id = ? AND type = ?", taskId, typ).Count()
+	if err != nil {
+		return 0, e.New(e.DBError, err)
+	}
+	return n, nil
+}
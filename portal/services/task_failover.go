@@ -0,0 +1,66 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+)
+
+// 不会修改云资源及 state 的步骤，runner 失联后可以在其他 runner 上重新执行
+var reschedulableStepTypes = []string{
+	common.TaskStepCheckout,
+	common.TaskStepTfInit,
+	common.TaskStepTfPlan,
+	common.TaskStepScanInit,
+	common.TaskStepTplParse,
+	common.TaskStepTplScan,
+	common.TaskStepEnvParse,
+	common.TaskStepEnvScan,
+	common.TaskStepOpaScan,
+}
+
+func IsReschedulableStep(typ string) bool {
+	return utils.StrInArray(typ, reschedulableStepTypes...)
+}
+
+// CanRescheduleTask 任务重新调度后需要从第一个步骤开始执行，
+// 所以 lostStep 及之前的步骤都可以重复执行时任务才能被重新调度
+func CanRescheduleTask(steps []*models.TaskStep, lostStep *models.TaskStep) bool {
+	for _, s := range steps {
+		if s.Index > lostStep.Index || s.IsCallback {
+			continue
+		}
+		if !IsReschedulableStep(s.Type) {
+			return false
+		}
+	}
+	return true
+}
+
+// RescheduleTask 将任务重新分配给 runnerId 执行，lostStep 及之前的步骤会被重置为 pending 状态
+func RescheduleTask(tx *db.Session, task models.Tasker, lostStep *models.TaskStep, runnerId string) e.Error {
+	if _, err := tx.Model(&models.TaskStep{}).
+		Where("task_id = ? AND `index` <= ? AND is_callback = ?", task.GetId(), lostStep.Index, false).
+		UpdateAttrs(models.Attrs{
+			"status":    models.TaskStepPending,
+			"message":   "",
+			"exit_code": 0,
+			"start_at":  nil,
+			"end_at":    nil,
+		}); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	if _, err := tx.Model(task).Where("id = ?", task.GetId()).UpdateAttrs(models.Attrs{
+		"runner_id":    runnerId,
+		"container_id": "",
+		"curr_step":    0,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
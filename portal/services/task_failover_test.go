@@ -0,0 +1,34 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanRescheduleTask(t *testing.T) {
+	newStep := func(index int, typ string) *models.TaskStep {
+		return &models.TaskStep{PipelineStep: models.PipelineStep{Type: typ}, Index: index}
+	}
+	steps := []*models.TaskStep{
+		newStep(0, common.TaskStepCheckout),
+		newStep(1, common.TaskStepTfInit),
+		newStep(2, common.TaskStepTfPlan),
+		newStep(3, common.TaskStepEnvScan),
+		newStep(4, common.TaskStepTfApply),
+		newStep(5, common.TaskStepAnsiblePlay),
+	}
+
+	assert.True(t, CanRescheduleTask(steps, steps[2]))
+	assert.True(t, CanRescheduleTask(steps, steps[3]))
+	assert.False(t, CanRescheduleTask(steps, steps[4]))
+	assert.False(t, CanRescheduleTask(steps, steps[5]))
+
+	// 自定义流程中在 plan 之前执行的 command 步骤可能有副作用，不能重新调度
+	custom := []*models.TaskStep{newStep(0, common.TaskStepCheckout), newStep(1, common.TaskStepCommand), newStep(2, common.TaskStepTfPlan)}
+	assert.False(t, CanRescheduleTask(custom, custom[2]))
+}
@@ -7,6 +7,7 @@ import (
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
 	"time"
@@ -126,6 +127,10 @@ func changeTaskStepStatusAndExitCode(dbSess *db.Session, task models.Tasker, tas
 		taskStep.EndAt = &now
 		updateAttrs["end_at"] = &now
 	}
+	if taskStep.Status == models.TaskStepApproving && taskStep.ApprovingAt == nil {
+		taskStep.ApprovingAt = &now
+		updateAttrs["approving_at"] = &now
+	}
 
 	if taskStep.Id == "" {
 		// id 为空表示是生成的功能性步骤，非任务的流程步骤，
@@ -169,8 +174,12 @@ func newTaskStep(task models.Task, stepBody models.PipelineStep, index int) *mod
 		RetryNumber:  task.RetryNumber,
 	}
 
-	// apply 和 destroy 步骤需要审批
-	if !task.AutoApprove && (s.Type == common.TaskStepTfApply || s.Type == common.TaskStepTfDestroy) {
+	// apply、destroy 和 import 步骤需要审批，审批前会先执行 plan 以便预览变更
+	if !task.AutoApprove && utils.StrInArray(s.Type, common.TaskStepTfApply, common.TaskStepTfDestroy, common.TaskStepTfImport) {
+		s.MustApproval = true
+	}
+	// state 操作无法通过 plan 预览结果，总是需要审批
+	if s.Type == common.TaskStepTfState {
 		s.MustApproval = true
 	}
 
@@ -263,3 +272,25 @@ func UpdateTaskStepRetryNum(sess *db.Session, stepId models.Id, num int, nextTim
 	}
 	return nil
 }
+
+// PurgeStepLogs 删除 before 之前结束的步骤日志，每次最多处理 limit 个步骤，返回处理的步骤数量。
+// 日志删除后步骤的 LogPath 会被清空，避免重复处理
+func PurgeStepLogs(sess *db.Session, before time.Time, limit int) (int, error) {
+	steps := make([]*models.TaskStep, 0)
+	if err := sess.Model(&models.TaskStep{}).Where("end_at < ? AND log_path != ''", before).
+		Limit(limit).Find(&steps); err != nil {
+		return 0, err
+	}
+
+	storage := logstorage.Get()
+	for i, step := range steps {
+		if err := storage.Delete(step.LogPath); err != nil {
+			return i, err
+		}
+		if _, err := sess.Model(&models.TaskStep{}).Where("id = ?", step.Id).
+			UpdateColumn("log_path", ""); err != nil {
+			return i, err
+		}
+	}
+	return len(steps), nil
+}
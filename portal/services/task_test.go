@@ -4,6 +4,7 @@ package services
 
 import (
 	"cloudiac/policy"
+	"cloudiac/portal/models"
 	"cloudiac/portal/models/resps"
 	"encoding/json"
 	"testing"
@@ -323,3 +324,9 @@ func TestUnmarshalTfResultJson(t *testing.T) {
 		})
 	}
 }
+
+func TestReadTaskStepLogPurged(t *testing.T) {
+	content, err := ReadTaskStepLog(&models.TaskStep{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "purged")
+}
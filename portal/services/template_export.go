@@ -36,6 +36,7 @@ type exportedTpl struct {
 	Playbook     string `json:"playbook"`
 	PlayVarsFile string `json:"playVarsFile"`
 	TfVersion    string `json:"tfVersion"`
+	IacEngine    string `json:"iacEngine"`
 
 	Variables   []exportedTplVar `json:"variables"`
 	VarGroupIds []models.Id      `json:"varGroupIds"`
@@ -143,6 +144,7 @@ func appendTemplate(tpls []models.Template, vars []models.Variable, dbSess *db.S
 			Playbook:     t.Playbook,
 			PlayVarsFile: t.PlayVarsFile,
 			TfVersion:    t.TfVersion,
+			IacEngine:    t.IacEngine,
 			Variables:    []exportedTplVar{},
 		}
 
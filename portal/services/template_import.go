@@ -420,6 +420,7 @@ func (t *TplImporter) getTplFromExportData(tpl exportedTpl) (*models.Template, e
 		PlayVarsFile:   tpl.PlayVarsFile,
 		LastScanTaskId: "",
 		TfVersion:      tpl.TfVersion,
+		IacEngine:      tpl.IacEngine,
 	}
 	newTpl.Id = models.Id(tpl.Id)
 
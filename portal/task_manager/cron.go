@@ -3,6 +3,7 @@
 package task_manager
 
 import (
+	"cloudiac/configs"
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/services"
 	"cloudiac/utils/logs"
@@ -25,6 +26,48 @@ func billCron(ctx context.Context) {
 	}()
 }
 
+// logRetentionCron 按配置的保留天数定时清理过期的步骤日志
+func logRetentionCron(ctx context.Context) {
+	if configs.Get().LogStorage.RetentionDays <= 0 {
+		return
+	}
+
+	c := cron.New()
+	if _, err := c.AddFunc("@daily", cronPurgeStepLogs); err != nil {
+		logs.Get().Error("log retention cron task start failed")
+		return
+	}
+	c.Start()
+
+	go func() {
+		<-ctx.Done()
+		c.Stop()
+	}()
+}
+
+func cronPurgeStepLogs() {
+	logger := logs.Get().WithField("action", "log retention cron task")
+	retentionDays := configs.Get().LogStorage.RetentionDays
+	before := time.Now().AddDate(0, 0, -retentionDays)
+	logger.Infof("start purge step logs before %s", before.Format("2006-01-02 15:04:05"))
+
+	const batchSize = 500
+	total := 0
+	for {
+		n, err := services.PurgeStepLogs(db.Get(), before, batchSize)
+		total += n
+		if err != nil {
+			logger.Errorf("purge step logs error: %v", err)
+			break
+		}
+		if n < batchSize {
+			break
+		}
+	}
+
+	logger.Infof("stop purge step logs, %d purged", total)
+}
+
 func cronBillCollectTask() {
 	logger := logs.Get().WithField("action", "billing cron task")
 	logger.Info("start bill collect")
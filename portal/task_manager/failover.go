@@ -0,0 +1,115 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"fmt"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// maxTaskReschedule 任务因 runner 失联被重新调度的最大次数
+const maxTaskReschedule = 3
+
+// markTaskStepLost 将 runner 失联的步骤标记为 lost，并记录到任务时间线
+func markTaskStepLost(sess *db.Session, task models.Tasker, step *models.TaskStep, changeStepStatus changeStepStatusFunc) {
+	message := fmt.Sprintf("runner %s lost", task.GetRunnerId())
+	changeStepStatus(models.TaskStepLost, message, step)
+	addTaskEvent(sess, task, step, models.TaskEventRunnerLost, message, "")
+}
+
+func addTaskEvent(sess *db.Session, task models.Tasker, step *models.TaskStep, typ, message, related string) {
+	if _, er := services.AddTaskEvent(sess, task, step, typ, message, related); er != nil {
+		logs.Get().WithField("taskId", task.GetId()).Errorf("add task event %s: %v", typ, er)
+	}
+}
+
+// failoverTask runner 失联后尝试将任务重新调度到其他匹配 tags 的 runner，返回 true 表示任务需要从头重新执行。
+// 只有由系统自动选择 runner 的任务，且失联前执行的步骤都不会修改云资源时才会重新调度；
+// 执行 apply 等变更步骤时失联的任务需要由用户发起恢复(force-unlock + refresh)
+func (m *TaskManager) failoverTask(task models.Tasker, steps []*models.TaskStep, lostStep *models.TaskStep) bool {
+	logger := m.logger.WithField("taskId", task.GetId()).WithField("func", "failoverTask")
+	base, _ := taskSchedInfo(task)
+
+	if !services.CanRescheduleTask(steps, lostStep) {
+		if t, ok := task.(*models.Task); ok && utils.StrInArray(lostStep.Type,
+			models.TaskStepApply, models.TaskStepDestroy, models.TaskStepImport, models.TaskStepState) {
+			m.requireTaskRecovery(t, lostStep)
+		}
+		return false
+	}
+	if !base.AutoRunner {
+		logger.Infof("task runner %s is specified, skip reschedule", base.RunnerId)
+		return false
+	}
+	if n, er := services.CountTaskEvents(m.db, task.GetId(), models.TaskEventRescheduled); er != nil {
+		logger.Errorf("count task reschedule: %v", er)
+		return false
+	} else if n >= maxTaskReschedule {
+		logger.Infof("task has been rescheduled %d times, give up", n)
+		return false
+	}
+
+	runners, er := services.RunnerSearch()
+	if er != nil {
+		logger.Errorf("search runners: %v", er)
+		return false
+	}
+	candidates := make([]*api.AgentService, 0, len(runners))
+	slots := make(map[string]int, len(runners))
+	for _, r := range runners {
+		if r.ID == base.RunnerId {
+			continue
+		}
+		candidates = append(candidates, r)
+		slots[r.ID] = services.RunnerSlots(r)
+	}
+	loads, _ := m.copyTaskNum()
+	runnerId := pickRunner(candidates, base.RunnerTags, loads, slots)
+	if runnerId == "" {
+		logger.Infof("no available runner with tags '%s' to reschedule", base.RunnerTags)
+		return false
+	}
+
+	if er := services.RescheduleTask(m.db, task, lostStep, runnerId); er != nil {
+		logger.Errorf("reschedule task: %v", er)
+		return false
+	}
+	if t, ok := task.(*models.Task); ok {
+		// plan 步骤执行时会锁定 state，这里只释放失联步骤开始后创建的锁。
+		// 只能释放 portal 托管的 state 锁，其他 backend 的锁需要用户手动解除
+		if er := services.ReleaseStepStateLock(m.db, t.EnvId, lostStep); er != nil {
+			logger.Warnf("release env state lock: %v", er)
+		}
+	}
+	addTaskEvent(m.db, task, lostStep, models.TaskEventRescheduled,
+		fmt.Sprintf("step %s lost on runner %s, rescheduled to runner %s", lostStep, base.RunnerId, runnerId), runnerId)
+
+	m.changeTaskNum(task, -1)
+	base.RunnerId = runnerId
+	base.ContainerId = ""
+	base.CurrStep = 0
+	m.changeTaskNum(task, 1)
+	return true
+}
+
+// requireTaskRecovery 变更步骤执行过程中 runner 失联，state 可能仍处于锁定状态且与实际资源不一致，
+// 记录需要恢复的事件，使用 portal 托管 state 时同时记录当前的锁 id
+func (m *TaskManager) requireTaskRecovery(task *models.Task, lostStep *models.TaskStep) {
+	lockId := ""
+	if lock, er := services.GetEnvStateLock(m.db, task.EnvId); er != nil {
+		m.logger.WithField("taskId", task.Id).Warnf("get env state lock: %v", er)
+	} else if lock != nil {
+		lockId = lock.LockId
+	}
+
+	message := fmt.Sprintf("runner lost while running step %s, "+
+		"the state may be locked and out of sync with the resources, "+
+		"recover the task to force-unlock and refresh the state", lostStep)
+	addTaskEvent(m.db, task, lostStep, models.TaskEventRecoveryRequired, message, lockId)
+}
@@ -13,6 +13,7 @@ import (
 	"cloudiac/portal/models"
 	"cloudiac/portal/services"
 	"cloudiac/portal/services/logstorage"
+	"cloudiac/portal/services/statebackend"
 	"cloudiac/runner"
 	"cloudiac/utils"
 	"cloudiac/utils/consul"
@@ -20,21 +21,24 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"path"
 	"path/filepath"
-	"regexp"
 	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/acarl005/stripansi"
+	"github.com/hashicorp/consul/api"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 const (
 	TaskManagerLockKey = "task-manager-lock"
+	// TaskManagerLeaseTTL 使用数据库锁时锁的有效期，持有锁的实例异常退出后其他实例最长需要等待该时间
+	TaskManagerLeaseTTL = 30 * time.Second
+
+	// acquireTaskNumInterval 审批通过的任务等待 runner 空闲时的检查间隔
+	acquireTaskNumInterval = 2 * time.Second
 )
 
 var (
@@ -46,12 +50,12 @@ type TaskManager struct {
 	db     *db.Session
 	logger logs.Logger
 
-	envRunningTask sync.Map       // 每个环境下正在执行的任务
-	runnerTaskNum  map[string]int // 每个 runner 正在执行的任务数量
+	envRunningTask sync.Map          // 每个环境下正在执行的任务
+	runnerTaskNum  map[string]int    // 每个 runner 正在执行的任务数量
+	queueTaskNum   map[models.Id]int // 每个调度队列正在执行的任务数量
+	taskNumLock    sync.Mutex
 
 	wg sync.WaitGroup // 等待执行任务协程退出的 wait group
-
-	maxTasksPerRunner int // 每个 runner 并发任务数量限制
 }
 
 func Start(serviceId string) {
@@ -79,11 +83,15 @@ func (m *TaskManager) reset() {
 	m.db = db.Get()
 	m.envRunningTask = sync.Map{}
 	m.runnerTaskNum = make(map[string]int)
+	m.queueTaskNum = make(map[models.Id]int)
 	m.wg = sync.WaitGroup{}
-	m.maxTasksPerRunner = services.GetRunnerMax()
 }
 
 func (m *TaskManager) acquireLock(ctx context.Context) (<-chan struct{}, error) {
+	if configs.Get().UseDBRegistry() {
+		return services.AcquireLease(ctx, TaskManagerLockKey, m.id, TaskManagerLeaseTTL)
+	}
+
 	locker, err := consul.GetLocker(TaskManagerLockKey, []byte(m.id), configs.Get().Consul.Address, false)
 	if err != nil {
 		return nil, errors.Wrap(err, "get locker")
@@ -139,6 +147,8 @@ func (m *TaskManager) start() {
 
 	// 启动账单采集定时任务
 	billCron(ctx)
+	// 启动日志清理定时任务
+	logRetentionCron(ctx)
 
 	// 恢复执行中的任务状态
 	if err = m.recoverTask(ctx); err != nil {
@@ -160,6 +170,12 @@ func (m *TaskManager) start() {
 			m.logger.Errorf("process auto deploy error: %v", err)
 		}
 
+		m.logger.Trace("start process env chains")
+		m.processEnvChains()
+
+		m.logger.Trace("start process stack runs")
+		m.processStackRuns()
+
 		m.logger.Trace("start process pending tasks")
 		m.processPendingTask(ctx)
 
@@ -238,6 +254,7 @@ func (m *TaskManager) beginCronDriftTask() {
 	}
 
 	// 限制每次删除的历史数据数量，避免耗时过长
+	// (资源漂移记录保存在 iac_resource_drift_record 中，不随历史任务删除)
 	if n, err := services.DeleteHistoryDrfitCronTask(m.db, 256); err != nil {
 		// 删除历史数据失败不影响其他流程
 		logger.Errorf("delete expired drift task and steps failed, error: %v", err)
@@ -288,7 +305,7 @@ func (m *TaskManager) recoverTask(ctx context.Context) error {
 	return nil
 }
 
-func (m *TaskManager) getPendingDeployTasks() []*models.Task {
+func (m *TaskManager) getPendingDeployTasks(limitedRunners []string) []*models.Task {
 	logger := m.logger
 
 	runningEnvs := make([]models.Id, 0)
@@ -315,62 +332,234 @@ func (m *TaskManager) getPendingDeployTasks() []*models.Task {
 		query = query.Where("iac_task.env_id NOT IN (?)", runningEnvs)
 	}
 
-	limitedRunners := m.getLimitedRunner()
 	if len(limitedRunners) > 0 {
-		// 查询时过滤掉己达并发限制的 runner
-		query = query.Where("runner_id NOT IN (?)", limitedRunners)
+		// 查询时过滤掉已达并发限制的 runner，自动选择 runner 的任务在调度时再分配
+		query = query.Where("iac_task.auto_runner = ? OR iac_task.runner_id NOT IN (?)", true, limitedRunners)
 	}
 
-	queryTaskLimit := 64 // 单次查询任务数量限制
+	// 单次查询任务数量限制，优先级高的任务先查询，同一优先级下先查询各项目排在前面的任务，
+	// 避免单个项目的大量任务占满查询数量，之后由 fairOrder() 按权重在各项目间公平调度
+	queryTaskLimit := 256
+	rankQuery := query.Select("iac_task.id, " + queueRankExpr("iac_task"))
 	tasks := make([]*models.Task, 0)
-	if err := query.Limit(queryTaskLimit).Find(&tasks); err != nil {
+	if err := m.db.Model(&models.Task{}).Joins("JOIN (?) AS r ON r.id = iac_task.id", rankQuery.Expr()).
+		Order("iac_task.priority DESC, r.queue_rank, iac_task.created_at").
+		Limit(queryTaskLimit).Find(&tasks); err != nil {
 		logger.Panicf("find '%s' task error: %v", models.TaskPending, err)
 	}
 
 	return tasks
 }
 
-func (m *TaskManager) getPendingScanTasks() []*models.ScanTask {
+func (m *TaskManager) getPendingScanTasks(limitedRunners []string) []*models.ScanTask {
 	logger := m.logger
 
 	// 扫描类型任务支持多个并行执行，不会互相影响，这里获取所有处于 pending 状态的任务列表
 	query := m.db.Model(&models.ScanTask{}).Where("status = ? AND mirror = 0", models.TaskPending)
 
-	limitedRunners := m.getLimitedRunner()
 	if len(limitedRunners) > 0 {
 		// 查询时过滤掉己达并发限制的 runner
-		query = query.Where("runner_id NOT IN (?)", limitedRunners)
+		query = query.Where("auto_runner = ? OR runner_id NOT IN (?)", true, limitedRunners)
 	}
 
-	queryTaskLimit := 64 // 单次查询任务数量限制
+	queryTaskLimit := 64 // 单次查询任务数量限制，与部署任务一样优先查询各队列排在前面的任务
+	rankQuery := query.Select("id, " + queueRankExpr("iac_scan_task"))
 	tasks := make([]*models.ScanTask, 0)
-	if err := query.Limit(queryTaskLimit).Find(&tasks); err != nil {
+	if err := m.db.Model(&models.ScanTask{}).Joins("JOIN (?) AS r ON r.id = iac_scan_task.id", rankQuery.Expr()).
+		Order("iac_scan_task.priority DESC, r.queue_rank, iac_scan_task.created_at").
+		Limit(queryTaskLimit).Find(&tasks); err != nil {
 		logger.Panicf("find '%s' task error: %v", models.TaskPending, err)
 	}
 
 	return tasks
 }
 
-func (m *TaskManager) getLimitedRunner() []string {
+// queueRankExpr 返回任务在其调度队列(同一优先级)中的排序序号，调度队列的划分与 taskSchedInfo() 一致
+func queueRankExpr(table string) string {
+	return fmt.Sprintf("ROW_NUMBER() OVER (PARTITION BY COALESCE(NULLIF(%[1]s.project_id, ''), %[1]s.org_id), %[1]s.priority "+
+		"ORDER BY %[1]s.created_at, %[1]s.id) AS queue_rank", table)
+}
+
+// runnerSlots 返回 runner 的并发任务数量限制，不在 runner 列表中的 runner 使用系统设置
+func runnerSlots(slots map[string]int, runnerId string) int {
+	if n, ok := slots[runnerId]; ok {
+		return n
+	}
+	return services.GetRunnerMax()
+}
+
+func (m *TaskManager) getLimitedRunner(slots map[string]int) []string {
+	m.taskNumLock.Lock()
+	defer m.taskNumLock.Unlock()
+
 	limitedRunners := make([]string, 0)
 	for runnerId, count := range m.runnerTaskNum {
-		if count >= m.maxTasksPerRunner {
+		if count >= runnerSlots(slots, runnerId) {
 			limitedRunners = append(limitedRunners, runnerId)
 		}
 	}
 	return limitedRunners
 }
 
+// changeTaskNum 任务开始及结束时更新 runner 及调度队列正在执行的任务数量
+func (m *TaskManager) changeTaskNum(task models.Tasker, delta int) {
+	m.taskNumLock.Lock()
+	defer m.taskNumLock.Unlock()
+	m.changeTaskNumLocked(task, delta)
+}
+
+func (m *TaskManager) changeTaskNumLocked(task models.Tasker, delta int) {
+	_, queue := taskSchedInfo(task)
+	m.runnerTaskNum[task.GetRunnerId()] += delta
+	m.queueTaskNum[queue] += delta
+}
+
+// acquireTaskNum 等待 runner 有空闲后重新占用任务数，用于审批通过后继续执行的任务。
+// ctx 被取消时同样会占用任务数并返回错误，以便任务结束时统一释放
+func (m *TaskManager) acquireTaskNum(ctx context.Context, task models.Tasker) error {
+	runnerId := task.GetRunnerId()
+	for {
+		slots := make(map[string]int)
+		if runners, er := services.RunnerSearch(); er != nil {
+			m.logger.Warnf("search runners error: %v", er)
+		} else {
+			for _, r := range runners {
+				slots[r.ID] = services.RunnerSlots(r)
+			}
+		}
+
+		m.taskNumLock.Lock()
+		acquired := m.runnerTaskNum[runnerId] < runnerSlots(slots, runnerId)
+		if acquired {
+			m.changeTaskNumLocked(task, 1)
+		}
+		m.taskNumLock.Unlock()
+		if acquired {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			m.changeTaskNum(task, 1)
+			return ctx.Err()
+		case <-time.After(acquireTaskNumInterval):
+		}
+	}
+}
+
+func (m *TaskManager) copyTaskNum() (map[string]int, map[models.Id]int) {
+	m.taskNumLock.Lock()
+	defer m.taskNumLock.Unlock()
+
+	runnerNum := make(map[string]int, len(m.runnerTaskNum))
+	for k, v := range m.runnerTaskNum {
+		runnerNum[k] = v
+	}
+	queueNum := make(map[models.Id]int, len(m.queueTaskNum))
+	for k, v := range m.queueTaskNum {
+		queueNum[k] = v
+	}
+	return runnerNum, queueNum
+}
+
+// getQueueWeights 查询调度队列(项目或组织)的权重，项目队列的权重为项目权重与所属组织权重的乘积
+func (m *TaskManager) getQueueWeights(tasks []models.Tasker) map[models.Id]int {
+	projectIds := make([]models.Id, 0, len(tasks))
+	orgIds := make([]models.Id, 0, len(tasks))
+	for _, t := range tasks {
+		switch t := t.(type) {
+		case *models.Task:
+			projectIds, orgIds = append(projectIds, t.ProjectId), append(orgIds, t.OrgId)
+		case *models.ScanTask:
+			projectIds, orgIds = append(projectIds, t.ProjectId), append(orgIds, t.OrgId)
+		}
+	}
+
+	weights := make(map[models.Id]int)
+	if len(orgIds) == 0 {
+		return weights
+	}
+
+	orgs := make([]struct {
+		Id          models.Id
+		QueueWeight int
+	}, 0)
+	if err := m.db.Model(&models.Organization{}).Select("id, queue_weight").
+		Where("id IN (?)", orgIds).Scan(&orgs); err != nil {
+		m.logger.Errorf("query org queue weight error: %v", err)
+	}
+	for _, r := range orgs {
+		weights[r.Id] = r.QueueWeight
+	}
+
+	projects := make([]struct {
+		Id          models.Id
+		OrgId       models.Id
+		QueueWeight int
+	}, 0)
+	if err := m.db.Model(&models.Project{}).Select("id, org_id, queue_weight").
+		Where("id IN (?)", projectIds).Scan(&projects); err != nil {
+		m.logger.Errorf("query project queue weight error: %v", err)
+	}
+	for _, r := range projects {
+		weights[r.Id] = r.QueueWeight * utils.FirstValueInt(weights[r.OrgId], 1)
+	}
+	return weights
+}
+
+// assignRunner 检查任务的 runner 是否可以执行任务，自动选择 runner 的任务会重新选择负载最低的 runner。
+// 返回 false 表示暂时没有可用的 runner
+func (m *TaskManager) assignRunner(task models.Tasker, runners []*api.AgentService, slots map[string]int) bool {
+	logger := m.logger.WithField("taskId", task.GetId())
+	base, _ := taskSchedInfo(task)
+	loads, _ := m.copyTaskNum()
+
+	if !base.AutoRunner {
+		if n := loads[base.RunnerId]; n >= runnerSlots(slots, base.RunnerId) {
+			logger.WithField("count", n).Infof("runner %s: %v", base.RunnerId, ErrMaxTasksPerRunner)
+			return false
+		}
+		return true
+	}
+
+	runnerId := pickRunner(runners, base.RunnerTags, loads, slots)
+	if runnerId == "" {
+		logger.Infof("no available runner with tags '%s': %v", base.RunnerTags, ErrMaxTasksPerRunner)
+		return false
+	}
+	if runnerId != base.RunnerId {
+		if _, err := m.db.Model(task).Where("id = ?", task.GetId()).
+			UpdateAttrs(models.Attrs{"runner_id": runnerId}); err != nil {
+			logger.Errorf("update task runner error: %v", err)
+			return false
+		}
+		logger.Infof("task runner changed: %s -> %s", base.RunnerId, runnerId)
+		base.RunnerId = runnerId
+	}
+	return true
+}
+
 func (m *TaskManager) processPendingTask(ctx context.Context) {
 	logger := m.logger
 
-	scanTasks := m.getPendingScanTasks()
+	runners, er := services.RunnerSearch()
+	if er != nil {
+		logger.Errorf("search runners error: %v", er)
+		return
+	}
+	slots := make(map[string]int, len(runners))
+	for _, r := range runners {
+		slots[r.ID] = services.RunnerSlots(r)
+	}
+	limitedRunners := m.getLimitedRunner(slots)
+
+	scanTasks := m.getPendingScanTasks(limitedRunners)
 	m.logger.Tracef("get pending scan tasks: %d", len(scanTasks))
-	deployTasks := m.getPendingDeployTasks()
+	deployTasks := m.getPendingDeployTasks(limitedRunners)
 	m.logger.Tracef("get pending deploy tasks: %d", len(deployTasks))
 	tasks := make([]models.Tasker, len(scanTasks)+len(deployTasks))
 
-	// 合并等待任务列表，扫描任务更轻量，我们先执行扫描任务
+	// 合并等待任务列表，同一优先级下扫描任务更轻量，我们先执行扫描任务
 	for idx := range scanTasks {
 		tasks[idx] = scanTasks[idx]
 	}
@@ -378,6 +567,8 @@ func (m *TaskManager) processPendingTask(ctx context.Context) {
 	for idx := range deployTasks {
 		tasks[scanTasksLen+idx] = deployTasks[idx]
 	}
+	_, queueNum := m.copyTaskNum()
+	tasks = fairOrder(tasks, queueNum, m.getQueueWeights(tasks))
 
 	for i := range tasks {
 		select {
@@ -387,12 +578,28 @@ func (m *TaskManager) processPendingTask(ctx context.Context) {
 		}
 
 		task := tasks[i]
+		if t, ok := task.(*models.Task); ok {
+			// 批量编排中的任务需要等待其依赖的任务执行完成
+			if ready, er := services.StackRunTaskReady(m.db, t.Id); er != nil {
+				logger.WithField("taskId", t.Id).Errorf("check stack run task ready error: %v", er)
+				continue
+			} else if !ready {
+				continue
+			}
+
+			// 冻结期内或者不在变更窗口内时部署任务直接失败
+			if er := services.CheckTaskChangeWindow(m.db, t, time.Now()); er != nil {
+				logger.WithField("taskId", t.Id).Infof("task blocked by change window: %v", er)
+				if er := services.ChangeTaskStatus(m.db, t, models.TaskFailed, er.Error(), true); er != nil {
+					logger.WithField("taskId", t.Id).Errorf("change task status error: %v", er)
+				}
+				continue
+			}
+		}
 		m.logger.Infof("process pending task: %s", task.GetId())
 
-		// 判断 runner 并发数量
-		n := m.runnerTaskNum[task.GetRunnerId()]
-		if n >= m.maxTasksPerRunner {
-			logger.WithField("count", n).Infof("runner %s: %v", task.GetRunnerId(), ErrMaxTasksPerRunner)
+		// 判断 runner 并发数量，并为自动选择 runner 的任务分配负载最低的 runner
+		if !m.assignRunner(task, runners, slots) {
 			continue
 		}
 
@@ -421,12 +628,14 @@ func (m *TaskManager) runTask(ctx context.Context, task models.Tasker) error {
 		}
 	}
 
+	m.changeTaskNum(task, 1)
 	m.wg.Add(1)
 	go func() {
 		defer func() {
 			if t, ok := task.(*models.Task); ok {
 				m.envRunningTask.Delete(t.EnvId)
 			}
+			m.changeTaskNum(task, -1)
 			m.wg.Done()
 		}()
 
@@ -541,18 +750,16 @@ func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startEr
 		taskStartFailed(errors.Wrap(err, "get task steps"))
 		return
 	}
-	var PlanIndex int
 	for _, step := range steps {
-		if step.PipelineStep.Type == models.TaskStepPlan {
-			PlanIndex = step.Index
-		}
 		if step.PipelineStep.Type == models.TaskStepApply {
 			if task.Source == consts.TaskSourceDriftApply {
-				if bs, err := readIfExist(task.TFPlanOutputLogPath(fmt.Sprintf("step%d", PlanIndex))); err != nil {
-					logger.Errorf("read plan output log: %v", err)
+				if bs, err := readIfExist(task.PlanJsonPath()); err != nil {
+					logger.Errorf("read plan json: %v", err)
 				} else {
-					driftInfo := ParseResourceDriftInfo(bs)
-					if len(driftInfo) <= 0 {
+					driftInfo, er := services.FilterIgnoredResourceDrift(m.db, task.EnvId, ParseResourceDriftInfo(bs))
+					if er != nil {
+						logger.Errorf("filter ignored resource drift: %v", er)
+					} else if len(driftInfo) <= 0 {
 						_ = changeTaskStatus(models.TaskStepComplete, "autoDrift source nothing changed", false)
 						logger.WithField("step", fmt.Sprintf("%d(%s)", step.Index, step.Name)).
 							Infof("auto task drift step stop ")
@@ -573,9 +780,16 @@ func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startEr
 			taskStartFailed(startErr)
 			return startErr
 		}
+		if runErr == nil && step.Type == models.TaskStepPlan {
+			runErr = m.processPlanPolicy(task, step, steps)
+		}
 		if runErr != nil {
 			logger.WithField("step", fmt.Sprintf("%d(%s)", step.Index, step.Name)).
 				Warnf("run task step error: %v", runErr)
+			if errors.Is(runErr, ErrRunnerLost) && m.failoverTask(task, steps, step) {
+				// 已重新分配 runner，从第一个步骤开始重新执行
+				return m.doRunTask(ctx, task)
+			}
 			break
 		}
 	}
@@ -624,6 +838,9 @@ func (m *TaskManager) processStartStep(
 
 	if runErr != nil {
 		logger.Warnf("run task step err: %v", runErr)
+		if errors.Is(runErr, ErrRunnerLost) {
+			return nil, runErr
+		}
 		if (step.Type == common.TaskStepEnvScan || step.Type == common.TaskStepOpaScan) &&
 			!task.StopOnViolation {
 			// 合规任务失败不影响环境部署流程
@@ -671,6 +888,16 @@ func (m *TaskManager) processStepDone(task *models.Task, step *models.TaskStep)
 			if err := services.UpdateScanResult(dbSess, scanTask, tsResult, scanTask.PolicyStatus); err != nil {
 				return fmt.Errorf("save scan result: %v", err)
 			}
+			// 合并执行计划策略的检查结果
+			if scanTask.PolicyStatus == common.PolicyStatusPassed {
+				if violated, er := services.HasViolatedPlanPolicy(dbSess, task.Id); er != nil {
+					return er
+				} else if violated {
+					if er := services.ChangeScanTaskStatus(dbSess, scanTask, "", common.PolicyStatusViolated, ""); er != nil {
+						return er
+					}
+				}
+			}
 		} else if scanTask.PolicyStatus == common.PolicyStatusFailed {
 			if err := services.CleanScanResult(dbSess, task); err != nil {
 				return fmt.Errorf("clean scan result err: %v", err)
@@ -689,6 +916,85 @@ func (m *TaskManager) processStepDone(task *models.Task, step *models.TaskStep)
 	return nil
 }
 
+// processPlanPolicy plan 完成后使用执行计划策略对执行计划进行检查
+// - deny 策略不通过且任务开启了 StopOnViolation 时将 plan 步骤标记为失败，并返回错误中止任务
+// - approval 策略不通过时后续的 apply、destroy 步骤需要人工审批
+func (m *TaskManager) processPlanPolicy(task *models.Task, planStep *models.TaskStep, steps []*models.TaskStep) error {
+	logger := m.logger.WithField("taskId", task.Id).WithField("func", "processPlanPolicy")
+
+	// 无法完成检查时，如果环境绑定了执行计划策略或开启了 StopOnViolation 则将 plan 步骤标记为失败，
+	// 避免未经检查的变更被执行
+	checkFailed := func(message string) error {
+		required := task.StopOnViolation
+		if !required {
+			has, er := services.HasTaskPlanPolicies(m.db, task)
+			if er != nil {
+				logger.Errorf("query plan policies: %v", er)
+			}
+			required = er != nil || has
+		}
+		if !required {
+			logger.Errorf("%s", message)
+			return nil
+		}
+		if er := services.ChangeTaskStepStatus(m.db, task, planStep, models.TaskStepFailed, message); er != nil {
+			logger.Errorf("change plan step status: %v", er)
+		}
+		return errors.New(message)
+	}
+
+	bs, err := readIfExist(task.PlanJsonPath())
+	if err != nil {
+		return checkFailed(fmt.Sprintf("read plan json: %v", err))
+	} else if len(bs) == 0 {
+		if has, er := services.HasTaskPlanPolicies(m.db, task); er != nil || has {
+			return checkFailed("plan json not found")
+		}
+		return nil
+	}
+
+	result, er := services.CheckTaskPlanPolicies(m.db, task, bs)
+	if er != nil {
+		return checkFailed(fmt.Sprintf("check plan policies: %v", er))
+	}
+	if !result.Violated && !result.RequireApproval {
+		return nil
+	}
+
+	if scanTask, er := services.GetMirrorScanTask(m.db, task.Id); er == nil {
+		if er := services.ChangeScanTaskStatus(m.db, scanTask, "", common.PolicyStatusViolated, ""); er != nil {
+			logger.Errorf("update scan task policy status: %v", er)
+		}
+	}
+
+	if result.RequireApproval {
+		for _, s := range steps {
+			if s.Index <= planStep.Index || (s.Type != models.TaskStepApply && s.Type != models.TaskStepDestroy) {
+				continue
+			}
+			// 记录为策略要求的审批，不能被审批规则自动通过
+			s.MustApproval = true
+			s.PolicyApproval = true
+			if _, err := m.db.Model(&models.TaskStep{}).Where("id = ?", s.Id).UpdateAttrs(models.Attrs{
+				"must_approval":   true,
+				"policy_approval": true,
+			}); err != nil {
+				logger.Errorf("update step must approval: %v", err)
+			}
+		}
+	}
+
+	if result.Violated && task.StopOnViolation {
+		message := fmt.Sprintf("plan policy violated: %s", strings.Join(result.Messages, "; "))
+		if er := services.ChangeTaskStepStatusAndExitCode(m.db, task, planStep,
+			models.TaskStepFailed, message, common.TaskStepPolicyViolationExitCode); er != nil {
+			logger.Errorf("change plan step status: %v", er)
+		}
+		return fmt.Errorf(message)
+	}
+	return nil
+}
+
 func changePlanResult(dbSess *db.Session, task *models.Task, step *models.TaskStep) {
 	logger := logs.Get()
 	if step.Type == common.TaskStepTfPlan && step.Status == models.TaskComplete {
@@ -830,11 +1136,23 @@ func (m *TaskManager) runTaskStep(
 		}
 	}
 
-	if newStep, err := waitTaskStepApprove(ctx, m.db, task, step); err != nil {
+	// 等待审批期间不占用 runner 的并发任务数，审批通过后等待 runner 有空闲时再继续执行
+	waitApproval := step.MustApproval && !step.IsApproved()
+	if waitApproval {
+		m.changeTaskNum(task, -1)
+	}
+	newStep, err := waitTaskStepApprove(ctx, m.db, task, step)
+	if waitApproval {
+		if err != nil {
+			m.changeTaskNum(task, 1)
+		} else if err = m.acquireTaskNum(ctx, task); err != nil {
+			return err
+		}
+	}
+	if err != nil {
 		return err
-	} else {
-		step = newStep
 	}
+	step = newStep
 
 	if err := waitTaskStepDone(ctx, m.db, task, step, taskReq); err != nil {
 		return err
@@ -861,6 +1179,8 @@ func (m *TaskManager) runTaskStep(
 			message = step.Message
 		}
 		return fmt.Errorf(message)
+	case models.TaskStepLost:
+		return ErrRunnerLost
 	default:
 		return fmt.Errorf("unknown step status: %v", step.Status)
 	}
@@ -878,9 +1198,35 @@ func waitTaskStepApprove(ctx context.Context, db *db.Session, task *models.Task,
 		err     error
 	)
 	if step.MustApproval && !step.IsApproved() {
+		// 执行计划满足审批规则的自动审批条件时不需要等待人工审批，执行计划策略要求的审批除外
+		if step.PolicyApproval {
+			logger.Infof("plan policy requires manual approval")
+		} else if ok, er := services.AutoApproveTaskStep(db, task.Id, step); er != nil {
+			logger.Errorf("auto approve task step: %v", er)
+		} else if ok {
+			logger.Infof("task step auto approved by approval rules")
+			return services.GetTaskStep(db, task.Id, step.Index)
+		}
+
 		logger.Infof("waitting task step approve")
 		changeStepStatus(models.TaskStepApproving, "", step)
-		if newStep, err = WaitTaskStepApprove(ctx, db, step.TaskId, step.Index); err != nil {
+
+		// 超过审批超时时间未完成审批时自动驳回
+		waitCtx := ctx
+		ttl := services.GetApprovalTTL(db)
+		if ttl > 0 && step.ApprovingAt != nil {
+			var cancel context.CancelFunc
+			waitCtx, cancel = context.WithDeadline(ctx, time.Time(*step.ApprovingAt).Add(ttl))
+			defer cancel()
+		}
+		if newStep, err = WaitTaskStepApprove(waitCtx, db, step.TaskId, step.Index); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				logger.Infof("task step approval expired")
+				if er := services.ExpireTaskStepApproval(db, task, step, ttl); er != nil {
+					logger.Errorf("expire task step approval: %v", er)
+				}
+				return nil, ErrTaskStepRejected
+			}
 			if errors.Is(err, context.Canceled) {
 				return nil, err
 			}
@@ -891,6 +1237,13 @@ func waitTaskStepApprove(ctx context.Context, db *db.Session, task *models.Task,
 			}
 			return nil, err
 		}
+
+		// 审批规则在审批过程中可能被修改，需要再次检查审批是否满足规则
+		if er := services.CheckTaskStepApprovals(db, task, newStep); er != nil {
+			logger.Warnf("task step approvals not satisfied: %v", er)
+			changeStepStatus(models.TaskStepRejected, er.Error(), newStep)
+			return nil, ErrTaskStepRejected
+		}
 	}
 	return newStep, nil
 }
@@ -961,6 +1314,10 @@ func waitTaskStepDone(
 			stepResult, err := WaitTaskStep(ctx, db, task, step)
 			if err != nil {
 				logger.Errorf("wait task result error: %v", err)
+				if errors.Is(err, ErrRunnerLost) {
+					markTaskStepLost(db, task, step, changeStepStatus)
+					return err
+				}
 				changeStepStatus(models.TaskStepFailed, err.Error(), step)
 				return err
 			}
@@ -1004,35 +1361,32 @@ func buildRunTaskReq(dbSess *db.Session, task models.Task) (taskReq *runner.RunT
 		Playbook:        task.Playbook,
 		PlayVarsFile:    task.PlayVarsFile,
 		TfVersion:       task.TfVersion,
+		IacEngine:       task.IacEngine,
 		EnvironmentVars: make(map[string]string),
 		TerraformVars:   make(map[string]string),
 		AnsibleVars:     make(map[string]string),
 	}
 
 	if runnerEnv.TfVersion == "" {
-		runnerEnv.TfVersion = consts.DefaultTerraformVersion
-	}
-	if err := buildTaskReqEnvVars(&runnerEnv, task.Variables); err != nil {
-		return nil, err
+		runnerEnv.TfVersion = runnerEnv.DefaultTfVersion()
 	}
 
-	stateStore := runner.StateStore{
-		Backend: "consul",
-		Scheme:  "http",
-		Path:    task.StatePath,
-		Address: "",
+	env, err := services.GetEnvById(dbSess, task.EnvId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get env '%s'", task.EnvId)
 	}
 
-	if configs.Get().Consul.ConsulAcl {
-		stateStore.ConsulAcl = configs.Get().Consul.ConsulAcl
-		stateStore.ConsulToken = configs.Get().Consul.ConsulAclToken
+	// 引用其他环境 output 的变量在任务执行时才进行解析，以获取依赖环境的最新 outputs
+	variables, err := services.ResolveEnvOutputRefs(dbSess, env, task.Variables)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve env output references")
 	}
-
-	if configs.Get().Consul.ConsulTls {
-		stateStore.ConsulTls = configs.Get().Consul.ConsulTls
-		stateStore.CaPath = path.Join(common.ConsulContainerPath, common.ConsulCa)
-		stateStore.CakeyPath = path.Join(common.ConsulContainerPath, common.ConsulCakey)
-		stateStore.CapemPath = path.Join(common.ConsulContainerPath, common.ConsulCapem)
+	if err := buildTaskReqEnvVars(&runnerEnv, variables); err != nil {
+		return nil, err
+	}
+	stateStore, err := statebackend.TaskStateStore(env, task.Id)
+	if err != nil {
+		return nil, err
 	}
 
 	pk := ""
@@ -1076,6 +1430,17 @@ func buildRunTaskReq(dbSess *db.Session, task models.Task) (taskReq *runner.RunT
 		taskReq.PrivateKey = utils.EncodeSecretVar(pk, true)
 	}
 
+	for _, imp := range task.Imports {
+		taskReq.Imports = append(taskReq.Imports, runner.TaskImport{Address: imp.Address, Id: imp.Id})
+	}
+	for _, op := range task.StateOps {
+		taskReq.StateOps = append(taskReq.StateOps, runner.TaskStateOp{
+			Op:          op.Op,
+			Address:     op.Address,
+			Destination: op.Destination,
+		})
+	}
+
 	return taskReq, nil
 }
 
@@ -1106,7 +1471,11 @@ func (m *TaskManager) processAutoDestroy() error {
 
 	for _, env := range destroyEnvs {
 		err = deployOrDestroy(env, logger, dbSess, "destroy")
-		if err != nil {
+		if e.Is(err, e.EnvHasDependents) {
+			// 等待依赖该环境的环境销毁后再执行，继续处理其他环境
+			logger.WithField("envId", env.Id).Debugf("auto destroy delayed: %v", err)
+			continue
+		} else if err != nil {
 			break
 		}
 	}
@@ -1149,6 +1518,54 @@ func (m *TaskManager) processAutoDeploy() error {
 	return nil
 }
 
+// processEnvChains 推进执行中的依赖链编排
+func (m *TaskManager) processEnvChains() {
+	logger := m.logger.WithField("func", "processEnvChains")
+
+	chains, er := services.GetRunningEnvChains(m.db)
+	if er != nil {
+		logger.Errorf("query running env chains error: %v", er)
+		return
+	}
+
+	for i := range chains {
+		chain := &chains[i]
+		err := m.db.Transaction(func(tx *db.Session) error {
+			if er := services.AdvanceEnvChain(tx, chain); er != nil {
+				return er
+			}
+			return nil
+		})
+		if err != nil {
+			logger.WithField("chainId", chain.Id).Errorf("advance env chain error: %v", err)
+		}
+	}
+}
+
+// processStackRuns 推进执行中的批量编排
+func (m *TaskManager) processStackRuns() {
+	logger := m.logger.WithField("func", "processStackRuns")
+
+	runs, er := services.GetActiveStackRuns(m.db)
+	if er != nil {
+		logger.Errorf("query active stack runs error: %v", er)
+		return
+	}
+
+	for i := range runs {
+		run := &runs[i]
+		err := m.db.Transaction(func(tx *db.Session) error {
+			if er := services.AdvanceStackRun(tx, run); er != nil {
+				return er
+			}
+			return nil
+		})
+		if err != nil {
+			logger.WithField("stackRunId", run.Id).Errorf("advance stack run error: %v", err)
+		}
+	}
+}
+
 func deployOrDestroy(env *models.Env, lg *logrus.Entry, dbSess *db.Session, op string) error {
 	const (
 		OpDeploy  = "deploy"
@@ -1176,6 +1593,10 @@ func deployOrDestroy(env *models.Env, lg *logrus.Entry, dbSess *db.Session, op s
 
 	if er != nil {
 		_ = tx.Rollback()
+		if er.Code() == e.EnvHasDependents {
+			// 由调用方决定如何处理，不能当作任务已创建
+			return er
+		}
 		logger.Errorf("create auto %s task: %v", op, er)
 		// 创建任务失败继续处理其他任务
 		return nil
@@ -1269,6 +1690,9 @@ func (m *TaskManager) doRunScanTask(ctx context.Context, task *models.ScanTask)
 		if runErr != nil {
 			logger.WithField("step", fmt.Sprintf("%d(%s)", step.Index, step.Name)).
 				Warnf("run task step error: %v", runErr)
+			if errors.Is(runErr, ErrRunnerLost) && m.failoverTask(task, steps, step) {
+				return m.doRunScanTask(ctx, task)
+			}
 			break
 		}
 	}
@@ -1387,12 +1811,13 @@ func buildScanTaskReq(dbSess *db.Session, task *models.ScanTask, step *models.Ta
 		Playbook:        task.Playbook,
 		PlayVarsFile:    task.PlayVarsFile,
 		TfVersion:       task.TfVersion,
+		IacEngine:       task.IacEngine,
 		EnvironmentVars: make(map[string]string),
 		TerraformVars:   make(map[string]string),
 		AnsibleVars:     make(map[string]string),
 	}
 	if runnerEnv.TfVersion == "" {
-		runnerEnv.TfVersion = consts.DefaultTerraformVersion
+		runnerEnv.TfVersion = runnerEnv.DefaultTfVersion()
 	}
 	if err := buildTaskReqEnvVars(&runnerEnv, task.Variables); err != nil {
 		return nil, err
@@ -1400,28 +1825,14 @@ func buildScanTaskReq(dbSess *db.Session, task *models.ScanTask, step *models.Ta
 	taskReq.Env = runnerEnv
 
 	if task.Type == common.TaskTypeEnvScan || task.Type == common.TaskTypeEnvParse {
-		env, _ := services.GetEnvById(dbSess, task.EnvId)
-
-		stateStore := runner.StateStore{
-			Backend: "consul",
-			Scheme:  "http",
-			Path:    env.StatePath,
-			Address: "",
-		}
-
-		if configs.Get().Consul.ConsulAcl {
-			stateStore.ConsulAcl = configs.Get().Consul.ConsulAcl
-			stateStore.ConsulToken = configs.Get().Consul.ConsulAclToken
+		env, er := services.GetEnvById(dbSess, task.EnvId)
+		if er != nil {
+			return nil, errors.Wrapf(er, "get env '%s'", task.EnvId)
 		}
-
-		if configs.Get().Consul.ConsulTls {
-			stateStore.ConsulTls = configs.Get().Consul.ConsulTls
-			stateStore.CaPath = path.Join(common.ConsulContainerPath, common.ConsulCa)
-			stateStore.CakeyPath = path.Join(common.ConsulContainerPath, common.ConsulCakey)
-			stateStore.CapemPath = path.Join(common.ConsulContainerPath, common.ConsulCapem)
+		taskReq.StateStore, err = statebackend.TaskStateStore(env, task.Id)
+		if err != nil {
+			return nil, err
 		}
-
-		taskReq.StateStore = stateStore
 	}
 
 	if err := runTaskReqAddSysEnvs(taskReq); err != nil {
@@ -1477,6 +1888,8 @@ func (m *TaskManager) runScanTaskStep(ctx context.Context, taskReq runner.RunTas
 		return errors.New("timeout")
 	case models.TaskStepAborted:
 		return errors.New("aborted")
+	case models.TaskStepLost:
+		return ErrRunnerLost
 	default:
 		return fmt.Errorf("unknown step status: %v", step.Status)
 	}
@@ -1526,6 +1939,10 @@ func waitScanTaskStepDone(
 		case models.TaskStepRunning:
 			if _, err := WaitScanTaskStep(ctx, db, task, step); err != nil {
 				logger.Errorf("wait scan task result error: %v", err)
+				if errors.Is(err, ErrRunnerLost) {
+					markTaskStepLost(db, task, step, changeStepStatus)
+					return err
+				}
 				changeStepStatus(models.TaskStepFailed, err.Error(), step)
 				return err
 			}
@@ -1600,6 +2017,11 @@ func runTaskReqAddSysEnvs(req *runner.RunTaskReq) error {
 		sysEnvs["CLOUDIAC_ENV_RESOURCES"] = fmt.Sprintf("%d", resCount)
 		// 当前任务使用的 terraform 版本号(eg. 0.14.11)
 		sysEnvs["CLOUDIAC_TF_VERSION"] = req.Env.TfVersion
+		// 当前任务使用的 IaC 引擎(terraform 或 opentofu)
+		sysEnvs["CLOUDIAC_IAC_ENGINE"] = common.IacEngineTerraform
+		if req.Env.IacEngine != "" {
+			sysEnvs["CLOUDIAC_IAC_ENGINE"] = req.Env.IacEngine
+		}
 
 		// 所有 CLOUDIAC_ 前缀的变量都以小写名称通过环境变量传入 terraform
 		for k, v := range sysEnvs {
@@ -1614,36 +2036,19 @@ func runTaskReqAddSysEnvs(req *runner.RunTaskReq) error {
 	return nil
 }
 
+// ParseResourceDriftInfo 解析 plan json 得到发生漂移的资源及属性
 func ParseResourceDriftInfo(bs []byte) map[string]models.ResourceDrift {
-	logger := logs.Get().WithField("func", "ParseResourceDriftInfo")
-	defer func() {
-		err := recover()
-		if err != nil {
-			logger.Errorf("parse resource drift info error: %v", err)
-		}
-	}()
-	content := strings.Split(string(bs), "\n")
-	cronTaskInfoMap := make(map[string]models.ResourceDrift)
-	for k, v := range content {
-		if strings.Contains(v, "#") && strings.Contains(v, "must be") || strings.Contains(v, "will be") {
-			var resourceDetail string
-			cronTaskInfo := models.ResourceDrift{}
-			reg1 := regexp.MustCompile(`#\s\S*`)
-			result1 := reg1.FindAllStringSubmatch(v, 1)
-			if len(result1) == 0 {
-				continue
-			}
-			address := stripansi.Strip(strings.TrimSpace(result1[0][0][1:]))
-			for k1, v2 := range content[k+1:] {
-				if ((strings.Contains(v2, "#") && strings.Contains(v2, "must be")) || strings.Contains(v2, "will be")) ||
-					strings.Contains(v2, "Plan:") {
-					resourceDetail = strings.Join(content[k+1:k1+k], "\n")
-					break
-				}
-			}
-			cronTaskInfo.DriftDetail = resourceDetail
-			cronTaskInfoMap[address] = cronTaskInfo
+	driftInfoMap := make(map[string]models.ResourceDrift)
+	drifts, err := services.ParsePlanResourceDrift(bs)
+	if err != nil {
+		logs.Get().WithField("func", "ParseResourceDriftInfo").Errorf("parse resource drift info error: %v", err)
+		return driftInfoMap
+	}
+	for address, attrs := range drifts {
+		driftInfoMap[address] = models.ResourceDrift{
+			DriftDetail: services.DriftAttrsDetail(attrs),
+			Attrs:       attrs,
 		}
 	}
-	return cronTaskInfoMap
+	return driftInfoMap
 }
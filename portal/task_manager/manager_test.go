@@ -5,100 +5,108 @@ package task_manager
 import (
 	"cloudiac/portal/models"
 	"testing"
-)
-
-var TextCase = `
-random_password.password[0]: Refreshing state... [id=none]
-random_password.password[1]: Refreshing state... [id=none]
 
-Terraform used the selected providers to generate the following execution
-plan. Resource actions are indicated with the following symbols:
-  + create
--/+ destroy and then create replacement
-
-Terraform will perform the following actions:
+	"github.com/stretchr/testify/assert"
+)
 
-  # random_password.password[0] must be replaced
--/+ resource "random_password" "password" {
-      ~ id               = "none" -> (known after apply)
-      ~ length           = 12 -> 13 # forces replacement
-      ~ result           = (sensitive value)
-        # (9 unchanged attributes hidden)
+var PlanJsonCase = `{
+  "format_version": "1.1",
+  "resource_drift": [
+    {
+      "address": "random_password.password[0]",
+      "mode": "managed",
+      "type": "random_password",
+      "name": "password",
+      "index": 0,
+      "change": {
+        "actions": ["update"],
+        "before": {"id": "none", "length": 13, "lower": true, "result": "secret"},
+        "after": {"id": "none", "length": 12, "lower": true, "result": "secret"},
+        "before_sensitive": {"result": true},
+        "after_sensitive": {"result": true}
+      }
+    },
+    {
+      "address": "random_password.password[1]",
+      "mode": "managed",
+      "type": "random_password",
+      "name": "password",
+      "index": 1,
+      "change": {"actions": ["no-op"], "before": {"length": 12}, "after": {"length": 12}}
+    },
+    {
+      "address": "random_password.password[2]",
+      "mode": "managed",
+      "type": "random_password",
+      "name": "password",
+      "index": 2,
+      "change": {"actions": ["delete"], "before": {"length": 13}, "after": null}
+    },
+    {
+      "address": "aws_instance.web",
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "web",
+      "change": {
+        "actions": ["update"],
+        "before": {"tags": {"Name": "b", "Env": "dev"}, "password": "y", "ingress": [{"from_port": 443}],
+          "ebs_block_device": [{"kms_key_id": "k1", "size": 10}]},
+        "after": {"tags": {"Name": "a", "Env": "dev"}, "password": "x", "ingress": [{"from_port": 80}],
+          "ebs_block_device": [{"kms_key_id": "k1", "size": 10}, {"kms_key_id": "k2", "size": 20}]},
+        "before_sensitive": {"password": true, "ebs_block_device": [{"kms_key_id": true}]},
+        "after_sensitive": {"password": true, "ebs_block_device": [{"kms_key_id": true}, {"kms_key_id": true}]}
+      }
+    },
+    {
+      "address": "data.aws_ami.ubuntu",
+      "mode": "data",
+      "type": "aws_ami",
+      "name": "ubuntu",
+      "change": {"actions": ["read"], "before": null, "after": {}}
     }
-
-  # random_password.password[1] must be replaced
--/+ resource "random_password" "password" {
-      ~ id               = "none" -> (known after apply)
-      ~ length           = 12 -> 13 # forces replacement
-      ~ result           = (sensitive value)
-        # (9 unchanged attributes hidden)
+  ],
+  "resource_changes": [
+    {
+      "address": "aws_instance.db",
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "db",
+      "change": {"actions": ["update"], "before": {"ami": "a"}, "after": {"ami": "b"}}
     }
+  ]
+}`
 
-  # random_password.password[2] will be created
-  + resource "random_password" "password" {
-      + id               = (known after apply)
-      + length           = 13
-      + lower            = true
-      + min_lower        = 0
-      + min_numeric      = 0
-      + min_special      = 0
-      + min_upper        = 0
-      + number           = true
-      + override_special = "_%@"
-      + result           = (sensitive value)
-      + special          = true
-      + upper            = true
-    }
+func TestParseResourceDriftInfo(t *testing.T) {
+	tt := ParseResourceDriftInfo([]byte(PlanJsonCase))
+	assert.Len(t, tt, 3)
 
-Plan: 3 to add, 0 to change, 2 to destroy.
+	assert.Equal(t, []models.DriftAttr{
+		{Path: "length", Expected: float64(13), Actual: float64(12)},
+	}, tt["random_password.password[0]"].Attrs)
+	assert.Equal(t, "  ~ length: expected 13, actual 12", tt["random_password.password[0]"].DriftDetail)
 
-─────────────────────────────────────────────────────────────────────────────
+	assert.Equal(t, []models.DriftAttr{
+		{Path: "", Expected: "(exists)", Actual: "(absent)"},
+	}, tt["random_password.password[2]"].Attrs)
 
-Note: You didn't use the -out option to save this plan, so Terraform can't
-guarantee to take exactly these actions if you run "terraform apply" now.
-`
+	// 敏感属性不记录实际值，整个列表不同时同样隐藏其中的敏感属性
+	assert.Equal(t, []models.DriftAttr{
+		{Path: "ebs_block_device",
+			Expected: []interface{}{
+				map[string]interface{}{"kms_key_id": "(sensitive)", "size": float64(10)},
+			},
+			Actual: []interface{}{
+				map[string]interface{}{"kms_key_id": "(sensitive)", "size": float64(10)},
+				map[string]interface{}{"kms_key_id": "(sensitive)", "size": float64(20)},
+			}},
+		{Path: "ingress.0.from_port", Expected: float64(443), Actual: float64(80)},
+		{Path: "password", Expected: "(sensitive)", Actual: "(sensitive)"},
+		{Path: "tags.Name", Expected: "b", Actual: "a"},
+	}, tt["aws_instance.web"].Attrs)
+	assert.NotContains(t, tt["aws_instance.web"].DriftDetail, "k2")
 
-func TestParseResourceDriftInfo(t *testing.T) {
-	DriftMap := map[string]models.ResourceDrift{
-		"random_password.password[0]": {
-			DriftDetail: `-/+ resource "random_password" "password" {
-      ~ id               = "none" -> (known after apply)
-      ~ length           = 12 -> 13 # forces replacement
-      ~ result           = (sensitive value)
-        # (9 unchanged attributes hidden)
-    }`},
-		"random_password.password[1]": {
-			DriftDetail: `-/+ resource "random_password" "password" {
-      ~ id               = "none" -> (known after apply)
-      ~ length           = 12 -> 13 # forces replacement
-      ~ result           = (sensitive value)
-        # (9 unchanged attributes hidden)
-    }`},
-		"random_password.password[2]": {
-			DriftDetail: `  + resource "random_password" "password" {
-      + id               = (known after apply)
-      + length           = 13
-      + lower            = true
-      + min_lower        = 0
-      + min_numeric      = 0
-      + min_special      = 0
-      + min_upper        = 0
-      + number           = true
-      + override_special = "_%@"
-      + result           = (sensitive value)
-      + special          = true
-      + upper            = true
-    }`},
-	}
-	tt := ParseResourceDriftInfo([]byte(TextCase))
-	if tt["random_password.password[0]"].DriftDetail != DriftMap["random_password.password[0]"].DriftDetail {
-		t.Error("random_password.password[0]解析失败") //nolint
-	}
-	if tt["random_password.password[1]"].DriftDetail != DriftMap["random_password.password[1]"].DriftDetail {
-		t.Error("random_password.password[1]解析失败") //nolint
-	}
-	if tt["random_password.password[2]"].DriftDetail != DriftMap["random_password.password[2]"].DriftDetail {
-		t.Error("random_password.password[2]解析失败") //nolint
-	}
+	// 配置变更导致的资源变更不是漂移
+	assert.NotContains(t, tt, "aws_instance.db")
 
+	assert.Len(t, ParseResourceDriftInfo([]byte("invalid")), 0)
 }
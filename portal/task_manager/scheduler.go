@@ -0,0 +1,107 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// taskSchedInfo 获取任务的调度信息，返回任务基础信息及所属的调度队列。
+// 调度队列按项目划分，没有项目的任务(如云模板扫描)按组织划分
+func taskSchedInfo(task models.Tasker) (base *models.BaseTask, queue models.Id) {
+	switch t := task.(type) {
+	case *models.Task:
+		return &t.BaseTask, models.Id(utils.FirstValueStr(t.ProjectId.String(), t.OrgId.String()))
+	case *models.ScanTask:
+		return &t.BaseTask, models.Id(utils.FirstValueStr(t.ProjectId.String(), t.OrgId.String()))
+	}
+	return &models.BaseTask{}, ""
+}
+
+// fairOrder 对等待执行的任务排序：优先级高的任务先执行，同一优先级的任务在各队列间按权重轮流选择，
+// 正在执行的任务数与权重的比值越小的队列越先被选中，避免某个项目的大量任务(如批量漂移检测)阻塞其他项目。
+// tasks 需要按创建顺序传入，同一队列内的任务保持原有顺序
+func fairOrder(tasks []models.Tasker, running map[models.Id]int, weights map[models.Id]int) []models.Tasker {
+	sorted := make([]models.Tasker, len(tasks))
+	copy(sorted, tasks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		bi, _ := taskSchedInfo(sorted[i])
+		bj, _ := taskSchedInfo(sorted[j])
+		return bi.Priority > bj.Priority
+	})
+
+	weight := func(q models.Id) int {
+		if w := weights[q]; w > 0 {
+			return w
+		}
+		return 1
+	}
+
+	result := make([]models.Tasker, 0, len(sorted))
+	picked := make(map[models.Id]int)
+	for start := 0; start < len(sorted); {
+		base, _ := taskSchedInfo(sorted[start])
+		end := start
+		// 按队列分组，queues 保存队列首次出现的顺序，用于权重相同时的排序
+		queues := make([]models.Id, 0)
+		queueTasks := make(map[models.Id][]models.Tasker)
+		for ; end < len(sorted); end++ {
+			b, q := taskSchedInfo(sorted[end])
+			if b.Priority != base.Priority {
+				break
+			}
+			if _, ok := queueTasks[q]; !ok {
+				queues = append(queues, q)
+			}
+			queueTasks[q] = append(queueTasks[q], sorted[end])
+		}
+
+		for n := end - start; n > 0; n-- {
+			var next models.Id
+			var nextLoad float64
+			for _, q := range queues {
+				if len(queueTasks[q]) == 0 {
+					continue
+				}
+				load := float64(running[q]+picked[q]) / float64(weight(q))
+				if next == "" || load < nextLoad {
+					next, nextLoad = q, load
+				}
+			}
+			result = append(result, queueTasks[next][0])
+			queueTasks[next] = queueTasks[next][1:]
+			picked[next]++
+		}
+		start = end
+	}
+	return result
+}
+
+// pickRunner 从匹配 tags 的 runner 中选择负载(正在执行的任务数/可执行任务数)最低的 runner，
+// 所有匹配的 runner 都已满载时返回空字符串
+func pickRunner(runners []*api.AgentService, tags string, loads map[string]int, slots map[string]int) string {
+	tagList := make([]string, 0)
+	if tags != "" {
+		tagList = strings.Split(tags, ",")
+	}
+
+	var (
+		picked     string
+		pickedLoad float64
+	)
+	for _, r := range runners {
+		if !utils.ListContains(r.Tags, tagList) || slots[r.ID] <= 0 || loads[r.ID] >= slots[r.ID] {
+			continue
+		}
+		load := float64(loads[r.ID]) / float64(slots[r.ID])
+		if picked == "" || load < pickedLoad || (load == pickedLoad && r.ID < picked) {
+			picked, pickedLoad = r.ID, load
+		}
+	}
+	return picked
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSchedTask(id, project string, priority int) *models.Task {
+	t := &models.Task{OrgId: "org-1", ProjectId: models.Id(project)}
+	t.Id = models.Id(id)
+	t.Priority = priority
+	return t
+}
+
+func TestFairOrder(t *testing.T) {
+	tasks := []models.Tasker{
+		newSchedTask("a1", "p-a", consts.TaskPriorityLow),
+		newSchedTask("a2", "p-a", consts.TaskPriorityLow),
+		newSchedTask("a3", "p-a", consts.TaskPriorityLow),
+		newSchedTask("b1", "p-b", consts.TaskPriorityLow),
+		newSchedTask("c1", "p-c", consts.TaskPriorityHigh),
+		&models.ScanTask{OrgId: "org-2", BaseTask: models.BaseTask{Priority: consts.TaskPriorityLow}},
+	}
+	tasks[5].(*models.ScanTask).Id = "s1"
+
+	ids := func(tasks []models.Tasker) []models.Id {
+		r := make([]models.Id, 0)
+		for _, t := range tasks {
+			r = append(r, t.GetId())
+		}
+		return r
+	}
+
+	// 高优先级的任务先执行，同一优先级的任务在各队列间轮流选择
+	assert.Equal(t, []models.Id{"c1", "a1", "b1", "s1", "a2", "a3"}, ids(fairOrder(tasks, nil, nil)))
+
+	// 正在执行的任务越多的队列越靠后
+	running := map[models.Id]int{"p-a": 1, "org-2": 2}
+	assert.Equal(t, []models.Id{"c1", "b1", "a1", "a2", "s1", "a3"}, ids(fairOrder(tasks, running, nil)))
+
+	// 权重越大可同时执行的任务越多
+	weights := map[models.Id]int{"p-a": 3}
+	assert.Equal(t, []models.Id{"c1", "b1", "a1", "a2", "a3", "s1"}, ids(fairOrder(tasks, running, weights)))
+}
+
+func TestPickRunner(t *testing.T) {
+	runners := []*api.AgentService{
+		{ID: "runner-01", Tags: []string{"aws", "prod"}},
+		{ID: "runner-02", Tags: []string{"aws"}},
+		{ID: "runner-03", Tags: []string{"aliyun"}},
+	}
+	slots := map[string]int{"runner-01": 4, "runner-02": 2, "runner-03": 2}
+
+	assert.Equal(t, "runner-01", pickRunner(runners, "", nil, slots))
+	assert.Equal(t, "runner-02", pickRunner(runners, "aws", map[string]int{"runner-01": 3, "runner-02": 1}, slots))
+	assert.Equal(t, "runner-01", pickRunner(runners, "aws", map[string]int{"runner-01": 1, "runner-02": 1}, slots))
+	assert.Equal(t, "", pickRunner(runners, "aws,prod", map[string]int{"runner-01": 4}, slots))
+	assert.Equal(t, "", pickRunner(runners, "gcp", nil, slots))
+}
@@ -8,7 +8,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
 	"time"
 
@@ -19,6 +18,7 @@ import (
 	"cloudiac/portal/models"
 	"cloudiac/portal/services"
 	"cloudiac/portal/services/logstorage"
+	"cloudiac/portal/services/stepbroker"
 	"cloudiac/runner"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
@@ -34,17 +34,12 @@ func StartTaskStep(taskReq runner.RunTaskReq, step models.TaskStep) (
 		WithField("taskId", taskReq.TaskId).
 		WithField("step", step.Index)
 
-	header := &http.Header{}
-	header.Set("Content-Type", "application/json")
-
 	var runnerAddr string
 	runnerAddr, err = services.GetRunnerAddress(taskReq.RunnerId)
 	if err != nil {
 		return "", true, err
 	}
-
-	requestUrl := utils.JoinURL(runnerAddr, consts.RunnerRunTaskStepURL)
-	logger.Debugf("request runner: %s", requestUrl)
+	logger.Debugf("request runner: %s", utils.JoinURL(runnerAddr, consts.RunnerRunTaskStepURL))
 
 	taskReq.Step = step.Index
 	taskReq.StepType = step.Type
@@ -52,7 +47,7 @@ func StartTaskStep(taskReq runner.RunTaskReq, step models.TaskStep) (
 	taskReq.StepBeforeCmds = step.BeforeCmds
 	taskReq.StepAfterCmds = step.AfterCmds
 
-	respData, err := utils.HttpService(requestUrl, "POST", header, taskReq,
+	respData, err := services.RunnerPost(runnerAddr, consts.RunnerRunTaskStepURL, taskReq,
 		int(consts.RunnerConnectTimeout.Seconds()), int(consts.RunnerConnectTimeout.Seconds())*10)
 	if err != nil {
 		return "", true, err
@@ -100,11 +95,15 @@ func WaitTaskStep(ctx context.Context, sess *db.Session, task *models.Task, step
 	}
 	taskDeadline := time.Time(*step.StartAt).Add(time.Duration(timeout*2) * time.Second)
 
-	// 当前版本实现中需要 portal 主动连接到 runner 获取状态
+	// runner 未推送步骤事件时需要 portal 主动连接到 runner 获取状态
+	detector := &runnerLostDetector{runnerId: task.RunnerId}
 	err = utils.RetryFunc(10, time.Second*5, func(retryN int) (retry bool, er error) {
-		stepResult, er = pullTaskStepStatus(ctx, task, step, taskDeadline)
+		stepResult, er = pullTaskStepStatus(ctx, task, step, taskDeadline, detector)
 		if er != nil {
 			logger.Errorf("pull task status error: %v, retry(%d)", er, retryN)
+			if errors.Is(er, ErrRunnerLost) || detector.check() {
+				return false, ErrRunnerLost
+			}
 			return true, er
 		}
 
@@ -191,10 +190,22 @@ func newReadMessageErr(err error) error {
 
 // pullTaskStepStatus 获取任务最新状态，直到任务结束(或 ctx cancel)
 // 该函数允许重复调用，即使任务己结束 (runner 会在本地保存近期(约7天)任务执行信息)，如果任务结束则写入全量日志到存储
-func pullTaskStepStatus(ctx context.Context, task models.Tasker, step *models.TaskStep, deadline time.Time) (
+// runner 通过事件连接推送步骤状态时优先订阅事件，无法订阅或订阅中断时才主动连接 runner
+func pullTaskStepStatus(ctx context.Context, task models.Tasker, step *models.TaskStep, deadline time.Time,
+	detector *runnerLostDetector) (
 	stepResult *waitStepResult, err error) {
 	logger := logs.Get().WithField("action", "PullTaskState").WithField("taskId", task.GetId())
 
+	if sub := stepbroker.Get().Subscribe(task.GetRunnerId(), step.TaskId.String(), step.Index); sub != nil {
+		logger.Debugf("waiting step status events, step=%s(%d)", step.Type, step.Index)
+		stepResult, err = waitTaskStepStatusEvents(ctx, sub, deadline, detector)
+		if err != nil || stepResult.Status != "" {
+			return stepResult, err
+		}
+		// 订阅中断(runner 事件连接断开或长时间未收到事件)，改为主动连接 runner 获取状态
+		logger.Infof("step status events interrupted, pull status from runner, step=%s(%d)", step.Type, step.Index)
+	}
+
 	runnerAddr, err := services.GetRunnerAddress(task.GetRunnerId())
 	if err != nil {
 		return nil, err
@@ -204,7 +215,7 @@ func pullTaskStepStatus(ctx context.Context, task models.Tasker, step *models.Ta
 	params.Add("envId", string(step.EnvId))
 	params.Add("taskId", string(step.TaskId))
 	params.Add("step", fmt.Sprintf("%d", step.Index))
-	wsConn, resp, err := utils.WebsocketDail(runnerAddr, consts.RunnerTaskStepStatusURL, params)
+	wsConn, resp, err := services.RunnerWebsocketDial(runnerAddr, consts.RunnerTaskStepStatusURL, params)
 	if err != nil {
 		logger.Errorf("connect error: %v", err)
 		if resp != nil && resp.StatusCode >= 300 {
@@ -264,7 +275,7 @@ func pullTaskStepStatus(ctx context.Context, task models.Tasker, step *models.Ta
 	go readMessage()
 
 	logger.Debugf("pulling step status, step=%s(%d)", step.Type, step.Index)
-	stepResult, err = pullTaskStepStatusLoop(ctx, messageChan, readErrChan, deadline)
+	stepResult, err = pullTaskStepStatusLoop(ctx, messageChan, readErrChan, deadline, detector.check)
 	if err != nil {
 		return stepResult, err
 	}
@@ -273,11 +284,55 @@ func pullTaskStepStatus(ctx context.Context, task models.Tasker, step *models.Ta
 	return stepResult, nil
 }
 
+// waitTaskStepStatusEvents 通过订阅 runner 推送的事件等待步骤结束，订阅中断时返回的 Status 为空
+func waitTaskStepStatusEvents(ctx context.Context, sub *stepbroker.Subscription, deadline time.Time,
+	detector *runnerLostDetector) (*waitStepResult, error) {
+	defer sub.Close()
+
+	doneChan := make(chan struct{})
+	defer close(doneChan)
+
+	messageChan := make(chan *runner.TaskStatusMessage, 1)
+	go func() {
+		defer close(messageChan)
+
+		idle := time.NewTimer(consts.StepEventIdleTimeout)
+		defer idle.Stop()
+		for {
+			select {
+			case <-doneChan:
+				return
+			case <-idle.C:
+				return
+			case ev, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if !idle.Stop() {
+					<-idle.C
+				}
+				idle.Reset(consts.StepEventIdleTimeout)
+				if ev.Status == nil {
+					continue
+				}
+				select {
+				case messageChan <- ev.Status:
+				case <-doneChan:
+					return
+				}
+			}
+		}
+	}()
+
+	return pullTaskStepStatusLoop(ctx, messageChan, nil, deadline, detector.check)
+}
+
 func pullTaskStepStatusLoop(
 	ctx context.Context,
 	messageChan chan *runner.TaskStatusMessage,
 	readErrChan chan error,
-	deadline time.Time) (result *waitStepResult, err error) {
+	deadline time.Time,
+	lostCheck func() bool) (result *waitStepResult, err error) {
 
 	now := time.Now()
 	var timeout *time.Timer
@@ -288,6 +343,10 @@ func pullTaskStepStatusLoop(
 		timeout = time.NewTimer(deadline.Sub(now))
 	}
 
+	// runner 宿主机异常宕机时连接可能不会断开，所以需要定时检查 runner 是否在线
+	lostTicker := time.NewTicker(runnerLostCheckInterval)
+	defer lostTicker.Stop()
+
 	result = &waitStepResult{}
 	for {
 		select {
@@ -322,6 +381,11 @@ func pullTaskStepStatusLoop(
 		case <-timeout.C:
 			result.Status = models.TaskStepTimeout
 			return result, nil
+
+		case <-lostTicker.C:
+			if lostCheck() {
+				return result, ErrRunnerLost
+			}
 		}
 	}
 }
@@ -329,8 +393,44 @@ func pullTaskStepStatusLoop(
 var (
 	ErrTaskStepRejected = fmt.Errorf("rejected")
 	ErrTaskStepAborted  = fmt.Errorf("aborted")
+	ErrRunnerLost       = fmt.Errorf("runner lost")
+)
+
+const (
+	// runnerLostCheckInterval 等待步骤结束时检查 runner 是否在线的间隔
+	runnerLostCheckInterval = 10 * time.Second
+	// runnerLostThreshold 连续多次检查 runner 都不在线才认为 runner 失联，避免注册中心抖动造成误判
+	runnerLostThreshold = 3
 )
 
+var isRunnerAlive = func(runnerId string) (bool, error) {
+	alive, er := services.IsRunnerAlive(runnerId)
+	if er != nil {
+		return false, er
+	}
+	return alive, nil
+}
+
+// runnerLostDetector 检查 runner 是否失联(心跳超时、健康检查失败或 agent 连接断开)
+type runnerLostDetector struct {
+	runnerId string
+	misses   int // 连续检查到 runner 不在线的次数
+}
+
+// check 检查一次 runner 状态，返回 runner 是否已失联。无法获取 runner 状态时不计入失联次数
+func (d *runnerLostDetector) check() bool {
+	alive, err := isRunnerAlive(d.runnerId)
+	if err != nil {
+		logs.Get().WithField("runnerId", d.runnerId).Warnf("check runner alive: %v", err)
+		return false
+	} else if alive {
+		d.misses = 0
+		return false
+	}
+	d.misses++
+	return d.misses >= runnerLostThreshold
+}
+
 // WaitTaskStepApprove
 // TODO: 使用注册通知机制，统一由一个 worker 来加载所有待审批的步骤最新状态，当有步骤审批通过时触发通知
 func WaitTaskStepApprove(ctx context.Context, dbSess *db.Session, taskId models.Id, step int) (
@@ -375,11 +475,15 @@ func WaitScanTaskStep(ctx context.Context, sess *db.Session, task *models.ScanTa
 	// runner 端己经增加了超时处理，portal 端的超时暂时保留，但时间设置为给定时间的 2 倍
 	taskDeadline := time.Time(*step.StartAt).Add(time.Duration(task.StepTimeout*2) * time.Second)
 
-	// 当前版本实现中需要 portal 主动连接到 runner 获取状态
+	// runner 未推送步骤事件时需要 portal 主动连接到 runner 获取状态
+	detector := &runnerLostDetector{runnerId: task.RunnerId}
 	err = utils.RetryFunc(10, time.Second*5, func(retryN int) (retry bool, er error) {
-		stepResult, er = pullTaskStepStatus(ctx, task, step, taskDeadline)
+		stepResult, er = pullTaskStepStatus(ctx, task, step, taskDeadline, detector)
 		if er != nil {
 			logger.Errorf("pull task status error: %v, retry(%d)", er, retryN)
+			if errors.Is(er, ErrRunnerLost) || detector.check() {
+				return false, ErrRunnerLost
+			}
 			return true, er
 		}
 
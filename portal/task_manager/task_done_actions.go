@@ -18,7 +18,6 @@ import (
 	"cloudiac/utils/logs"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"time"
 
 	"github.com/pkg/errors"
@@ -154,18 +153,12 @@ func computeResourceCost(resources []*schema.Resource) (float32, []string, error
 	// 询价失败产品的address
 	forecastFailed := make([]string, 0)
 
+	source := pricecalculator.GetPriceSource()
 	for _, res := range resources {
-		priceResp, err := pricecalculator.GetResourcePrice(res)
+		price, err := source.GetPrice(res)
 		if err != nil {
 			forecastFailed = append(forecastFailed, res.Name)
-			logs.Get().WithField("cost_forecast", "GetResourcePrice").Error(err)
-			continue
-		}
-
-		price, err := pricecalculator.GetPriceFromResponse(priceResp)
-		if err != nil {
-			forecastFailed = append(forecastFailed, res.Name)
-			logs.Get().WithField("cost_forecast", "GetPriceFromResponse").Error(err)
+			logs.Get().WithField("cost_forecast", source.Name()).Error(err)
 			continue
 		}
 
@@ -176,60 +169,63 @@ func computeResourceCost(resources []*schema.Resource) (float32, []string, error
 }
 
 func taskDoneProcessDriftTask(logger logs.Logger, dbSess *db.Session, task *models.Task) error {
-	// 判断是否是偏移检测任务，如果是，解析log文件并写入表
-	step, err := services.GetTaskPlanStep(db.Get(), task.Id)
+	// 判断是否是偏移检测任务，如果是，解析 plan json 并写入表
+	bs, err := readIfExist(task.PlanJsonPath())
 	if err != nil {
 		// 解析失败任务不停止不影响主流程
-		logger.Errorf("read plan output log: %v", err)
+		logger.Errorf("read plan json: %v", err)
+		return nil
+	} else if len(bs) == 0 {
+		logger.Warnf("plan json not found")
+		return nil
+	}
+
+	// 解析并保存资源漂移信息
+	env, err := services.GetEnv(dbSess, task.EnvId)
+	if err != nil {
+		logger.Errorf("get env '%s': %v", task.EnvId, err)
+		return err
+	}
+	driftInfoMap, er := services.SaveEnvDriftRecords(dbSess, task, ParseResourceDriftInfo(bs), time.Now())
+	if er != nil {
+		return errors.Wrap(er, "save resource drift records")
+	}
+	if len(driftInfoMap) == 0 {
+		err = services.DeleteEnvResourceDrift(dbSess, env.LastResTaskId)
+		if err != nil {
+			logs.Get().Error("Failed to delete all resoruce drift information in the environment")
+		}
 	} else {
-		if bs, err := readIfExist(task.TFPlanOutputLogPath(fmt.Sprintf("step%d", step.Index))); err != nil {
-			logger.Errorf("read plan output log: %v", err)
-		} else {
-			// 解析并保存资源漂移信息
-			env, err := services.GetEnv(dbSess, task.EnvId)
+		addressList := []string{}
+		for address := range driftInfoMap {
+			addressList = append(addressList, address)
+		}
+		err = services.DeleteEnvResourceDriftByAddressList(dbSess, env.LastResTaskId, addressList)
+		if err != nil {
+			logs.Get().Error("Failed to delete already repair resoruce drift information in the environment")
+		}
+		for address, driftInfo := range driftInfoMap {
+			res, err := services.GetResourceIdByAddressAndTaskId(dbSess, address, env.LastResTaskId)
 			if err != nil {
-				logger.Errorf("get env '%s': %v", task.EnvId, err)
-				return err
-			}
-			driftInfoMap := ParseResourceDriftInfo(bs)
-			if len(driftInfoMap) == 0 {
-				err = services.DeleteEnvResourceDrift(dbSess, env.LastResTaskId)
-				if err != nil {
-					logs.Get().Error("Failed to delete all resoruce drift information in the environment")
-				}
+				logs.Get().Error("Failed to query resource table while writing drift resource")
+				continue
 			} else {
-				addressList := []string{}
-				for address := range driftInfoMap {
-					addressList = append(addressList, address)
-				}
-				err = services.DeleteEnvResourceDriftByAddressList(dbSess, env.LastResTaskId, addressList)
-				if err != nil {
-					logs.Get().Error("Failed to delete already repair resoruce drift information in the environment")
-				}
-				for address, driftInfo := range driftInfoMap {
-					res, err := services.GetResourceIdByAddressAndTaskId(dbSess, address, env.LastResTaskId)
-					if err != nil {
-						logs.Get().Error("Failed to query resource table while writing drift resource")
-						continue
-					} else {
-						driftInfo.ResId = res.Id
-						// TODO 后续使用batch 改进
-						services.InsertOrUpdateCronTaskInfo(db.Get(), driftInfo)
-					}
-				}
+				driftInfo.ResId = res.Id
+				// TODO 后续使用batch 改进
+				services.InsertOrUpdateCronTaskInfo(db.Get(), driftInfo)
 			}
+		}
+	}
 
-			if len(driftInfoMap) > 0 {
-				// 发送 kafka 通知 发生漂移, true 表示发生漂移
-				services.SendKafkaDriftMessage(dbSess, task, true, driftInfoMap)
+	if len(driftInfoMap) > 0 {
+		// 发送 kafka 通知 发生漂移, true 表示发生漂移
+		services.SendKafkaDriftMessage(dbSess, task, true, driftInfoMap)
 
-				// 发送邮件通知
-				services.TaskStatusChangeSendMessage(task, consts.EvenvtCronDrift)
-			} else {
-				// 发送 kafka 通知, false 表示未漂移
-				services.SendKafkaDriftMessage(dbSess, task, false, driftInfoMap)
-			}
-		}
+		// 发送邮件通知
+		services.TaskStatusChangeSendMessage(task, consts.EvenvtCronDrift)
+	} else {
+		// 发送 kafka 通知, false 表示未漂移
+		services.SendKafkaDriftMessage(dbSess, task, false, driftInfoMap)
 	}
 	return nil
 }
@@ -360,7 +356,6 @@ func stopTaskContainers(sess *db.Session, taskId, envId models.Id, isScanTask bo
 		return err
 	}
 
-	requestUrl := utils.JoinURL(runnerAddr, consts.RunnerStopTaskURL)
 	req := runner.TaskStopReq{
 		EnvId:        envId.String(),
 		TaskId:       taskId.String(),
@@ -368,10 +363,8 @@ func stopTaskContainers(sess *db.Session, taskId, envId models.Id, isScanTask bo
 	}
 	req.ContainerIds = append(req.ContainerIds, containerId)
 
-	header := &http.Header{}
-	header.Set("Content-Type", "application/json")
 	timeout := int(consts.RunnerConnectTimeout.Seconds())
-	_, err = utils.HttpService(requestUrl, "POST", header, req, timeout, timeout)
+	_, err = services.RunnerPost(runnerAddr, consts.RunnerStopTaskURL, req, timeout, timeout)
 	return err
 }
 
@@ -31,6 +31,12 @@ func (m *TaskManager) runTaskStepsDoneActions(ctx context.Context, taskId models
 		return errors.Wrapf(err, "get task current step")
 	}
 
+	// runner 失联时无法再在该 runner 上执行回调及信息采集步骤
+	if currStep.IsLost() {
+		logger.Infof("task runner lost, skip callback and collect steps")
+		return nil
+	}
+
 	// 执行 callback 步骤
 	m.taskStepDoneCallback(ctx, task, currStep, *runTaskReq)
 
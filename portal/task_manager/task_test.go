@@ -0,0 +1,72 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/stepbroker"
+	"cloudiac/runner"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunnerLostDetector(t *testing.T) {
+	var (
+		alive bool
+		err   error
+	)
+	defer func(f func(string) (bool, error)) { isRunnerAlive = f }(isRunnerAlive)
+	isRunnerAlive = func(string) (bool, error) { return alive, err }
+
+	d := &runnerLostDetector{runnerId: "runner-1"}
+	for i := 1; i < runnerLostThreshold; i++ {
+		assert.False(t, d.check())
+	}
+	// runner 恢复在线后重新计数
+	alive = true
+	assert.False(t, d.check())
+	alive = false
+	for i := 1; i < runnerLostThreshold; i++ {
+		assert.False(t, d.check())
+	}
+	// 无法获取 runner 状态时不计数
+	err = fmt.Errorf("consul unavailable")
+	assert.False(t, d.check())
+	err = nil
+	assert.True(t, d.check())
+}
+
+func TestWaitTaskStepStatusEvents(t *testing.T) {
+	broker, err := stepbroker.New(configs.StepBrokerConfig{})
+	assert.NoError(t, err)
+	broker.RunnerConnected("runner-1")
+
+	publishStatus := func(msg runner.TaskStatusMessage) {
+		broker.Publish("runner-1", &runner.TaskStepEvent{
+			Type: runner.TaskStepEventStatus, TaskId: "run-1", Step: 0, Status: &msg})
+	}
+	detector := &runnerLostDetector{runnerId: "runner-1"}
+	deadline := time.Now().Add(time.Minute)
+
+	sub := broker.Subscribe("runner-1", "run-1", 0)
+	go func() {
+		publishStatus(runner.TaskStatusMessage{})
+		publishStatus(runner.TaskStatusMessage{Exited: true, ExitCode: 1, LogContent: []byte("error")})
+	}()
+	result, err := waitTaskStepStatusEvents(context.Background(), sub, deadline, detector)
+	assert.NoError(t, err)
+	assert.Equal(t, models.TaskStepFailed, result.Status)
+	assert.Equal(t, "error", string(result.Result.LogContent))
+
+	// runner 断开事件连接时返回空状态，由调用方改为主动连接 runner
+	sub = broker.Subscribe("runner-1", "run-1", 1)
+	broker.RunnerDisconnected("runner-1")
+	result, err = waitTaskStepStatusEvents(context.Background(), sub, deadline, detector)
+	assert.NoError(t, err)
+	assert.Equal(t, "", result.Status)
+}
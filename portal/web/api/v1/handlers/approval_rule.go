@@ -0,0 +1,108 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// SearchApprovalRule 审批规则列表
+// @Tags 审批规则
+// @Summary 审批规则列表
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form query forms.SearchApprovalRuleForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.ApprovalRule}}
+// @Router /approval_rules [get]
+func SearchApprovalRule(c *ctx.GinRequest) {
+	form := &forms.SearchApprovalRuleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchApprovalRule(c.Service(), form))
+}
+
+// DetailApprovalRule 审批规则详情
+// @Tags 审批规则
+// @Summary 审批规则详情
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "审批规则ID"
+// @Success 200 {object} ctx.JSONResult{result=models.ApprovalRule}
+// @Router /approval_rules/{id} [get]
+func DetailApprovalRule(c *ctx.GinRequest) {
+	form := &forms.DetailApprovalRuleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DetailApprovalRule(c.Service(), form))
+}
+
+// CreateApprovalRule 创建审批规则
+// @Tags 审批规则
+// @Summary 创建审批规则
+// @Description 规则关联到项目或者环境，任务步骤需要满足所有生效的规则才能通过审批
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form formData forms.CreateApprovalRuleForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=models.ApprovalRule}
+// @Router /approval_rules [post]
+func CreateApprovalRule(c *ctx.GinRequest) {
+	form := &forms.CreateApprovalRuleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateApprovalRule(c.Service(), form))
+}
+
+// UpdateApprovalRule 修改审批规则
+// @Tags 审批规则
+// @Summary 修改审批规则
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "审批规则ID"
+// @Param form formData forms.UpdateApprovalRuleForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=models.ApprovalRule}
+// @Router /approval_rules/{id} [put]
+func UpdateApprovalRule(c *ctx.GinRequest) {
+	form := &forms.UpdateApprovalRuleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateApprovalRule(c.Service(), form))
+}
+
+// DeleteApprovalRule 删除审批规则
+// @Tags 审批规则
+// @Summary 删除审批规则
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "审批规则ID"
+// @Success 200 {object} ctx.JSONResult
+// @Router /approval_rules/{id} [delete]
+func DeleteApprovalRule(c *ctx.GinRequest) {
+	form := &forms.DeleteApprovalRuleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteApprovalRule(c.Service(), form))
+}
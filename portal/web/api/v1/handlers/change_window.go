@@ -0,0 +1,103 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// SearchChangeWindow 变更窗口列表
+// @Tags 变更窗口
+// @Summary 变更窗口及冻结期列表
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchChangeWindowForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.ChangeWindow}}
+// @Router /change_windows [get]
+func SearchChangeWindow(c *ctx.GinRequest) {
+	form := &forms.SearchChangeWindowForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchChangeWindow(c.Service(), form))
+}
+
+// DetailChangeWindow 变更窗口详情
+// @Tags 变更窗口
+// @Summary 变更窗口详情
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "变更窗口ID"
+// @Success 200 {object} ctx.JSONResult{result=models.ChangeWindow}
+// @Router /change_windows/{id} [get]
+func DetailChangeWindow(c *ctx.GinRequest) {
+	form := &forms.DetailChangeWindowForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DetailChangeWindow(c.Service(), form))
+}
+
+// CreateChangeWindow 创建变更窗口
+// @Tags 变更窗口
+// @Summary 创建变更窗口或冻结期
+// @Description 冻结期内不允许执行变更任务；设置了变更窗口时只允许在窗口内执行变更任务，plan 任务不受限制
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form formData forms.CreateChangeWindowForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=models.ChangeWindow}
+// @Router /change_windows [post]
+func CreateChangeWindow(c *ctx.GinRequest) {
+	form := &forms.CreateChangeWindowForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateChangeWindow(c.Service(), form))
+}
+
+// UpdateChangeWindow 修改变更窗口
+// @Tags 变更窗口
+// @Summary 修改变更窗口或冻结期
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "变更窗口ID"
+// @Param form formData forms.UpdateChangeWindowForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=models.ChangeWindow}
+// @Router /change_windows/{id} [put]
+func UpdateChangeWindow(c *ctx.GinRequest) {
+	form := &forms.UpdateChangeWindowForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateChangeWindow(c.Service(), form))
+}
+
+// DeleteChangeWindow 删除变更窗口
+// @Tags 变更窗口
+// @Summary 删除变更窗口或冻结期
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "变更窗口ID"
+// @Success 200 {object} ctx.JSONResult
+// @Router /change_windows/{id} [delete]
+func DeleteChangeWindow(c *ctx.GinRequest) {
+	form := &forms.DeleteChangeWindowForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteChangeWindow(c.Service(), form))
+}
@@ -404,6 +404,29 @@ func (Env) EnvStat(c *ctx.GinRequest) {
 	c.JSONResult(apps.EnvStat(c.Service(), &form))
 }
 
+// EnvStateMigrate 环境 state 迁移
+// @Tags 环境
+// @Summary 迁移环境 state 到指定的存储后端
+// @Description 迁移完成后源存储后端中的 state 会作为备份保留
+// @Accept multipart/form-data
+// @Accept application/x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form formData forms.EnvStateMigrateForm true "迁移参数"
+// @router /envs/{envId}/state/migrate [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Env}
+func EnvStateMigrate(c *ctx.GinRequest) {
+	form := forms.EnvStateMigrateForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvStateMigrate(c.Service(), &form))
+}
+
 // EnvLock 环境锁定
 // @Tags 环境
 // @Summary 环境锁定
@@ -0,0 +1,185 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// SearchApproverGroup 审批组列表
+// @Tags 审批组
+// @Summary 审批组列表
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param form query forms.SearchApproverGroupForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.ApproverGroup}}
+// @Router /approver_groups [get]
+func SearchApproverGroup(c *ctx.GinRequest) {
+	form := &forms.SearchApproverGroupForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchApproverGroup(c.Service(), form))
+}
+
+// DetailApproverGroup 审批组详情
+// @Tags 审批组
+// @Summary 审批组详情
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param id path string true "审批组ID"
+// @Success 200 {object} ctx.JSONResult{result=models.ApproverGroup}
+// @Router /approver_groups/{id} [get]
+func DetailApproverGroup(c *ctx.GinRequest) {
+	form := &forms.DetailApproverGroupForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DetailApproverGroup(c.Service(), form))
+}
+
+// CreateApproverGroup 创建审批组
+// @Tags 审批组
+// @Summary 创建审批组
+// @Description 受保护的环境可以指定审批组，只有审批组成员可以审批该环境的任务
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param form formData forms.CreateApproverGroupForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=models.ApproverGroup}
+// @Router /approver_groups [post]
+func CreateApproverGroup(c *ctx.GinRequest) {
+	form := &forms.CreateApproverGroupForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateApproverGroup(c.Service(), form))
+}
+
+// UpdateApproverGroup 修改审批组
+// @Tags 审批组
+// @Summary 修改审批组
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param id path string true "审批组ID"
+// @Param form formData forms.UpdateApproverGroupForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=models.ApproverGroup}
+// @Router /approver_groups/{id} [put]
+func UpdateApproverGroup(c *ctx.GinRequest) {
+	form := &forms.UpdateApproverGroupForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateApproverGroup(c.Service(), form))
+}
+
+// DeleteApproverGroup 删除审批组
+// @Tags 审批组
+// @Summary 删除审批组
+// @Description 审批组被环境使用时不允许删除
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param id path string true "审批组ID"
+// @Success 200 {object} ctx.JSONResult
+// @Router /approver_groups/{id} [delete]
+func DeleteApproverGroup(c *ctx.GinRequest) {
+	form := &forms.DeleteApproverGroupForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteApproverGroup(c.Service(), form))
+}
+
+// SearchEnvUser 环境用户角色列表
+// @Tags 环境
+// @Summary 环境用户角色列表
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "环境ID"
+// @Param form query forms.SearchEnvUserForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.EnvUser}}
+// @Router /envs/{id}/users [get]
+func SearchEnvUser(c *ctx.GinRequest) {
+	form := &forms.SearchEnvUserForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvUser(c.Service(), form))
+}
+
+// SetEnvUser 设置用户的环境角色
+// @Tags 环境
+// @Summary 设置用户的环境角色
+// @Description 环境角色会覆盖用户在项目中的角色，只对该环境生效
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "环境ID"
+// @Param form formData forms.SetEnvUserForm true "parameter"
+// @Success 200 {object} ctx.JSONResult
+// @Router /envs/{id}/users [put]
+func SetEnvUser(c *ctx.GinRequest) {
+	form := &forms.SetEnvUserForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SetEnvUser(c.Service(), form))
+}
+
+// DeleteEnvUser 删除用户的环境角色
+// @Tags 环境
+// @Summary 删除用户的环境角色
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "环境ID"
+// @Param userId path string true "用户ID"
+// @Success 200 {object} ctx.JSONResult
+// @Router /envs/{id}/users/{userId} [delete]
+func DeleteEnvUser(c *ctx.GinRequest) {
+	form := &forms.DeleteEnvUserForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteEnvUser(c.Service(), form))
+}
+
+// SearchTaskApproval 任务审批记录
+// @Tags 环境
+// @Summary 任务审批记录
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "任务ID"
+// @Success 200 {object} ctx.JSONResult{result=[]models.TaskApproval}
+// @Router /tasks/{id}/approvals [get]
+func SearchTaskApproval(c *ctx.GinRequest) {
+	form := &forms.DetailTaskForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTaskApproval(c.Service(), form))
+}
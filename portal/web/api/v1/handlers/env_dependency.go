@@ -0,0 +1,128 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+)
+
+// GetEnvDependency 环境依赖关系
+// @Tags 环境
+// @Summary 查询环境依赖的环境及依赖该环境的环境
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/dependencies [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.EnvDependencyResp}
+func GetEnvDependency(c *ctx.GinRequest) {
+	form := forms.EnvParam{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.GetEnvDependency(c.Service(), &form))
+}
+
+// UpdateEnvDependency 更新环境依赖
+// @Tags 环境
+// @Summary 更新环境依赖的环境列表
+// @Description 依赖的环境需要在同一项目下且不能存在循环依赖，环境变量可以通过 ${env:环境名称.outputs.名称} 引用依赖环境的 outputs
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form body forms.UpdateEnvDependencyForm true "parameter"
+// @router /envs/{envId}/dependencies [put]
+// @Success 200 {object} ctx.JSONResult{result=resps.EnvDependencyResp}
+func UpdateEnvDependency(c *ctx.GinRequest) {
+	form := forms.UpdateEnvDependencyForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateEnvDependency(c.Service(), &form))
+}
+
+// EnvChainDeploy 部署环境依赖链
+// @Tags 环境
+// @Summary 按依赖顺序依次部署环境依赖的所有环境及当前环境
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/chain/deploy [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.EnvChainResp}
+func EnvChainDeploy(c *ctx.GinRequest) {
+	form := forms.EnvParam{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateEnvChain(c.Service(), &form, models.EnvChainActionDeploy))
+}
+
+// EnvChainDestroy 销毁环境依赖链
+// @Tags 环境
+// @Summary 按依赖的逆序依次销毁依赖当前环境的所有环境及当前环境
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/chain/destroy [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.EnvChainResp}
+func EnvChainDestroy(c *ctx.GinRequest) {
+	form := forms.EnvParam{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateEnvChain(c.Service(), &form, models.EnvChainActionDestroy))
+}
+
+// SearchEnvChain 环境依赖链编排记录
+// @Tags 环境
+// @Summary 环境依赖链编排记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchEnvChainForm true "parameter"
+// @router /envs/{envId}/chains [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.EnvChain}}
+func SearchEnvChain(c *ctx.GinRequest) {
+	form := forms.SearchEnvChainForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvChain(c.Service(), &form))
+}
+
+// EnvChainDetail 环境依赖链编排详情
+// @Tags 环境
+// @Summary 环境依赖链编排详情
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param chainId path string true "编排ID"
+// @router /envs/{envId}/chains/{chainId} [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.EnvChainResp}
+func EnvChainDetail(c *ctx.GinRequest) {
+	form := forms.EnvChainParam{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvChainDetail(c.Service(), &form))
+}
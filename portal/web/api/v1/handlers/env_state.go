@@ -0,0 +1,175 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+func tfStateErrorStatus(err e.Error) int {
+	switch err.Code() {
+	case e.InvalidToken:
+		return http.StatusUnauthorized
+	case e.PermissionDeny, e.EnvStateNotHosted:
+		return http.StatusForbidden
+	case e.EnvNotExists:
+		return http.StatusNotFound
+	case e.EnvStateLocked:
+		return http.StatusLocked
+	case e.EnvStateLockIdMismatch:
+		return http.StatusConflict
+	case e.BadParam:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// TfState portal 内置的 terraform http backend，供任务执行时读写环境 state。
+// 接口遵循 terraform http backend 协议(GET/POST/LOCK/UNLOCK)，
+// 使用任务签发的 state token 作为 basic auth 密码进行鉴权，不使用用户 token。
+func TfState(c *ctx.GinRequest) {
+	statePath := c.Param("path")
+	_, token, _ := c.Request.BasicAuth()
+
+	var body []byte
+	if c.Request.Method != http.MethodGet {
+		var err error
+		if body, err = ioutil.ReadAll(c.Request.Body); err != nil {
+			c.JSONError(e.New(e.BadParam, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch c.Request.Method {
+	case http.MethodGet:
+		content, err := apps.TfStateGet(c.Service(), token, statePath)
+		if err != nil {
+			c.JSONError(err, tfStateErrorStatus(err))
+		} else if content == nil {
+			c.Status(http.StatusNoContent)
+		} else {
+			c.Data(http.StatusOK, "application/json", content)
+		}
+	case http.MethodPost:
+		if err := apps.TfStateSave(c.Service(), token, statePath, c.Query("ID"), body); err != nil {
+			c.JSONError(err, tfStateErrorStatus(err))
+		} else {
+			c.Status(http.StatusOK)
+		}
+	case "LOCK":
+		lock, err := apps.TfStateLock(c.Service(), token, statePath, body)
+		if err != nil && lock != nil {
+			// 锁冲突时返回当前的锁信息
+			c.Data(tfStateErrorStatus(err), "application/json", []byte(lock.Info))
+		} else if err != nil {
+			c.JSONError(err, tfStateErrorStatus(err))
+		} else {
+			c.Status(http.StatusOK)
+		}
+	case "UNLOCK":
+		if err := apps.TfStateUnlock(c.Service(), token, statePath, body); err != nil {
+			c.JSONError(err, tfStateErrorStatus(err))
+		} else {
+			c.Status(http.StatusOK)
+		}
+	default:
+		c.JSONError(e.New(e.BadRequest, fmt.Errorf("unsupported method %s", c.Request.Method)),
+			http.StatusMethodNotAllowed)
+	}
+}
+
+// SearchStateVersion 环境 state 版本列表
+// @Tags 环境
+// @Summary 环境 state 版本列表
+// @Description 仅使用平台内置 http backend 的环境会记录 state 版本，其他 backend 的环境返回 EnvStateNotHosted 错误
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchStateVersionForm true "parameter"
+// @router /envs/{envId}/state/versions [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.StateVersion}}
+func SearchStateVersion(c *ctx.GinRequest) {
+	form := forms.SearchStateVersionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchStateVersion(c.Service(), &form))
+}
+
+// DownloadStateVersion 下载环境 state 版本
+// @Tags 环境
+// @Summary 下载环境 state 版本
+// @Description 仅支持使用平台内置 http backend 的环境
+// @Produce application/octet-stream
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param versionId path string true "state 版本ID"
+// @router /envs/{envId}/state/versions/{versionId} [get]
+// @Success 200 {string} string "state 文件内容"
+func DownloadStateVersion(c *ctx.GinRequest) {
+	form := forms.StateVersionParam{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	version, err := apps.GetStateVersion(c.Service(), &form)
+	if err != nil {
+		c.JSONError(err)
+		return
+	}
+	c.FileDownloadResponse(version.Content, fmt.Sprintf("terraform-%s-%d.tfstate", form.Id, version.Serial), "")
+}
+
+// StateVersionDiff 环境 state 版本对比
+// @Tags 环境
+// @Summary 对比 state 版本与基准版本的资源及输出差异
+// @Description 仅支持使用平台内置 http backend 的环境
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param versionId path string true "state 版本ID"
+// @Param form query forms.StateVersionDiffForm true "parameter"
+// @router /envs/{envId}/state/versions/{versionId}/diff [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.StateVersionDiffResp}
+func StateVersionDiff(c *ctx.GinRequest) {
+	form := forms.StateVersionDiffForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.StateVersionDiff(c.Service(), &form))
+}
+
+// StateVersionRollback 环境 state 回滚
+// @Tags 环境
+// @Summary 将环境 state 回滚到指定版本
+// @Description 仅支持使用平台内置 http backend 的环境。回滚会以指定版本的内容生成一个新的 state 版本，环境有活跃任务或 state 被锁定时不允许回滚
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param versionId path string true "state 版本ID"
+// @router /envs/{envId}/state/versions/{versionId}/rollback [post]
+// @Success 200 {object} ctx.JSONResult{result=models.StateVersion}
+func StateVersionRollback(c *ctx.GinRequest) {
+	form := forms.StateVersionParam{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.StateVersionRollback(c.Service(), &form))
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// LoginMfa 多因素认证登录
+// @Tags 鉴权
+// @Summary 多因素认证登录
+// @Description 登录接口返回 mfaRequired 时，使用返回的 mfaToken 及认证器中的验证码(或恢复码)完成登录
+// @Accept multipart/form-data
+// @Accept json
+// @Param body formData forms.LoginMfaForm true "parameter"
+// @router /auth/login/mfa [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.LoginResp}
+func (a Auth) LoginMfa(c *ctx.GinRequest) {
+	form := forms.LoginMfaForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.LoginMfa(c.Service(), &form))
+}
+
+// MfaEnroll 登录时绑定认证器
+// @Tags 鉴权
+// @Summary 登录时绑定认证器
+// @Description 登录接口返回 mfaEnrollRequired 时，使用返回的 mfaToken 获取 TOTP 密钥
+// @Accept multipart/form-data
+// @Accept json
+// @Param body formData forms.MfaEnrollForm true "parameter"
+// @router /auth/mfa/enroll [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.MfaEnrollResp}
+func (a Auth) MfaEnroll(c *ctx.GinRequest) {
+	form := forms.MfaEnrollForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.MfaEnroll(c.Service(), &form))
+}
+
+// MfaEnrollConfirm 登录时确认绑定认证器
+// @Tags 鉴权
+// @Summary 登录时确认绑定认证器
+// @Description 确认成功后启用多因素认证，返回恢复码及登录令牌
+// @Accept multipart/form-data
+// @Accept json
+// @Param body formData forms.MfaEnrollConfirmForm true "parameter"
+// @router /auth/mfa/enroll/confirm [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.MfaEnrollConfirmResp}
+func (a Auth) MfaEnrollConfirm(c *ctx.GinRequest) {
+	form := forms.MfaEnrollConfirmForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.MfaEnrollConfirm(c.Service(), &form))
+}
+
+// SelfMfaEnroll 绑定认证器
+// @Tags 用户
+// @Summary 绑定认证器
+// @Description 获取新的 TOTP 密钥，确认后才会启用多因素认证
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @router /users/self/mfa [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.MfaEnrollResp}
+func (User) SelfMfaEnroll(c *ctx.GinRequest) {
+	c.JSONResult(apps.SelfMfaEnroll(c.Service()))
+}
+
+// SelfMfaEnrollConfirm 确认绑定认证器
+// @Tags 用户
+// @Summary 确认绑定认证器
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param form formData forms.MfaCodeForm true "parameter"
+// @router /users/self/mfa/confirm [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.MfaEnrollConfirmResp}
+func (User) SelfMfaEnrollConfirm(c *ctx.GinRequest) {
+	form := forms.MfaCodeForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SelfMfaEnrollConfirm(c.Service(), &form))
+}
+
+// SelfMfaDisable 关闭多因素认证
+// @Tags 用户
+// @Summary 关闭多因素认证
+// @Description 平台管理员及要求启用多因素认证的组织成员不能关闭
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param form formData forms.MfaCodeForm true "parameter"
+// @router /users/self/mfa [delete]
+// @Success 200 {object} ctx.JSONResult
+func (User) SelfMfaDisable(c *ctx.GinRequest) {
+	form := forms.MfaCodeForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SelfMfaDisable(c.Service(), &form))
+}
+
+// MfaReset 重置用户的多因素认证
+// @Tags 用户
+// @Summary 重置用户的多因素认证
+// @Description 需要平台管理员权限，用于用户丢失认证器及恢复码的情况
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param userId path string true "用户ID"
+// @router /users/{userId}/mfa/reset [post]
+// @Success 200 {object} ctx.JSONResult
+func (User) MfaReset(c *ctx.GinRequest) {
+	form := forms.DetailUserForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ResetUserMfa(c.Service(), &form))
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"net/http"
+)
+
+const oidcAuthRequestCookie = "iac_oidc_auth_request"
+
+// OidcConfig 查询 oidc 单点登录配置
+// @Tags 鉴权
+// @Summary 查询 oidc 单点登录配置
+// @Accept json
+// @Produce json
+// @router /auth/oidc/config [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.OidcConfigResp}
+func OidcConfig(c *ctx.GinRequest) {
+	c.JSONResult(apps.OidcConfig(c.Service()))
+}
+
+// OidcLogin oidc 单点登录，跳转到 IdP 的认证页面
+// @Tags 鉴权
+// @Summary oidc 单点登录
+// @Param form query forms.OidcLoginForm true "parameter"
+// @router /auth/oidc/login [get]
+// @Success 302
+func OidcLogin(c *ctx.GinRequest) {
+	form := forms.OidcLoginForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	authUrl, authReq, er := apps.OidcLogin(c.Service(), &form)
+	if er != nil {
+		c.JSONError(er)
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcAuthRequestCookie, authReq, int(services.OidcAuthRequestExpire.Seconds()),
+		"/api/v1/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authUrl)
+}
+
+// OidcCallback oidc 登录回调，登录成功后跳转到登录时指定的页面，页面地址中的 oidcCode 参数用于换取用户 token
+// @Tags 鉴权
+// @Summary oidc 登录回调
+// @Param form query forms.OidcCallbackForm true "parameter"
+// @router /auth/oidc/callback [get]
+// @Success 302
+func OidcCallback(c *ctx.GinRequest) {
+	form := forms.OidcCallbackForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	authReq, _ := c.Cookie(oidcAuthRequestCookie)
+	// 登录请求只能使用一次
+	c.SetCookie(oidcAuthRequestCookie, "", -1, "/api/v1/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, apps.OidcCallback(c.Service(), &form, authReq))
+}
+
+// OidcToken 使用 oidcCode 换取用户 token
+// @Tags 鉴权
+// @Summary 使用 oidcCode 换取用户 token
+// @Accept multipart/form-data
+// @Accept json
+// @Param body formData forms.OidcTokenForm true "parameter"
+// @router /auth/oidc/token [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.LoginResp}
+func OidcToken(c *ctx.GinRequest) {
+	form := forms.OidcTokenForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.OidcToken(c.Service(), &form))
+}
+
+// SearchOidcGroupRole oidc 用户组角色映射列表
+// @Tags oidc
+// @Summary oidc 用户组角色映射列表
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param form query forms.SearchOidcGroupRoleForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.OidcGroupRole}}
+// @Router /oidc/group_roles [get]
+func SearchOidcGroupRole(c *ctx.GinRequest) {
+	form := &forms.SearchOidcGroupRoleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchOidcGroupRole(c.Service(), form))
+}
+
+// CreateOidcGroupRole 创建 oidc 用户组角色映射
+// @Tags oidc
+// @Summary 创建 oidc 用户组角色映射
+// @Description 用户通过 oidc 登录时，根据 ID token 中的用户组授予组织或项目角色
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param form formData forms.CreateOidcGroupRoleForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=models.OidcGroupRole}
+// @Router /oidc/group_roles [post]
+func CreateOidcGroupRole(c *ctx.GinRequest) {
+	form := &forms.CreateOidcGroupRoleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateOidcGroupRole(c.Service(), form))
+}
+
+// DeleteOidcGroupRole 删除 oidc 用户组角色映射
+// @Tags oidc
+// @Summary 删除 oidc 用户组角色映射
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param id path string true "映射ID"
+// @Success 200 {object} ctx.JSONResult
+// @Router /oidc/group_roles/{id} [delete]
+func DeleteOidcGroupRole(c *ctx.GinRequest) {
+	form := &forms.DeleteOidcGroupRoleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteOidcGroupRole(c.Service(), form))
+}
+
+// OidcLink 设置是否允许用户绑定 oidc 身份
+// @Tags 用户
+// @Summary 设置是否允许用户绑定 oidc 身份
+// @Description 需要平台管理员权限。已存在的用户只有在允许后才能在 oidc 登录时绑定身份，修改后用户已绑定的身份失效
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param userId path string true "用户ID"
+// @Param form body forms.UserOidcLinkForm true "parameter"
+// @Success 200 {object} ctx.JSONResult
+// @Router /users/{userId}/oidc [put]
+func (User) OidcLink(c *ctx.GinRequest) {
+	form := &forms.UserOidcLinkForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SetUserOidcLink(c.Service(), form))
+}
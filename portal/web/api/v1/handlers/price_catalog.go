@@ -0,0 +1,76 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// SearchPriceCatalog 查询价格目录列表
+// @Summary 查询价格目录列表
+// @Description 查询费用预估内置询价使用的价格目录，每个云商使用版本号最大的价格目录(active)询价
+// @Tags 价格目录
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Success 200 {object} ctx.JSONResult{result=[]pricecalculator.CatalogInfo}
+// @Router /price_catalogs [get]
+func SearchPriceCatalog(c *ctx.GinRequest) {
+	c.JSONResult(apps.SearchPriceCatalog(c.Service()))
+}
+
+// PriceCatalogDetail 价格目录详情
+// @Summary 价格目录详情
+// @Tags 价格目录
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Param provider path string true "云商"
+// @Param version path string true "版本"
+// @Success 200 {object} ctx.JSONResult{result=pricecalculator.Catalog}
+// @Router /price_catalogs/{provider}/{version} [get]
+func PriceCatalogDetail(c *ctx.GinRequest) {
+	form := forms.PriceCatalogParam{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PriceCatalogDetail(c.Service(), &form))
+}
+
+// UploadPriceCatalog 上传价格目录
+// @Summary 上传价格目录
+// @Description 上传 yaml 或 json 格式的价格目录，云商及版本相同时覆盖原有的价格目录
+// @Tags 价格目录
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Param data body forms.UploadPriceCatalogForm true "价格目录"
+// @Success 200 {object} ctx.JSONResult{result=pricecalculator.CatalogInfo}
+// @Router /price_catalogs [post]
+func UploadPriceCatalog(c *ctx.GinRequest) {
+	form := forms.UploadPriceCatalogForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UploadPriceCatalog(c.Service(), &form))
+}
+
+// DeletePriceCatalog 删除价格目录
+// @Summary 删除价格目录
+// @Tags 价格目录
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Param provider path string true "云商"
+// @Param version path string true "版本"
+// @Success 200 {object} ctx.JSONResult
+// @Router /price_catalogs/{provider}/{version} [delete]
+func DeletePriceCatalog(c *ctx.GinRequest) {
+	form := forms.PriceCatalogParam{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeletePriceCatalog(c.Service(), &form))
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// SearchEnvDrift 环境资源漂移记录
+// @Tags 资源漂移
+// @Summary 查询环境的资源属性漂移记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "环境ID"
+// @Param form query forms.SearchEnvDriftForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.ResourceDriftRecord}}
+// @Router /envs/{id}/drifts [get]
+func SearchEnvDrift(c *ctx.GinRequest) {
+	form := &forms.SearchEnvDriftForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvDrift(c.Service(), form))
+}
+
+// UpdateEnvDrift 确认或者忽略资源属性漂移
+// @Tags 资源漂移
+// @Summary 确认或者忽略资源属性漂移
+// @Description 忽略的属性在之后的偏移检测中不再视为漂移；确认的漂移在实际值再次变化时会重新标记为漂移
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "环境ID"
+// @Param driftId path string true "漂移记录ID"
+// @Param form formData forms.UpdateEnvDriftForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=models.ResourceDriftRecord}
+// @Router /envs/{id}/drifts/{driftId} [put]
+func UpdateEnvDrift(c *ctx.GinRequest) {
+	form := &forms.UpdateEnvDriftForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateEnvDrift(c.Service(), form))
+}
+
+// EnvDriftTrend 环境漂移趋势
+// @Tags 资源漂移
+// @Summary 环境每天处于漂移状态的属性及资源数量
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "环境ID"
+// @Param form query forms.EnvDriftTrendForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=[]resps.DriftTrendPoint}
+// @Router /envs/{id}/drifts/trend [get]
+func EnvDriftTrend(c *ctx.GinRequest) {
+	form := &forms.EnvDriftTrendForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvDriftTrend(c.Service(), form))
+}
+
+// ProjectDriftTrend 项目漂移趋势
+// @Tags 资源漂移
+// @Summary 项目每天处于漂移状态的属性、资源及环境数量
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form query forms.DriftTrendForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=[]resps.DriftTrendPoint}
+// @Router /projects/drifts/trend [get]
+func ProjectDriftTrend(c *ctx.GinRequest) {
+	form := &forms.DriftTrendForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ProjectDriftTrend(c.Service(), form))
+}
+
+// OrgDriftTrend 组织漂移趋势
+// @Tags 资源漂移
+// @Summary 组织每天处于漂移状态的属性、资源及环境数量
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.DriftTrendForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=[]resps.DriftTrendPoint}
+// @Router /orgs/drifts/trend [get]
+func OrgDriftTrend(c *ctx.GinRequest) {
+	form := &forms.DriftTrendForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.OrgDriftTrend(c.Service(), form))
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// SearchRole 自定义角色列表
+// @Tags 角色
+// @Summary 自定义角色列表
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param form query forms.SearchRoleForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.Role}}
+// @Router /roles [get]
+func SearchRole(c *ctx.GinRequest) {
+	form := &forms.SearchRoleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchRole(c.Service(), form))
+}
+
+// RolePermissions 自定义角色可以授予的权限列表
+// @Tags 角色
+// @Summary 自定义角色可以授予的权限列表
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param form query forms.RolePermissionsForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=[]resps.RolePermissionResp}
+// @Router /roles/permissions [get]
+func RolePermissions(c *ctx.GinRequest) {
+	form := &forms.RolePermissionsForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RolePermissions(c.Service(), form))
+}
+
+// DetailRole 自定义角色详情
+// @Tags 角色
+// @Summary 自定义角色详情
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param id path string true "角色ID"
+// @Success 200 {object} ctx.JSONResult{result=models.Role}
+// @Router /roles/{id} [get]
+func DetailRole(c *ctx.GinRequest) {
+	form := &forms.DetailRoleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DetailRole(c.Service(), form))
+}
+
+// CreateRole 创建自定义角色
+// @Tags 角色
+// @Summary 创建自定义角色
+// @Description 自定义角色可以通过组织用户及项目用户接口授予用户
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param form formData forms.CreateRoleForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=models.Role}
+// @Router /roles [post]
+func CreateRole(c *ctx.GinRequest) {
+	form := &forms.CreateRoleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateRole(c.Service(), form))
+}
+
+// UpdateRole 修改自定义角色
+// @Tags 角色
+// @Summary 修改自定义角色
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param id path string true "角色ID"
+// @Param form formData forms.UpdateRoleForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=models.Role}
+// @Router /roles/{id} [put]
+func UpdateRole(c *ctx.GinRequest) {
+	form := &forms.UpdateRoleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateRole(c.Service(), form))
+}
+
+// DeleteRole 删除自定义角色
+// @Tags 角色
+// @Summary 删除自定义角色
+// @Description 角色已授予用户时不允许删除
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param id path string true "角色ID"
+// @Success 200 {object} ctx.JSONResult
+// @Router /roles/{id} [delete]
+func DeleteRole(c *ctx.GinRequest) {
+	form := &forms.DeleteRoleForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteRole(c.Service(), form))
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// CreateRunnerJoinToken 创建 runner agent 注册令牌
+// @Summary 创建 runner agent 注册令牌
+// @Description 创建一次性的 runner agent 注册令牌，令牌明文只在创建时返回
+// @Tags runner
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Param data body forms.CreateRunnerJoinTokenForm true "令牌信息"
+// @Success 200 {object} ctx.JSONResult{result=resps.RunnerJoinTokenResp}
+// @Router /runner_agents/join_tokens [post]
+func CreateRunnerJoinToken(c *ctx.GinRequest) {
+	form := forms.CreateRunnerJoinTokenForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateRunnerJoinToken(c.Service(), &form))
+}
+
+// SearchRunnerAgent 查询 runner agent 列表
+// @Summary 查询 runner agent 列表
+// @Description 查询 runner agent 列表
+// @Tags runner
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Param form query forms.SearchRunnerAgentForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.RunnerAgent}}
+// @Router /runner_agents [get]
+func SearchRunnerAgent(c *ctx.GinRequest) {
+	form := forms.SearchRunnerAgentForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchRunnerAgent(c.Service(), &form))
+}
+
+// DeleteRunnerAgent 删除 runner agent
+// @Summary 删除 runner agent
+// @Description 删除 runner agent 并断开其连接
+// @Tags runner
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Param id path string true "runner agent ID"
+// @Success 200 {object} ctx.JSONResult
+// @Router /runner_agents/{id} [delete]
+func DeleteRunnerAgent(c *ctx.GinRequest) {
+	form := forms.DeleteRunnerAgentForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteRunnerAgent(c.Service(), &form))
+}
+
+// RunnerAgentJoin runner agent 注册
+// @Summary runner agent 注册
+// @Description runner agent 使用注册令牌注册，返回 runner id 及连接 portal 使用的密钥
+// @Tags runner
+// @Accept  json
+// @Produce  json
+// @Param data body forms.RunnerAgentJoinForm true "注册信息"
+// @Success 200 {object} ctx.JSONResult{result=resps.RunnerAgentJoinResp}
+// @Router /runner_agent/join [post]
+func RunnerAgentJoin(c *ctx.GinRequest) {
+	form := forms.RunnerAgentJoinForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RunnerAgentJoin(c.Service(), &form))
+}
+
+// RunnerAgentConnect runner agent 建立 websocket 长连接，portal 通过该连接向 runner 下发请求
+func RunnerAgentConnect(c *ctx.GinRequest) {
+	if err := apps.RunnerAgentConnect(c); err != nil {
+		c.JSONError(err)
+	}
+}
+
+// RunnerAgentProxy 通过 agent 连接转发 runner api 请求，由 portal 内部调用
+func RunnerAgentProxy(c *ctx.GinRequest) {
+	if err := apps.RunnerAgentProxy(c, c.Param("id"), c.Param("path")); err != nil {
+		c.JSONError(err)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// CreateStackRun 创建批量编排
+// @Tags 批量编排
+// @Summary 对项目下的多个环境批量发起 plan、部署或销毁任务
+// @Description 任务按环境依赖关系执行，没有依赖关系的环境并行执行，所有任务的执行计划共用一次审批
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form body forms.CreateStackRunForm true "parameter"
+// @router /stack_runs [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.StackRunResp}
+func CreateStackRun(c *ctx.GinRequest) {
+	form := forms.CreateStackRunForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateStackRun(c.Service(), &form))
+}
+
+// SearchStackRun 批量编排记录
+// @Tags 批量编排
+// @Summary 查询项目的批量编排记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form query forms.SearchStackRunForm true "parameter"
+// @router /stack_runs [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.StackRun}}
+func SearchStackRun(c *ctx.GinRequest) {
+	form := forms.SearchStackRunForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchStackRun(c.Service(), &form))
+}
+
+// StackRunDetail 批量编排详情
+// @Tags 批量编排
+// @Summary 批量编排详情，包含每个环境对应的任务
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param stackRunId path string true "编排ID"
+// @router /stack_runs/{stackRunId} [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.StackRunResp}
+func StackRunDetail(c *ctx.GinRequest) {
+	form := forms.StackRunParam{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.StackRunDetail(c.Service(), &form))
+}
+
+// ApproveStackRun 审批批量编排
+// @Tags 批量编排
+// @Summary 审批批量编排中所有任务的执行计划
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param stackRunId path string true "编排ID"
+// @Param form body forms.ApproveStackRunForm true "parameter"
+// @router /stack_runs/{stackRunId}/approve [post]
+// @Success 200 {object} ctx.JSONResult{result=resps.StackRunResp}
+func ApproveStackRun(c *ctx.GinRequest) {
+	form := forms.ApproveStackRunForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ApproveStackRun(c.Service(), &form))
+}
@@ -56,10 +56,10 @@ func ConsulKVSearch(c *ctx.GinRequest) {
 // @Accept  json
 // @Produce  json
 // @Security AuthToken
-// @Success 200 {object} ctx.JSONResult
+// @Success 200 {object} ctx.JSONResult{result=[]resps.RunnerResp}
 // @Router /runners [get]
 func RunnerSearch(c *ctx.GinRequest) {
-	c.JSONResult(apps.RunnerSearch())
+	c.JSONResult(apps.RunnerSearch(c.Service()))
 }
 
 // ConsulTagUpdate 修改服务标签
@@ -92,3 +92,57 @@ func ConsulTagUpdate(c *ctx.GinRequest) {
 func RunnerTags(c *ctx.GinRequest) {
 	c.JSONResult(apps.RunnerTags())
 }
+
+// UpdateRunnerTags 修改 runner tags
+// @Summary 修改 runner tags
+// @Description 修改 runner tags，根据 runner 注册方式保存到 consul 或数据库
+// @Tags runner
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Param id path string true "runner ID"
+// @Param data body forms.UpdateRunnerTagsForm true "tag信息"
+// @Success 200 {object} ctx.JSONResult
+// @Router /runners/{id}/tags [put]
+func UpdateRunnerTags(c *ctx.GinRequest) {
+	form := forms.UpdateRunnerTagsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateRunnerTags(c.Service(), &form))
+}
+
+// RunnerHeartbeat runner 心跳上报
+// @Summary runner 心跳上报
+// @Description 使用数据库作为注册中心时 runner 定时上报心跳，请求使用 runner api 密钥签名
+// @Tags runner
+// @Accept  json
+// @Produce  json
+// @Param data body forms.RunnerHeartbeatForm true "runner 信息"
+// @Success 200 {object} ctx.JSONResult
+// @Router /runners/heartbeat [post]
+func RunnerHeartbeat(c *ctx.GinRequest) {
+	if _, err := apps.VerifyRunnerRequest(c, c.Request.URL.Path); err != nil {
+		c.JSONError(err)
+		return
+	}
+	form := forms.RunnerHeartbeatForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RunnerHeartbeat(c.Service(), &form))
+}
+
+// RunnerStepEvents runner 建立 websocket 长连接，通过该连接推送所有步骤的状态和日志，请求使用 runner api 密钥签名
+func RunnerStepEvents(c *ctx.GinRequest) {
+	if err := apps.RunnerStepEvents(c); err != nil {
+		c.JSONError(err)
+	}
+}
+
+// SubscribeRunnerStepEvents portal 实例间转发步骤事件订阅，请求使用 runner api 密钥签名
+func SubscribeRunnerStepEvents(c *ctx.GinRequest) {
+	if err := apps.SubscribeRunnerStepEvents(c); err != nil {
+		c.JSONError(err)
+	}
+}
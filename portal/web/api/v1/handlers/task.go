@@ -264,3 +264,43 @@ func (Task) ResourceGraph(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.SearchTaskResourcesGraph(c.Service(), &form))
 }
+
+// SearchTaskEvent 获取任务时间线
+// @Tags 任务管理
+// @Summary 获取任务时间线，包括 runner 失联、重新调度及恢复等事件
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @router /tasks/{taskId}/events [get]
+// @Success 200 {object} ctx.JSONResult{result=[]models.TaskEvent}
+func (Task) SearchTaskEvent(c *ctx.GinRequest) {
+	form := forms.SearchTaskEventForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTaskEvents(c.Service(), &form))
+}
+
+// TaskRecover 恢复任务
+// @Tags 环境
+// @Summary 恢复执行变更步骤时 runner 失联的任务，发起 state 任务解除 state 锁并刷新 state
+// @Accept application/json
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @Param form formData forms.RecoverTaskForm true "parameter"
+// @router /tasks/{taskId}/recover [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (Task) TaskRecover(c *ctx.GinRequest) {
+	form := &forms.RecoverTaskForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RecoverTask(c.Service(), form))
+}
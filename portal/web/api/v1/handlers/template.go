@@ -179,10 +179,15 @@ func TemplatePlaybookSearch(c *ctx.GinRequest) {
 // @Accept application/x-www-form-urlencoded
 // @Security AuthToken
 // @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.TfVersionListForm true "parameter"
 // @router /templates/tfversions [get]
 // @Success 200 {object} ctx.JSONResult{result=[]string}
 func TemplateTfVersionSearch(c *ctx.GinRequest) {
-	c.JSONResult(common.TerraformVersions, nil)
+	form := forms.TfVersionListForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(common.IacEngineVersions(form.IacEngine), nil)
 }
 
 // AutoTemplateTfVersionChoice
@@ -51,7 +51,14 @@ func Register(g *gin.RouterGroup) {
 
 	g.POST("/auth/register", w(handlers.Auth{}.Registry))
 	g.POST("/auth/login", w(handlers.Auth{}.Login))
+	g.POST("/auth/login/mfa", w(handlers.Auth{}.LoginMfa))
+	g.POST("/auth/mfa/enroll", w(handlers.Auth{}.MfaEnroll))
+	g.POST("/auth/mfa/enroll/confirm", w(handlers.Auth{}.MfaEnrollConfirm))
 	g.GET("/auth/email", w(handlers.Auth{}.CheckEmail))
+	g.GET("/auth/oidc/config", w(handlers.OidcConfig))
+	g.GET("/auth/oidc/login", w(handlers.OidcLogin))
+	g.GET("/auth/oidc/callback", w(handlers.OidcCallback))
+	g.POST("/auth/oidc/token", w(handlers.OidcToken))
 	g.POST("/auth/password/reset/email", w(handlers.Auth{}.PasswordResetEmail))
 
 	// 重新发送邮件
@@ -61,6 +68,24 @@ func Register(g *gin.RouterGroup) {
 
 	g.GET("/system_config/switches", w(handlers.SystemSwitchesStatus))
 
+	// portal 内置的 terraform http backend，使用任务签发的 state token 鉴权
+	for _, method := range []string{"GET", "POST", "LOCK", "UNLOCK"} {
+		g.Handle(method, "/tfstate/*path", w(handlers.TfState))
+	}
+
+	// 使用数据库作为注册中心时 runner 上报心跳，使用 runner api 签名鉴权
+	g.POST("/runners/heartbeat", w(handlers.RunnerHeartbeat))
+	// runner 推送步骤状态和日志，使用 runner api 签名鉴权
+	g.GET("/runners/events", w(handlers.RunnerStepEvents))
+	// portal 实例间转发步骤事件订阅，使用 runner api 签名鉴权
+	g.GET("/runners/events/subscribe", w(handlers.SubscribeRunnerStepEvents))
+
+	// runner agent 注册及连接，使用注册令牌或 agent 密钥鉴权
+	g.POST("/runner_agent/join", w(handlers.RunnerAgentJoin))
+	g.GET("/runner_agent/connect", w(handlers.RunnerAgentConnect))
+	// portal 实例间转发 runner api 请求，使用 runner api 签名鉴权
+	g.Any("/runner_agent/proxy/:id/*path", w(handlers.RunnerAgentProxy))
+
 	// Authorization Header 鉴权
 	g.Use(w(middleware.Auth)) // 解析 header token
 
@@ -80,17 +105,26 @@ func Register(g *gin.RouterGroup) {
 
 	g.GET("/auth/me", ac("self", "read"), w(handlers.Auth{}.GetUserByToken))
 	g.PUT("/users/self", ac("self", "update"), w(handlers.User{}.UpdateSelf))
+	g.POST("/users/self/mfa", ac("self", "update"), w(handlers.User{}.SelfMfaEnroll))
+	g.POST("/users/self/mfa/confirm", ac("self", "update"), w(handlers.User{}.SelfMfaEnrollConfirm))
+	g.DELETE("/users/self/mfa", ac("self", "update"), w(handlers.User{}.SelfMfaDisable))
 	//todo runner list权限怎么划分
 	g.GET("/runners", ac(), w(handlers.RunnerSearch))
 	g.PUT("/consul/tags/update", ac(), w(handlers.ConsulTagUpdate))
 	g.GET("/consul/kv/search", ac(), w(handlers.ConsulKVSearch))
 	g.GET("/runners/tags", ac(), w(handlers.RunnerTags)) // 返回所有的runner tags
+	g.PUT("/runners/:id/tags", ac(), w(handlers.UpdateRunnerTags))
+	g.GET("/runner_agents", ac(), w(handlers.SearchRunnerAgent))
+	g.POST("/runner_agents/join_tokens", ac(), w(handlers.CreateRunnerJoinToken))
+	g.DELETE("/runner_agents/:id", ac(), w(handlers.DeleteRunnerAgent))
 
 	ctrl.Register(g.Group("orgs", ac()), &handlers.Organization{})
 	g.PUT("/orgs/:id/status", ac(), w(handlers.Organization{}.ChangeOrgStatus))
 	ctrl.Register(g.Group("users", ac()), &handlers.User{})
 	g.PUT("/users/:id/status", ac(), w(handlers.User{}.ChangeUserStatus))
 	g.POST("/users/:id/password/reset", ac(), w(handlers.User{}.PasswordReset))
+	g.POST("/users/:id/mfa/reset", ac(), w(handlers.User{}.MfaReset))
+	g.PUT("/users/:id/oidc", ac(), w(handlers.User{}.OidcLink))
 
 	// 系统配置
 	g.PUT("/systems", ac(), w(handlers.SystemConfig{}.Update))
@@ -105,6 +139,12 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/system_config/registry/addr", ac(), w(handlers.GetRegistryAddr))     // 获取registry地址的设置
 	g.POST("/system_config/registry/addr", ac(), w(handlers.UpsertRegistryAddr)) // 更新registry地址的设置
 
+	// 费用预估价格目录，仅平台管理员可以管理
+	g.GET("/price_catalogs", ac(), w(handlers.SearchPriceCatalog))
+	g.POST("/price_catalogs", ac(), w(handlers.UploadPriceCatalog))
+	g.GET("/price_catalogs/:provider/:version", ac(), w(handlers.PriceCatalogDetail))
+	g.DELETE("/price_catalogs/:provider/:version", ac(), w(handlers.DeletePriceCatalog))
+
 	// 平台概览
 	g.GET("/platform/stat/basedata", ac(), w(handlers.Platform{}.PlatformStatBasedata))
 	g.GET("/platform/stat/provider/env", ac(), w(handlers.Platform{}.PlatformStatProEnv))
@@ -182,6 +222,10 @@ func Register(g *gin.RouterGroup) {
 	// 列出项目下资源搜索得到的相关环境名称以及provider名称
 	g.GET("/projects/resources/filters", ac("projects", "read"), w(handlers.Project{}.SearchProjectResourcesFilters))
 
+	// 组织及项目的资源漂移趋势
+	g.GET("/orgs/drifts/trend", ac("orgs", "read"), w(handlers.OrgDriftTrend))
+	g.GET("/projects/drifts/trend", ac("projects", "read"), w(handlers.ProjectDriftTrend))
+
 	// 组织概览统计数据
 	g.GET("/orgs/projects/statistics", ac(), w(handlers.Organization{}.OrgProjectsStat))
 
@@ -203,6 +247,33 @@ func Register(g *gin.RouterGroup) {
 	g.POST("/ldap/auth/org_user", ac(), w(handlers.AuthLdapUser))
 	g.POST("/ldap/auth/org_ou", ac(), w(handlers.AuthLdapOU))
 
+	// orgs oidc 用户组角色映射
+	g.GET("/oidc/group_roles", ac(), w(handlers.SearchOidcGroupRole))
+	g.POST("/oidc/group_roles", ac(), w(handlers.CreateOidcGroupRole))
+	g.DELETE("/oidc/group_roles/:id", ac(), w(handlers.DeleteOidcGroupRole))
+
+	// 组织自定义角色
+	g.GET("/roles", ac(), w(handlers.SearchRole))
+	g.GET("/roles/permissions", ac(), w(handlers.RolePermissions))
+	g.POST("/roles", ac(), w(handlers.CreateRole))
+	g.GET("/roles/:id", ac(), w(handlers.DetailRole))
+	g.PUT("/roles/:id", ac(), w(handlers.UpdateRole))
+	g.DELETE("/roles/:id", ac(), w(handlers.DeleteRole))
+
+	// 环境审批组
+	g.GET("/approver_groups", ac(), w(handlers.SearchApproverGroup))
+	g.POST("/approver_groups", ac(), w(handlers.CreateApproverGroup))
+	g.GET("/approver_groups/:id", ac(), w(handlers.DetailApproverGroup))
+	g.PUT("/approver_groups/:id", ac(), w(handlers.UpdateApproverGroup))
+	g.DELETE("/approver_groups/:id", ac(), w(handlers.DeleteApproverGroup))
+
+	// 变更窗口
+	g.GET("/change_windows", ac(), w(handlers.SearchChangeWindow))
+	g.POST("/change_windows", ac(), w(handlers.CreateChangeWindow))
+	g.GET("/change_windows/:id", ac(), w(handlers.DetailChangeWindow))
+	g.PUT("/change_windows/:id", ac(), w(handlers.UpdateChangeWindow))
+	g.DELETE("/change_windows/:id", ac(), w(handlers.DeleteChangeWindow))
+
 	g.GET("/projects/users", ac(), w(handlers.ProjectUser{}.Search))
 	g.GET("/projects/authorization/users", ac(), w(handlers.ProjectUser{}.SearchProjectAuthorizationUser))
 	g.POST("/projects/users", ac(), w(handlers.ProjectUser{}.Create))
@@ -286,9 +357,31 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/envs/:id/policy_result", ac(), w(handlers.Env{}.PolicyResult))
 	g.GET("/envs/:id/resources/graph", ac(), w(handlers.Env{}.SearchResourcesGraph))
 	g.GET("/envs/:id/resources/graph/:resourceId", ac(), w(handlers.Env{}.ResourceGraphDetail))
+	g.GET("/envs/:id/drifts", ac(), w(handlers.SearchEnvDrift))
+	g.GET("/envs/:id/drifts/trend", ac(), w(handlers.EnvDriftTrend))
+	g.PUT("/envs/:id/drifts/:driftId", ac("envs", "update"), w(handlers.UpdateEnvDrift))
 	g.POST("/envs/:id/lock", ac("envs", "lock"), w(handlers.EnvLock))
 	g.POST("/envs/:id/unlock", ac("envs", "unlock"), w(handlers.EnvUnLock))
 	g.GET("/envs/:id/unlock/confirm", ac(), w(handlers.EnvUnLockConfirm))
+	g.POST("/envs/:id/state/migrate", ac("envs", "migratestate"), w(handlers.EnvStateMigrate))
+	g.GET("/envs/:id/state/versions", ac(), w(handlers.SearchStateVersion))
+	// state 内容中可能包含敏感信息，只允许管理者查看
+	g.GET("/envs/:id/state/versions/:versionId", ac("envs", "stateread"), w(handlers.DownloadStateVersion))
+	g.GET("/envs/:id/state/versions/:versionId/diff", ac("envs", "stateread"), w(handlers.StateVersionDiff))
+	g.POST("/envs/:id/state/versions/:versionId/rollback", ac("envs", "staterollback"), w(handlers.StateVersionRollback))
+	g.GET("/envs/:id/dependencies", ac(), w(handlers.GetEnvDependency))
+	g.PUT("/envs/:id/dependencies", ac("envs", "update"), w(handlers.UpdateEnvDependency))
+	g.POST("/envs/:id/chain/deploy", ac("envs", "deploy"), w(handlers.EnvChainDeploy))
+	g.POST("/envs/:id/chain/destroy", ac("envs", "destroy"), w(handlers.EnvChainDestroy))
+	g.GET("/envs/:id/chains", ac(), w(handlers.SearchEnvChain))
+	g.GET("/envs/:id/chains/:chainId", ac(), w(handlers.EnvChainDetail))
+	g.GET("/envs/:id/users", ac(), w(handlers.SearchEnvUser))
+	g.PUT("/envs/:id/users", ac("envs", "acl"), w(handlers.SetEnvUser))
+	g.DELETE("/envs/:id/users/:userId", ac("envs", "acl"), w(handlers.DeleteEnvUser))
+	g.POST("/stack_runs", ac("envs", "deploy"), w(handlers.CreateStackRun))
+	g.GET("/stack_runs", ac(), w(handlers.SearchStackRun))
+	g.GET("/stack_runs/:id", ac(), w(handlers.StackRunDetail))
+	g.POST("/stack_runs/:id/approve", ac("tasks", "approve"), w(handlers.ApproveStackRun))
 
 	// 环境概览统计数据
 	g.GET("/envs/:id/statistics", ac(), w(handlers.Env{}.EnvStat))
@@ -301,13 +394,23 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/tasks/:id/resources", ac(), w(handlers.Task{}.Resource))
 	g.POST("/tasks/:id/abort", ac("tasks", "abort"), w(handlers.Task{}.TaskAbort))
 	g.POST("/tasks/:id/approve", ac("tasks", "approve"), w(handlers.Task{}.TaskApprove))
+	g.GET("/tasks/:id/approvals", ac(), w(handlers.SearchTaskApproval))
 	g.POST("/tasks/:id/comment", ac(), w(handlers.TaskComment{}.Create))
 	g.GET("/tasks/:id/comment", ac(), w(handlers.TaskComment{}.Search))
 	g.GET("/tasks/:id/steps", ac(), w(handlers.Task{}.SearchTaskStep))
+	g.GET("/tasks/:id/events", ac(), w(handlers.Task{}.SearchTaskEvent))
+	g.POST("/tasks/:id/recover", ac("tasks", "recover"), w(handlers.Task{}.TaskRecover))
 	g.GET("/tasks/:id/steps/:stepId/log", ac(), w(handlers.Task{}.GetTaskStepLog))
 	g.GET("/tasks/:id/steps/:stepId/log/sse", ac(), w(handlers.Task{}.FollowStepLogSse))
 	g.GET("/tasks/:id/resources/graph", ac(), w(handlers.Task{}.ResourceGraph))
 
+	// 任务审批规则
+	g.GET("/approval_rules", ac(), w(handlers.SearchApprovalRule))
+	g.POST("/approval_rules", ac(), w(handlers.CreateApprovalRule))
+	g.GET("/approval_rules/:id", ac(), w(handlers.DetailApprovalRule))
+	g.PUT("/approval_rules/:id", ac(), w(handlers.UpdateApprovalRule))
+	g.DELETE("/approval_rules/:id", ac(), w(handlers.DeleteApprovalRule))
+
 	//g.GET("/tokens/trigger", ac(), w(handlers.Token{}.VcsWebhookUrl))
 	g.GET("/vcs/webhook", ac(), w(handlers.Token{}.VcsWebhookUrl))
 	ctrl.Register(g.Group("resource/account", ac()), &handlers.ResourceAccount{})
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -63,6 +64,12 @@ func parseId(requestURI string) string {
 }
 
 func Operation(c *ctx.GinRequest) {
+	// runner agent 注册、runner api 转发及 runner 心跳请求由服务调用，且包含令牌和任务参数，不记录操作日志
+	if strings.HasPrefix(c.Request.URL.Path, "/api/v1/runner_agent/") || c.Request.URL.Path == "/api/v1/runners/heartbeat" {
+		c.Next()
+		return
+	}
+
 	opMethod := &OperationMethod{C: c}
 	var opLog *models.OperationLog
 
@@ -6,12 +6,14 @@ import (
 	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
 	"cloudiac/portal/services"
 	"cloudiac/portal/services/rbac"
 	"cloudiac/utils/logs"
 	"fmt"
 	"net/http"
 	"regexp"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -121,6 +123,36 @@ func getCtxProjectRole(s *ctx.ServiceContext) string {
 	return proj
 }
 
+// getCtxEnvRole 获取用户在请求的环境中设置的角色，环境角色会覆盖用户的项目角色。
+// 环境通过 /envs/:id 或者 /tasks/:id 的路径参数确定，组织管理员不受环境角色限制
+func getCtxEnvRole(g *gin.Context, s *ctx.ServiceContext, object string) string {
+	if s.IsSuperAdmin || s.UserId == "" || services.UserHasOrgRole(s.UserId, s.OrgId, consts.OrgRoleAdmin) {
+		return ""
+	}
+
+	id := models.Id(g.Param("id"))
+	envId := models.Id("")
+	switch {
+	case object == "envs" && strings.HasPrefix(id.String(), "env-"):
+		envId = id
+	case object == "tasks" && strings.HasPrefix(id.String(), "run-"):
+		task, er := services.GetTaskById(s.DB(), id)
+		if er != nil {
+			return ""
+		}
+		envId = task.EnvId
+	default:
+		return ""
+	}
+
+	role, er := services.GetEnvUserRole(s.DB(), envId, s.UserId)
+	if er != nil {
+		s.Logger().Errorf("get user env role error: %v", er)
+		return ""
+	}
+	return role
+}
+
 func rewriteACParams(op, act, res, obj, role, sub string) (string, string, string) {
 	action := op
 	if act != "" {
@@ -167,6 +199,9 @@ func AccessControl(args ...string) gin.HandlerFunc {
 
 		// 参数重写
 		action, object, role := rewriteACParams(op, act, res, obj, role, sub)
+		if envRole := getCtxEnvRole(g, s, object); envRole != "" {
+			proj = envRole
+		}
 
 		// 根据 角色 和 项目角色 判断资源访问许可
 		allow, err := rbac.Enforce(role, proj, object, action)
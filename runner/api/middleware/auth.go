@@ -0,0 +1,31 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package middleware
+
+import (
+	"bytes"
+	"cloudiac/configs"
+	"cloudiac/runner/api/ctx"
+	"cloudiac/utils/runnerauth"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Auth 校验 portal 请求签名，拒绝未签名或签名错误的请求
+func Auth(c *ctx.Context) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.Error(err, http.StatusBadRequest)
+		c.Abort()
+		return
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err := runnerauth.Verify(configs.Get().RunnerApiSecret, c.Request, body); err != nil {
+		c.Error(fmt.Errorf("unauthorized: %v", err), http.StatusUnauthorized)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
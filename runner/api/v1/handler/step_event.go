@@ -0,0 +1,111 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handler
+
+import (
+	"cloudiac/runner"
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+)
+
+const (
+	stepEventLogChunkSize     = 32 * 1024              // 单个日志事件的最大长度
+	stepEventLogFlushInterval = 500 * time.Millisecond // 日志事件的发送间隔
+	stepEventStatusInterval   = 30 * time.Second       // 步骤执行中定时发送状态事件，portal 以此判断事件推送是否正常
+)
+
+// publishTaskStepEvents 推送步骤的日志和状态事件，直到步骤退出
+func publishTaskStepEvents(task *runner.StartedTask) {
+	logger := logger.WithField("func", "publishTaskStepEvents").
+		WithField("taskId", task.TaskId).WithField("step", task.Step)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	waitTaskErrCh := make(chan error, 1)
+	go func() {
+		_, err := task.Wait(ctx)
+		// 等待 followFile() 读取最后写入的日志
+		time.Sleep(runner.FollowLogDelay)
+		waitTaskErrCh <- err
+	}()
+
+	logPath := filepath.Join(runner.GetTaskDir(task.EnvId, task.TaskId, task.Step), runner.TaskLogName)
+	contentCh, readErrCh := followFile(ctx, logPath, 0)
+
+	newEvent := func(typ string) *runner.TaskStepEvent {
+		return &runner.TaskStepEvent{Type: typ, EnvId: task.EnvId, TaskId: task.TaskId, Step: task.Step}
+	}
+	publish := func(ev *runner.TaskStepEvent) {
+		if !runner.PublishStepEvent(ev) {
+			logger.Warnf("step event queue is full, drop %s event", ev.Type)
+		}
+	}
+
+	var (
+		offset int64
+		buf    []byte
+	)
+	flushLog := func() {
+		if len(buf) == 0 {
+			return
+		}
+		ev := newEvent(runner.TaskStepEventLog)
+		ev.Offset = offset
+		ev.Content = buf
+		publish(ev)
+		offset += int64(len(buf))
+		buf = nil
+	}
+	sendStatus := func(withLog bool, isDeadline bool) {
+		flushLog()
+		msg, err := newTaskStatusMessage(task, withLog, isDeadline)
+		if err != nil {
+			logger.Warnf("get task status: %v", err)
+			return
+		}
+		ev := newEvent(runner.TaskStepEventStatus)
+		ev.Status = msg
+		publish(ev)
+	}
+
+	flushTicker := time.NewTicker(stepEventLogFlushInterval)
+	defer flushTicker.Stop()
+	statusTicker := time.NewTicker(stepEventStatusInterval)
+	defer statusTicker.Stop()
+
+	sendStatus(false, false)
+	for {
+		select {
+		case content, ok := <-contentCh:
+			if !ok {
+				contentCh = nil
+				continue
+			}
+			buf = append(buf, content...)
+			if len(buf) >= stepEventLogChunkSize {
+				flushLog()
+			}
+		case err := <-readErrCh:
+			if err != nil {
+				logger.Warnf("follow task log: %v", err)
+			}
+			readErrCh = nil
+		case <-flushTicker.C:
+			flushLog()
+		case <-statusTicker.C:
+			sendStatus(false, false)
+		case err := <-waitTaskErrCh:
+			if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+				// 不发送退出事件，portal 会在超时后主动连接 runner 获取步骤状态
+				logger.Errorf("wait task: %v", err)
+				return
+			}
+			// 退出事件包含全量日志，portal 以此补全丢失的日志事件
+			sendStatus(true, err != nil)
+			return
+		}
+	}
+}
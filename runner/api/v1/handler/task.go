@@ -33,6 +33,13 @@ func RunTask(c *ctx.Context) {
 		}
 		return
 	} else {
+		if runner.StepEventsEnabled() {
+			if started, err := runner.LoadStartedTask(req.Env.Id, req.TaskId, req.Step); err != nil {
+				c.Logger.Warnf("load started task: %v", err)
+			} else {
+				go publishTaskStepEvents(started)
+			}
+		}
 		c.Result(gin.H{"containerId": cid})
 	}
 }
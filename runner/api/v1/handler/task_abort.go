@@ -85,20 +85,21 @@ func doAbortTask(task *runner.StartedTask) error {
 		return nil
 	}
 
+	executor := runner.GetExecutor()
 	// 容器可能被暂停了，所以先启动容器
-	if err := (runner.Executor{}).UnpauseIf(task.ContainerId); err != nil {
+	if err := executor.UnpauseIf(task.ContainerId); err != nil {
 		return err
 	}
 
 	if task.ExecId != "" {
 		logger.Infof("stop exec: %s", task.ExecId)
-		if err := (runner.Executor{}).StopCommand(task.ExecId); err != nil {
+		if err := executor.StopCommand(task.ExecId); err != nil {
 			return err
 		}
 	}
 
 	unlockScript := `if cd code/%s && terraform state list; then terraform force-unlock --force %s; else echo 'Not Initialization'; fi`
-	if output, err := (runner.Executor{}).RunCommandOutput(task.ContainerId, []string{
+	if output, err := executor.RunCommandOutput(task.ContainerId, []string{
 		"sh", "-c", fmt.Sprintf(unlockScript, task.Workdir, task.StatePath),
 	}); err != nil {
 		logger.Errorf("force-unlock error: %v", err)
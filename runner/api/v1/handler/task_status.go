@@ -122,16 +122,30 @@ func doTaskStatus(wsConn *websocket.Conn, task *runner.StartedTask, closedCh <-c
 }
 
 func doSendTaskStatus(wsConn *websocket.Conn, task *runner.StartedTask, withLog bool, isDeadline bool) error {
-	var msg runner.TaskStatusMessage
+	msg, err := newTaskStatusMessage(task, withLog, isDeadline)
+	if err != nil {
+		return err
+	}
+
+	if err := wsConn.WriteJSON(msg); err != nil {
+		logger.Warnf("write message error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// newTaskStatusMessage 获取任务最新状态，任务退出或 withLog 为 true 时同时返回全量日志及 state 等结果文件
+func newTaskStatusMessage(task *runner.StartedTask, withLog bool, isDeadline bool) (*runner.TaskStatusMessage, error) {
+	msg := &runner.TaskStatusMessage{}
 
 	if isDeadline {
 		msg.Timeout = true
 	} else {
 		status, err := task.Status()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		msg = runner.TaskStatusMessage{
+		msg = &runner.TaskStatusMessage{
 			Exited:   !status.Running,
 			ExitCode: status.ExitCode,
 		}
@@ -179,10 +193,5 @@ func doSendTaskStatus(wsConn *websocket.Conn, task *runner.StartedTask, withLog
 			msg.TfResultJson = resultJson
 		}
 	}
-
-	if err := wsConn.WriteJSON(msg); err != nil {
-		logger.Warnf("write message error: %v", err)
-		return err
-	}
-	return nil
+	return msg, nil
 }
@@ -5,6 +5,7 @@ package v1
 import (
 	"cloudiac/common"
 	"cloudiac/runner/api/ctx"
+	"cloudiac/runner/api/middleware"
 	"cloudiac/runner/api/v1/handler"
 
 	"github.com/gin-gonic/gin"
@@ -22,6 +23,7 @@ func RegisterRoute(apiV1 *gin.RouterGroup) {
 	})
 
 	apiV1.Use(gin.Logger())
+	apiV1.Use(w(middleware.Auth))
 	apiV1.POST("/task/step/run", w(handler.RunTask))
 	apiV1.GET("/task/step/status", w(handler.TaskStatus))
 	apiV1.POST("/task/stop", w(handler.StopTask))
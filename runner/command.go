@@ -32,6 +32,7 @@ type Executor struct {
 	Timeout    int
 	PrivateKey string
 
+	IacEngine        string
 	TerraformVersion string
 	Commands         []string
 	HostWorkdir      string // 宿主机目录
@@ -135,7 +136,15 @@ func (exec *Executor) Start() (string, error) {
 	// 注意，该方案有个问题：客户无法自定义镜像预先安装需要的 terraform 版本，
 	// 因为判断版本不在 TerraformVersions 列表中就会挂载目录，客户自定义镜像安装的版本会被覆盖
 	//（考虑把版本列表写到配置文件？）
-	if !utils.StrInArray(exec.TerraformVersion, common.TerraformVersions...) {
+	if exec.IacEngine == common.IacEngineOpenTofu {
+		if !utils.StrInArray(exec.TerraformVersion, common.OpenTofuVersions...) {
+			mountConfigs = append(mountConfigs, mount.Mount{
+				Type:   mount.TypeBind,
+				Source: conf.Runner.AbsTofuenvVersionsCachePath(),
+				Target: "/root/.tofuenv/versions",
+			})
+		}
+	} else if !utils.StrInArray(exec.TerraformVersion, common.TerraformVersions...) {
 		mountConfigs = append(mountConfigs, mount.Mount{
 			Type:   mount.TypeBind,
 			Source: conf.Runner.AbsTfenvVersionsCachePath(),
@@ -298,26 +307,6 @@ func (Executor) WaitCommand(ctx context.Context, containerId string, execId stri
 	}
 }
 
-// 等待进程结束，如果提前触发了 deadline 则 kill 进程
-func (exec Executor) WaitCommandWithDeadline(ctx context.Context, containerId string, execId string, deadline time.Time) (execInfo types.ContainerExecInspect, err error) {
-	var cancel context.CancelFunc
-	ctx, cancel = context.WithDeadline(ctx, deadline)
-	defer cancel()
-
-	logger.Debugf("wait exec %s, deadline: %s", execId, deadline.Format(time.RFC3339))
-	if execInfo, err = exec.WaitCommand(ctx, containerId, execId); err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			// logger.Infof("task %s/step%s: %v", exec..TaskId, t.req.Step, err)
-			if err := (Executor{}).StopCommand(execId); err != nil {
-				logger.WithField("cid", execInfo.ContainerID).Errorf("stop command error: %v", err)
-			}
-		}
-		return execInfo, err
-	}
-
-	return execInfo, err
-}
-
 func (e Executor) StopCommand(execId string) (err error) {
 	cli, err := dockerClient()
 	if err != nil {
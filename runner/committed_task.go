@@ -80,7 +80,7 @@ func (task *StartedTask) Status() (info types.ContainerExecInspect, err error) {
 		return task.readContainerInfo()
 	}
 
-	info, err = Executor{}.GetExecInfo(task.ExecId)
+	info, err = GetExecutor().GetExecInfo(task.ExecId)
 	if err != nil {
 		return info, err
 	}
@@ -187,9 +187,9 @@ func (task *StartedTask) Wait(ctx context.Context) (int64, error) {
 	var err error
 	if task.StartedAt != nil && task.Timeout > 0 {
 		deadline := task.StartedAt.Add(time.Duration(task.Timeout) * time.Second)
-		_, err = Executor{}.WaitCommandWithDeadline(ctx, task.ContainerId, task.ExecId, deadline)
+		_, err = WaitCommandWithDeadline(ctx, GetExecutor(), task.ContainerId, task.ExecId, deadline)
 	} else {
-		_, err = Executor{}.WaitCommand(ctx, task.ContainerId, task.ExecId)
+		_, err = GetExecutor().WaitCommand(ctx, task.ContainerId, task.ExecId)
 	}
 
 	if err != nil {
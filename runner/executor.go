@@ -0,0 +1,104 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+
+	"cloudiac/configs"
+)
+
+const (
+	ExecutorDocker     = "docker"
+	ExecutorKubernetes = "kubernetes"
+)
+
+// TaskExecutor 任务执行器
+// docker 执行器为每个任务启动一个常驻容器，步骤通过 exec 在容器中执行；
+// kubernetes 执行器为每个步骤启动一个 pod，工作目录通过 pvc 在步骤间共享。
+// 步骤的执行状态统一使用 types.ContainerExecInspect 表示，以兼容已保存的 container.json
+type TaskExecutor interface {
+	// Start 准备任务运行环境，返回值会作为 containerId 传给后续的步骤
+	Start(exec *Executor) (cid string, err error)
+	// RunCommand 启动步骤命令(不等待结束)
+	RunCommand(cid string, command []string) (execId string, err error)
+	// RunCommandOutput 执行命令并等待结束，返回命令输出
+	RunCommandOutput(cid string, command []string) (output []byte, err error)
+	GetExecInfo(execId string) (execInfo types.ContainerExecInspect, err error)
+	WaitCommand(ctx context.Context, cid string, execId string) (execInfo types.ContainerExecInspect, err error)
+	StopCommand(execId string) error
+	UnpauseIf(cid string) error
+	// KillContainers 结束任务，终止任务所有仍在运行的进程
+	KillContainers(ctx context.Context, cids ...string) error
+}
+
+// stepLogCollector 由执行器收集步骤输出的执行器实现该接口，
+// 步骤命令的输出写到标准输出，执行器负责将其追加到 logPath(runner 所在主机的路径)
+type stepLogCollector interface {
+	RunCommandWithLog(cid string, command []string, logPath string) (execId string, err error)
+}
+
+func GetExecutor() TaskExecutor {
+	if configs.Get().Runner.Executor == ExecutorKubernetes {
+		return kubeExecutor{}
+	}
+	return dockerExecutor{}
+}
+
+// WaitCommandWithDeadline 等待进程结束，如果提前触发了 deadline 则 kill 进程
+func WaitCommandWithDeadline(ctx context.Context, executor TaskExecutor, containerId string, execId string,
+	deadline time.Time) (execInfo types.ContainerExecInspect, err error) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	logger.Debugf("wait exec %s, deadline: %s", execId, deadline.Format(time.RFC3339))
+	if execInfo, err = executor.WaitCommand(ctx, containerId, execId); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			if err := executor.StopCommand(execId); err != nil {
+				logger.WithField("cid", containerId).Errorf("stop command error: %v", err)
+			}
+		}
+		return execInfo, err
+	}
+
+	return execInfo, err
+}
+
+type dockerExecutor struct{}
+
+func (dockerExecutor) Start(exec *Executor) (string, error) {
+	return exec.Start()
+}
+
+func (dockerExecutor) RunCommand(cid string, command []string) (string, error) {
+	return Executor{}.RunCommand(cid, command)
+}
+
+func (dockerExecutor) RunCommandOutput(cid string, command []string) ([]byte, error) {
+	return Executor{}.RunCommandOutput(cid, command)
+}
+
+func (dockerExecutor) GetExecInfo(execId string) (types.ContainerExecInspect, error) {
+	return Executor{}.GetExecInfo(execId)
+}
+
+func (dockerExecutor) WaitCommand(ctx context.Context, cid string, execId string) (types.ContainerExecInspect, error) {
+	return Executor{}.WaitCommand(ctx, cid, execId)
+}
+
+func (dockerExecutor) StopCommand(execId string) error {
+	return Executor{}.StopCommand(execId)
+}
+
+func (dockerExecutor) UnpauseIf(cid string) error {
+	return Executor{}.UnpauseIf(cid)
+}
+
+func (dockerExecutor) KillContainers(ctx context.Context, cids ...string) error {
+	return killDockerContainers(ctx, cids...)
+}
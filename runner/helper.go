@@ -223,6 +223,10 @@ func TaskControlFilePath(envId, taskId string) string {
 }
 
 func KillContainers(ctx context.Context, cids ...string) error {
+	return GetExecutor().KillContainers(ctx, cids...)
+}
+
+func killDockerContainers(ctx context.Context, cids ...string) error {
 	cli, err := DockerClient()
 	if err != nil {
 		return err
@@ -0,0 +1,60 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"cloudiac/configs"
+)
+
+const defaultKubeNamespace = "default"
+
+var (
+	defaultKubeClient         kubernetes.Interface
+	defaultKubeClientInitErr  error
+	defaultKubeClientInitOnce sync.Once
+)
+
+func kubeClient() (kubernetes.Interface, error) {
+	defaultKubeClientInitOnce.Do(func() {
+		defaultKubeClient, defaultKubeClientInitErr = initKubeClient()
+	})
+	return defaultKubeClient, defaultKubeClientInitErr
+}
+
+func initKubeClient() (kubernetes.Interface, error) {
+	var (
+		restConf *rest.Config
+		err      error
+	)
+
+	// 未指定 kubeconfig 时认为 runner 部署在集群内，使用 service account 访问 api server
+	conf := configs.Get().Runner.Kubernetes
+	if conf.Kubeconfig != "" {
+		restConf, err = clientcmd.BuildConfigFromFlags("", conf.Kubeconfig)
+	} else {
+		restConf, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "load kubernetes config")
+	}
+
+	cli, err := kubernetes.NewForConfig(restConf)
+	if err != nil {
+		return nil, errors.Wrap(err, "create kubernetes client")
+	}
+	return cli, nil
+}
+
+func kubeNamespace() string {
+	if ns := configs.Get().Runner.Kubernetes.Namespace; ns != "" {
+		return ns
+	}
+	return defaultKubeNamespace
+}
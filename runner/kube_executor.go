@@ -0,0 +1,549 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/utils"
+)
+
+const (
+	kubeLabelManagedBy    = "app.kubernetes.io/managed-by"
+	kubeLabelTask         = "cloudiac.io/task"
+	kubeAnnotationPodSpec = "cloudiac.io/pod-template"
+	kubeAnnotationReserve = "cloudiac.io/reserve-pod"
+	kubeAnnotationStepLog = "cloudiac.io/step-log"
+	kubeAnnotationLogFrom = "cloudiac.io/step-log-offset"
+
+	kubeManagedBy         = "cloudiac-runner"
+	kubeStepContainerName = "step"
+
+	// pod 名称最长 63 个字符，需要为步骤后缀预留长度
+	kubeTaskNameMaxLen = 52
+
+	// pod 被删除(任务中止或超时)后按进程被 kill 处理
+	kubeKilledExitCode = 137
+
+	kubeStopGracePeriod     = int64(30)
+	kubeRunOutputTimeout    = 10 * time.Minute
+	kubeLogStreamWait       = 10 * time.Second // pod 退出后等待日志写入完成的最长时间
+	kubeTfenvVersionsPath   = "/root/.tfenv/versions"
+	kubeTofuenvVersionsPath = "/root/.tofuenv/versions"
+)
+
+// kubeExecutor 每个任务步骤启动一个 pod 执行
+// 任务启动时创建与任务同名的 secret，保存步骤 pod 模板及环境变量，
+// 返回的 cid 即为 secret 名称，执行步骤时基于模板创建 pod，execId 为 pod 名称。
+// 任务工作目录保存在 workspace pvc 中，runner 需要将同一 pvc 挂载到 storage_path，
+// 步骤的执行结果仍通过工作目录中的文件获取，步骤日志则由 runner 跟踪 pod 输出写入日志文件，
+// 避免 pvc 上由其他节点写入的文件内容在 pod 退出前无法读取。
+type kubeExecutor struct{}
+
+// kubeLogStreams 正在跟踪输出的步骤 pod，值在跟踪结束后关闭
+var kubeLogStreams = struct {
+	sync.Mutex
+	m map[string]chan struct{}
+}{m: make(map[string]chan struct{})}
+
+func kubeTaskName(taskId string) string {
+	name := "iac-" + strings.ToLower(taskId)
+	if len(name) > kubeTaskNameMaxLen {
+		name = name[:kubeTaskNameMaxLen]
+	}
+	return strings.TrimRight(name, "-")
+}
+
+func (kubeExecutor) buildPodTemplate(exec *Executor, name string) (*corev1.Pod, error) {
+	conf := configs.Get()
+	kubeConf := conf.Runner.Kubernetes
+	if kubeConf.WorkspacePVC == "" {
+		return nil, fmt.Errorf("configuration 'runner.kubernetes.workspace_pvc' is empty")
+	}
+
+	subPath, err := filepath.Rel(conf.Runner.AbsStoragePath(), exec.HostWorkdir)
+	if err != nil {
+		return nil, errors.Wrap(err, "workspace sub path")
+	} else if strings.HasPrefix(subPath, "..") {
+		return nil, fmt.Errorf("workspace '%s' is not under storage path", exec.HostWorkdir)
+	}
+
+	volumes := []corev1.Volume{
+		{
+			Name: "workspace",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: kubeConf.WorkspacePVC},
+			},
+		},
+	}
+	mounts := []corev1.VolumeMount{
+		{Name: "workspace", MountPath: ContainerWorkspace, SubPath: filepath.ToSlash(subPath)},
+		{Name: "plugin-cache", MountPath: ContainerPluginCachePath},
+	}
+
+	if kubeConf.PluginCachePVC != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: "plugin-cache",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: kubeConf.PluginCachePVC},
+			},
+		})
+		// 与 docker 执行器一致，非内置的 terraform/opentofu 版本下载后保存到缓存目录
+		if exec.IacEngine == common.IacEngineOpenTofu {
+			if !utils.StrInArray(exec.TerraformVersion, common.OpenTofuVersions...) {
+				mounts = append(mounts, corev1.VolumeMount{
+					Name: "plugin-cache", MountPath: kubeTofuenvVersionsPath, SubPath: ".tofuenv-versions",
+				})
+			}
+		} else if !utils.StrInArray(exec.TerraformVersion, common.TerraformVersions...) {
+			mounts = append(mounts, corev1.VolumeMount{
+				Name: "plugin-cache", MountPath: kubeTfenvVersionsPath, SubPath: ".tfenv-versions",
+			})
+		}
+	} else {
+		volumes = append(volumes, corev1.Volume{
+			Name:         "plugin-cache",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+	}
+
+	if conf.Consul.ConsulTls && kubeConf.ConsulCertSecret != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: "consul-cert",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: kubeConf.ConsulCertSecret},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name: "consul-cert", MountPath: ContainerCertificateDir, ReadOnly: true,
+		})
+	}
+
+	pullSecrets := make([]corev1.LocalObjectReference, 0, len(kubeConf.ImagePullSecrets))
+	for _, s := range kubeConf.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, corev1.LocalObjectReference{Name: s})
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: kubeNamespace(),
+			Labels:    map[string]string{kubeLabelManagedBy: kubeManagedBy, kubeLabelTask: name},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:      corev1.RestartPolicyNever,
+			ServiceAccountName: kubeConf.ServiceAccount,
+			ImagePullSecrets:   pullSecrets,
+			NodeSelector:       kubeConf.NodeSelector,
+			Volumes:            volumes,
+			Containers: []corev1.Container{
+				{
+					Name:         kubeStepContainerName,
+					Image:        exec.Image,
+					WorkingDir:   exec.Workdir,
+					VolumeMounts: mounts,
+					EnvFrom: []corev1.EnvFromSource{
+						{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}}},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func (e kubeExecutor) Start(exec *Executor) (string, error) {
+	logger := logger.WithField("taskId", filepath.Base(exec.HostWorkdir))
+	cli, err := kubeClient()
+	if err != nil {
+		return "", err
+	}
+
+	name := kubeTaskName(exec.Name)
+	tpl, err := e.buildPodTemplate(exec, name)
+	if err != nil {
+		return "", err
+	}
+
+	// 环境变量中包含解密后的敏感变量，所以保存在 secret 中，步骤 pod 通过 envFrom 引用
+	env := make(map[string]string)
+	for _, kv := range exec.Env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: kubeNamespace(),
+			Labels:    map[string]string{kubeLabelManagedBy: kubeManagedBy, kubeLabelTask: name},
+			Annotations: map[string]string{
+				kubeAnnotationPodSpec: string(utils.MustJSON(tpl)),
+				kubeAnnotationReserve: fmt.Sprintf("%v", !exec.AutoRemove),
+			},
+		},
+		StringData: env,
+	}
+
+	ctx := context.Background()
+	secrets := cli.CoreV1().Secrets(kubeNamespace())
+	if _, err = secrets.Create(ctx, secret, metav1.CreateOptions{}); k8serrors.IsAlreadyExists(err) {
+		// 步骤重试时会重新启动任务
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		logger.Errorf("create task secret err: %v", err)
+		return "", errors.Wrap(err, "create task secret")
+	}
+
+	logger.Infof("task pod template: %s", name)
+	return name, nil
+}
+
+func (e kubeExecutor) RunCommand(cid string, command []string) (execId string, err error) {
+	return e.createPod(cid, command, nil)
+}
+
+// RunCommandWithLog 启动步骤 pod，并跟踪 pod 的输出追加到 logPath
+func (e kubeExecutor) RunCommandWithLog(cid string, command []string, logPath string) (execId string, err error) {
+	var offset int64
+	if st, err := os.Stat(logPath); err == nil {
+		offset = st.Size()
+	} else if !os.IsNotExist(err) {
+		return "", errors.Wrap(err, "stat step log")
+	}
+
+	// 日志路径保存在 pod 上，runner 重启后可以继续跟踪
+	execId, err = e.createPod(cid, command, map[string]string{
+		kubeAnnotationStepLog: logPath,
+		kubeAnnotationLogFrom: strconv.FormatInt(offset, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	e.ensureLogStream(execId)
+	return execId, nil
+}
+
+func (kubeExecutor) createPod(cid string, command []string, annotations map[string]string) (string, error) {
+	cli, err := kubeClient()
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	secret, err := cli.CoreV1().Secrets(kubeNamespace()).Get(ctx, cid, metav1.GetOptions{})
+	if err != nil {
+		return "", errors.Wrap(err, "get task secret")
+	}
+
+	pod := corev1.Pod{}
+	if err := json.Unmarshal([]byte(secret.Annotations[kubeAnnotationPodSpec]), &pod); err != nil {
+		return "", errors.Wrap(err, "unmarshal pod template")
+	}
+	pod.Name = fmt.Sprintf("%s-%s", cid, rand.String(5))
+	pod.Annotations = annotations
+	pod.Spec.Containers[0].Command = command
+
+	if _, err := cli.CoreV1().Pods(kubeNamespace()).Create(ctx, &pod, metav1.CreateOptions{}); err != nil {
+		return "", errors.Wrap(err, "create step pod")
+	}
+	return pod.Name, nil
+}
+
+// ensureLogStream 开始跟踪步骤 pod 的输出(如果还未开始)，返回的 channel 在跟踪结束后关闭，
+// pod 不需要跟踪输出时返回 nil
+func (e kubeExecutor) ensureLogStream(execId string) <-chan struct{} {
+	kubeLogStreams.Lock()
+	done, ok := kubeLogStreams.m[execId]
+	kubeLogStreams.Unlock()
+	if ok {
+		return done
+	}
+
+	cli, err := kubeClient()
+	if err != nil {
+		logger.Warnf("stream pod log: %v", err)
+		return nil
+	}
+	pod, err := cli.CoreV1().Pods(kubeNamespace()).Get(context.Background(), execId, metav1.GetOptions{})
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			logger.Warnf("stream pod log, get pod %s: %v", execId, err)
+		}
+		return nil
+	}
+	logPath := pod.Annotations[kubeAnnotationStepLog]
+	if logPath == "" {
+		return nil
+	}
+	offset, _ := strconv.ParseInt(pod.Annotations[kubeAnnotationLogFrom], 10, 64)
+
+	kubeLogStreams.Lock()
+	defer kubeLogStreams.Unlock()
+	if done, ok := kubeLogStreams.m[execId]; ok {
+		return done
+	}
+	done = make(chan struct{})
+	kubeLogStreams.m[execId] = done
+	go func() {
+		defer close(done)
+		if err := e.streamPodLog(execId, logPath, offset); err != nil {
+			logger.WithField("pod", execId).Warnf("stream pod log: %v", err)
+		}
+	}()
+	return done
+}
+
+// streamPodLog 跟踪 pod 输出，写入日志文件 offset 之后的位置，直到容器退出或 pod 被删除
+func (kubeExecutor) streamPodLog(name string, logPath string, offset int64) error {
+	cli, err := kubeClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pods := cli.CoreV1().Pods(kubeNamespace())
+	for {
+		pod, err := pods.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				return nil
+			}
+			return errors.Wrap(err, "get step pod")
+		}
+
+		// 容器启动前无法获取日志
+		if pod.Status.Phase != corev1.PodPending {
+			if !podExecInfo(pod).Running {
+				return copyPodLog(ctx, name, logPath, offset, false)
+			}
+			// follow 正常结束时容器已退出，连接中断则重新获取全部输出
+			if err := copyPodLog(ctx, name, logPath, offset, true); err != nil {
+				logger.WithField("pod", name).Warnf("follow pod log: %v", err)
+			}
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// copyPodLog 获取 pod 的全部输出，覆盖写入日志文件 offset 之后的位置
+func copyPodLog(ctx context.Context, name string, logPath string, offset int64, follow bool) error {
+	cli, err := kubeClient()
+	if err != nil {
+		return err
+	}
+
+	reader, err := cli.CoreV1().Pods(kubeNamespace()).GetLogs(name, &corev1.PodLogOptions{
+		Container: kubeStepContainerName,
+		Follow:    follow,
+	}).Stream(ctx)
+	if err != nil {
+		return errors.Wrap(err, "stream pod log")
+	}
+	defer reader.Close()
+
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE, 0644) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(f, reader)
+	return err
+}
+
+// RunCommandOutput 启动 pod 执行命令，等待结束后读取 pod 日志作为输出
+func (e kubeExecutor) RunCommandOutput(cid string, command []string) (output []byte, err error) {
+	cli, err := kubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	execId, err := e.RunCommand(cid, command)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = e.deletePod(context.Background(), execId)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubeRunOutputTimeout)
+	defer cancel()
+
+	if _, err := e.WaitCommand(ctx, cid, execId); err != nil {
+		return nil, err
+	}
+
+	reader, err := cli.CoreV1().Pods(kubeNamespace()).GetLogs(execId, &corev1.PodLogOptions{
+		Container: kubeStepContainerName,
+	}).Stream(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "stream pod log")
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+func podExecInfo(pod *corev1.Pod) types.ContainerExecInspect {
+	info := types.ContainerExecInspect{
+		ExecID:      pod.Name,
+		ContainerID: pod.Labels[kubeLabelTask],
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded, corev1.PodFailed:
+		if pod.Status.Phase == corev1.PodFailed {
+			info.ExitCode = 1
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name == kubeStepContainerName && cs.State.Terminated != nil {
+				info.ExitCode = int(cs.State.Terminated.ExitCode)
+			}
+		}
+	default:
+		info.Running = true
+	}
+	return info
+}
+
+func (kubeExecutor) GetExecInfo(execId string) (execInfo types.ContainerExecInspect, err error) {
+	cli, err := kubeClient()
+	if err != nil {
+		return execInfo, err
+	}
+
+	pod, err := cli.CoreV1().Pods(kubeNamespace()).Get(context.Background(), execId, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return types.ContainerExecInspect{ExecID: execId, ExitCode: kubeKilledExitCode}, nil
+		}
+		return execInfo, errors.Wrap(err, "get step pod")
+	}
+	return podExecInfo(pod), nil
+}
+
+func (e kubeExecutor) WaitCommand(ctx context.Context, cid string, execId string) (execInfo types.ContainerExecInspect, err error) {
+	ticker := time.NewTicker(time.Second * 1)
+	defer ticker.Stop()
+
+	// runner 重启后需要重新开始跟踪步骤输出
+	logDone := e.ensureLogStream(execId)
+	for {
+		execInfo, err = e.GetExecInfo(execId)
+		if err != nil {
+			return execInfo, err
+		}
+		if !execInfo.Running {
+			if logDone != nil {
+				select {
+				case <-logDone:
+				case <-time.After(kubeLogStreamWait):
+				case <-ctx.Done():
+				}
+			}
+			return execInfo, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return execInfo, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (kubeExecutor) deletePod(ctx context.Context, name string) error {
+	cli, err := kubeClient()
+	if err != nil {
+		return err
+	}
+
+	grace := kubeStopGracePeriod
+	err = cli.CoreV1().Pods(kubeNamespace()).Delete(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: &grace})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrapf(err, "delete pod %s", name)
+	}
+
+	kubeLogStreams.Lock()
+	delete(kubeLogStreams.m, name)
+	kubeLogStreams.Unlock()
+	return nil
+}
+
+// StopCommand 通过删除 pod 终止步骤，pod 会先收到 SIGTERM，30s 后被强制 kill
+func (e kubeExecutor) StopCommand(execId string) error {
+	return e.deletePod(context.Background(), execId)
+}
+
+func (kubeExecutor) UnpauseIf(cid string) error {
+	// pod 不支持暂停
+	return nil
+}
+
+func (e kubeExecutor) KillContainers(ctx context.Context, cids ...string) error {
+	cli, err := kubeClient()
+	if err != nil {
+		return err
+	}
+
+	pods := cli.CoreV1().Pods(kubeNamespace())
+	secrets := cli.CoreV1().Secrets(kubeNamespace())
+	for _, cid := range cids {
+		reserve := false
+		if secret, err := secrets.Get(ctx, cid, metav1.GetOptions{}); err == nil {
+			reserve = utils.IsTrueStr(secret.Annotations[kubeAnnotationReserve])
+		} else if !k8serrors.IsNotFound(err) {
+			return errors.Wrap(err, "get task secret")
+		}
+
+		podList, err := pods.List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", kubeLabelTask, cid),
+		})
+		if err != nil {
+			return errors.Wrap(err, "list task pods")
+		}
+		for i := range podList.Items {
+			pod := &podList.Items[i]
+			// 保留容器时只终止仍在运行的 pod
+			if reserve && !podExecInfo(pod).Running {
+				continue
+			}
+			if err := e.deletePod(ctx, pod.Name); err != nil {
+				return err
+			}
+		}
+
+		// secret 中保存有敏感变量，任务结束后总是删除
+		if err := secrets.Delete(ctx, cid, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+			return errors.Wrap(err, "delete task secret")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"cloudiac/configs"
+)
+
+func TestKubeExecutor(t *testing.T) {
+	storage := t.TempDir()
+	configs.Set(&configs.Config{
+		Runner: configs.RunnerConfig{
+			StoragePath: storage,
+			Executor:    ExecutorKubernetes,
+			Kubernetes: configs.KubernetesConfig{
+				Namespace:    "iac",
+				WorkspacePVC: "iac-workspace",
+			},
+		},
+	})
+	cli := fake.NewSimpleClientset()
+	defaultKubeClientInitOnce.Do(func() {
+		defaultKubeClient = cli
+	})
+
+	ctx := context.Background()
+	executor := GetExecutor()
+	cid, err := executor.Start(&Executor{
+		Image:       "cloudiac/ct-worker",
+		Name:        "run-C6ABC",
+		Env:         []string{"TF_VAR_a=1", "SECRET=x=y"},
+		Workdir:     ContainerWorkspace,
+		HostWorkdir: filepath.Join(storage, "env-a", "run-C6ABC"),
+		AutoRemove:  true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "iac-run-c6abc", cid)
+
+	secret, err := cli.CoreV1().Secrets("iac").Get(ctx, cid, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "x=y", secret.StringData["SECRET"])
+
+	execId, err := executor.RunCommand(cid, []string{"/bin/sh", "-c", "step0/run.sh"})
+	assert.NoError(t, err)
+
+	pod, err := cli.CoreV1().Pods("iac").Get(ctx, execId, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/bin/sh", "-c", "step0/run.sh"}, pod.Spec.Containers[0].Command)
+	assert.Equal(t, "env-a/run-C6ABC", pod.Spec.Containers[0].VolumeMounts[0].SubPath)
+	assert.Equal(t, cid, pod.Spec.Containers[0].EnvFrom[0].SecretRef.Name)
+
+	info, err := executor.GetExecInfo(execId)
+	assert.NoError(t, err)
+	assert.True(t, info.Running)
+
+	pod.Status.Phase = corev1.PodFailed
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  kubeStepContainerName,
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 2}},
+	}}
+	_, err = cli.CoreV1().Pods("iac").UpdateStatus(ctx, pod, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	info, err = executor.WaitCommand(ctx, cid, execId)
+	assert.NoError(t, err)
+	assert.False(t, info.Running)
+	assert.Equal(t, 2, info.ExitCode)
+
+	// 步骤输出由 runner 跟踪写入日志文件
+	logPath := filepath.Join(t.TempDir(), TaskLogName)
+	assert.NoError(t, os.WriteFile(logPath, []byte("retry\n"), 0644))
+	logExecId, err := kubeExecutor{}.RunCommandWithLog(cid, []string{"/bin/sh", "-c", "step1/run.sh"}, logPath)
+	assert.NoError(t, err)
+	logPod, err := cli.CoreV1().Pods("iac").Get(ctx, logExecId, metav1.GetOptions{})
+	assert.NoError(t, err)
+	logPod.Status.Phase = corev1.PodSucceeded
+	_, err = cli.CoreV1().Pods("iac").UpdateStatus(ctx, logPod, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	_, err = executor.WaitCommand(ctx, cid, logExecId)
+	assert.NoError(t, err)
+	content, err := os.ReadFile(logPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "retry\nfake logs", string(content))
+	assert.NoError(t, executor.StopCommand(logExecId))
+
+	// 中止步骤时删除 pod
+	assert.NoError(t, executor.StopCommand(execId))
+	info, err = executor.GetExecInfo(execId)
+	assert.NoError(t, err)
+	assert.Equal(t, kubeKilledExitCode, info.ExitCode)
+
+	_, err = executor.RunCommand(cid, []string{"/bin/sh", "-c", "step1/run.sh"})
+	assert.NoError(t, err)
+	assert.NoError(t, executor.KillContainers(ctx, cid))
+
+	pods, err := cli.CoreV1().Pods("iac").List(ctx, metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, pods.Items)
+	_, err = cli.CoreV1().Secrets("iac").Get(ctx, cid, metav1.GetOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"cloudiac/configs"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"cloudiac/utils/runnerauth"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// StepEventsPath portal 接收 runner 步骤事件的接口
+	StepEventsPath = "/api/v1/runners/events"
+
+	stepEventQueueSize = 4096
+	stepEventRetryMax  = time.Minute
+)
+
+// 待发送的步骤事件，为 nil 表示未开启事件推送
+var stepEventQueue chan *TaskStepEvent
+
+// EnableStepEvents 开启步骤事件推送，需要在启动 api 服务前调用
+func EnableStepEvents() {
+	stepEventQueue = make(chan *TaskStepEvent, stepEventQueueSize)
+}
+
+func StepEventsEnabled() bool {
+	return stepEventQueue != nil
+}
+
+// PublishStepEvent 将事件放入发送队列，队列已满时丢弃事件并返回 false。
+// 事件丢失时 portal 会在超时后改为主动连接 runner 获取步骤状态
+func PublishStepEvent(ev *TaskStepEvent) bool {
+	select {
+	case stepEventQueue <- ev:
+		return true
+	default:
+		return false
+	}
+}
+
+// StartStepEventPublisher 连接 portal 并持续推送步骤事件，所有步骤的事件共用一个连接，连接断开后自动重连
+func StartStepEventPublisher(portalAddr string, runnerId string) {
+	logger := logs.Get().WithField("func", "StartStepEventPublisher")
+	logger.Infof("publish step events to portal %s", portalAddr)
+
+	params := url.Values{}
+	params.Set("runnerId", runnerId)
+	var pending *TaskStepEvent // 上次连接断开时未发送成功的事件
+	retry := time.Second
+	for {
+		header := runnerauth.SignHeader(configs.Get().RunnerApiSecret, http.MethodGet,
+			StepEventsPath, params.Encode(), nil)
+		conn, _, err := utils.WebsocketDailWithHeader(portalAddr, StepEventsPath, params, header)
+		if err != nil {
+			logger.Warnf("connect portal: %v, retry after %s", err, retry)
+			time.Sleep(retry)
+			if retry *= 2; retry > stepEventRetryMax {
+				retry = stepEventRetryMax
+			}
+			continue
+		}
+
+		logger.Infof("step events connected")
+		retry = time.Second
+		pending, err = publishStepEvents(conn, pending)
+		logger.Warnf("step events disconnected: %v", err)
+		_ = conn.Close()
+		time.Sleep(retry)
+	}
+}
+
+func publishStepEvents(conn *websocket.Conn, pending *TaskStepEvent) (*TaskStepEvent, error) {
+	// 读取消息以便处理 portal 的 ping 及关闭连接的通知
+	closedCh := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closedCh <- err
+				return
+			}
+		}
+	}()
+
+	if pending != nil {
+		if err := conn.WriteJSON(pending); err != nil {
+			return pending, err
+		}
+	}
+	for {
+		select {
+		case err := <-closedCh:
+			return nil, err
+		case ev := <-stepEventQueue:
+			if err := conn.WriteJSON(ev); err != nil {
+				// 发送失败的事件在重连后优先发送，保证日志顺序
+				return ev, err
+			}
+		}
+	}
+}
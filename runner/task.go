@@ -6,7 +6,6 @@ import (
 	"bytes"
 	"cloudiac/common"
 	"cloudiac/configs"
-	"cloudiac/portal/consts"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
 	"encoding/json"
@@ -17,6 +16,7 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/alessio/shellescape"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
@@ -128,7 +128,7 @@ func (t *Task) start() (cid string, err error) {
 	}
 
 	t.logger.Infof("start task step, %s", stepDir)
-	if cid, err = cmd.Start(); err != nil {
+	if cid, err = GetExecutor().Start(&cmd); err != nil {
 		return cid, err
 	}
 
@@ -154,12 +154,22 @@ func (t *Task) buildVarsAndCmdEnv(cmd *Executor) error {
 	for k, v := range t.req.SysEnvironments {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
+	for k, name := range backendSecretEnvs[t.req.StateStore.Backend] {
+		if v, ok := t.req.StateStore.Config[k]; ok {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%v", name, v))
+		}
+	}
 
 	if t.req.Env.TfVersion == "" {
-		t.req.Env.TfVersion = consts.DefaultTerraformVersion
+		t.req.Env.TfVersion = t.req.Env.DefaultTfVersion()
 	}
+	cmd.IacEngine = t.req.Env.IacEngine
 	cmd.TerraformVersion = t.req.Env.TfVersion
-	cmd.Env = append(cmd.Env, fmt.Sprintf("TFENV_TERRAFORM_VERSION=%s", cmd.TerraformVersion))
+	if cmd.IacEngine == common.IacEngineOpenTofu {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("TOFUENV_TOFU_VERSION=%s", cmd.TerraformVersion))
+	} else {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("TFENV_TERRAFORM_VERSION=%s", cmd.TerraformVersion))
+	}
 	return nil
 }
 
@@ -180,12 +190,15 @@ func (t *Task) runStep() (err error) {
 	containerScriptPath := filepath.Join(t.stepDirName(t.req.Step), TaskScriptName)
 	logPath := filepath.Join(t.stepDirName(t.req.Step), TaskLogName)
 
-	var command string
+	// outputCommand 用于由执行器收集输出的场景，命令输出到标准输出
+	var command, outputCommand string
 	if utils.StrInArray(t.req.StepType, common.TaskStepCheckout, common.TaskStepScanInit) {
 		// 移除日志中可能出现的 token 信息
 		command = fmt.Sprintf("set -o pipefail\n%s 2>&1 >>%s", containerScriptPath, logPath)
+		outputCommand = fmt.Sprintf("%s 2>/dev/null", containerScriptPath)
 	} else {
 		command = fmt.Sprintf("%s >>%s 2>&1", containerScriptPath, logPath)
+		outputCommand = fmt.Sprintf("%s 2>&1", containerScriptPath)
 	}
 
 	if t.req.Step >= 0 { // step < 0 表示是隐含步骤，不需要判断任务是否已中止
@@ -196,11 +209,18 @@ func (t *Task) runStep() (err error) {
 		}
 	}
 
-	if err := (Executor{}).UnpauseIf(t.req.ContainerId); err != nil {
+	executor := GetExecutor()
+	if err := executor.UnpauseIf(t.req.ContainerId); err != nil {
 		return err
 	}
 
-	execId, err := (&Executor{}).RunCommand(t.req.ContainerId, t.generateCommand(command))
+	var execId string
+	if collector, ok := executor.(stepLogCollector); ok {
+		hostLogPath := filepath.Join(GetTaskDir(t.req.Env.Id, t.req.TaskId, t.req.Step), TaskLogName)
+		execId, err = collector.RunCommandWithLog(t.req.ContainerId, t.generateCommand(outputCommand), hostLogPath)
+	} else {
+		execId, err = executor.RunCommand(t.req.ContainerId, t.generateCommand(command))
+	}
 	if err != nil {
 		return err
 	}
@@ -291,8 +311,15 @@ func (t *Task) initWorkspace() (workspace string, err error) {
 	return workspace, nil
 }
 
-var iacTerraformTpl = template.Must(template.New("").Parse(` terraform {
+var iacTerraformTpl = template.Must(template.New("").Funcs(template.FuncMap{
+	"hclValue": hclValue,
+}).Parse(` terraform {
   backend "{{.State.Backend}}" {
+{{- if ne .State.Backend "consul"}}
+{{- range $k, $v := .State.Config}}
+    {{$k}} = {{hclValue $v}}
+{{- end}}
+{{- else}}
     address = "{{.State.Address}}"
     scheme  = "{{.State.Scheme}}"
     path    = "{{.State.Path}}"
@@ -304,6 +331,7 @@ var iacTerraformTpl = template.Must(template.New("").Parse(` terraform {
     cert_file = "{{.State.CapemPath}}"
     key_file = "{{.State.CakeyPath}}"
 	{{end}}
+{{- end}}
   }
 }
 
@@ -313,6 +341,27 @@ locals {
 }
 `))
 
+// backendSecretEnvs backend 配置中的敏感参数及对应的环境变量，
+// 这些参数通过环境变量传入，避免明文写入工作目录中的 tf 文件
+var backendSecretEnvs = map[string]map[string]string{
+	common.StateBackendS3:   {"access_key": "AWS_ACCESS_KEY_ID", "secret_key": "AWS_SECRET_ACCESS_KEY"},
+	common.StateBackendPg:   {"conn_str": "PG_CONN_STR"},
+	common.StateBackendHttp: {"username": "TF_HTTP_USERNAME", "password": "TF_HTTP_PASSWORD"},
+}
+
+// hclValue 将 backend 配置值转为 hcl 字面量
+func hclValue(v interface{}) string {
+	switch val := v.(type) {
+	case bool, int, int64, float64:
+		return fmt.Sprintf("%v", val)
+	default:
+		// json 字符串编码后即为合法的 hcl 字符串，只需要额外转义模板插值符号
+		bs, _ := json.Marshal(fmt.Sprintf("%v", val))
+		s := strings.ReplaceAll(string(bs), "${", "$${")
+		return strings.ReplaceAll(s, "%{", "%%{")
+	}
+}
+
 func execTpl2File(tpl *template.Template, data interface{}, savePath string) error {
 	fp, err := os.OpenFile(savePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644) //nolint:gosec
 	if err != nil {
@@ -331,7 +380,10 @@ func (t *Task) genEnvironmentFile(workspace string) error {
 }
 
 func (t *Task) genIacTfFile(workspace string) error {
-	if t.req.StateStore.Address == "" {
+	if t.req.StateStore.Backend == "" {
+		t.req.StateStore.Backend = common.StateBackendConsul
+	}
+	if t.req.StateStore.Backend == common.StateBackendConsul && t.req.StateStore.Address == "" {
 		if os.Getenv("IAC_WORKER_CONSUL") != "" {
 			t.req.StateStore.Address = os.Getenv("IAC_WORKER_CONSUL")
 			//t.req.StateStore.Backend = "consul"
@@ -340,10 +392,19 @@ func (t *Task) genIacTfFile(workspace string) error {
 			t.req.StateStore.Address = configs.Get().Consul.Address
 		}
 	}
+	state := t.req.StateStore
+	if secrets := backendSecretEnvs[state.Backend]; len(secrets) > 0 {
+		state.Config = make(map[string]interface{}, len(t.req.StateStore.Config))
+		for k, v := range t.req.StateStore.Config {
+			if _, ok := secrets[k]; !ok {
+				state.Config[k] = v
+			}
+		}
+	}
 	ctx := map[string]interface{}{
 		"Workspace":      workspace,
 		"PrivateKeyPath": t.up2Workspace("ssh_key"),
-		"State":          t.req.StateStore,
+		"State":          state,
 	}
 	if err := execTpl2File(iacTerraformTpl, ctx, filepath.Join(workspace, CloudIacTfFile)); err != nil {
 		return err
@@ -425,8 +486,8 @@ var terraformrcTpl = template.Must(template.New("").Parse(`provider_installation
   {{ if .NetworkMirrorUrl }}
   network_mirror {
     url = "{{.NetworkMirrorUrl}}"
-    include = ["registry.terraform.io/*/*"]
-    exclude = ["registry.terraform.io/idcos/*"]
+    include = ["{{ .Registry }}/*/*"]
+    exclude = ["{{ .Registry }}/idcos/*"]
   }
   {{ end }}
 
@@ -440,15 +501,20 @@ func (t *Task) genTerraformrcFile(workspace string) error {
 
 	// 默认情况下我们只针对 idcos 命名空间下的 provider 禁用 terraform 官方 registry
 	// （如果不主动禁用，terraform cli 的默认行为总是会查询官方 registry 获取 provider 版本列表）
-	directExclude := "registry.terraform.io/idcos/*"
+	registry := "registry.terraform.io"
+	if t.req.Env.IacEngine == common.IacEngineOpenTofu {
+		registry = "registry.opentofu.org"
+	}
+	directExclude := registry + "/idcos/*"
 	offline := configs.Get().Runner.OfflineMode
 	if offline || t.req.NetworkMirror != "" {
 		// 如果开启了 offline 或者 network mirror 则全局禁用 terraform 默认 registry
-		directExclude = "registry.terraform.io/*/*"
+		directExclude = registry + "/*/*"
 	}
 
 	return execTpl2File(terraformrcTpl, map[string]interface{}{
 		"NetworkMirrorUrl": t.req.NetworkMirror,
+		"Registry":         registry,
 		"DirectExclude":    directExclude,
 	}, path)
 }
@@ -506,6 +572,10 @@ func (t *Task) genStepScript() (string, error) {
 		command, err = t.stepApply()
 	case common.TaskStepTfDestroy:
 		command, err = t.stepDestroy()
+	case common.TaskStepTfImport:
+		command, err = t.stepImport()
+	case common.TaskStepTfState:
+		command, err = t.stepState()
 	case common.TaskStepAnsiblePlay:
 		command, err = t.stepPlay()
 	case common.TaskStepCommand:
@@ -617,9 +687,14 @@ var initCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
 {{if .Before}}{{.Before}} && \{{- end}}
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
+{{if eq .Req.Env.IacEngine "opentofu" -}}
+tofuenv install $TOFUENV_TOFU_VERSION && \
+tofuenv use $TOFUENV_TOFU_VERSION && \
+{{else -}}
 tfenv install $TFENV_TERRAFORM_VERSION && \
 tfenv use $TFENV_TERRAFORM_VERSION  && \
-terraform init -input=false {{- range $arg := .Req.StepArgs }} {{$arg}}{{ end }} {{- if .After}} && \
+{{end -}}
+{{.Req.Env.TfBin}} init -input=false {{- range $arg := .Req.StepArgs }} {{$arg}}{{ end }} {{- if .After}} && \
 {{.After}}{{- end}}
 `))
 
@@ -650,10 +725,10 @@ var planCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
 {{if .Before}}{{.Before}} && \{{- end}}
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
-terraform plan -input=false -out=_cloudiac.tfplan \
+{{.Req.Env.TfBin}} plan -input=false -out=_cloudiac.tfplan \
 {{if .TfVars}}-var-file={{.TfVars}} {{end}}-var-file={{.IacTfVars}} \
 {{ range $arg := .Req.StepArgs }}{{$arg}} {{ end }}&& \
-terraform show -no-color -json _cloudiac.tfplan >{{.TFPlanJsonFilePath}} {{- if .After}} && \
+{{.Req.Env.TfBin}} show -no-color -json _cloudiac.tfplan >{{.TFPlanJsonFilePath}} {{- if .After}} && \
 {{.After}}{{- end}}
 `))
 
@@ -675,7 +750,7 @@ var applyCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
 {{if .Before}}{{.Before}} && \{{- end}}
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
-terraform apply -input=false -auto-approve \
+{{.Req.Env.TfBin}} apply -input=false -auto-approve \
 {{ range $arg := .Req.StepArgs}}{{$arg}} {{ end }}_cloudiac.tfplan {{- if .After}} && \
 {{.After}}{{- end}}
 
@@ -683,8 +758,8 @@ result=$?
 
 # state collect command
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
-terraform show -no-color -json >{{.TFStateJsonFilePath}} && \
-terraform providers schema -json > {{.TFProviderSchema}}
+{{.Req.Env.TfBin}} show -no-color -json >{{.TFStateJsonFilePath}} && \
+{{.Req.Env.TfBin}} providers schema -json > {{.TFProviderSchema}}
 exit $result
 `))
 
@@ -714,6 +789,112 @@ func (t *Task) stepDestroy() (command string, err error) {
 	})
 }
 
+// 已在 state 中的资源跳过导入，保证步骤重试时可以重复执行
+var importCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
+{{if .Before}}{{.Before}} && \{{- end}}
+cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
+{{ range $imp := .Imports -}}
+{ {{$.Req.Env.TfBin}} state show {{$imp.Address}} >/dev/null 2>&1 || \
+{{$.Req.Env.TfBin}} import -input=false \
+{{if $.TfVars}}-var-file={{$.TfVars}} {{end}}-var-file={{$.IacTfVars}} \
+{{ range $arg := $.Req.StepArgs }}{{$arg}} {{ end }}{{$imp.Address}} {{$imp.Id}}; } && \
+{{ end -}}
+echo "{{len .Imports}} resource(s) imported" {{- if .After}} && \
+{{.After}}{{- end}}
+`))
+
+func (t *Task) stepImport() (command string, err error) {
+	if len(t.req.Imports) == 0 {
+		return "", fmt.Errorf("no resources to import")
+	}
+	imports := make([]TaskImport, 0, len(t.req.Imports))
+	for _, imp := range t.req.Imports {
+		imports = append(imports, TaskImport{
+			Address: shellescape.Quote(imp.Address),
+			Id:      shellescape.Quote(imp.Id),
+		})
+	}
+
+	beforeCmds, afterCmds := getBeforeAfterCmds(t.req.StepBeforeCmds, t.req.StepAfterCmds)
+	return t.executeTpl(importCommandTpl, map[string]interface{}{
+		"Req":                t.req,
+		"Imports":            imports,
+		"TfVars":             t.req.Env.TfVarsFile,
+		"IacTfVars":          t.up2Workspace(CloudIacTfvarsJson),
+		"Before":             beforeCmds,
+		"After":              afterCmds,
+		"ContainerWorkspace": ContainerWorkspace,
+	})
+}
+
+// 操作完成后输出 state 中的资源列表，便于确认操作结果
+var stateCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
+{{if .Before}}{{.Before}} && \{{- end}}
+cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
+{{ range $cmd := .Commands -}}
+{{$cmd}} && \
+{{ end -}}
+{{.Req.Env.TfBin}} state list {{- if .After}} && \
+{{.After}}{{- end}}
+`))
+
+func (t *Task) stepState() (command string, err error) {
+	if len(t.req.StateOps) == 0 {
+		return "", fmt.Errorf("no state operations")
+	}
+
+	tfBin := t.req.Env.TfBin()
+	commands := make([]string, 0, len(t.req.StateOps))
+	for _, op := range t.req.StateOps {
+		var cmd, addrs string
+		switch op.Op {
+		case "mv":
+			if op.Destination == "" {
+				return "", fmt.Errorf("state mv '%s' without destination", op.Address)
+			}
+			cmd = fmt.Sprintf("%s state mv", tfBin)
+			addrs = fmt.Sprintf("%s %s", shellescape.Quote(op.Address), shellescape.Quote(op.Destination))
+		case "rm":
+			cmd = fmt.Sprintf("%s state rm", tfBin)
+			addrs = shellescape.Quote(op.Address)
+		case "taint", "untaint":
+			cmd = fmt.Sprintf("%s %s -allow-missing", tfBin, op.Op)
+			addrs = shellescape.Quote(op.Address)
+		case "force-unlock":
+			// force-unlock 不支持 -lock-timeout 等参数，所以不添加步骤参数
+			commands = append(commands, fmt.Sprintf("%s force-unlock -force %s", tfBin, shellescape.Quote(op.Address)))
+			continue
+		case "refresh":
+			cmd = fmt.Sprintf("%s apply -refresh-only -auto-approve -input=false", tfBin)
+			if t.req.Env.TfVarsFile != "" {
+				cmd = fmt.Sprintf("%s -var-file=%s", cmd, shellescape.Quote(t.req.Env.TfVarsFile))
+			}
+			cmd = fmt.Sprintf("%s -var-file=%s", cmd, t.up2Workspace(CloudIacTfvarsJson))
+		default:
+			return "", fmt.Errorf("unknown state operation '%s'", op.Op)
+		}
+		// 选项参数需要在地址参数之前
+		for _, arg := range t.req.StepArgs {
+			cmd = fmt.Sprintf("%s %s", cmd, arg)
+		}
+		if addrs != "" {
+			cmd = fmt.Sprintf("%s %s", cmd, addrs)
+		}
+		commands = append(commands, cmd)
+	}
+
+	beforeCmds, afterCmds := getBeforeAfterCmds(t.req.StepBeforeCmds, t.req.StepAfterCmds)
+	return t.executeTpl(stateCommandTpl, map[string]interface{}{
+		"Req":                t.req,
+		"Commands":           commands,
+		"Before":             beforeCmds,
+		"After":              afterCmds,
+		"ContainerWorkspace": ContainerWorkspace,
+	})
+}
+
 // CLOUDIAC_WORKDIR 环境变量在 task_manager 中会自动设置
 var playCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 export CLOUDIAC_ANSIBLE_INVENTORY={{.AnsibleStateAnalysis}}
@@ -761,8 +942,8 @@ func (t *Task) stepCommand() (command string, err error) {
 // collect command 失败不影响任务状态
 var collectCommandTpl = template.Must(template.New("").Parse(`# state collect command
 cd 'code/{{.Req.Env.Workdir}}' && \
-terraform show -no-color -json >{{.TFStateJsonFilePath}} && \
-terraform providers schema -json > {{.TFProviderSchema}}
+{{.Req.Env.TfBin}} show -no-color -json >{{.TFStateJsonFilePath}} && \
+{{.Req.Env.TfBin}} providers schema -json > {{.TFProviderSchema}}
 `))
 
 func (t *Task) collectCommand() (string, error) {
@@ -1,6 +1,7 @@
 package runner
 
 import (
+	"cloudiac/common"
 	"cloudiac/configs"
 	"cloudiac/utils/logs"
 	"os"
@@ -144,6 +145,21 @@ func TestGenTerraformrcFile(t *testing.T) {
 			t.FailNow()
 		}
 	}
+
+	// opentofu 使用自己的默认 registry
+	task.req.Env.IacEngine = common.IacEngineOpenTofu
+	task.req.NetworkMirror = mirrorUrl
+	configs.Get().Runner.OfflineMode = false
+	if err := task.genTerraformrcFile(dir); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, TerraformrcFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, removeSpace(string(content)), `include=["registry.opentofu.org/*/*"]`)
+	assert.Contains(t, removeSpace(string(content)), `exclude=["registry.opentofu.org/idcos/*"]`)
+	assert.NotContains(t, string(content), "registry.terraform.io")
 }
 
 func removeSpace(s string) string {
@@ -152,3 +168,140 @@ func removeSpace(s string) string {
 	s = strings.ReplaceAll(s, "\n", "")
 	return s
 }
+
+func TestGenIacTfFileBackend(t *testing.T) {
+	configs.Set(&configs.Config{})
+
+	dir, err := os.MkdirTemp("", "cloudiac-runner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	task := Task{
+		req: RunTaskReq{
+			StateStore: StateStore{
+				Backend: "s3",
+				Config: map[string]interface{}{
+					"bucket":           "tf${state}",
+					"key":              "org/project/env/terraform.tfstate",
+					"force_path_style": true,
+					"access_key":       "ak",
+					"secret_key":       "sk",
+				},
+			},
+		},
+		logger: logs.Get(),
+	}
+	if err := task.genIacTfFile(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, CloudIacTfFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(content), `backend "s3" {`)
+	assert.Contains(t, string(content), `bucket = "tf$${state}"`)
+	assert.Contains(t, string(content), `force_path_style = true`)
+	assert.NotContains(t, string(content), "address")
+
+	// 访问凭证通过环境变量传入，不写入 tf 文件
+	assert.NotContains(t, string(content), "access_key")
+	assert.NotContains(t, string(content), "secret_key")
+	cmd := Executor{}
+	assert.NoError(t, task.buildVarsAndCmdEnv(&cmd))
+	assert.Contains(t, cmd.Env, "AWS_ACCESS_KEY_ID=ak")
+	assert.Contains(t, cmd.Env, "AWS_SECRET_ACCESS_KEY=sk")
+}
+
+func TestStepImport(t *testing.T) {
+	task := Task{
+		req: RunTaskReq{
+			Env: TaskEnv{TfVarsFile: "prod.tfvars"},
+			Imports: []TaskImport{
+				{Address: "aws_instance.web", Id: "i-0abc"},
+				{Address: `aws_s3_bucket.b["logs"]`, Id: "my bucket"},
+			},
+		},
+		logger: logs.Get(),
+	}
+
+	command, err := task.stepImport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, command, "terraform import -input=false")
+	assert.Contains(t, command, "-var-file=prod.tfvars")
+	assert.Contains(t, command, "aws_instance.web i-0abc;")
+	assert.Contains(t, command, `'aws_s3_bucket.b["logs"]' 'my bucket';`)
+	assert.Contains(t, command, "terraform state show aws_instance.web")
+	assert.Equal(t, 2, strings.Count(command, "terraform import"))
+
+	task.req.Imports = nil
+	_, err = task.stepImport()
+	assert.Error(t, err)
+}
+
+func TestStepState(t *testing.T) {
+	task := Task{
+		req: RunTaskReq{
+			StepArgs: []string{"-lock-timeout=60s"},
+			StateOps: []TaskStateOp{
+				{Op: "mv", Address: "aws_instance.a", Destination: "module.web.aws_instance.a"},
+				{Op: "rm", Address: `aws_s3_bucket.b["logs"]`},
+				{Op: "taint", Address: "aws_instance.c"},
+			},
+		},
+		logger: logs.Get(),
+	}
+
+	command, err := task.stepState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, command, "terraform state mv -lock-timeout=60s aws_instance.a module.web.aws_instance.a && \\")
+	assert.Contains(t, command, `terraform state rm -lock-timeout=60s 'aws_s3_bucket.b["logs"]' && \`)
+	assert.Contains(t, command, "terraform taint -allow-missing -lock-timeout=60s aws_instance.c && \\")
+
+	task.req.StateOps = []TaskStateOp{{Op: "force-unlock", Address: "6a1b-lock"}, {Op: "refresh"}}
+	command, err = task.stepState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, command, "terraform force-unlock -force 6a1b-lock && \\")
+	assert.Contains(t, command, "terraform apply -refresh-only -auto-approve -input=false -var-file=../_cloudiac.tfvars.json -lock-timeout=60s && \\")
+
+	task.req.StateOps = []TaskStateOp{{Op: "mv", Address: "aws_instance.a"}}
+	_, err = task.stepState()
+	assert.Error(t, err)
+
+	task.req.StateOps = []TaskStateOp{{Op: "push", Address: "aws_instance.a"}}
+	_, err = task.stepState()
+	assert.Error(t, err)
+}
+
+func TestStepInitIacEngine(t *testing.T) {
+	task := Task{
+		req:    RunTaskReq{Env: TaskEnv{Workdir: "src"}},
+		logger: logs.Get(),
+	}
+
+	command, err := task.stepInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, command, "tfenv use $TFENV_TERRAFORM_VERSION")
+	assert.Contains(t, command, "terraform init -input=false")
+	assert.NotContains(t, command, "tofu")
+
+	task.req.Env.IacEngine = common.IacEngineOpenTofu
+	command, err = task.stepInit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, command, "tofuenv use $TOFUENV_TOFU_VERSION")
+	assert.Contains(t, command, "tofu init -input=false")
+	assert.NotContains(t, command, "tfenv")
+	assert.NotContains(t, command, "terraform")
+}
@@ -7,6 +7,8 @@ portal 和 runner 通信使用的消息结构体
 */
 
 import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
 	"fmt"
 
 	"github.com/alessio/shellescape"
@@ -22,12 +24,29 @@ type TaskEnv struct {
 	Playbook     string `json:"playbook"`
 	PlayVarsFile string `json:"playVarsFile"`
 	TfVersion    string `json:"tfVersion"`
+	IacEngine    string `json:"iacEngine"` // IaC 引擎，为空表示 terraform
 
 	EnvironmentVars map[string]string `json:"environment"`
 	TerraformVars   map[string]string `json:"terraform"`
 	AnsibleVars     map[string]string `json:"ansible"`
 }
 
+// TfBin 返回 IaC 引擎的命令名称
+func (e TaskEnv) TfBin() string {
+	if e.IacEngine == common.IacEngineOpenTofu {
+		return "tofu"
+	}
+	return "terraform"
+}
+
+// DefaultTfVersion 返回 IaC 引擎的默认版本
+func (e TaskEnv) DefaultTfVersion() string {
+	if e.IacEngine == common.IacEngineOpenTofu {
+		return consts.DefaultOpenTofuVersion
+	}
+	return consts.DefaultTerraformVersion
+}
+
 type StateStore struct {
 	Backend     string `json:"backend" binding:""`
 	Scheme      string `json:"scheme" binding:""`
@@ -39,6 +58,9 @@ type StateStore struct {
 	CakeyPath   string `json:"cakey_path" binding:""`
 	CapemPath   string `json:"capem_path" binding:""`
 	Address     string `json:"address" binding:""` // consul 地址 runner 会自动设置
+
+	// 非 consul backend 的配置参数，key 为 terraform backend 的参数名
+	Config map[string]interface{} `json:"config" binding:""`
 }
 
 type RunTaskReq struct {
@@ -72,6 +94,9 @@ type RunTaskReq struct {
 	PauseTask   bool   `json:"pauseTask"` // 本次执行结束后暂停任务
 
 	CreatorId string `json:"creatorId"`
+
+	Imports  []TaskImport  `json:"imports"`  // 导入任务需要导入的资源
+	StateOps []TaskStateOp `json:"stateOps"` // state 任务需要执行的操作
 }
 
 func (r RunTaskReq) Validate() error {
@@ -84,6 +109,7 @@ func (r RunTaskReq) Validate() error {
 		{"playbook", r.Env.Playbook},
 		{"tfVarsFile", r.Env.TfVarsFile},
 		{"tfVersion", r.Env.TfVersion},
+		{"iacEngine", r.Env.IacEngine},
 	}
 
 	for _, v := range vs {
@@ -95,6 +121,20 @@ func (r RunTaskReq) Validate() error {
 	return nil
 }
 
+// TaskImport 需要导入的资源，Address 为资源在代码中的地址，Id 为资源在云上的 id
+type TaskImport struct {
+	Address string `json:"address"`
+	Id      string `json:"id"`
+}
+
+// TaskStateOp state 操作，Op 为 mv/rm/taint/untaint/force-unlock/refresh，Destination 只在 mv 操作时使用。
+// force-unlock 操作的 Address 为 state 锁 id，refresh 操作不需要 Address
+type TaskStateOp struct {
+	Op          string `json:"op"`
+	Address     string `json:"address"`
+	Destination string `json:"destination"`
+}
+
 type Repository struct {
 	RepoAddress  string `json:"repoAddress" binding:""` // 带 token 的完整路径
 	RepoRevision string `json:"repoRevision" binding:""`
@@ -159,6 +199,28 @@ type TaskStatusMessage struct {
 	TFProviderSchemaJson []byte `json:"tfProviderSchemaJson"`
 }
 
+const (
+	TaskStepEventLog    = "log"    // 步骤日志内容
+	TaskStepEventStatus = "status" // 步骤状态
+)
+
+// TaskStepEvent runner 通过事件连接主动推送到 portal 的步骤事件
+type TaskStepEvent struct {
+	Type   string `json:"type"`
+	EnvId  string `json:"envId"`
+	TaskId string `json:"taskId"`
+	Step   int    `json:"step"`
+
+	Offset  int64              `json:"offset,omitempty"` // 日志内容在步骤日志文件中的偏移
+	Content []byte             `json:"content,omitempty"`
+	Status  *TaskStatusMessage `json:"status,omitempty"`
+}
+
+// IsExited 是否为步骤退出(包括超时、中止)的状态事件
+func (ev *TaskStepEvent) IsExited() bool {
+	return ev.Status != nil && (ev.Status.Exited || ev.Status.Timeout || ev.Status.Aborted)
+}
+
 type ErrorMessage struct {
 	Error string `json:"error"`
 }
@@ -12,6 +12,7 @@ import (
 
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -42,6 +43,9 @@ func Register(serviceName string, consulConfig configs.ConsulConfig) error {
 	registration.Port = consulConfig.ServicePort  // 服务端口
 	registration.Tags = tags                      // tag，可以为空
 	registration.Address = consulConfig.ServiceIP // 服务 IP
+	if slots := configs.Get().Runner.MaxTasks; serviceName == common.RunnerServiceName && slots > 0 {
+		registration.Meta = map[string]string{common.RunnerMetaSlots: strconv.Itoa(slots)}
+	}
 
 	checkPort := consulConfig.ServicePort
 	registration.Check = &consulapi.AgentServiceCheck{ // 健康检查
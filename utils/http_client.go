@@ -46,6 +46,16 @@ func getHttpRequest(reqUrl, method string, header *http.Header, data interface{}
 		return http.NewRequest(method, reqUrl, nil)
 	}
 
+	// raw data，直接作为请求 body
+	if value, ok := data.([]byte); ok {
+		req, err := http.NewRequest(method, reqUrl, bytes.NewReader(value))
+		if err != nil {
+			return nil, err
+		}
+		req.Header = *header
+		return req, nil
+	}
+
 	// json data
 	if header.Get(HeaderContentType) == "application/json" { //nolint
 		b, err := json.Marshal(data)
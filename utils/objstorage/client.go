@@ -0,0 +1,45 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package objstorage
+
+import (
+	"cloudiac/configs"
+	"context"
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// NewClient 创建 S3 兼容对象存储的客户端(aws s3、minio 等)
+func NewClient(conf configs.ObjectStorageConfig) (*minio.Client, error) {
+	if conf.Endpoint == "" || conf.Bucket == "" {
+		return nil, fmt.Errorf("object storage endpoint and bucket are required")
+	}
+	return minio.New(conf.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(conf.AccessKey, conf.SecretKey, ""),
+		Secure: conf.UseSSL,
+		Region: conf.Region,
+	})
+}
+
+// EnsureBucket 检查 bucket 是否存在，不存在则创建
+func EnsureBucket(ctx context.Context, cli *minio.Client, conf configs.ObjectStorageConfig) error {
+	exists, err := cli.BucketExists(ctx, conf.Bucket)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	return cli.MakeBucket(ctx, conf.Bucket, minio.MakeBucketOptions{Region: conf.Region})
+}
+
+// IsNotFound 判断对象存储返回的错误是否为对象不存在
+func IsNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	resp := minio.ToErrorResponse(err)
+	return resp.Code == "NoSuchKey" || resp.Code == "NoSuchBucket"
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runnerauth
+
+/*
+portal 调用 runner api 的请求签名
+
+portal 使用与 runner 共享的密钥对请求计算 HMAC-SHA256 签名，runner 拒绝未签名或签名错误的请求。
+签名内容为: method + "\n" + path + "\n" + query + "\n" + timestamp + "\n" + nonce + "\n" + sha256(body)，
+timestamp 与当前时间相差超过 MaxClockSkew 的请求会被拒绝，时间窗口内同一个 nonce 只能使用一次，以防止请求被重放。
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderTimestamp = "X-Iac-Timestamp"
+	HeaderSignature = "X-Iac-Signature"
+	HeaderNonce     = "X-Iac-Nonce"
+
+	MaxClockSkew = 5 * time.Minute
+)
+
+// Sign 计算请求签名
+func Sign(secret string, method string, path string, query string, timestamp int64, nonce string, body []byte) string {
+	bodySum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%s\n%s\n%s\n%d\n%s\n%s",
+		method, path, query, timestamp, nonce, hex.EncodeToString(bodySum[:]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func genNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SignHeader 生成带签名的请求头，path 和 query 需要与 runner 收到的请求一致
+func SignHeader(secret string, method string, path string, query string, body []byte) http.Header {
+	ts := time.Now().Unix()
+	nonce := genNonce()
+	header := http.Header{}
+	header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	header.Set(HeaderNonce, nonce)
+	header.Set(HeaderSignature, Sign(secret, method, path, query, ts, nonce, body))
+	return header
+}
+
+// Verify 校验请求签名，body 为请求的完整 body 内容
+func Verify(secret string, r *http.Request, body []byte) error {
+	signature := r.Header.Get(HeaderSignature)
+	if signature == "" {
+		return fmt.Errorf("missing request signature")
+	}
+
+	ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid request timestamp")
+	}
+	skew := time.Since(time.Unix(ts, 0))
+	if skew > MaxClockSkew || skew < -MaxClockSkew {
+		return fmt.Errorf("request timestamp expired")
+	}
+
+	nonce := r.Header.Get(HeaderNonce)
+	if nonce == "" {
+		return fmt.Errorf("missing request nonce")
+	}
+
+	expected := Sign(secret, r.Method, r.URL.Path, r.URL.RawQuery, ts, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("invalid request signature")
+	}
+	// 签名校验通过后才记录 nonce，nonce 在 timestamp 过期后才会被清理
+	if !usedNonces.add(nonce, time.Unix(ts, 0).Add(MaxClockSkew)) {
+		return fmt.Errorf("request nonce already used")
+	}
+	return nil
+}
+
+// nonceCache 记录时间窗口内已使用的 nonce
+type nonceCache struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time // nonce -> 过期时间
+	lastSweep time.Time
+}
+
+var usedNonces = &nonceCache{nonces: make(map[string]time.Time)}
+
+// add 记录 nonce，nonce 已被使用时返回 false
+func (c *nonceCache) add(nonce string, expiredAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) > time.Minute {
+		c.lastSweep = now
+		for k, t := range c.nonces {
+			if now.After(t) {
+				delete(c.nonces, k)
+			}
+		}
+	}
+
+	if _, ok := c.nonces[nonce]; ok {
+		return false
+	}
+	c.nonces[nonce] = expiredAt
+	return true
+}
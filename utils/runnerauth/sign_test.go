@@ -0,0 +1,51 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runnerauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	secret := "test-secret"
+	body := []byte(`{"taskId":"run-xxx"}`)
+	params := url.Values{"taskId": []string{"run-xxx"}, "step": []string{"1"}}
+
+	newReq := func(method string, query string, header http.Header) *http.Request {
+		r := httptest.NewRequest(method, "/api/v1/task/step/log/follow?"+query, nil)
+		for k := range header {
+			r.Header.Set(k, header.Get(k))
+		}
+		return r
+	}
+
+	header := SignHeader(secret, http.MethodGet, "/api/v1/task/step/log/follow", params.Encode(), nil)
+	assert.NoError(t, Verify(secret, newReq(http.MethodGet, params.Encode(), header), nil))
+	// 重放的请求
+	assert.Error(t, Verify(secret, newReq(http.MethodGet, params.Encode(), header), nil))
+	header = SignHeader(secret, http.MethodGet, "/api/v1/task/step/log/follow", params.Encode(), nil)
+
+	// 密钥、query、body 任一不一致都会校验失败
+	assert.Error(t, Verify("other-secret", newReq(http.MethodGet, params.Encode(), header), nil))
+	assert.Error(t, Verify(secret, newReq(http.MethodGet, "taskId=run-yyy&step=1", header), nil))
+	assert.Error(t, Verify(secret, newReq(http.MethodGet, params.Encode(), header), body))
+
+	// 未签名的请求
+	assert.Error(t, Verify(secret, newReq(http.MethodGet, params.Encode(), http.Header{}), nil))
+	assert.NoError(t, Verify(secret, newReq(http.MethodGet, params.Encode(), header), nil))
+
+	// 过期的请求
+	ts := time.Now().Add(-2 * MaxClockSkew).Unix()
+	expired := http.Header{}
+	expired.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	expired.Set(HeaderNonce, "nonce")
+	expired.Set(HeaderSignature, Sign(secret, http.MethodGet, "/api/v1/task/step/log/follow", params.Encode(), ts, "nonce", nil))
+	assert.Error(t, Verify(secret, newReq(http.MethodGet, params.Encode(), expired), nil))
+}
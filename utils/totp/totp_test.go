@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeAt(t *testing.T) {
+	// RFC 6238 附录 B 中 SHA1 的测试数据(取后 6 位)
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for ts, code := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		c, err := CodeAt(secret, Step(time.Unix(ts, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, code, c)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NoError(t, err)
+
+	now := time.Now()
+	code, _ := CodeAt(secret, Step(now)-1)
+	step, ok := Validate(secret, code, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now)-1, step)
+
+	// 已使用的时间步不能重复使用
+	_, ok = Validate(secret, code, now, step)
+	assert.False(t, ok)
+
+	code, _ = CodeAt(secret, Step(now)-2)
+	_, ok = Validate(secret, code, now, 0)
+	assert.False(t, ok)
+
+	_, ok = Validate(secret, "12345", now, 0)
+	assert.False(t, ok)
+}
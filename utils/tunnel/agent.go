@@ -0,0 +1,166 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package tunnel
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"cloudiac/utils"
+)
+
+// Agent runner 端的隧道连接，将 portal 发送的请求转发到本地 runner api
+type Agent struct {
+	conn   *websocket.Conn
+	target string // 本地 runner api 地址，如 http://127.0.0.1:19030
+	client *http.Client
+
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	streams map[uint64]*websocket.Conn
+}
+
+func NewAgent(conn *websocket.Conn, target string) *Agent {
+	return &Agent{
+		conn:    conn,
+		target:  target,
+		client:  &http.Client{Timeout: 10 * time.Minute},
+		streams: make(map[uint64]*websocket.Conn),
+	}
+}
+
+// Serve 处理 portal 发送的消息，直到连接断开
+func (a *Agent) Serve() error {
+	defer a.closeStreams()
+
+	for {
+		msg := Message{}
+		if err := a.conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+
+		switch msg.Type {
+		case MsgRequest:
+			go a.handleRequest(msg)
+		case MsgStreamOpen:
+			go a.handleStream(msg)
+		case MsgStreamClose:
+			a.mu.Lock()
+			local := a.streams[msg.Id]
+			delete(a.streams, msg.Id)
+			a.mu.Unlock()
+			if local != nil {
+				_ = utils.WebsocketClose(local)
+			}
+		}
+	}
+}
+
+func (a *Agent) write(msg *Message) error {
+	a.wmu.Lock()
+	defer a.wmu.Unlock()
+	return a.conn.WriteJSON(msg)
+}
+
+func (a *Agent) localURL(msg Message) string {
+	u := utils.JoinURL(a.target, msg.Path)
+	if msg.Query != "" {
+		u += "?" + msg.Query
+	}
+	return u
+}
+
+func (a *Agent) handleRequest(msg Message) {
+	resp := &Message{Type: MsgResponse, Id: msg.Id}
+	defer func() {
+		_ = a.write(resp)
+	}()
+
+	req, err := http.NewRequest(msg.Method, a.localURL(msg), bytes.NewReader(msg.Body))
+	if err != nil {
+		resp.Status, resp.Error = http.StatusBadRequest, err.Error()
+		return
+	}
+	req.Header = msg.Header
+	r, err := a.client.Do(req)
+	if err != nil {
+		resp.Status, resp.Error = http.StatusBadGateway, err.Error()
+		return
+	}
+	defer r.Body.Close()
+
+	resp.Status = r.StatusCode
+	resp.Header = http.Header{"Content-Type": r.Header.Values("Content-Type")}
+	if resp.Body, err = ioutil.ReadAll(r.Body); err != nil {
+		resp.Status, resp.Error = http.StatusBadGateway, err.Error()
+	}
+}
+
+func (a *Agent) handleStream(msg Message) {
+	u, err := url.Parse(a.target)
+	if err != nil {
+		_ = a.write(&Message{Type: MsgResponse, Id: msg.Id, Status: http.StatusBadGateway, Error: err.Error()})
+		return
+	}
+	params, _ := url.ParseQuery(msg.Query)
+	local, r, err := utils.WebsocketDailWithHeader(u.String(), msg.Path, params, msg.Header)
+	if err != nil {
+		resp := &Message{Type: MsgResponse, Id: msg.Id, Status: http.StatusBadGateway, Error: err.Error()}
+		if r != nil {
+			resp.Status = r.StatusCode
+			resp.Body, _ = ioutil.ReadAll(r.Body)
+			r.Body.Close()
+		}
+		_ = a.write(resp)
+		return
+	}
+
+	a.mu.Lock()
+	a.streams[msg.Id] = local
+	a.mu.Unlock()
+	if err := a.write(&Message{Type: MsgResponse, Id: msg.Id, Status: StatusStreamOpened}); err != nil {
+		_ = local.Close()
+		return
+	}
+
+	closeMsg := &Message{Type: MsgStreamClose, Id: msg.Id, Status: websocket.CloseNormalClosure}
+	for {
+		_, data, err := local.ReadMessage()
+		if err != nil {
+			if ce, ok := err.(*websocket.CloseError); ok {
+				closeMsg.Status, closeMsg.Error = ce.Code, ce.Text
+			} else {
+				closeMsg.Status, closeMsg.Error = websocket.CloseAbnormalClosure, err.Error()
+			}
+			break
+		}
+		if err := a.write(&Message{Type: MsgStreamData, Id: msg.Id, Body: data}); err != nil {
+			break
+		}
+	}
+
+	a.mu.Lock()
+	_, ok := a.streams[msg.Id]
+	delete(a.streams, msg.Id)
+	a.mu.Unlock()
+	_ = local.Close()
+	// portal 主动关闭的数据流不需要再通知
+	if ok {
+		_ = a.write(closeMsg)
+	}
+}
+
+func (a *Agent) closeStreams() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, c := range a.streams {
+		_ = c.Close()
+		delete(a.streams, id)
+	}
+}
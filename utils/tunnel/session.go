@@ -0,0 +1,196 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrSessionClosed = fmt.Errorf("tunnel session closed")
+
+// Session portal 端持有的 agent 连接
+type Session struct {
+	conn *websocket.Conn
+	wmu  sync.Mutex
+
+	mu      sync.Mutex
+	nextId  uint64
+	pending map[uint64]chan *Message // 等待响应的请求
+	streams map[uint64]*Stream       // 已建立的数据流
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewSession(conn *websocket.Conn) *Session {
+	return &Session{
+		conn:    conn,
+		pending: make(map[uint64]chan *Message),
+		streams: make(map[uint64]*Stream),
+		done:    make(chan struct{}),
+	}
+}
+
+// Serve 读取 agent 发送的消息，直到连接断开
+func (s *Session) Serve() error {
+	defer s.Close()
+
+	for {
+		msg := Message{}
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		var (
+			ch     chan *Message
+			stream *Stream
+		)
+		switch msg.Type {
+		case MsgResponse:
+			ch = s.pending[msg.Id]
+			delete(s.pending, msg.Id)
+		case MsgStreamData, MsgStreamClose:
+			stream = s.streams[msg.Id]
+			if msg.Type == MsgStreamClose {
+				delete(s.streams, msg.Id)
+			}
+		}
+		s.mu.Unlock()
+
+		if ch != nil {
+			// 响应 channel 带缓冲，不会阻塞
+			ch <- &msg
+		} else if stream != nil {
+			// 数据流的消费端退出时会关闭数据流，避免因消费端已退出而阻塞其他请求和数据流
+			select {
+			case stream.ch <- &msg:
+			case <-stream.closed:
+			case <-s.done:
+				return ErrSessionClosed
+			}
+		}
+	}
+}
+
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Session) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		_ = s.conn.Close()
+	})
+}
+
+func (s *Session) write(msg *Message) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return s.conn.WriteJSON(msg)
+}
+
+func (s *Session) call(ctx context.Context, msg *Message, stream *Stream) (*Message, error) {
+	ch := make(chan *Message, 1)
+	s.mu.Lock()
+	s.nextId++
+	msg.Id = s.nextId
+	s.pending[msg.Id] = ch
+	if stream != nil {
+		s.streams[msg.Id] = stream
+	}
+	s.mu.Unlock()
+
+	cleanup := func() {
+		s.mu.Lock()
+		delete(s.pending, msg.Id)
+		delete(s.streams, msg.Id)
+		s.mu.Unlock()
+	}
+
+	if err := s.write(msg); err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-s.done:
+		cleanup()
+		return nil, ErrSessionClosed
+	case <-ctx.Done():
+		cleanup()
+		return nil, ctx.Err()
+	}
+}
+
+// Do 通过隧道发送 http 请求并等待响应
+func (s *Session) Do(ctx context.Context, req *Message) (*Message, error) {
+	req.Type = MsgRequest
+	return s.call(ctx, req, nil)
+}
+
+// OpenStream 建立数据流，resp.Status 不为 http.StatusSwitchingProtocols 时表示建立失败，此时 stream 为 nil
+func (s *Session) OpenStream(ctx context.Context, req *Message) (stream *Stream, resp *Message, err error) {
+	req.Type = MsgStreamOpen
+	stream = &Stream{s: s, ch: make(chan *Message, 16), closed: make(chan struct{})}
+	resp, err = s.call(ctx, req, stream)
+	if err != nil {
+		stream.markClosed()
+		return nil, nil, err
+	}
+	if resp.Status != StatusStreamOpened {
+		s.mu.Lock()
+		delete(s.streams, req.Id)
+		s.mu.Unlock()
+		stream.markClosed()
+		return nil, resp, nil
+	}
+	stream.id = req.Id
+	return stream, resp, nil
+}
+
+// Stream portal 端的数据流
+type Stream struct {
+	id uint64
+	s  *Session
+	ch chan *Message
+
+	closed    chan struct{} // 消费端关闭数据流后不再投递消息
+	closeOnce sync.Once
+}
+
+func (st *Stream) markClosed() {
+	st.closeOnce.Do(func() {
+		close(st.closed)
+	})
+}
+
+// Recv 读取数据流消息，返回 streamClose 消息时表示数据流已被 agent 关闭
+func (st *Stream) Recv(ctx context.Context) (*Message, error) {
+	select {
+	case msg := <-st.ch:
+		return msg, nil
+	case <-st.s.done:
+		return nil, ErrSessionClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close 关闭数据流，通知 agent 断开本地连接
+func (st *Stream) Close() {
+	st.markClosed()
+	st.s.mu.Lock()
+	_, ok := st.s.streams[st.id]
+	delete(st.s.streams, st.id)
+	st.s.mu.Unlock()
+	if ok {
+		_ = st.s.write(&Message{Type: MsgStreamClose, Id: st.id, Status: websocket.CloseNormalClosure})
+	}
+}
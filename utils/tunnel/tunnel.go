@@ -0,0 +1,49 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package tunnel
+
+/*
+runner agent 模式使用的隧道协议
+
+agent 模式的 runner 主动与 portal 建立一条 websocket 长连接，portal 通过该连接向 runner 发送 api 请求，
+runner 将请求转发到本地的 runner api 并通过同一连接返回结果。
+普通 http 请求使用 request/response 消息，
+websocket 接口(任务状态、日志)使用 streamOpen 建立数据流，之后 runner 通过 streamData 推送数据，任意一端通过 streamClose 关闭。
+*/
+
+import (
+	"net/http"
+)
+
+const (
+	MsgRequest     = "request"     // portal -> agent，http 请求
+	MsgResponse    = "response"    // agent -> portal，http 请求或建立数据流的结果
+	MsgStreamOpen  = "streamOpen"  // portal -> agent，建立数据流(对应 runner 的 websocket 接口)
+	MsgStreamData  = "streamData"  // agent -> portal，数据流消息
+	MsgStreamClose = "streamClose" // 关闭数据流，双向
+)
+
+// StatusStreamOpened 数据流建立成功时 response 消息的状态码
+const StatusStreamOpened = http.StatusSwitchingProtocols
+
+const (
+	HeaderRunnerId      = "X-Iac-Runner-Id"
+	HeaderRunnerSecret  = "X-Iac-Runner-Secret"
+	HeaderRunnerSlots   = "X-Iac-Runner-Slots"
+	HeaderRunnerVersion = "X-Iac-Runner-Version"
+)
+
+// Message 隧道中传输的消息，Id 用于关联请求与响应及数据流
+type Message struct {
+	Type string `json:"type"`
+	Id   uint64 `json:"id"`
+
+	Method string      `json:"method,omitempty"`
+	Path   string      `json:"path,omitempty"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+
+	Status int    `json:"status,omitempty"` // http 状态码，streamClose 消息中为 websocket close code
+	Error  string `json:"error,omitempty"`
+}
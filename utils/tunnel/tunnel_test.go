@@ -0,0 +1,152 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package tunnel
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSession(t *testing.T) *Session {
+	upgrader := websocket.Upgrader{}
+	runner := http.NewServeMux()
+	runner.HandleFunc("/api/v1/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.RawQuery + " " + r.Header.Get("X-Test") + " " + string(body)))
+	})
+	runner.HandleFunc("/api/v1/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, m := range []string{"line1", "line2"} {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(m))
+		}
+		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(4000, "done"))
+	})
+	runner.HandleFunc("/api/v1/flood", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for i := 0; i < 100; i++ {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte("data")); err != nil {
+				return
+			}
+		}
+	})
+	runnerSrv := httptest.NewServer(runner)
+	t.Cleanup(runnerSrv.Close)
+
+	sessCh := make(chan *Session, 1)
+	portalSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		sess := NewSession(conn)
+		sessCh <- sess
+		_ = sess.Serve()
+	}))
+	t.Cleanup(portalSrv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(portalSrv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = NewAgent(conn, runnerSrv.URL).Serve() }()
+
+	select {
+	case sess := <-sessCh:
+		t.Cleanup(sess.Close)
+		return sess
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait session timeout")
+	}
+	return nil
+}
+
+func TestSessionDo(t *testing.T) {
+	sess := newTestSession(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := sess.Do(ctx, &Message{
+		Method: http.MethodPost,
+		Path:   "/api/v1/echo",
+		Query:  "a=1",
+		Header: http.Header{"X-Test": []string{"x"}},
+		Body:   []byte("hello"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.Status)
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "POST a=1 x hello", string(resp.Body))
+
+	resp, err = sess.Do(ctx, &Message{Method: http.MethodGet, Path: "/api/v1/notfound"})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.Status)
+}
+
+func TestSessionOpenStream(t *testing.T) {
+	sess := newTestSession(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, resp, err := sess.OpenStream(ctx, &Message{Method: http.MethodGet, Path: "/api/v1/ws"})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusStreamOpened, resp.Status)
+	if stream == nil {
+		t.FailNow()
+	}
+
+	for _, want := range []string{"line1", "line2"} {
+		msg, err := stream.Recv(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, MsgStreamData, msg.Type)
+		assert.Equal(t, want, string(msg.Body))
+	}
+	msg, err := stream.Recv(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, MsgStreamClose, msg.Type)
+	assert.Equal(t, 4000, msg.Status)
+	assert.Equal(t, "done", msg.Error)
+
+	// 非 websocket 接口建立数据流失败时返回 runner 的响应
+	stream, resp, err = sess.OpenStream(ctx, &Message{Method: http.MethodGet, Path: "/api/v1/notfound"})
+	assert.NoError(t, err)
+	assert.Nil(t, stream)
+	assert.Equal(t, http.StatusNotFound, resp.Status)
+}
+
+func TestSessionStreamConsumerGone(t *testing.T) {
+	sess := newTestSession(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, resp, err := sess.OpenStream(ctx, &Message{Method: http.MethodGet, Path: "/api/v1/flood"})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusStreamOpened, resp.Status)
+	if stream == nil {
+		t.FailNow()
+	}
+
+	// 消费端不再读取数据流，关闭后不影响其他请求
+	time.Sleep(200 * time.Millisecond)
+	stream.Close()
+	resp, err = sess.Do(ctx, &Message{Method: http.MethodGet, Path: "/api/v1/echo"})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.Status)
+}
@@ -12,6 +12,10 @@ import (
 )
 
 func WebsocketDail(server string, urlPath string, params url.Values) (*websocket.Conn, *http.Response, error) {
+	return WebsocketDailWithHeader(server, urlPath, params, nil)
+}
+
+func WebsocketDailWithHeader(server string, urlPath string, params url.Values, header http.Header) (*websocket.Conn, *http.Response, error) {
 	u, err := url.Parse(server)
 	if err != nil {
 		return nil, nil, err
@@ -25,7 +29,7 @@ func WebsocketDail(server string, urlPath string, params url.Values) (*websocket
 	}
 	u.RawQuery = params.Encode()
 
-	c, resp, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c, resp, err := websocket.DefaultDialer.Dial(u.String(), header)
 	return c, resp, err
 }
 